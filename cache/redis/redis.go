@@ -21,11 +21,16 @@ type RedisAdapter struct {
 type ClientI interface {
 	Get(ctx context.Context, key string) *redis.StringCmd
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd
+	SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd
 	Exists(ctx context.Context, keys ...string) *redis.IntCmd
 	Del(ctx context.Context, keys ...string) *redis.IntCmd
 	Keys(ctx context.Context, pattern string) *redis.StringSliceCmd
+	Scan(ctx context.Context, cursor uint64, match string, count int64) *redis.ScanCmd
 }
 
+// scanCount is the number of keys SCAN looks at per call.
+const scanCount = 1000
+
 var (
 	ErrMissingParam = errors.New("parameter is missing")
 	ErrConnectTest  = errors.New("test connection failed")
@@ -79,6 +84,55 @@ func (adapter *RedisAdapter) Set(ctx context.Context, key string, value interfac
 	return nil
 }
 
+// SetNX sets the value only when the key doesn't exist, reporting whether it was set.
+func (adapter *RedisAdapter) SetNX(ctx context.Context, key string, value interface{}, duration time.Duration) (bool, error) {
+	if key == "" {
+		return false, ErrEmptyKey
+	}
+
+	set, err := adapter.client.SetNX(ctx, key, value, duration).Result()
+	if err != nil {
+		return false, errors.Wrap(err, "setnx redis value")
+	}
+
+	return set, nil
+}
+
+// Scan returns the keys matching pattern, e.g.: prefix:*. It iterates with SCAN, so redis isn't
+// blocked while it goes through every key, keys added or deleted meanwhile may be missed.
+func (adapter *RedisAdapter) Scan(ctx context.Context, pattern string) ([]string, error) {
+	if pattern == "" {
+		return nil, ErrEmptyKey
+	}
+
+	var (
+		keys   []string
+		seen   = make(map[string]bool)
+		cursor uint64
+	)
+
+	for {
+		page, next, err := adapter.client.Scan(ctx, cursor, pattern, scanCount).Result()
+		if err != nil {
+			return nil, errors.Wrap(err, "scan redis keys")
+		}
+
+		// a key can be returned more than once
+		for _, key := range page {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+
+		if next == 0 {
+			return keys, nil
+		}
+
+		cursor = next
+	}
+}
+
 func (adapter *RedisAdapter) Get(ctx context.Context, key string) ([]byte, error) {
 	var result []byte
 
@@ -200,6 +200,139 @@ func TestRedisAdapter_Set(t *testing.T) {
 	}
 }
 
+func TestRedisAdapter_SetNX(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		client  func() ClientI
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:    "error: empty key",
+			client:  func() ClientI { return nil },
+			wantErr: true,
+		},
+		{
+			name: "error: setnx value",
+			key:  "key",
+			client: func() ClientI {
+				cmd := redis.NewBoolCmd(context.Background())
+				cmd.SetErr(errors.New("unknown"))
+
+				client := mocks.NewMockClientI(gomock.NewController(t))
+				client.EXPECT().SetNX(nil, "key", "val", time.Minute).Return(cmd)
+
+				return client
+			},
+			wantErr: true,
+		},
+		{
+			name: "success: key exists",
+			key:  "key",
+			client: func() ClientI {
+				cmd := redis.NewBoolCmd(context.Background())
+				cmd.SetVal(false)
+
+				client := mocks.NewMockClientI(gomock.NewController(t))
+				client.EXPECT().SetNX(nil, "key", "val", time.Minute).Return(cmd)
+
+				return client
+			},
+		},
+		{
+			name: "success: key set",
+			key:  "key",
+			client: func() ClientI {
+				cmd := redis.NewBoolCmd(context.Background())
+				cmd.SetVal(true)
+
+				client := mocks.NewMockClientI(gomock.NewController(t))
+				client.EXPECT().SetNX(nil, "key", "val", time.Minute).Return(cmd)
+
+				return client
+			},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &RedisAdapter{client: tt.client()}
+
+			got, err := adapter.SetNX(nil, tt.key, "val", time.Minute)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RedisAdapter.SetNX() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("RedisAdapter.SetNX() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedisAdapter_Scan(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		client  func() ClientI
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "error: empty pattern",
+			client:  func() ClientI { return nil },
+			wantErr: true,
+		},
+		{
+			name:    "error: scan keys",
+			pattern: "prefix:*",
+			client: func() ClientI {
+				cmd := redis.NewScanCmd(context.Background(), nil)
+				cmd.SetErr(errors.New("unknown"))
+
+				client := mocks.NewMockClientI(gomock.NewController(t))
+				client.EXPECT().Scan(nil, uint64(0), "prefix:*", int64(scanCount)).Return(cmd)
+
+				return client
+			},
+			wantErr: true,
+		},
+		{
+			name:    "success: every page, each key once",
+			pattern: "prefix:*",
+			client: func() ClientI {
+				first := redis.NewScanCmd(context.Background(), nil)
+				first.SetVal([]string{"prefix:1", "prefix:2"}, 42)
+
+				last := redis.NewScanCmd(context.Background(), nil)
+				last.SetVal([]string{"prefix:2", "prefix:3"}, 0)
+
+				client := mocks.NewMockClientI(gomock.NewController(t))
+				gomock.InOrder(
+					client.EXPECT().Scan(nil, uint64(0), "prefix:*", int64(scanCount)).Return(first),
+					client.EXPECT().Scan(nil, uint64(42), "prefix:*", int64(scanCount)).Return(last),
+				)
+
+				return client
+			},
+			want: []string{"prefix:1", "prefix:2", "prefix:3"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			adapter := &RedisAdapter{client: tt.client()}
+
+			got, err := adapter.Scan(nil, tt.pattern)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RedisAdapter.Scan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("RedisAdapter.Scan() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestRedisAdapter_get(t *testing.T) {
 	var bytesOut []byte
 
@@ -0,0 +1,391 @@
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/braiphub/go-core/log"
+	"github.com/pkg/errors"
+)
+
+// OverflowPolicy decides what publishing does when the queue of a bounded subscription is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the publisher until a worker takes an event from the queue. Publishing
+	// holds the bus lock, so the handlers of a full queue can't publish to the bus meanwhile.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest queued event to make room for the new one.
+	OverflowDropOldest
+	// OverflowError rejects the new event, reporting ErrQueueFull to the logger and error handler.
+	OverflowError
+)
+
+const (
+	defaultAsyncWorkers   = 1
+	defaultAsyncQueueSize = 100
+)
+
+var (
+	ErrQueueFull    = errors.New("async subscription queue full")
+	ErrEventDropped = errors.New("async subscription dropped its oldest event")
+	ErrPoolClosed   = errors.New("async subscription closed")
+)
+
+// AsyncConfig bounds an async subscription: Workers handle the events taken from a queue holding up
+// to QueueSize events, Overflow applies when it's full.
+type AsyncConfig struct {
+	Workers   int
+	QueueSize int
+	Overflow  OverflowPolicy
+}
+
+// QueueStats is a snapshot of a bounded subscription queue, meant for metrics.
+type QueueStats struct {
+	Topic    string
+	Queued   int
+	InFlight int
+	Capacity int
+	Dropped  uint64
+	Rejected uint64
+}
+
+type asyncPool struct {
+	topic    string
+	config   AsyncConfig
+	handler  func(args ...any)
+	logger   log.LoggerI
+	errorFn  ErrorHandler
+	mu       sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+	idle     *sync.Cond
+	queue    [][]any
+	inFlight int
+	dropped  uint64
+	rejected uint64
+	// closed rejects new events, stopped makes the workers leave the queued ones
+	closed  bool
+	stopped bool
+	workers sync.WaitGroup
+}
+
+func SubscribeAsyncBounded(topic string, eventHandler any, config AsyncConfig) {
+	defaultInstance.SubscribeAsyncBounded(topic, eventHandler, config)
+}
+
+func Drain(ctx context.Context) error {
+	return defaultInstance.Drain(ctx)
+}
+
+func Close(ctx context.Context) error {
+	return defaultInstance.Close(ctx)
+}
+
+// SubscribeAsyncBounded subscribes eventHandler to topic, handled asynchronously by a fixed number of
+// workers instead of a goroutine per publish. Events wait in a bounded queue, see AsyncConfig.
+func (b *Bus) SubscribeAsyncBounded(topic string, eventHandler any, config AsyncConfig) {
+	handlerKind := reflect.TypeOf(eventHandler).Kind()
+
+	if handlerKind != reflect.Func {
+		if b.config.PanicOnSubscribeFailed {
+			panic(fmt.Errorf("%s is not of type reflect.Func", handlerKind))
+		}
+
+		if b.logger != nil {
+			b.logger.Error("topic async-subscribe", fmt.Errorf("%s is not of type reflect.Func", handlerKind))
+		}
+
+		return
+	}
+
+	if config.Workers <= 0 {
+		config.Workers = defaultAsyncWorkers
+	}
+
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaultAsyncQueueSize
+	}
+
+	pool := newAsyncPool(topic, config, b.decorate(eventHandler), b.logger, b.errorHandler)
+
+	if err := b.Bus.Subscribe(topic, pool.enqueue); err != nil {
+		if b.config.PanicOnSubscribeFailed {
+			panic(err)
+		}
+
+		if b.logger != nil {
+			b.logger.Error("topic async-subscribe", err, log.Any("topic", topic))
+		}
+
+		return
+	}
+
+	pool.start()
+
+	b.poolsMu.Lock()
+	b.pools = append(b.pools, pool)
+	b.poolsMu.Unlock()
+}
+
+// Drain waits until the queues of the bounded subscriptions are empty and their workers idle, or
+// until ctx is done. Stop publishing before draining, the queues keep taking events.
+func (b *Bus) Drain(ctx context.Context) error {
+	b.poolsMu.Lock()
+	pools := append([]*asyncPool(nil), b.pools...)
+	b.poolsMu.Unlock()
+
+	for _, pool := range pools {
+		if err := pool.drain(ctx); err != nil {
+			return errors.Wrap(err, pool.topic)
+		}
+	}
+
+	return nil
+}
+
+// Close stops the bounded subscriptions: new events are rejected with ErrPoolClosed and the workers
+// exit once the queued events are handled. When ctx is done first, the events still queued are
+// dropped and the workers exit after their current event.
+func (b *Bus) Close(ctx context.Context) error {
+	b.poolsMu.Lock()
+	pools := append([]*asyncPool(nil), b.pools...)
+	b.poolsMu.Unlock()
+
+	for _, pool := range pools {
+		if err := pool.close(ctx); err != nil {
+			return errors.Wrap(err, pool.topic)
+		}
+	}
+
+	return nil
+}
+
+// QueueStats returns the stats of the bounded subscriptions, in subscription order.
+func (b *Bus) QueueStats() []QueueStats {
+	b.poolsMu.Lock()
+	defer b.poolsMu.Unlock()
+
+	stats := make([]QueueStats, 0, len(b.pools))
+	for _, pool := range b.pools {
+		stats = append(stats, pool.stats())
+	}
+
+	return stats
+}
+
+func newAsyncPool(
+	topic string,
+	config AsyncConfig,
+	handler func(args ...any),
+	logger log.LoggerI,
+	errorFn ErrorHandler,
+) *asyncPool {
+	pool := &asyncPool{
+		topic:   topic,
+		config:  config,
+		handler: handler,
+		logger:  logger,
+		errorFn: errorFn,
+		queue:   make([][]any, 0, config.QueueSize),
+	}
+
+	pool.notEmpty = sync.NewCond(&pool.mu)
+	pool.notFull = sync.NewCond(&pool.mu)
+	pool.idle = sync.NewCond(&pool.mu)
+
+	return pool
+}
+
+func (p *asyncPool) start() {
+	p.workers.Add(p.config.Workers)
+
+	for range p.config.Workers {
+		go p.work()
+	}
+}
+
+func (p *asyncPool) work() {
+	defer p.workers.Done()
+
+	for {
+		p.mu.Lock()
+
+		for len(p.queue) == 0 && !p.closed {
+			p.notEmpty.Wait()
+		}
+
+		if len(p.queue) == 0 || p.stopped {
+			p.mu.Unlock()
+
+			return
+		}
+
+		args := p.queue[0]
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		p.inFlight++
+
+		p.notFull.Signal()
+		p.mu.Unlock()
+
+		p.handle(args)
+
+		p.mu.Lock()
+		p.inFlight--
+
+		if len(p.queue) == 0 && p.inFlight == 0 {
+			p.idle.Broadcast()
+		}
+
+		p.mu.Unlock()
+	}
+}
+
+// handle runs the handler, reporting a panic instead of killing the worker.
+func (p *asyncPool) handle(args []any) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err := errors.Errorf("event handler panic: %v", recovered)
+
+			if p.logger != nil {
+				p.logger.Error("topic async-handle", err, log.Any("topic", p.topic))
+			}
+
+			if p.errorFn != nil {
+				p.errorFn(errors.Wrap(err, p.topic))
+			}
+		}
+	}()
+
+	p.handler(args...)
+}
+
+// enqueue is subscribed to the topic, it runs on Publish.
+func (p *asyncPool) enqueue(args ...any) {
+	p.mu.Lock()
+
+	for len(p.queue) >= p.config.QueueSize && !p.closed {
+		switch p.config.Overflow {
+		case OverflowDropOldest:
+			p.queue[0] = nil
+			p.queue = p.queue[1:]
+			p.dropped++
+			p.mu.Unlock()
+
+			p.report(ErrEventDropped)
+
+			p.mu.Lock()
+
+		case OverflowError:
+			p.rejected++
+			p.mu.Unlock()
+
+			p.report(ErrQueueFull)
+
+			return
+
+		default:
+			p.notFull.Wait()
+		}
+	}
+
+	if p.closed {
+		p.rejected++
+		p.mu.Unlock()
+
+		p.report(ErrPoolClosed)
+
+		return
+	}
+
+	p.queue = append(p.queue, args)
+	p.notEmpty.Signal()
+	p.mu.Unlock()
+}
+
+func (p *asyncPool) report(err error) {
+	err = errors.Wrap(err, p.topic)
+
+	if p.logger != nil {
+		p.logger.Error("topic async-publish", err, log.Any("topic", p.topic))
+	}
+
+	if p.errorFn != nil {
+		p.errorFn(err)
+	}
+}
+
+func (p *asyncPool) drain(ctx context.Context) error {
+	// wake the wait below when ctx is done
+	stop := context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		p.idle.Broadcast()
+		p.mu.Unlock()
+	})
+	defer stop()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.queue) > 0 || p.inFlight > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		p.idle.Wait()
+	}
+
+	return nil
+}
+
+func (p *asyncPool) close(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	// wake the idle workers to exit and the blocked publishers to reject their event
+	p.notEmpty.Broadcast()
+	p.notFull.Broadcast()
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		p.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+
+	case <-ctx.Done():
+		p.mu.Lock()
+		p.stopped = true
+		p.dropped += uint64(len(p.queue))
+		p.queue = nil
+
+		if p.inFlight == 0 {
+			p.idle.Broadcast()
+		}
+
+		p.mu.Unlock()
+
+		return ctx.Err()
+	}
+}
+
+func (p *asyncPool) stats() QueueStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return QueueStats{
+		Topic:    p.topic,
+		Queued:   len(p.queue),
+		InFlight: p.inFlight,
+		Capacity: p.config.QueueSize,
+		Dropped:  p.dropped,
+		Rejected: p.rejected,
+	}
+}
@@ -0,0 +1,265 @@
+package eventbus
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBus_SubscribeAsyncBounded(t *testing.T) {
+	tests := []struct {
+		name      string
+		overflow  OverflowPolicy
+		wantCalls []int
+		wantStats QueueStats
+		wantErr   error
+	}{
+		{
+			name:      "drop oldest",
+			overflow:  OverflowDropOldest,
+			wantCalls: []int{0, 3, 4},
+			wantStats: QueueStats{Topic: "topic", Capacity: 2, Dropped: 2},
+			wantErr:   ErrEventDropped,
+		},
+		{
+			name:      "error",
+			overflow:  OverflowError,
+			wantCalls: []int{0, 1, 2},
+			wantStats: QueueStats{Topic: "topic", Capacity: 2, Rejected: 2},
+			wantErr:   ErrQueueFull,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu    sync.Mutex
+				calls []int
+				errs  []error
+			)
+
+			bus := New(Config{}, WithErrorHandler(func(err error) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				errs = append(errs, err)
+			}))
+
+			started, release := make(chan struct{}), make(chan struct{})
+
+			bus.SubscribeAsyncBounded("topic", func(i int) {
+				if i == 0 {
+					close(started)
+					<-release
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				calls = append(calls, i)
+			}, AsyncConfig{Workers: 1, QueueSize: 2, Overflow: tt.overflow})
+
+			// the worker holds 0, 1 and 2 fill the queue
+			bus.Publish("topic", 0)
+			<-started
+
+			for i := 1; i <= 4; i++ {
+				bus.Publish("topic", i)
+			}
+
+			stats := bus.QueueStats()
+			require.Len(t, stats, 1)
+			assert.Equal(t, 2, stats[0].Queued)
+			assert.Equal(t, 1, stats[0].InFlight)
+
+			close(release)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			require.NoError(t, bus.Drain(ctx))
+			assert.Equal(t, []QueueStats{tt.wantStats}, bus.QueueStats())
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			assert.Equal(t, tt.wantCalls, calls)
+			require.Len(t, errs, 2)
+			assert.ErrorIs(t, errs[0], tt.wantErr)
+		})
+	}
+}
+
+func TestBus_SubscribeAsyncBounded_Block(t *testing.T) {
+	bus := New(Config{})
+
+	var (
+		mu    sync.Mutex
+		calls int
+	)
+
+	bus.SubscribeAsyncBounded("topic", func() {
+		time.Sleep(time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls++
+	}, AsyncConfig{Workers: 2, QueueSize: 1})
+
+	// publishing waits for room in the queue instead of dropping
+	for range 10 {
+		bus.Publish("topic")
+	}
+
+	require.NoError(t, bus.Drain(context.Background()))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, 10, calls)
+}
+
+func TestBus_Drain_ContextDone(t *testing.T) {
+	bus := New(Config{})
+	release := make(chan struct{})
+
+	bus.SubscribeAsyncBounded("topic", func() { <-release }, AsyncConfig{})
+	bus.Publish("topic")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, bus.Drain(ctx), context.DeadlineExceeded)
+
+	close(release)
+	assert.NoError(t, bus.Drain(context.Background()))
+}
+
+func TestBus_SubscribeAsyncBounded_Panic(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []int
+		errs  []error
+	)
+
+	bus := New(Config{}, WithErrorHandler(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		errs = append(errs, err)
+	}))
+
+	bus.SubscribeAsyncBounded("topic", func(i int) {
+		if i == 0 {
+			panic("boom")
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls = append(calls, i)
+	}, AsyncConfig{Workers: 1})
+
+	bus.Publish("topic", 0)
+	bus.Publish("topic", 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// the panic neither kills the worker nor leaves the event in flight
+	require.NoError(t, bus.Drain(ctx))
+	assert.Equal(t, 0, bus.QueueStats()[0].InFlight)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, []int{1}, calls)
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "event handler panic: boom")
+}
+
+func TestBus_Close(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		calls []int
+		errs  []error
+	)
+
+	bus := New(Config{}, WithErrorHandler(func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		errs = append(errs, err)
+	}))
+
+	started, release := make(chan struct{}), make(chan struct{})
+
+	bus.SubscribeAsyncBounded("topic", func(i int) {
+		if i == 0 {
+			close(started)
+			<-release
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls = append(calls, i)
+	}, AsyncConfig{Workers: 1})
+
+	bus.Publish("topic", 0)
+	<-started
+	bus.Publish("topic", 1)
+
+	closed := make(chan error, 1)
+
+	go func() { closed <- bus.Close(context.Background()) }()
+
+	// the queued event is still handled once the worker is free
+	close(release)
+	require.NoError(t, <-closed)
+
+	bus.Publish("topic", 2)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, []int{0, 1}, calls)
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], ErrPoolClosed)
+	assert.Equal(t, []QueueStats{{Topic: "topic", Capacity: defaultAsyncQueueSize, Rejected: 1}}, bus.QueueStats())
+}
+
+func TestBus_Close_ContextDone(t *testing.T) {
+	bus := New(Config{})
+	started, release := make(chan struct{}), make(chan struct{})
+
+	var calls atomic.Int32
+
+	bus.SubscribeAsyncBounded("topic", func() {
+		if calls.Add(1) == 1 {
+			close(started)
+			<-release
+		}
+	}, AsyncConfig{})
+
+	bus.Publish("topic")
+	<-started
+	bus.Publish("topic")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, bus.Close(ctx), context.DeadlineExceeded)
+
+	// the queued event is dropped, the worker exits after the current one
+	close(release)
+	require.NoError(t, bus.Drain(context.Background()))
+	assert.Equal(t, int32(1), calls.Load())
+	assert.Equal(t, uint64(1), bus.QueueStats()[0].Dropped)
+}
@@ -0,0 +1,364 @@
+// Package bridge connects an in-process eventbus.Bus to a distributed bus. Both APIs of the bus are
+// bridged: the events of Emit reach the remote subscribers, and the inbound ones are delivered to the
+// On handlers, while the topics of Publish are forwarded with their args and the inbound ones are
+// delivered to the Subscribe, SubscribeAsync and SubscribeAsyncBounded handlers. A string topic has
+// no type to decode its args from: register it with RegisterTopic.
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/braiphub/go-core/log"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// remoteOrigin marks the inbound events published without an origin, e.g. by a distributed.EventBus.
+const remoteOrigin = "remote"
+
+var ErrAlreadyConnected = errors.New("bridge already connected")
+
+// Remote is the distributed side of the bridge, *distributed.EventBus implements it.
+type Remote interface {
+	Register(event distributed.EventInterface, handler interface{}, opts ...distributed.HandlerOption) error
+	PublishEnvelope(ctx context.Context, envelope eventbus.Envelope, data []byte) error
+}
+
+// assert meets contract
+var _ Remote = &distributed.EventBus{}
+
+// Bridge connects an in-process eventbus.Bus to a distributed bus, so Emit reaches the subscribers of
+// both. Outbound events go out with the bridge origin in their envelope and inbound ones come in with
+// theirs: the bridge doesn't deliver its own events back, nor forward the events it delivered.
+type Bridge struct {
+	local  *eventbus.Bus
+	remote Remote
+	rules  []Rule
+	origin string
+	logger log.LoggerI
+
+	events    map[string]reflect.Type
+	topics    map[string][]reflect.Type
+	connected bool
+}
+
+type Option func(*Bridge)
+
+// WithOrigin names the bridge in the envelopes. It defaults to service.daemon for a
+// *distributed.EventBus remote, so the replicas of a daemon, sharing its queue, don't deliver the
+// events forwarded by each other again: the replica that emitted one already did. Other remotes get a
+// random id. Bridges of different daemons must not share it.
+func WithOrigin(origin string) Option {
+	return func(b *Bridge) {
+		b.origin = origin
+	}
+}
+
+func WithLogger(logger log.LoggerI) Option {
+	return func(b *Bridge) {
+		b.logger = logger
+	}
+}
+
+func New(local *eventbus.Bus, remote Remote, rules []Rule, opts ...Option) *Bridge {
+	bridge := &Bridge{
+		local:  local,
+		remote: remote,
+		rules:  rules,
+		origin: defaultOrigin(remote),
+		events: make(map[string]reflect.Type),
+		topics: make(map[string][]reflect.Type),
+	}
+
+	for _, opt := range opts {
+		opt(bridge)
+	}
+
+	return bridge
+}
+
+func defaultOrigin(remote Remote) string {
+	if bus, ok := remote.(*distributed.EventBus); ok {
+		return bus.Config.ServiceName + "." + bus.Config.DaemonName
+	}
+
+	return uuid.NewString()
+}
+
+// Register registers the local event types received from the distributed bus, they're delivered as
+// the value or pointer given. Register the forwarded ones too when the remote bus listens to its own
+// events, as a *distributed.EventBus does: it dead-letters the events it has no handler for.
+func (b *Bridge) Register(events ...eventbus.Event) {
+	for _, event := range events {
+		b.events[event.Topic()] = reflect.TypeOf(event)
+	}
+}
+
+// RegisterTopic registers a string topic of Publish, its args are decoded as the types of the args
+// given, e.g.: RegisterTopic("user.created", "", false) for Publish("user.created", id, admin). Like
+// Register, it's needed for the forwarded topics too when the remote bus listens to its own events.
+func (b *Bridge) RegisterTopic(topic string, args ...any) {
+	types := make([]reflect.Type, 0, len(args))
+	for _, arg := range args {
+		types = append(types, reflect.TypeOf(arg))
+	}
+
+	b.topics[topic] = types
+}
+
+// Connect forwards the outbound events and registers the inbound ones on the remote bus, call it
+// before the remote bus starts listening. The forwarded events come back to a remote bus listening
+// to its own events: they're acknowledged without being delivered again.
+func (b *Bridge) Connect() error {
+	if b.connected {
+		return ErrAlreadyConnected
+	}
+
+	for topic, eventType := range b.events {
+		if err := b.register(topic, b.inboundHandler(eventType)); err != nil {
+			return err
+		}
+	}
+
+	for topic, argTypes := range b.topics {
+		if err := b.register(topic, b.inboundTopicHandler(argTypes)); err != nil {
+			return err
+		}
+	}
+
+	b.local.OnAll(b.forward)
+	b.local.OnPublish(b.forwardPublished)
+	b.connected = true
+
+	return nil
+}
+
+// register registers the remote handler of an inbound topic, or acknowledges an outbound one.
+func (b *Bridge) register(topic string, handler func(ctx context.Context, event rawEvent) error) error {
+	switch {
+	case b.match(topic, Inbound):
+	case b.match(topic, Outbound):
+		handler = acknowledge
+	default:
+		return nil
+	}
+
+	err := b.remote.Register(&rawEvent{Topic: topic}, handler, distributed.WithHandlerName("bridge:"+topic))
+	if err != nil {
+		return errors.Wrap(err, "register "+topic)
+	}
+
+	return nil
+}
+
+// acknowledge is the remote handler of the forwarded topics, the local subscribers already got them.
+func acknowledge(context.Context, rawEvent) error {
+	return nil
+}
+
+func (b *Bridge) match(topic string, direction Direction) bool {
+	for _, rule := range b.rules {
+		if rule.Match(topic, direction) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forward publishes the outbound local events to the remote bus.
+func (b *Bridge) forward(ctx context.Context, event eventbus.Event) error {
+	envelope, ok := eventbus.EnvelopeFromContext(ctx)
+
+	// delivered from a remote bus, or not emitted
+	if !ok || envelope.Origin != "" || !b.match(envelope.Type, Outbound) {
+		return nil
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		return errors.Wrap(err, "marshal "+envelope.Type)
+	}
+
+	envelope.Origin = b.origin
+
+	if err := b.remote.PublishEnvelope(ctx, envelope, data); err != nil {
+		return errors.Wrap(err, "forward "+envelope.Type)
+	}
+
+	if b.logger != nil {
+		b.logger.Debug("event forwarded", log.Any("topic", envelope.Type))
+	}
+
+	return nil
+}
+
+// forwardPublished publishes the args of the outbound local topics to the remote bus.
+func (b *Bridge) forwardPublished(ctx context.Context, topic string, args []any) error {
+	envelope, ok := eventbus.EnvelopeFromContext(ctx)
+
+	// delivered from a remote bus
+	if !ok || envelope.Origin != "" || !b.match(topic, Outbound) {
+		return nil
+	}
+
+	data, err := encodeArgs(args)
+	if err != nil {
+		return errors.Wrap(err, "marshal "+topic)
+	}
+
+	envelope.Origin = b.origin
+
+	if err := b.remote.PublishEnvelope(ctx, envelope, data); err != nil {
+		return errors.Wrap(err, "forward "+topic)
+	}
+
+	if b.logger != nil {
+		b.logger.Debug("topic forwarded", log.Any("topic", topic))
+	}
+
+	return nil
+}
+
+// inboundHandler returns the remote bus handler delivering the events as eventType to the local bus.
+func (b *Bridge) inboundHandler(eventType reflect.Type) func(ctx context.Context, event rawEvent) error {
+	return func(ctx context.Context, event rawEvent) error {
+		envelope, _ := eventbus.EnvelopeFromContext(ctx)
+
+		// forwarded by this bridge, the local subscribers already got it
+		if envelope.Origin == b.origin {
+			return nil
+		}
+
+		if envelope.Origin == "" {
+			envelope.Origin = remoteOrigin
+		}
+
+		local, err := decode(eventType, event.Data)
+		if err != nil {
+			return errors.Wrap(err, event.Topic)
+		}
+
+		return b.local.Deliver(ctx, envelope, local)
+	}
+}
+
+// inboundTopicHandler returns the remote bus handler publishing the topics to the local bus, with
+// their args decoded as argTypes.
+func (b *Bridge) inboundTopicHandler(argTypes []reflect.Type) func(ctx context.Context, event rawEvent) error {
+	return func(ctx context.Context, event rawEvent) error {
+		envelope, _ := eventbus.EnvelopeFromContext(ctx)
+
+		// forwarded by this bridge, the local subscribers already got it
+		if envelope.Origin == b.origin {
+			return nil
+		}
+
+		if envelope.Origin == "" {
+			envelope.Origin = remoteOrigin
+		}
+
+		args, err := decodeArgs(argTypes, event.Data)
+		if err != nil {
+			return errors.Wrap(err, event.Topic)
+		}
+
+		b.local.DeliverPublished(ctx, envelope, event.Topic, args...)
+
+		return nil
+	}
+}
+
+// encodeArgs encodes a single arg as itself, and none or several as an array.
+func encodeArgs(args []any) ([]byte, error) {
+	if len(args) == 1 {
+		return json.Marshal(args[0])
+	}
+
+	if args == nil {
+		args = []any{}
+	}
+
+	return json.Marshal(args)
+}
+
+func decodeArgs(argTypes []reflect.Type, data []byte) ([]any, error) {
+	if len(argTypes) == 1 {
+		arg, err := decodeValue(argTypes[0], data)
+		if err != nil {
+			return nil, err
+		}
+
+		return []any{arg}, nil
+	}
+
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, errors.Wrap(err, "unmarshal")
+	}
+
+	if len(raw) != len(argTypes) {
+		return nil, errors.Errorf("got %d args, want %d", len(raw), len(argTypes))
+	}
+
+	args := make([]any, 0, len(argTypes))
+
+	for i, argType := range argTypes {
+		arg, err := decodeValue(argType, raw[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "arg %d", i)
+		}
+
+		args = append(args, arg)
+	}
+
+	return args, nil
+}
+
+func decodeValue(valueType reflect.Type, data []byte) (any, error) {
+	if valueType.Kind() == reflect.Ptr {
+		ptr := reflect.New(valueType.Elem())
+		if err := json.Unmarshal(data, ptr.Interface()); err != nil {
+			return nil, errors.Wrap(err, "unmarshal")
+		}
+
+		return ptr.Interface(), nil
+	}
+
+	ptr := reflect.New(valueType)
+	if err := json.Unmarshal(data, ptr.Interface()); err != nil {
+		return nil, errors.Wrap(err, "unmarshal")
+	}
+
+	return ptr.Elem().Interface(), nil
+}
+
+func decode(eventType reflect.Type, data []byte) (eventbus.Event, error) {
+	event, err := decodeValue(eventType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return event.(eventbus.Event), nil
+}
+
+// rawEvent is the remote bus model of a bridged topic, it keeps the payload to decode it as the
+// registered local type.
+type rawEvent struct {
+	Topic string
+	Data  json.RawMessage
+}
+
+func (e *rawEvent) EventType() string {
+	return e.Topic
+}
+
+func (e *rawEvent) UnmarshalJSON(data []byte) error {
+	e.Data = append(e.Data[:0], data...)
+
+	return nil
+}
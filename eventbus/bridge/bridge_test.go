@@ -0,0 +1,372 @@
+package bridge
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/braiphub/go-core/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+type orderCreated struct {
+	ID string `json:"id"`
+}
+
+func (orderCreated) Topic() string { return "order.created" }
+
+type orderPaid struct {
+	ID string `json:"id"`
+}
+
+func (*orderPaid) Topic() string { return "order.paid" }
+
+type userCreated struct{}
+
+func (userCreated) Topic() string { return "user.created" }
+
+// remoteOrderPaid is order.paid published by another service with a distributed.EventBus.
+type remoteOrderPaid struct {
+	ID string `json:"id"`
+}
+
+func (remoteOrderPaid) EventType() string { return "order.paid" }
+
+func TestRule_Match(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		want    bool
+	}{
+		{pattern: "order.created", topic: "order.created", want: true},
+		{pattern: "order.created", topic: "order.paid"},
+		{pattern: "order.*", topic: "order.created", want: true},
+		{pattern: "order.*", topic: "order"},
+		{pattern: "order.*", topic: "order.item.added"},
+		{pattern: "*.created", topic: "user.created", want: true},
+		{pattern: "order.#", topic: "order", want: true},
+		{pattern: "order.#", topic: "order.item.added", want: true},
+		{pattern: "#.added", topic: "order.item.added", want: true},
+		{pattern: "#.added", topic: "order.item.removed"},
+		{pattern: "#", topic: "anything.at.all", want: true},
+		{pattern: "order.#.added", topic: "order.added", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.topic, func(t *testing.T) {
+			assert.Equal(t, tt.want, Mirror(tt.pattern).Match(tt.topic, Outbound))
+		})
+	}
+
+	assert.True(t, Forward("order.*").Match("order.created", Outbound))
+	assert.False(t, Forward("order.*").Match("order.created", Inbound))
+	assert.True(t, Receive("order.*").Match("order.created", Inbound))
+	assert.False(t, Receive("order.*").Match("order.created", Outbound))
+}
+
+func newTestBridge(t *testing.T, rules ...Rule) (*eventbus.Bus, *distributed.EventBus, *distributed.InMemoryPubSub) {
+	t.Helper()
+
+	logger := log.NewMockLoggerI(gomock.NewController(t))
+	logger.EXPECT().Debug(gomock.Any(), gomock.Any()).AnyTimes()
+	logger.EXPECT().Warn(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	logger.EXPECT().Error(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+	pubSub := distributed.NewInMemoryPubSub()
+
+	remote, err := distributed.New("orders", "worker", distributed.WithLogger(logger), distributed.WithPubSub(pubSub))
+	require.NoError(t, err)
+
+	local := eventbus.New(eventbus.Config{Producer: "orders"})
+
+	bridge := New(local, remote, rules, WithOrigin("orders-1"), WithLogger(logger))
+	bridge.Register(orderCreated{}, &orderPaid{}, userCreated{})
+	bridge.RegisterTopic("order.shipped", "", 0)
+	bridge.RegisterTopic("order.noted", "")
+	require.NoError(t, bridge.Connect())
+	assert.ErrorIs(t, bridge.Connect(), ErrAlreadyConnected)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go func() { _ = remote.StartListen(ctx) }()
+
+	return local, remote, pubSub
+}
+
+// received records the local deliveries of a topic with their envelope.
+type received struct {
+	mu        sync.Mutex
+	envelopes []eventbus.Envelope
+	ids       []string
+}
+
+func (r *received) add(ctx context.Context, id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	envelope, _ := eventbus.EnvelopeFromContext(ctx)
+	r.envelopes = append(r.envelopes, envelope)
+	r.ids = append(r.ids, id)
+}
+
+func (r *received) get() ([]string, []eventbus.Envelope) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.ids...), append([]eventbus.Envelope(nil), r.envelopes...)
+}
+
+func TestBridge(t *testing.T) {
+	local, remote, pubSub := newTestBridge(t, Mirror("order.#"))
+
+	var created, paid received
+
+	eventbus.On(local, func(ctx context.Context, event orderCreated) error {
+		created.add(ctx, event.ID)
+
+		return nil
+	})
+	eventbus.On(local, func(ctx context.Context, event *orderPaid) error {
+		paid.add(ctx, event.ID)
+
+		return nil
+	})
+
+	var remoteCreated received
+
+	require.NoError(t, remote.Register(&remoteOrderPaid{}, func(ctx context.Context, event remoteOrderPaid) error {
+		return nil
+	}))
+	require.NoError(t, remote.Register(&rawEvent{Topic: "order.created"}, func(ctx context.Context, event rawEvent) error {
+		remoteCreated.add(ctx, string(event.Data))
+
+		return nil
+	}))
+
+	// local events reach the remote subscribers once, and the local ones aren't called again
+	require.NoError(t, eventbus.Emit(context.Background(), local, orderCreated{ID: "1"}))
+
+	assert.Eventually(t, func() bool {
+		ids, _ := remoteCreated.get()
+
+		return len(ids) == 1
+	}, time.Second, time.Millisecond)
+
+	ids, envelopes := remoteCreated.get()
+	assert.JSONEq(t, `{"id":"1"}`, ids[0])
+	assert.Equal(t, "orders-1", envelopes[0].Origin)
+	assert.Equal(t, "order.created", envelopes[0].Type)
+
+	// remote events reach the local subscribers, and aren't forwarded back
+	require.NoError(t, remote.Publish(context.Background(), &remoteOrderPaid{ID: "2"}))
+
+	assert.Eventually(t, func() bool {
+		ids, _ := paid.get()
+
+		return len(ids) == 1
+	}, time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool { return pubSub.Pending() == 0 }, time.Second, time.Millisecond)
+
+	ids, envelopes = paid.get()
+	assert.Equal(t, []string{"2"}, ids)
+	assert.Equal(t, remoteOrigin, envelopes[0].Origin)
+
+	ids, _ = created.get()
+	assert.Equal(t, []string{"1"}, ids)
+	assert.Empty(t, pubSub.Dead())
+}
+
+func TestBridge_ForwardOnly(t *testing.T) {
+	local, _, pubSub := newTestBridge(t, Forward("order.*"), Receive("user.*"))
+
+	var created received
+
+	eventbus.On(local, func(ctx context.Context, event orderCreated) error {
+		created.add(ctx, event.ID)
+
+		return nil
+	})
+
+	// the forwarded events come back to the remote bus, and are acknowledged
+	require.NoError(t, eventbus.Emit(context.Background(), local, orderCreated{ID: "1"}))
+	local.Publish("order.shipped", "1", 2)
+
+	assert.Eventually(t, func() bool { return pubSub.Pending() == 0 }, time.Second, time.Millisecond)
+
+	ids, _ := created.get()
+	assert.Equal(t, []string{"1"}, ids)
+	assert.Empty(t, pubSub.Dead())
+}
+
+func TestBridge_Publish(t *testing.T) {
+	local, remote, pubSub := newTestBridge(t, Mirror("order.#"))
+
+	var shipped, noted received
+
+	local.Subscribe("order.shipped", func(id string, items int) {
+		shipped.add(context.Background(), "sync "+id)
+	})
+	local.SubscribeAsync("order.shipped", func(id string, items int) {
+		shipped.add(context.Background(), "async "+id)
+	}, false)
+	local.SubscribeAsyncBounded("order.shipped", func(id string, items int) {
+		shipped.add(context.Background(), "bounded "+id)
+	}, eventbus.AsyncConfig{Workers: 1, QueueSize: 1})
+	local.Subscribe("order.noted", func(note string) {
+		noted.add(context.Background(), note)
+	})
+
+	var remoteShipped received
+
+	require.NoError(t, remote.Register(&rawEvent{Topic: "order.shipped"}, func(ctx context.Context, event rawEvent) error {
+		remoteShipped.add(ctx, string(event.Data))
+
+		return nil
+	}))
+
+	shippedCount := func(n int) func() bool {
+		return func() bool {
+			ids, _ := shipped.get()
+
+			return len(ids) == n
+		}
+	}
+
+	// published topics reach the remote subscribers with an envelope
+	ctx := eventbus.WithCorrelationID(context.Background(), "request-1")
+	local.PublishWithContext(ctx, "order.shipped", "1", 2)
+
+	assert.Eventually(t, func() bool {
+		ids, _ := remoteShipped.get()
+
+		return len(ids) == 1
+	}, time.Second, time.Millisecond)
+
+	ids, envelopes := remoteShipped.get()
+	assert.JSONEq(t, `["1",2]`, ids[0])
+	assert.Equal(t, "orders-1", envelopes[0].Origin)
+	assert.Equal(t, "order.shipped", envelopes[0].Type)
+	assert.Equal(t, "orders", envelopes[0].Producer)
+	assert.Equal(t, "request-1", envelopes[0].CorrelationID)
+
+	// remote topics reach every kind of local subscriber, and aren't forwarded back
+	envelope := eventbus.NewEnvelope(ctx, "order.shipped", 1, "billing")
+	require.NoError(t, remote.PublishEnvelope(ctx, envelope, []byte(`["2",3]`)))
+
+	envelope = eventbus.NewEnvelope(ctx, "order.noted", 1, "billing")
+	require.NoError(t, remote.PublishEnvelope(ctx, envelope, []byte(`"fragile"`)))
+
+	assert.Eventually(t, shippedCount(6), time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool { return pubSub.Pending() == 0 }, time.Second, time.Millisecond)
+
+	ids, _ = shipped.get()
+	assert.ElementsMatch(t, []string{"sync 1", "async 1", "bounded 1", "sync 2", "async 2", "bounded 2"}, ids)
+
+	ids, _ = noted.get()
+	assert.Equal(t, []string{"fragile"}, ids)
+
+	ids, _ = remoteShipped.get()
+	assert.Len(t, ids, 2)
+	assert.Empty(t, pubSub.Dead())
+}
+
+// remoteStub records the published envelopes.
+type remoteStub struct {
+	published []eventbus.Envelope
+	data      []string
+}
+
+func (r *remoteStub) Register(distributed.EventInterface, interface{}, ...distributed.HandlerOption) error {
+	return nil
+}
+
+func (r *remoteStub) PublishEnvelope(_ context.Context, envelope eventbus.Envelope, data []byte) error {
+	r.published = append(r.published, envelope)
+	r.data = append(r.data, string(data))
+
+	return nil
+}
+
+func TestBridge_forward(t *testing.T) {
+	local := eventbus.New(eventbus.Config{Producer: "orders"})
+	remote := &remoteStub{}
+
+	bridge := New(local, remote, []Rule{Forward("order.*"), Receive("user.*")}, WithOrigin("orders-1"))
+	require.NoError(t, bridge.Connect())
+
+	ctx := eventbus.WithCorrelationID(context.Background(), "request-1")
+
+	require.NoError(t, eventbus.Emit(ctx, local, orderCreated{ID: "1"}))
+	require.NoError(t, eventbus.Emit(ctx, local, &orderPaid{ID: "2"}))
+	// inbound only
+	require.NoError(t, eventbus.Emit(ctx, local, userCreated{}))
+	// delivered from another bus
+	require.NoError(t, local.Deliver(ctx, eventbus.Envelope{ID: "remote", Origin: "billing-1"}, orderCreated{ID: "3"}))
+
+	require.Len(t, remote.published, 2)
+	assert.Equal(t, []string{`{"id":"1"}`, `{"id":"2"}`}, remote.data)
+	assert.Equal(t, "order.created", remote.published[0].Type)
+	assert.Equal(t, "orders-1", remote.published[0].Origin)
+	assert.Equal(t, "orders", remote.published[0].Producer)
+	assert.Equal(t, "request-1", remote.published[0].CorrelationID)
+	assert.Equal(t, "order.paid", remote.published[1].Type)
+}
+
+func TestBridge_DefaultOrigin(t *testing.T) {
+	local := eventbus.New(eventbus.Config{Producer: "orders"})
+
+	// other remotes get a random id
+	first, second := New(local, &remoteStub{}, nil), New(local, &remoteStub{}, nil)
+	assert.NotEmpty(t, first.origin)
+	assert.NotEqual(t, first.origin, second.origin)
+
+	logger := log.NewMockLoggerI(gomock.NewController(t))
+	logger.EXPECT().Debug(gomock.Any(), gomock.Any()).AnyTimes()
+
+	pubSub := distributed.NewInMemoryPubSub()
+
+	remote, err := distributed.New("orders", "worker", distributed.WithLogger(logger), distributed.WithPubSub(pubSub))
+	require.NoError(t, err)
+
+	bridge := New(local, remote, []Rule{Mirror("order.#")})
+	assert.Equal(t, "orders.worker", bridge.origin)
+
+	bridge.Register(&orderPaid{})
+	require.NoError(t, bridge.Connect())
+
+	var paid received
+
+	eventbus.On(local, func(ctx context.Context, event *orderPaid) error {
+		paid.add(ctx, event.ID)
+
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go func() { _ = remote.StartListen(ctx) }()
+
+	// forwarded by another replica of the daemon, which delivered it locally already
+	replica := eventbus.NewEnvelope(ctx, "order.paid", 1, "orders")
+	replica.Origin = "orders.worker"
+	require.NoError(t, remote.PublishEnvelope(ctx, replica, []byte(`{"id":"1"}`)))
+
+	// forwarded by another daemon of the service
+	daemon := eventbus.NewEnvelope(ctx, "order.paid", 1, "orders")
+	daemon.Origin = "orders.api"
+	require.NoError(t, remote.PublishEnvelope(ctx, daemon, []byte(`{"id":"2"}`)))
+
+	assert.Eventually(t, func() bool { return pubSub.Pending() == 0 }, time.Second, time.Millisecond)
+
+	ids, envelopes := paid.get()
+	assert.Equal(t, []string{"2"}, ids)
+	assert.Equal(t, "orders.api", envelopes[0].Origin)
+	assert.Empty(t, pubSub.Dead())
+}
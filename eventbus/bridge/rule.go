@@ -0,0 +1,67 @@
+package bridge
+
+import "strings"
+
+// Direction is the way a rule bridges its topics.
+type Direction int
+
+const (
+	// Outbound forwards the events emitted on the local bus to the distributed bus.
+	Outbound Direction = 1 << iota
+	// Inbound delivers the events of the distributed bus to the local subscribers.
+	Inbound
+	Both = Outbound | Inbound
+)
+
+// Rule bridges the topics matching Pattern. Patterns are dot separated like amqp topics: "*" matches
+// a word and "#" zero or more words, e.g.: "order.*" or "billing.#".
+type Rule struct {
+	Pattern   string
+	Direction Direction
+}
+
+func Forward(pattern string) Rule {
+	return Rule{Pattern: pattern, Direction: Outbound}
+}
+
+func Receive(pattern string) Rule {
+	return Rule{Pattern: pattern, Direction: Inbound}
+}
+
+func Mirror(pattern string) Rule {
+	return Rule{Pattern: pattern, Direction: Both}
+}
+
+// Match reports whether the rule bridges the topic in the direction.
+func (r Rule) Match(topic string, direction Direction) bool {
+	return r.Direction&direction != 0 && matchTopic(strings.Split(r.Pattern, "."), strings.Split(topic, "."))
+}
+
+func matchTopic(pattern, topic []string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case "#":
+			for i := 0; i <= len(topic); i++ {
+				if matchTopic(pattern[1:], topic[i:]) {
+					return true
+				}
+			}
+
+			return false
+
+		case "*":
+			if len(topic) == 0 {
+				return false
+			}
+
+		default:
+			if len(topic) == 0 || topic[0] != pattern[0] {
+				return false
+			}
+		}
+
+		pattern, topic = pattern[1:], topic[1:]
+	}
+
+	return len(topic) == 0
+}
@@ -14,6 +14,7 @@ func New(cfg Config, opts ...OptionFn) *Bus {
 		config:       cfg,
 		logger:       nil,
 		errorHandler: nil,
+		handlers:     make(map[string][]eventHandler),
 	}
 
 	for _, opt := range opts {
@@ -1,16 +1,24 @@
-package with_dlq_backup
+package distributed
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 type Config struct {
 	ServiceName           string
 	DaemonName            string
 	ShouldDLQUnregistered bool
+	// ShutdownTimeout bounds how long StartListen waits for the event being handled once its
+	// context is cancelled.
+	ShutdownTimeout time.Duration
 }
 
 type EventRegisterConfig struct {
 	eventModel EventInterface
 	handler    interface{}
+	name       string
+	retry      *RetryPolicy
 }
 
 func (e *EventBus) validateConfig() error {
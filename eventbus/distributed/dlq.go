@@ -0,0 +1,101 @@
+package distributed
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"time"
+
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrDeadLetterQueueUnsupported = errors.New("pub/sub doesn't support dead letter queue inspection")
+	ErrDeadEventNotFound          = errors.New("dead event not found")
+)
+
+// DeadLetterQueue inspects and manages the events dead-lettered by the daemon, the ones its handlers
+// failed or that weren't registered.
+type DeadLetterQueue interface {
+	// List returns up to limit matching dead events, oldest first. A limit <= 0 lists all of them.
+	List(ctx context.Context, filter DeadEventFilter, limit int) ([]DeadEvent, error)
+	Peek(ctx context.Context, id string) (DeadEvent, error)
+	// Replay moves the matching dead events back to the daemon queue, returning how many were moved.
+	Replay(ctx context.Context, filter DeadEventFilter) (int, error)
+	// Purge deletes the matching dead events, returning how many were deleted.
+	Purge(ctx context.Context, filter DeadEventFilter) (int, error)
+}
+
+// DeadEvent is an event of the daemon ".dead" queue.
+type DeadEvent struct {
+	// ID is the envelope id, or a hash of the payload for events published without one.
+	ID        string
+	EventName string
+	Envelope  eventbus.Envelope
+	Data      []byte
+	// Reason is the x-death reason: rejected when a handler failed, delivery_limit, expired or maxlen.
+	Reason string
+	// Queue is the queue that dead-lettered the event and Count how many times it did.
+	Queue  string
+	Count  int64
+	DeadAt time.Time
+}
+
+// DeadEventFilter selects dead events, empty fields match every event.
+type DeadEventFilter struct {
+	IDs        []string
+	EventNames []string
+	// DeadBefore matches the events dead-lettered before it.
+	DeadBefore time.Time
+}
+
+func (f DeadEventFilter) Match(event DeadEvent) bool {
+	switch {
+	case len(f.IDs) > 0 && !slices.Contains(f.IDs, event.ID):
+		return false
+
+	case len(f.EventNames) > 0 && !slices.Contains(f.EventNames, event.EventName):
+		return false
+
+	case !f.DeadBefore.IsZero() && !event.DeadAt.Before(f.DeadBefore):
+		return false
+	}
+
+	return true
+}
+
+// IsEmpty reports whether the filter matches every event.
+func (f DeadEventFilter) IsEmpty() bool {
+	return len(f.IDs) == 0 && len(f.EventNames) == 0 && f.DeadBefore.IsZero()
+}
+
+// DeadLetterQueue returns the dead letter queue of the bus daemon.
+func (bus *EventBus) DeadLetterQueue() (DeadLetterQueue, error) {
+	dlq, ok := bus.pubSub.(DeadLetterQueue)
+	if !ok {
+		return nil, ErrDeadLetterQueueUnsupported
+	}
+
+	return dlq, nil
+}
+
+func peekDeadEvent(ctx context.Context, dlq DeadLetterQueue, id string) (DeadEvent, error) {
+	events, err := dlq.List(ctx, DeadEventFilter{IDs: []string{id}}, 1)
+	if err != nil {
+		return DeadEvent{}, err
+	}
+
+	if len(events) == 0 {
+		return DeadEvent{}, errors.Wrap(ErrDeadEventNotFound, id)
+	}
+
+	return events[0], nil
+}
+
+func payloadID(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,101 @@
+package distributed
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type otherEventType struct{}
+
+func (otherEventType) EventType() string {
+	return "other_event"
+}
+
+func TestDeadEventFilter_Match(t *testing.T) {
+	now := time.Now()
+	event := DeadEvent{ID: "1", EventName: "test_event", DeadAt: now.Add(-time.Hour)}
+
+	tests := []struct {
+		name   string
+		filter DeadEventFilter
+		want   bool
+	}{
+		{name: "empty", want: true},
+		{name: "id", filter: DeadEventFilter{IDs: []string{"2", "1"}}, want: true},
+		{name: "other id", filter: DeadEventFilter{IDs: []string{"2"}}},
+		{name: "event name", filter: DeadEventFilter{EventNames: []string{"test_event"}}, want: true},
+		{name: "other event name", filter: DeadEventFilter{EventNames: []string{"other_event"}}},
+		{name: "dead before", filter: DeadEventFilter{DeadBefore: now}, want: true},
+		{name: "dead after", filter: DeadEventFilter{DeadBefore: now.Add(-2 * time.Hour)}},
+		{name: "all fields", filter: DeadEventFilter{IDs: []string{"1"}, EventNames: []string{"other_event"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.filter.Match(event))
+		})
+	}
+}
+
+func TestInMemoryPubSub_DeadLetterQueue(t *testing.T) {
+	bus, pubSub := newTestInMemoryBus(t)
+	failing := true
+
+	require.NoError(t, bus.Register(&testEventType{}, func(ctx context.Context, event testEventType) error {
+		if failing {
+			return errors.New("failed")
+		}
+
+		return nil
+	}))
+	require.NoError(t, bus.Register(&otherEventType{}, func(ctx context.Context, event otherEventType) error {
+		return errors.New("failed")
+	}))
+
+	dlq, err := bus.DeadLetterQueue()
+	require.NoError(t, err)
+
+	startListen(t, bus)
+
+	require.NoError(t, bus.Publish(
+		context.Background(),
+		&testEventType{SampleValue: "first"},
+		&otherEventType{},
+		&testEventType{SampleValue: "second"},
+	))
+	assert.Eventually(t, func() bool { return pubSub.Pending() == 0 }, time.Second, time.Millisecond)
+
+	events, err := dlq.List(context.Background(), DeadEventFilter{}, 0)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, "rejected", events[0].Reason)
+
+	limited, err := dlq.List(context.Background(), DeadEventFilter{EventNames: []string{"test_event"}}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, events[:1], limited)
+
+	peeked, err := dlq.Peek(context.Background(), events[2].ID)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"sample_value":"second"}`, string(peeked.Data))
+
+	_, err = dlq.Peek(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrDeadEventNotFound)
+
+	// replayed events are handled again
+	failing = false
+
+	replayed, err := dlq.Replay(context.Background(), DeadEventFilter{EventNames: []string{"test_event"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, replayed)
+	assert.Eventually(t, func() bool { return pubSub.Pending() == 0 }, time.Second, time.Millisecond)
+
+	purged, err := dlq.Purge(context.Background(), DeadEventFilter{DeadBefore: time.Now()})
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	assert.Empty(t, pubSub.Dead())
+}
@@ -1,4 +1,4 @@
-package with_dlq_backup
+package distributed
 
 import "errors"
 
@@ -7,4 +7,6 @@ var (
 	ErrEventHandlersNotSpecified = errors.New("you must specify at least one event-handler")
 	ErrUnregisteredEvent         = errors.New("unregistered event")
 	ErrInvalidEventHandler       = errors.New("invalid event handler")
+	ErrNotConnected              = errors.New("pub/sub not connected")
+	ErrClosed                    = errors.New("pub/sub closed")
 )
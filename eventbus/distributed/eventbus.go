@@ -0,0 +1,313 @@
+package distributed
+
+import (
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/braiphub/go-core/log"
+	"github.com/mohae/deepcopy"
+	"github.com/pkg/errors"
+)
+
+// assert meets contract
+var _ EventBusInterface = (*EventBus)(nil)
+
+type EventBus struct {
+	Config           Config
+	pubSub           PubSubInterface
+	registeredEvents map[string][]EventRegisterConfig
+	logger           log.LoggerI
+	handlerStore     HandlerStore
+	retryPolicy      RetryPolicy
+}
+
+func New(serviceName, daemonName string, opts ...Option) (*EventBus, error) {
+	bus := &EventBus{
+		Config: Config{
+			ServiceName: serviceName,
+			DaemonName:  daemonName,
+		},
+		registeredEvents: make(map[string][]EventRegisterConfig),
+	}
+
+	WithDefaultConfig(bus)
+
+	for _, o := range opts {
+		o(bus)
+	}
+
+	if err := bus.validateConfig(); err != nil {
+		return nil, err
+	}
+
+	if err := bus.pubSub.Configure(bus.Config); err != nil {
+		return nil, errors.Wrap(err, "configure pub/sub")
+	}
+
+	return bus, nil
+}
+
+// Register - Handlers func should have signature: (context.Context, EventInterface) error
+func (bus *EventBus) Register(event EventInterface, handler interface{}, opts ...HandlerOption) error {
+	// validate
+	if reflect.ValueOf(event).Kind() != reflect.Ptr {
+		return errors.Wrap(ErrEventModelShouldBePointer, event.EventType())
+	}
+
+	if err := validateHandler(reflect.TypeOf(event).Elem(), handler); err != nil {
+		return errors.Wrap(err, event.EventType())
+	}
+
+	// init list if first use
+	if _, ok := bus.registeredEvents[event.EventType()]; !ok {
+		bus.registeredEvents[event.EventType()] = make([]EventRegisterConfig, 0)
+	}
+
+	// append event handler
+	eventHandlerList := bus.registeredEvents[event.EventType()]
+
+	config := EventRegisterConfig{
+		eventModel: event,
+		handler:    handler,
+	}
+
+	for _, o := range opts {
+		o(&config)
+	}
+
+	if config.name == "" {
+		config.name = handlerName(handler, eventHandlerList)
+
+		if isClosure(handler) {
+			bus.logger.Warn(
+				"handler registered without a name, the generated name of a closure changes with the code around it",
+				log.Any("event_name", event.EventType()),
+				log.Any("handler", config.name),
+			)
+		}
+	}
+
+	eventHandlerList = append(eventHandlerList, config)
+
+	bus.registeredEvents[event.EventType()] = eventHandlerList
+
+	return nil
+}
+
+// validateHandler checks the handler takes a context and the event, and returns nothing or an error last.
+func validateHandler(eventType reflect.Type, handler interface{}) error {
+	handlerType := reflect.TypeOf(handler)
+
+	switch {
+	case handlerType == nil || handlerType.Kind() != reflect.Func:
+		return errors.Wrap(ErrInvalidEventHandler, "handler isn't a func")
+
+	case handlerType.NumIn() != 2:
+		return errors.Wrap(ErrInvalidEventHandler, "handler must take a context and the event")
+
+	case handlerType.In(0) != reflect.TypeOf((*context.Context)(nil)).Elem():
+		return errors.Wrap(ErrInvalidEventHandler, "first handler param isn't a context.Context")
+
+	case !eventType.AssignableTo(handlerType.In(1)):
+		return errors.Wrapf(ErrInvalidEventHandler, "second handler param doesn't accept %s", eventType)
+
+	case handlerType.NumOut() > 0 && handlerType.Out(handlerType.NumOut()-1) != reflect.TypeOf((*error)(nil)).Elem():
+		return errors.Wrap(ErrInvalidEventHandler, "last handler return isn't an error")
+	}
+
+	return nil
+}
+
+// RegisterList - Handlers func should have signature: (context.Context, EventInterface) error
+func (bus *EventBus) RegisterList(eventList map[EventInterface][]interface{}) error {
+	for event, handlers := range eventList {
+		for _, handler := range handlers {
+			if err := bus.Register(event, handler); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// StartListen delivers the events to the registered handlers until ctx is cancelled. On shutdown it
+// stops taking events and waits up to Config.ShutdownTimeout for the event being handled.
+func (bus *EventBus) StartListen(ctx context.Context) error {
+	if err := bus.pubSub.ListenToEvents(ctx, bus.receivedEventFromPubSubHandler); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Publish publishes the events in order, in envelopes created from ctx (see eventbus.NewEnvelope).
+// It stops on the first error or once ctx is done.
+func (bus *EventBus) Publish(ctx context.Context, events ...EventInterface) error {
+	for _, event := range events {
+		if err := ctx.Err(); err != nil {
+			return errors.Wrap(err, "publish event")
+		}
+
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+
+		envelope := eventbus.NewEnvelope(ctx, event.EventType(), eventbus.VersionOf(event), bus.Config.ServiceName)
+
+		if err := bus.pubSub.Publish(ctx, envelope, data); err != nil {
+			return errors.Wrap(err, "pub/sub publish event")
+		}
+
+		bus.logger.Debug("event published", log.Any("event_name", event.EventType()))
+	}
+
+	return nil
+}
+
+// PublishEnvelope publishes an event already marshaled in its envelope, e.g. relayed from an outbox.
+func (bus *EventBus) PublishEnvelope(ctx context.Context, envelope eventbus.Envelope, data []byte) error {
+	if err := bus.pubSub.Publish(ctx, envelope, data); err != nil {
+		return errors.Wrap(err, "pub/sub publish event")
+	}
+
+	bus.logger.Debug("event published", log.Any("event_name", envelope.Type))
+
+	return nil
+}
+
+// Health reports whether the bus can publish and, while listening, is still connected.
+func (bus *EventBus) Health(ctx context.Context) error {
+	if err := bus.pubSub.Health(ctx); err != nil {
+		return errors.Wrap(err, "pub/sub health")
+	}
+
+	return nil
+}
+
+// Close releases the pub/sub connections, listening stops with the StartListen context.
+func (bus *EventBus) Close() error {
+	return bus.pubSub.Close()
+}
+
+func (bus *EventBus) receivedEventFromPubSubHandler(
+	ctx context.Context,
+	envelope eventbus.Envelope,
+	data []byte,
+) error {
+	eventName := envelope.Type
+
+	eventHandlers, ok := bus.registeredEvents[eventName]
+	if !ok && bus.Config.ShouldDLQUnregistered {
+		bus.logger.Error("nacking unknown/unregistered event", ErrUnregisteredEvent, log.Any("event_name", eventName))
+
+		return ErrUnregisteredEvent
+	}
+
+	var (
+		eventID = envelope.ID
+		errs    []error
+	)
+
+	// handlers get the envelope, and publish with it as the cause
+	ctx = eventbus.ExtractEnvelope(ctx, envelope)
+
+	// every handler runs, a failure doesn't stop the others
+	for i, h := range eventHandlers {
+		if eventID != "" && bus.handlerStore != nil {
+			succeeded, err := bus.handlerStore.Succeeded(ctx, eventID, h.name)
+			if err != nil {
+				bus.logger.Error("error reading handler store", err, log.Any("event_name", eventName))
+
+				return errors.Wrap(err, "handler store")
+			}
+
+			if succeeded {
+				continue
+			}
+		}
+
+		event := deepcopy.Copy(h.eventModel)
+		if err := json.Unmarshal(data, &event); err != nil {
+			bus.logger.Error("error unmarshaling message", err, log.Any("event_name", eventName))
+
+			return errors.Wrap(err, "unmarshal")
+		}
+
+		attempts, err := bus.callHandler(ctx, h, event)
+		if err != nil {
+			bus.logger.Error(fmt.Sprintf("error on handler %d of %d", i+1, len(eventHandlers)), err, log.Any("event_name", eventName))
+
+			errs = append(errs, errors.Wrapf(err, "handler %s", h.name))
+			bus.recordFailure(ctx, HandlerFailure{
+				EventID:   eventID,
+				EventName: eventName,
+				Handler:   h.name,
+				Data:      data,
+				Error:     err.Error(),
+				Attempts:  attempts,
+				FailedAt:  time.Now(),
+			})
+
+			continue
+		}
+
+		if eventID != "" && bus.handlerStore != nil {
+			if err := bus.handlerStore.MarkSucceeded(ctx, eventID, h.name); err != nil {
+				bus.logger.Error("error writing handler store", err, log.Any("event_name", eventName))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.Wrap(stderrors.Join(errs...), "processing event")
+	}
+
+	bus.logger.Debug("event processed", log.Any("event_name", eventName))
+
+	return nil
+}
+
+func (bus *EventBus) recordFailure(ctx context.Context, failure HandlerFailure) {
+	if failure.EventID == "" || bus.handlerStore == nil {
+		return
+	}
+
+	if err := bus.handlerStore.RecordFailure(ctx, failure); err != nil {
+		bus.logger.Error("error recording handler failure", err, log.Any("event_name", failure.EventName))
+	}
+}
+
+// Failures returns the failure records of the handlers of the event.
+func (bus *EventBus) Failures(ctx context.Context, eventID string) ([]HandlerFailure, error) {
+	if bus.handlerStore == nil {
+		return nil, nil
+	}
+
+	return bus.handlerStore.Failures(ctx, eventID)
+}
+
+func callFuncWithArgs(callback interface{}, ctx context.Context, eventPtr interface{}) error {
+	passedArguments := make([]reflect.Value, 2)
+	passedArguments[0] = reflect.ValueOf(ctx)
+	passedArguments[1] = reflect.ValueOf(eventPtr).Elem()
+
+	if ctx == nil {
+		passedArguments[0] = reflect.New(reflect.ValueOf(callback).Type().In(0)).Elem()
+	}
+
+	result := reflect.ValueOf(callback).Call(passedArguments)
+	if len(result) > 0 {
+		if err, ok := result[len(result)-1].Interface().(error); ok && err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,13 +1,14 @@
-package with_dlq_backup
+package distributed
 
 import (
 	"context"
 	"errors"
 	"testing"
 
+	"github.com/braiphub/go-core/eventbus"
 	"github.com/braiphub/go-core/log"
-	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
 )
 
 type testEventType struct {
@@ -19,7 +20,11 @@ func (testEventType) EventType() string {
 }
 
 func TestEventBus_Register(t *testing.T) {
+	logger := log.NewMockLoggerI(gomock.NewController(t))
+	logger.EXPECT().Warn(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
 	bus := &EventBus{
+		logger:           logger,
 		registeredEvents: make(map[string][]EventRegisterConfig),
 	}
 
@@ -45,6 +50,23 @@ func TestEventBus_Register(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Len(t, bus.registeredEvents, 1)
 	assert.Len(t, bus.registeredEvents[eventName], 3)
+
+	// error: handlers not matching the signature
+	invalidHandlers := []interface{}{
+		nil,
+		"handler",
+		func(event testEventType) error { return nil },
+		func(ctx context.Context, event string) error { return nil },
+		func(ctx string, event testEventType) error { return nil },
+		func(ctx context.Context, event testEventType) string { return "" },
+	}
+	for _, handler := range invalidHandlers {
+		assert.ErrorIs(t, bus.Register(&testEventType{}, handler), ErrInvalidEventHandler)
+	}
+
+	// typed handlers and handlers without return are accepted
+	assert.NoError(t, bus.Register(&testEventType{}, func(ctx context.Context, event testEventType) error { return nil }))
+	assert.NoError(t, bus.Register(&testEventType{}, func(ctx context.Context, event testEventType) {}))
 }
 
 func TestEventBus_receivedEventFromPubSubHandler(t *testing.T) {
@@ -162,7 +184,14 @@ func TestEventBus_receivedEventFromPubSubHandler(t *testing.T) {
 				registeredEvents: tt.fields.registeredEvents,
 				logger:           tt.fields.logger,
 			}
-			if err := bus.receivedEventFromPubSubHandler(tt.args.ctx, tt.args.eventName, tt.args.data); (err != nil) != tt.wantErr {
+			ctx := tt.args.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+
+			envelope := eventbus.Envelope{Type: tt.args.eventName}
+
+			if err := bus.receivedEventFromPubSubHandler(ctx, envelope, tt.args.data); (err != nil) != tt.wantErr {
 				t.Errorf("EventBus.receivedEventFromPubSubHandler() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -0,0 +1,154 @@
+package distributed
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	handlerResultsTableName  = "eventbus_handler_results"
+	handlerFailuresTableName = "eventbus_handler_failures"
+)
+
+// GormHandlerResultModel records a handler that succeeded for an event.
+type GormHandlerResultModel struct {
+	EventID   string    `gorm:"primaryKey"`
+	Handler   string    `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (GormHandlerResultModel) TableName() string {
+	return handlerResultsTableName
+}
+
+// GormHandlerFailureModel is the failure record of a handler that ran out of retries.
+type GormHandlerFailureModel struct {
+	ID        uint   `gorm:"primary_key"`
+	EventID   string `gorm:"index"`
+	EventName string
+	Handler   string
+	Data      []byte
+	Error     string
+	Attempts  int
+	FailedAt  time.Time `gorm:"index"`
+}
+
+func (GormHandlerFailureModel) TableName() string {
+	return handlerFailuresTableName
+}
+
+// assert meets contract
+var _ HandlerStore = &GormHandlerStore{}
+
+// GormHandlerStore is a HandlerStore shared by every instance of the daemon. The tables can be
+// created by migrating GormHandlerResultModel and GormHandlerFailureModel.
+type GormHandlerStore struct {
+	database *gorm.DB
+}
+
+func NewGormHandlerStore(database *gorm.DB) *GormHandlerStore {
+	return &GormHandlerStore{database: database}
+}
+
+func (s *GormHandlerStore) Succeeded(ctx context.Context, eventID string, handler string) (bool, error) {
+	var count int64
+
+	err := s.database.WithContext(ctx).
+		Model(&GormHandlerResultModel{}).
+		Where("event_id = ? AND handler = ?", eventID, handler).
+		Count(&count).
+		Error
+	if err != nil {
+		return false, errors.Wrap(err, "count handler results")
+	}
+
+	return count > 0, nil
+}
+
+func (s *GormHandlerStore) MarkSucceeded(ctx context.Context, eventID string, handler string) error {
+	err := s.database.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&GormHandlerResultModel{EventID: eventID, Handler: handler}).
+		Error
+	if err != nil {
+		return errors.Wrap(err, "create handler result")
+	}
+
+	return nil
+}
+
+func (s *GormHandlerStore) RecordFailure(ctx context.Context, failure HandlerFailure) error {
+	model := &GormHandlerFailureModel{
+		EventID:   failure.EventID,
+		EventName: failure.EventName,
+		Handler:   failure.Handler,
+		Data:      failure.Data,
+		Error:     failure.Error,
+		Attempts:  failure.Attempts,
+		FailedAt:  failure.FailedAt,
+	}
+
+	if err := s.database.WithContext(ctx).Create(model).Error; err != nil {
+		return errors.Wrap(err, "create handler failure")
+	}
+
+	return nil
+}
+
+func (s *GormHandlerStore) Failures(ctx context.Context, eventID string) ([]HandlerFailure, error) {
+	var models []GormHandlerFailureModel
+
+	err := s.database.WithContext(ctx).
+		Where("event_id = ?", eventID).
+		Order("failed_at").
+		Find(&models).
+		Error
+	if err != nil {
+		return nil, errors.Wrap(err, "find handler failures")
+	}
+
+	failures := make([]HandlerFailure, 0, len(models))
+	for _, model := range models {
+		failures = append(failures, HandlerFailure{
+			EventID:   model.EventID,
+			EventName: model.EventName,
+			Handler:   model.Handler,
+			Data:      model.Data,
+			Error:     model.Error,
+			Attempts:  model.Attempts,
+			FailedAt:  model.FailedAt,
+		})
+	}
+
+	return failures, nil
+}
+
+// Cleanup deletes the records older than the given time, returning how many were deleted.
+func (s *GormHandlerStore) Cleanup(ctx context.Context, before time.Time) (int64, error) {
+	var deleted int64
+
+	err := s.database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		results := tx.Where("created_at < ?", before).Delete(&GormHandlerResultModel{})
+		if results.Error != nil {
+			return errors.Wrap(results.Error, "delete handler results")
+		}
+
+		failures := tx.Where("failed_at < ?", before).Delete(&GormHandlerFailureModel{})
+		if failures.Error != nil {
+			return errors.Wrap(failures.Error, "delete handler failures")
+		}
+
+		deleted = results.RowsAffected + failures.RowsAffected
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
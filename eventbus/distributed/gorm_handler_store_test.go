@@ -0,0 +1,92 @@
+package distributed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestDatabase(t *testing.T, models ...any) *gorm.DB {
+	t.Helper()
+
+	database, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	// every connection to an in-memory database opens a new, empty one
+	sqlDB, err := database.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	require.NoError(t, database.AutoMigrate(models...))
+
+	return database
+}
+
+func TestGormHandlerStore(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase(t, &GormHandlerResultModel{}, &GormHandlerFailureModel{})
+	store := NewGormHandlerStore(database)
+
+	require.NoError(t, store.MarkSucceeded(ctx, "event", "handler"))
+	// marking it again is a no-op
+	require.NoError(t, store.MarkSucceeded(ctx, "event", "handler"))
+
+	succeeded, err := store.Succeeded(ctx, "event", "handler")
+	require.NoError(t, err)
+	assert.True(t, succeeded)
+
+	succeeded, err = store.Succeeded(ctx, "event", "other")
+	require.NoError(t, err)
+	assert.False(t, succeeded)
+
+	failedAt := time.Now().Truncate(time.Second)
+	second := HandlerFailure{
+		EventID:   "event",
+		EventName: "test_event",
+		Handler:   "other",
+		Data:      []byte(`{}`),
+		Error:     "failed again",
+		Attempts:  3,
+		FailedAt:  failedAt,
+	}
+	first := second
+	first.Error = "failed"
+	first.FailedAt = failedAt.Add(-time.Minute)
+
+	require.NoError(t, store.RecordFailure(ctx, second))
+	require.NoError(t, store.RecordFailure(ctx, first))
+	require.NoError(t, store.RecordFailure(ctx, HandlerFailure{EventID: "old", FailedAt: failedAt.Add(-time.Hour)}))
+
+	failures, err := store.Failures(ctx, "event")
+	require.NoError(t, err)
+	require.Len(t, failures, 2)
+	assert.Equal(t, "failed", failures[0].Error)
+	assert.Equal(t, "failed again", failures[1].Error)
+	assert.Equal(t, "other", failures[1].Handler)
+	assert.Equal(t, []byte(`{}`), failures[1].Data)
+	assert.Equal(t, 3, failures[1].Attempts)
+	assert.True(t, failedAt.Equal(failures[1].FailedAt))
+
+	// the result is recent, only the old failure is deleted
+	deleted, err := store.Cleanup(ctx, failedAt.Add(-30*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	failures, err = store.Failures(ctx, "old")
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+
+	deleted, err = store.Cleanup(ctx, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), deleted)
+
+	succeeded, err = store.Succeeded(ctx, "event", "handler")
+	require.NoError(t, err)
+	assert.False(t, succeeded)
+}
@@ -0,0 +1,114 @@
+package distributed
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"runtime"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RetryPolicy retries a failing handler in process, before the event is dead-lettered. The delay
+// between attempts starts at Backoff and doubles up to MaxBackoff.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times the handler runs, values below 1 run it once.
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+// HandlerOption configures a handler on Register.
+type HandlerOption func(*EventRegisterConfig)
+
+// WithHandlerName names the handler in the handler store and failure records. It defaults to the
+// handler func name, so set it for closures, whose generated names change when the code around them
+// does, or handlers that may move. Registering a closure without a name logs a warning.
+func WithHandlerName(name string) HandlerOption {
+	return func(config *EventRegisterConfig) {
+		config.name = name
+	}
+}
+
+// WithHandlerRetry overrides the bus retry policy for the handler.
+func WithHandlerRetry(policy RetryPolicy) HandlerOption {
+	return func(config *EventRegisterConfig) {
+		config.retry = &policy
+	}
+}
+
+// closureName matches the names the compiler generates for anonymous funcs, e.g. pkg.Func.func1.2.
+var closureName = regexp.MustCompile(`\.func\d+(\.\d+)*$`)
+
+// isClosure tells if the func name of handler was generated by the compiler.
+func isClosure(handler interface{}) bool {
+	return closureName.MatchString(runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name())
+}
+
+// handlerName returns the func name of handler, suffixed when the event has a handler with that name.
+func handlerName(handler interface{}, registered []EventRegisterConfig) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+
+	taken := func(name string) bool {
+		for _, config := range registered {
+			if config.name == name {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if !taken(name) {
+		return name
+	}
+
+	for i := 2; ; i++ {
+		if suffixed := fmt.Sprintf("%s#%d", name, i); !taken(suffixed) {
+			return suffixed
+		}
+	}
+}
+
+// callHandler runs the handler with its retry policy, recovering panics. It returns the number of
+// attempts made.
+func (bus *EventBus) callHandler(ctx context.Context, config EventRegisterConfig, event interface{}) (int, error) {
+	policy := bus.retryPolicy
+	if config.retry != nil {
+		policy = *config.retry
+	}
+
+	backoff := policy.Backoff
+
+	for attempt := 1; ; attempt++ {
+		err := callHandlerOnce(ctx, config.handler, event)
+		if err == nil || attempt >= policy.MaxAttempts {
+			return attempt, err
+		}
+
+		if backoff > 0 {
+			select {
+			case <-ctx.Done():
+				return attempt, errors.Wrap(err, ctx.Err().Error())
+			case <-time.After(backoff):
+			}
+		}
+
+		backoff *= 2
+		if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
+
+func callHandlerOnce(ctx context.Context, handler interface{}, event interface{}) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = errors.Errorf("handler panic: %v", recovered)
+		}
+	}()
+
+	return callFuncWithArgs(handler, ctx, event)
+}
@@ -0,0 +1,125 @@
+package distributed
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultHandlerRecordTTL = 24 * time.Hour
+
+// HandlerStore keeps the outcome of each handler per event, so a redelivered event, e.g. replayed
+// from the dead letter queue, only runs the handlers that didn't succeed yet.
+type HandlerStore interface {
+	Succeeded(ctx context.Context, eventID string, handler string) (bool, error)
+	MarkSucceeded(ctx context.Context, eventID string, handler string) error
+	// RecordFailure keeps the failure of a handler that ran out of retries.
+	RecordFailure(ctx context.Context, failure HandlerFailure) error
+	// Failures returns the failures recorded for the event, oldest first.
+	Failures(ctx context.Context, eventID string) ([]HandlerFailure, error)
+}
+
+// HandlerFailure is the failure record of a handler that ran out of retries.
+type HandlerFailure struct {
+	EventID   string
+	EventName string
+	Handler   string
+	Data      []byte
+	Error     string
+	Attempts  int
+	FailedAt  time.Time
+}
+
+// assert meets contract
+var _ HandlerStore = &InMemoryHandlerStore{}
+
+// InMemoryHandlerStore is a HandlerStore for a single instance of the daemon. It only skips handlers
+// of events redelivered to the same process, use a GormHandlerStore when running several instances.
+// Records are dropped after ttl, it grows with the events handled within ttl.
+type InMemoryHandlerStore struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	succeeded map[handlerKey]time.Time
+	failures  map[string][]HandlerFailure
+	pruneAt   time.Time
+}
+
+type handlerKey struct {
+	eventID string
+	handler string
+}
+
+// NewInMemoryHandlerStore creates a store keeping records for ttl, 24 hours when ttl <= 0.
+func NewInMemoryHandlerStore(ttl time.Duration) *InMemoryHandlerStore {
+	if ttl <= 0 {
+		ttl = defaultHandlerRecordTTL
+	}
+
+	return &InMemoryHandlerStore{
+		ttl:       ttl,
+		succeeded: make(map[handlerKey]time.Time),
+		failures:  make(map[string][]HandlerFailure),
+		pruneAt:   time.Now().Add(ttl),
+	}
+}
+
+func (s *InMemoryHandlerStore) Succeeded(_ context.Context, eventID string, handler string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.succeeded[handlerKey{eventID: eventID, handler: handler}]
+
+	return ok, nil
+}
+
+func (s *InMemoryHandlerStore) MarkSucceeded(_ context.Context, eventID string, handler string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+	s.succeeded[handlerKey{eventID: eventID, handler: handler}] = time.Now()
+
+	return nil
+}
+
+func (s *InMemoryHandlerStore) RecordFailure(_ context.Context, failure HandlerFailure) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.prune()
+	s.failures[failure.EventID] = append(s.failures[failure.EventID], failure)
+
+	return nil
+}
+
+func (s *InMemoryHandlerStore) Failures(_ context.Context, eventID string) ([]HandlerFailure, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]HandlerFailure(nil), s.failures[eventID]...), nil
+}
+
+// prune drops the expired records, at most once per ttl. It must be called holding s.mu.
+func (s *InMemoryHandlerStore) prune() {
+	now := time.Now()
+	if now.Before(s.pruneAt) {
+		return
+	}
+
+	expired := now.Add(-s.ttl)
+
+	for key, at := range s.succeeded {
+		if at.Before(expired) {
+			delete(s.succeeded, key)
+		}
+	}
+
+	for eventID, failures := range s.failures {
+		if failures[len(failures)-1].FailedAt.Before(expired) {
+			delete(s.failures, eventID)
+		}
+	}
+
+	s.pruneAt = now.Add(s.ttl)
+}
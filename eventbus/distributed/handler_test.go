@@ -0,0 +1,196 @@
+package distributed
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestEventBus_HandlerIsolation(t *testing.T) {
+	bus, pubSub := newTestInMemoryBus(t,
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2}),
+		WithHandlerStore(NewInMemoryHandlerStore(time.Hour)),
+	)
+
+	var (
+		mu      sync.Mutex
+		calls   = make(map[string]int)
+		failing = true
+	)
+
+	call := func(name string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls[name]++
+
+		return failing
+	}
+
+	require.NoError(t, bus.Register(&testEventType{}, func(ctx context.Context, event testEventType) error {
+		call("first")
+
+		return nil
+	}, WithHandlerName("first")))
+	require.NoError(t, bus.Register(&testEventType{}, func(ctx context.Context, event testEventType) error {
+		if call("flaky") {
+			return errors.New("failed")
+		}
+
+		return nil
+	}, WithHandlerName("flaky"), WithHandlerRetry(RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})))
+	require.NoError(t, bus.Register(&testEventType{}, func(ctx context.Context, event testEventType) error {
+		if call("panics") {
+			panic("boom")
+		}
+
+		return nil
+	}, WithHandlerName("panics")))
+
+	startListen(t, bus)
+
+	require.NoError(t, bus.Publish(context.Background(), &testEventType{SampleValue: "value"}))
+	assert.Eventually(t, func() bool { return pubSub.Pending() == 0 }, time.Second, time.Millisecond)
+
+	// every handler ran, with its own retry policy
+	mu.Lock()
+	assert.Equal(t, map[string]int{"first": 1, "flaky": 3, "panics": 2}, calls)
+	failing = false
+	mu.Unlock()
+
+	dead := pubSub.Dead()
+	require.Len(t, dead, 1)
+
+	failures, err := bus.Failures(context.Background(), dead[0].ID)
+	require.NoError(t, err)
+	require.Len(t, failures, 2)
+	assert.Equal(t, "flaky", failures[0].Handler)
+	assert.Equal(t, 3, failures[0].Attempts)
+	assert.Equal(t, "panics", failures[1].Handler)
+	assert.Contains(t, failures[1].Error, "boom")
+
+	// the handlers that succeeded are skipped on redelivery
+	dlq, err := bus.DeadLetterQueue()
+	require.NoError(t, err)
+
+	_, err = dlq.Replay(context.Background(), DeadEventFilter{})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return pubSub.Pending() == 0 }, time.Second, time.Millisecond)
+
+	mu.Lock()
+	assert.Equal(t, map[string]int{"first": 1, "flaky": 4, "panics": 3}, calls)
+	mu.Unlock()
+	assert.Empty(t, pubSub.Dead())
+}
+
+func TestEventBus_WithoutHandlerStore(t *testing.T) {
+	bus, pubSub := newTestInMemoryBus(t)
+
+	var (
+		mu    sync.Mutex
+		calls = make(map[string]int)
+	)
+
+	require.NoError(t, bus.Register(&testEventType{}, func(ctx context.Context, event testEventType) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls["first"]++
+
+		return nil
+	}, WithHandlerName("first")))
+	require.NoError(t, bus.Register(&testEventType{}, func(ctx context.Context, event testEventType) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		calls["failing"]++
+
+		return errors.New("failed")
+	}, WithHandlerName("failing")))
+
+	startListen(t, bus)
+
+	require.NoError(t, bus.Publish(context.Background(), &testEventType{SampleValue: "value"}))
+	assert.Eventually(t, func() bool { return len(pubSub.Dead()) == 1 }, time.Second, time.Millisecond)
+
+	// nothing is recorded by default
+	failures, err := bus.Failures(context.Background(), pubSub.Dead()[0].ID)
+	require.NoError(t, err)
+	assert.Empty(t, failures)
+
+	// and every handler runs again on redelivery
+	dlq, err := bus.DeadLetterQueue()
+	require.NoError(t, err)
+
+	_, err = dlq.Replay(context.Background(), DeadEventFilter{})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return len(pubSub.Dead()) == 1 }, time.Second, time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, map[string]int{"first": 2, "failing": 2}, calls)
+}
+
+func namedTestHandler(context.Context, testEventType) error { return nil }
+
+func Test_handlerName(t *testing.T) {
+	const closure = "github.com/braiphub/go-core/eventbus/distributed.Test_handlerName.func1"
+
+	// only the unnamed closures are warned about
+	logger := log.NewMockLoggerI(gomock.NewController(t))
+	logger.EXPECT().
+		Warn(gomock.Any(), log.Any("event_name", "test_event"), log.Any("handler", closure)).
+		Times(1)
+	logger.EXPECT().
+		Warn(gomock.Any(), log.Any("event_name", "test_event"), log.Any("handler", closure+"#2")).
+		Times(1)
+
+	bus := &EventBus{logger: logger, registeredEvents: make(map[string][]EventRegisterConfig)}
+	handler := func(ctx context.Context, event testEventType) error { return nil }
+
+	require.NoError(t, bus.Register(&testEventType{}, handler))
+	require.NoError(t, bus.Register(&testEventType{}, handler))
+	require.NoError(t, bus.Register(&testEventType{}, handler, WithHandlerName("named")))
+	require.NoError(t, bus.Register(&testEventType{}, namedTestHandler))
+
+	registered := bus.registeredEvents["test_event"]
+	assert.Equal(t, closure, registered[0].name)
+	assert.Equal(t, closure+"#2", registered[1].name)
+	assert.Equal(t, "named", registered[2].name)
+	assert.Equal(t, "github.com/braiphub/go-core/eventbus/distributed.namedTestHandler", registered[3].name)
+}
+
+func TestInMemoryHandlerStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewInMemoryHandlerStore(time.Millisecond)
+
+	require.NoError(t, store.MarkSucceeded(ctx, "event", "handler"))
+
+	succeeded, err := store.Succeeded(ctx, "event", "handler")
+	require.NoError(t, err)
+	assert.True(t, succeeded)
+
+	succeeded, err = store.Succeeded(ctx, "event", "other")
+	require.NoError(t, err)
+	assert.False(t, succeeded)
+
+	// expired records are dropped on the next write
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, store.RecordFailure(ctx, HandlerFailure{EventID: "other", FailedAt: time.Now()}))
+
+	succeeded, err = store.Succeeded(ctx, "event", "handler")
+	require.NoError(t, err)
+	assert.False(t, succeeded)
+
+	failures, err := store.Failures(ctx, "other")
+	require.NoError(t, err)
+	assert.Len(t, failures, 1)
+}
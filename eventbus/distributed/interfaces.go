@@ -0,0 +1,39 @@
+package distributed
+
+import (
+	"context"
+
+	"github.com/braiphub/go-core/eventbus"
+)
+
+//go:generate mockgen -source=interfaces.go -destination=interfaces_mock.go -package=distributed . EventBusInterface,PubSubInterface
+
+type EventBusInterface interface {
+	// Register - Handlers func should have signature: (context.Context, EventInterface) error
+	Register(event EventInterface, handler interface{}, opts ...HandlerOption) error
+	RegisterList(eventList map[EventInterface][]interface{}) error
+	StartListen(ctx context.Context) error
+	Publish(ctx context.Context, events ...EventInterface) error
+	Health(ctx context.Context) error
+	Close() error
+}
+
+type EventInterface interface {
+	EventType() string
+}
+
+type HandlerFunc func(ctx context.Context, event EventInterface) error
+
+// SubscriberCallbackFunc handles an event received by the pub/sub, its type is envelope.Type.
+type SubscriberCallbackFunc func(ctx context.Context, envelope eventbus.Envelope, data []byte) error
+
+type PubSubInterface interface {
+	Configure(config Config) error
+	// ListenToEvents delivers the events to callback until ctx is cancelled, then waits up to
+	// Config.ShutdownTimeout for the event being handled. Events failing callback are dead-lettered.
+	ListenToEvents(ctx context.Context, callback SubscriberCallbackFunc) error
+	Publish(ctx context.Context, envelope eventbus.Envelope, data []byte) error
+	// Health returns an error when the pub/sub can't publish, or is listening without a connection.
+	Health(ctx context.Context) error
+	Close() error
+}
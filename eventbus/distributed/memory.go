@@ -0,0 +1,291 @@
+package distributed
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/pkg/errors"
+)
+
+// assert meets contract
+var (
+	_ PubSubInterface = &InMemoryPubSub{}
+	_ DeadLetterQueue = &InMemoryPubSub{}
+)
+
+// InMemoryPubSub is a PubSubInterface keeping the daemon queue in memory. Like the RabbitMQ pub/sub,
+// ListenToEvents handles the events one at a time and the failed ones are dead-lettered instead of
+// retried, see Dead and the DeadLetterQueue methods. It's meant for tests and local development.
+type InMemoryPubSub struct {
+	mu       sync.Mutex
+	config   Config
+	ready    []InMemoryEvent
+	dead     []InMemoryEvent
+	inFlight int
+	notify   chan struct{}
+	closed   bool
+}
+
+// InMemoryEvent is an event published to an InMemoryPubSub.
+type InMemoryEvent struct {
+	ID       string
+	Name     string
+	Envelope eventbus.Envelope
+	Data     []byte
+	// Err is the handling error of a dead-lettered event and DeadAt when it failed.
+	Err    error
+	DeadAt time.Time
+}
+
+func NewInMemoryPubSub() *InMemoryPubSub {
+	return &InMemoryPubSub{
+		notify: make(chan struct{}, 1),
+	}
+}
+
+func (p *InMemoryPubSub) Configure(config Config) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.config = config
+
+	return nil
+}
+
+func (p *InMemoryPubSub) ListenToEvents(ctx context.Context, callback SubscriberCallbackFunc) error {
+	p.mu.Lock()
+	shutdownTimeout := p.config.ShutdownTimeout
+	p.mu.Unlock()
+
+	handlerCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for {
+			event, ok := p.next(ctx)
+			if !ok {
+				return
+			}
+
+			event.Err = callback(handlerCtx, event.Envelope, event.Data)
+
+			p.settle(event)
+		}
+	}()
+
+	select {
+	case <-done:
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		return ErrClosed
+
+	case <-ctx.Done():
+		waitHandling(done, shutdownTimeout, cancel)
+
+		return nil
+	}
+}
+
+func (p *InMemoryPubSub) Publish(ctx context.Context, envelope eventbus.Envelope, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrap(err, "publish")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+
+	p.ready = append(p.ready, InMemoryEvent{
+		ID:       envelope.ID,
+		Name:     envelope.Type,
+		Envelope: envelope,
+		Data:     append([]byte(nil), data...),
+	})
+	p.signal()
+
+	return nil
+}
+
+func (p *InMemoryPubSub) Health(_ context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+
+	return nil
+}
+
+func (p *InMemoryPubSub) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.closed {
+		p.closed = true
+		close(p.notify)
+	}
+
+	return nil
+}
+
+// Pending returns the number of events published and not handled yet.
+func (p *InMemoryPubSub) Pending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.ready) + p.inFlight
+}
+
+// Dead returns the dead-lettered events, in the order they failed.
+func (p *InMemoryPubSub) Dead() []InMemoryEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]InMemoryEvent(nil), p.dead...)
+}
+
+// next waits for an event, it returns false once ctx is done or the pub/sub is closed.
+func (p *InMemoryPubSub) next(ctx context.Context) (InMemoryEvent, bool) {
+	for {
+		p.mu.Lock()
+
+		if p.closed {
+			p.mu.Unlock()
+
+			return InMemoryEvent{}, false
+		}
+
+		if len(p.ready) > 0 {
+			event := p.ready[0]
+			p.ready = p.ready[1:]
+			p.inFlight++
+
+			// wake up the other listeners
+			if len(p.ready) > 0 {
+				p.signal()
+			}
+
+			p.mu.Unlock()
+
+			return event, true
+		}
+
+		p.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return InMemoryEvent{}, false
+		case <-p.notify:
+		}
+	}
+}
+
+func (p *InMemoryPubSub) settle(event InMemoryEvent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.inFlight--
+
+	if event.Err != nil {
+		event.DeadAt = time.Now()
+		p.dead = append(p.dead, event)
+	}
+}
+
+func (p *InMemoryPubSub) List(_ context.Context, filter DeadEventFilter, limit int) ([]DeadEvent, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	events := make([]DeadEvent, 0)
+
+	for _, event := range p.dead {
+		if limit > 0 && len(events) >= limit {
+			break
+		}
+
+		if deadEvent := event.deadEvent(); filter.Match(deadEvent) {
+			events = append(events, deadEvent)
+		}
+	}
+
+	return events, nil
+}
+
+func (p *InMemoryPubSub) Peek(ctx context.Context, id string) (DeadEvent, error) {
+	return peekDeadEvent(ctx, p, id)
+}
+
+func (p *InMemoryPubSub) Replay(_ context.Context, filter DeadEventFilter) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	replayed := p.removeDead(filter, func(event InMemoryEvent) {
+		event.Err, event.DeadAt = nil, time.Time{}
+		p.ready = append(p.ready, event)
+	})
+
+	if replayed > 0 && !p.closed {
+		p.signal()
+	}
+
+	return replayed, nil
+}
+
+func (p *InMemoryPubSub) Purge(_ context.Context, filter DeadEventFilter) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.removeDead(filter, func(InMemoryEvent) {}), nil
+}
+
+// removeDead passes the matching dead events to fn and removes them. It must be called holding p.mu.
+func (p *InMemoryPubSub) removeDead(filter DeadEventFilter, fn func(event InMemoryEvent)) int {
+	kept := p.dead[:0]
+
+	for _, event := range p.dead {
+		if filter.Match(event.deadEvent()) {
+			fn(event)
+
+			continue
+		}
+
+		kept = append(kept, event)
+	}
+
+	removed := len(p.dead) - len(kept)
+	p.dead = kept
+
+	return removed
+}
+
+func (e InMemoryEvent) deadEvent() DeadEvent {
+	return DeadEvent{
+		ID:        e.ID,
+		EventName: e.Name,
+		Envelope:  e.Envelope,
+		Data:      e.Data,
+		Reason:    "rejected",
+		Count:     1,
+		DeadAt:    e.DeadAt,
+	}
+}
+
+// signal must be called holding p.mu.
+func (p *InMemoryPubSub) signal() {
+	select {
+	case p.notify <- struct{}{}:
+	default:
+	}
+}
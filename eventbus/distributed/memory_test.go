@@ -0,0 +1,217 @@
+package distributed
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/braiphub/go-core/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func newTestInMemoryBus(t *testing.T, opts ...Option) (*EventBus, *InMemoryPubSub) {
+	t.Helper()
+
+	logger := log.NewMockLoggerI(gomock.NewController(t))
+	logger.EXPECT().Debug(gomock.Any(), gomock.Any()).AnyTimes()
+	logger.EXPECT().Error(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+	logger.EXPECT().Warn(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+	pubSub := NewInMemoryPubSub()
+
+	bus, err := New("orders", "worker", append([]Option{WithLogger(logger), WithPubSub(pubSub)}, opts...)...)
+	require.NoError(t, err)
+
+	return bus, pubSub
+}
+
+func startListen(t *testing.T, bus *EventBus) (context.CancelFunc, <-chan error) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+
+	go func() { errCh <- bus.StartListen(ctx) }()
+
+	t.Cleanup(cancel)
+
+	return cancel, errCh
+}
+
+func TestEventBus_InMemoryPubSub(t *testing.T) {
+	bus, pubSub := newTestInMemoryBus(t)
+
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+
+	require.NoError(t, bus.Register(&testEventType{}, func(ctx context.Context, event testEventType) error {
+		if event.SampleValue == "fail" {
+			return errors.New("failed")
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		received = append(received, event.SampleValue)
+
+		return nil
+	}))
+
+	// events published before listening wait in the queue
+	require.NoError(t, bus.Publish(context.Background(), &testEventType{SampleValue: "first"}))
+
+	startListen(t, bus)
+
+	require.NoError(t, bus.Publish(
+		context.Background(),
+		&testEventType{SampleValue: "fail"},
+		&testEventType{SampleValue: "second"},
+	))
+
+	assert.Eventually(t, func() bool { return pubSub.Pending() == 0 }, time.Second, time.Millisecond)
+
+	mu.Lock()
+	assert.Equal(t, []string{"first", "second"}, received)
+	mu.Unlock()
+
+	dead := pubSub.Dead()
+	require.Len(t, dead, 1)
+	assert.Equal(t, "test_event", dead[0].Name)
+	assert.JSONEq(t, `{"sample_value":"fail"}`, string(dead[0].Data))
+	assert.ErrorContains(t, dead[0].Err, "failed")
+}
+
+func TestEventBus_InMemoryPubSub_UnregisteredEvent(t *testing.T) {
+	bus, pubSub := newTestInMemoryBus(t)
+
+	startListen(t, bus)
+
+	require.NoError(t, pubSub.Publish(context.Background(), eventbus.Envelope{ID: "1", Type: "unknown"}, []byte(`{}`)))
+
+	assert.Eventually(t, func() bool { return len(pubSub.Dead()) == 1 }, time.Second, time.Millisecond)
+	assert.ErrorIs(t, pubSub.Dead()[0].Err, ErrUnregisteredEvent)
+}
+
+func TestEventBus_StartListen_Shutdown(t *testing.T) {
+	t.Run("waits for the event being handled", func(t *testing.T) {
+		bus, pubSub := newTestInMemoryBus(t)
+		started, release := make(chan struct{}), make(chan struct{})
+
+		require.NoError(t, bus.Register(&testEventType{}, func(ctx context.Context, event testEventType) error {
+			close(started)
+			<-release
+
+			return ctx.Err()
+		}))
+		require.NoError(t, bus.Publish(context.Background(), &testEventType{}))
+
+		cancel, errCh := startListen(t, bus)
+
+		<-started
+		cancel()
+
+		select {
+		case <-errCh:
+			t.Fatal("StartListen returned before the handler")
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		close(release)
+
+		assert.NoError(t, <-errCh)
+		assert.Zero(t, pubSub.Pending())
+		assert.Empty(t, pubSub.Dead())
+	})
+
+	t.Run("cancels the handler after the timeout", func(t *testing.T) {
+		bus, _ := newTestInMemoryBus(t, WithShutdownTimeout(10*time.Millisecond))
+		started, handlerErr := make(chan struct{}), make(chan error, 1)
+
+		require.NoError(t, bus.Register(&testEventType{}, func(ctx context.Context, event testEventType) error {
+			close(started)
+			<-ctx.Done()
+			handlerErr <- ctx.Err()
+
+			return ctx.Err()
+		}))
+		require.NoError(t, bus.Publish(context.Background(), &testEventType{}))
+
+		cancel, errCh := startListen(t, bus)
+
+		<-started
+		cancel()
+
+		assert.NoError(t, <-errCh)
+		assert.ErrorIs(t, <-handlerErr, context.Canceled)
+	})
+}
+
+func TestEventBus_Publish_ContextDone(t *testing.T) {
+	bus, pubSub := newTestInMemoryBus(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.ErrorIs(t, bus.Publish(ctx, &testEventType{}), context.Canceled)
+	assert.Zero(t, pubSub.Pending())
+}
+
+func TestEventBus_Health(t *testing.T) {
+	bus, _ := newTestInMemoryBus(t)
+
+	assert.NoError(t, bus.Health(context.Background()))
+	assert.NoError(t, bus.Close())
+	assert.ErrorIs(t, bus.Health(context.Background()), ErrClosed)
+	assert.ErrorIs(t, bus.Publish(context.Background(), &testEventType{}), ErrClosed)
+}
+
+func TestEventBus_Envelope(t *testing.T) {
+	bus, pubSub := newTestInMemoryBus(t)
+
+	envelopes := make(chan eventbus.Envelope, 2)
+
+	require.NoError(t, bus.Register(&testEventType{}, func(ctx context.Context, event testEventType) error {
+		envelope, ok := eventbus.EnvelopeFromContext(ctx)
+		require.True(t, ok)
+
+		envelopes <- envelope
+
+		// events published while handling are caused by the handled one
+		return bus.Publish(ctx, &otherEventType{})
+	}))
+	require.NoError(t, bus.Register(&otherEventType{}, func(ctx context.Context, event otherEventType) error {
+		envelope, _ := eventbus.EnvelopeFromContext(ctx)
+		envelopes <- envelope
+
+		return nil
+	}))
+
+	startListen(t, bus)
+
+	ctx := eventbus.WithTenantID(eventbus.WithCorrelationID(context.Background(), "request-1"), "tenant-1")
+	require.NoError(t, bus.Publish(ctx, &testEventType{}))
+
+	first, second := <-envelopes, <-envelopes
+
+	assert.Equal(t, "test_event", first.Type)
+	assert.Equal(t, 1, first.Version)
+	assert.Equal(t, "orders", first.Producer)
+	assert.Equal(t, "request-1", first.CorrelationID)
+	assert.Equal(t, "tenant-1", first.TenantID)
+	assert.Empty(t, first.CausationID)
+	assert.WithinDuration(t, time.Now(), first.OccurredAt, time.Second)
+
+	assert.Equal(t, "other_event", second.Type)
+	assert.Equal(t, "request-1", second.CorrelationID)
+	assert.Equal(t, "tenant-1", second.TenantID)
+	assert.Equal(t, first.ID, second.CausationID)
+
+	assert.Eventually(t, func() bool { return pubSub.Pending() == 0 }, time.Second, time.Millisecond)
+}
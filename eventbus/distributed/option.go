@@ -0,0 +1,52 @@
+package distributed
+
+import (
+	"time"
+
+	"github.com/braiphub/go-core/log"
+)
+
+const defaultShutdownTimeout = 30 * time.Second
+
+type Option func(*EventBus)
+
+func WithDefaultConfig(e *EventBus) {
+	e.Config.ShouldDLQUnregistered = true
+	e.Config.ShutdownTimeout = defaultShutdownTimeout
+	e.retryPolicy = RetryPolicy{MaxAttempts: 1}
+}
+
+func WithLogger(logger log.LoggerI) func(bus *EventBus) {
+	return func(bus *EventBus) {
+		bus.logger = logger
+	}
+}
+
+func WithShutdownTimeout(timeout time.Duration) func(bus *EventBus) {
+	return func(bus *EventBus) {
+		bus.Config.ShutdownTimeout = timeout
+	}
+}
+
+// WithPubSub sets the pub/sub transport, e.g. an InMemoryPubSub in tests.
+func WithPubSub(pubSub PubSubInterface) func(bus *EventBus) {
+	return func(bus *EventBus) {
+		bus.pubSub = pubSub
+	}
+}
+
+// WithHandlerStore sets where the handler outcomes are kept, see HandlerStore. There's none by
+// default: every handler runs again on redelivery and no failure is recorded.
+func WithHandlerStore(store HandlerStore) func(bus *EventBus) {
+	return func(bus *EventBus) {
+		bus.handlerStore = store
+	}
+}
+
+// WithRetryPolicy sets the retry policy of the handlers registered without WithHandlerRetry. By
+// default handlers run once.
+func WithRetryPolicy(policy RetryPolicy) func(bus *EventBus) {
+	return func(bus *EventBus) {
+		bus.retryPolicy = policy
+	}
+}
@@ -0,0 +1,486 @@
+package distributed
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/braiphub/go-core/log"
+	"github.com/pkg/errors"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	eventNameHeader = "event_name"
+	prefetchCount   = 10
+	reconnectDelay  = 5 * time.Second
+)
+
+// assert meets contract
+var _ PubSubInterface = &rabbitMQPubSub{}
+
+type rabbitMQPubSub struct {
+	dsn             string
+	serviceName     string
+	daemonName      string
+	exchange        string
+	daemonQueue     string
+	shutdownTimeout time.Duration
+	logger          log.LoggerI
+
+	mu               sync.Mutex
+	closed           bool
+	publisherConn    *amqp091.Connection
+	publisherChannel *amqp091.Channel
+	listening        int
+	consumerConns    map[*amqp091.Connection]struct{}
+}
+
+func WithRabbitMQ(dsn string) func(bus *EventBus) {
+	return func(bus *EventBus) {
+		exchange := fmt.Sprintf("eventbus.%s", bus.Config.ServiceName)
+		daemonQueue := fmt.Sprintf("eventbus.%s.%s", bus.Config.ServiceName, bus.Config.DaemonName)
+
+		r := &rabbitMQPubSub{
+			dsn:           dsn,
+			serviceName:   bus.Config.ServiceName,
+			daemonName:    bus.Config.DaemonName,
+			exchange:      exchange,
+			daemonQueue:   daemonQueue,
+			logger:        bus.logger,
+			consumerConns: make(map[*amqp091.Connection]struct{}),
+		}
+
+		bus.pubSub = r
+	}
+}
+
+func (r *rabbitMQPubSub) Configure(config Config) error {
+	r.shutdownTimeout = config.ShutdownTimeout
+
+	if err := r.declareExchange(); err != nil {
+		return errors.Wrap(err, "declare exchange")
+	}
+
+	return nil
+}
+
+// ListenToEvents consumes the daemon queue, connecting again when the connection drops. Failed
+// events are nacked without requeue, so the queue dead-letters them to the ".dead" queue.
+func (r *rabbitMQPubSub) ListenToEvents(ctx context.Context, callback SubscriberCallbackFunc) error {
+	if err := r.declareDaemonQueue(); err != nil {
+		return errors.Wrap(err, "declare daemon consumer queue")
+	}
+
+	r.mu.Lock()
+	r.listening++
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		r.listening--
+		r.mu.Unlock()
+	}()
+
+	for {
+		err := r.consume(ctx, callback)
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		r.logger.Error("eventbus: consumer stopped, reconnecting", err, log.Any("queue", r.daemonQueue))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// consume handles the deliveries until ctx is cancelled or the connection drops. Deliveries not
+// acked when the connection closes are requeued by the broker.
+func (r *rabbitMQPubSub) consume(ctx context.Context, callback SubscriberCallbackFunc) error {
+	conn, err := amqp091.Dial(r.dsn)
+	if err != nil {
+		return errors.Wrap(err, "connect")
+	}
+
+	r.trackConsumerConn(conn, true)
+	defer r.trackConsumerConn(conn, false)
+	defer conn.Close()
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return errors.Wrap(err, "channel open")
+	}
+
+	if err := channel.Qos(prefetchCount, 0, false); err != nil {
+		return errors.Wrap(err, "set qos")
+	}
+
+	deliveries, err := channel.Consume(r.daemonQueue, "", false, false, false, false, nil)
+	if err != nil {
+		return errors.Wrap(err, "consume")
+	}
+
+	handlerCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for {
+			// an idle queue never closes deliveries, stop taking them as soon as ctx is cancelled
+			select {
+			case <-ctx.Done():
+				return
+
+			case d, ok := <-deliveries:
+				if !ok || ctx.Err() != nil {
+					return
+				}
+
+				r.handleDelivery(handlerCtx, d, callback)
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+		return errors.New("delivery channel closed")
+
+	case <-ctx.Done():
+		waitHandling(done, r.shutdownTimeout, cancel)
+
+		return nil
+	}
+}
+
+func (r *rabbitMQPubSub) handleDelivery(ctx context.Context, d amqp091.Delivery, callback SubscriberCallbackFunc) {
+	envelope := envelopeFromDelivery(d)
+	if envelope.Type == "" {
+		r.logger.Error(
+			"eventbus: discarding message due to unknown event",
+			nil,
+			log.Any("body", string(d.Body)),
+		)
+
+		r.settle(d.Nack(false, false))
+
+		return
+	}
+
+	if err := callback(ctx, envelope, d.Body); err != nil {
+		r.settle(d.Nack(false, false))
+
+		return
+	}
+
+	r.settle(d.Ack(false))
+}
+
+func (r *rabbitMQPubSub) settle(err error) {
+	if err != nil {
+		r.logger.Error("eventbus: settle delivery", err, log.Any("queue", r.daemonQueue))
+	}
+}
+
+func (r *rabbitMQPubSub) trackConsumerConn(conn *amqp091.Connection, add bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if add {
+		r.consumerConns[conn] = struct{}{}
+
+		return
+	}
+
+	delete(r.consumerConns, conn)
+}
+
+// Publish waits for the broker confirmation, or until ctx is done.
+func (r *rabbitMQPubSub) Publish(ctx context.Context, envelope eventbus.Envelope, data []byte) error {
+	confirmation, err := r.publish(ctx, envelope, data)
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "wait publish confirmation")
+	}
+
+	if !acked {
+		return errors.New("event nacked by the broker")
+	}
+
+	return nil
+}
+
+func (r *rabbitMQPubSub) publish(
+	ctx context.Context,
+	envelope eventbus.Envelope,
+	data []byte,
+) (*amqp091.DeferredConfirmation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	channel, err := r.channel()
+	if err != nil {
+		return nil, err
+	}
+
+	confirmation, err := channel.PublishWithDeferredConfirmWithContext(
+		ctx,
+		r.exchange,
+		"event."+envelope.Type,
+		false, // mandatory
+		false, // immediate
+		newPublishing(envelope, data),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "publish")
+	}
+
+	return confirmation, nil
+}
+
+func newPublishing(envelope eventbus.Envelope, data []byte) amqp091.Publishing {
+	headers := amqp091.Table(envelope.Headers())
+	headers[eventNameHeader] = envelope.Type
+
+	return amqp091.Publishing{
+		Headers:       headers,
+		ContentType:   "application/json",
+		DeliveryMode:  amqp091.Persistent,
+		MessageId:     envelope.ID,
+		CorrelationId: envelope.CorrelationID,
+		Type:          envelope.Type,
+		AppId:         envelope.Producer,
+		Timestamp:     envelope.OccurredAt,
+		Body:          data,
+	}
+}
+
+// envelopeFromDelivery decodes the envelope of d, filling it from the message properties for events
+// published without one.
+func envelopeFromDelivery(d amqp091.Delivery) eventbus.Envelope {
+	envelope := eventbus.EnvelopeFromHeaders(d.Headers)
+
+	if envelope.Type == "" {
+		envelope.Type, _ = d.Headers[eventNameHeader].(string)
+	}
+
+	// events published without an id keep it empty, the handler store can't tell them apart
+	if envelope.ID == "" {
+		envelope.ID = d.MessageId
+	}
+
+	if envelope.Version == 0 {
+		envelope.Version = 1
+	}
+
+	if envelope.OccurredAt.IsZero() {
+		envelope.OccurredAt = d.Timestamp
+	}
+
+	if envelope.CorrelationID == "" {
+		envelope.CorrelationID = d.CorrelationId
+	}
+
+	if envelope.Producer == "" {
+		envelope.Producer = d.AppId
+	}
+
+	return envelope
+}
+
+// channel returns the publisher channel, connecting again when it was closed. It must be called
+// holding r.mu.
+func (r *rabbitMQPubSub) channel() (*amqp091.Channel, error) {
+	if r.closed {
+		return nil, ErrClosed
+	}
+
+	if r.publisherChannel != nil && !r.publisherChannel.IsClosed() {
+		return r.publisherChannel, nil
+	}
+
+	if r.publisherConn != nil {
+		_ = r.publisherConn.Close()
+	}
+
+	r.publisherConn, r.publisherChannel = nil, nil
+
+	conn, err := amqp091.Dial(r.dsn)
+	if err != nil {
+		return nil, errors.Wrap(err, "open publisher conn")
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		_ = conn.Close()
+
+		return nil, errors.Wrap(err, "channel open")
+	}
+
+	if err := channel.Confirm(false); err != nil {
+		_ = conn.Close()
+
+		return nil, errors.Wrap(err, "enable publish confirms")
+	}
+
+	r.publisherConn, r.publisherChannel = conn, channel
+
+	return channel, nil
+}
+
+func (r *rabbitMQPubSub) Health(_ context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.listening > 0 && len(r.consumerConns) == 0 {
+		return errors.Wrap(ErrNotConnected, "consumer")
+	}
+
+	for conn := range r.consumerConns {
+		if conn.IsClosed() {
+			return errors.Wrap(ErrNotConnected, "consumer")
+		}
+	}
+
+	if _, err := r.channel(); err != nil {
+		return errors.Wrap(err, "publisher")
+	}
+
+	return nil
+}
+
+func (r *rabbitMQPubSub) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+
+	if r.publisherConn == nil {
+		return nil
+	}
+
+	err := r.publisherConn.Close()
+	r.publisherConn, r.publisherChannel = nil, nil
+
+	if err != nil && !errors.Is(err, amqp091.ErrClosed) {
+		return errors.Wrap(err, "close publisher conn")
+	}
+
+	return nil
+}
+
+func (r *rabbitMQPubSub) declareExchange() error {
+	conn, err := amqp091.Dial(r.dsn)
+	if err != nil {
+		return errors.Wrap(err, "connecting to rabbitmq")
+	}
+	defer conn.Close()
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return errors.Wrap(err, "channel open")
+	}
+	defer channel.Close()
+
+	err = channel.ExchangeDeclare(
+		r.exchange,
+		"topic",
+		true,  // durable
+		false, // auto-delete
+		false, // internal
+		false, // no-wait
+		nil,   // args [amqp-table]
+	)
+	if err != nil {
+		return errors.Wrap(err, "exchange declare")
+	}
+
+	return nil
+}
+
+func (r *rabbitMQPubSub) declareDaemonQueue() error {
+	conn, err := amqp091.Dial(r.dsn)
+	if err != nil {
+		return errors.Wrap(err, "connecting to rabbitmq")
+	}
+	defer conn.Close()
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return errors.Wrap(err, "channel open")
+	}
+	defer channel.Close()
+
+	deadQueueName := fmt.Sprintf("%s.dead", r.daemonQueue)
+
+	normalQueueArgs := amqp091.Table{
+		"x-dead-letter-exchange":    r.exchange,
+		"x-dead-letter-routing-key": deadQueueName,
+		"x-queue-type":              "quorum",
+	}
+
+	deadQueueArgs := amqp091.Table{}
+
+	_, err = channel.QueueDeclare(
+		deadQueueName,
+		true,  // durable
+		false, // auto-delete
+		false, // exclusive
+		false, // no-wait
+		deadQueueArgs,
+	)
+	if err != nil {
+		return errors.Wrap(err, "dead queue declare")
+	}
+	if err := r.bindQueue(channel, deadQueueName, deadQueueName); err != nil {
+		return errors.Wrap(err, "dead queue bind")
+	}
+
+	_, err = channel.QueueDeclare(
+		r.daemonQueue,
+		true,  // durable
+		false, // auto-delete
+		false, // exclusive
+		false, // no-wait
+		normalQueueArgs,
+	)
+	if err != nil {
+		return errors.Wrap(err, "daemon queue declare")
+	}
+	if err := r.bindQueue(channel, r.daemonQueue, "event.#"); err != nil {
+		return errors.Wrap(err, "normal queue bind")
+	}
+
+	return nil
+}
+
+func (r *rabbitMQPubSub) bindQueue(
+	channel *amqp091.Channel,
+	queue string,
+	routingKey string,
+) error {
+	err := channel.QueueBind(
+		queue,
+		routingKey,
+		r.exchange,
+		false, // no-wait
+		nil,   // args [amqp-table]
+	)
+	if err != nil {
+		return errors.Wrap(err, "queue bind")
+	}
+
+	return nil
+}
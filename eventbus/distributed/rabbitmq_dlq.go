@@ -0,0 +1,207 @@
+package distributed
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// assert meets contract
+var _ DeadLetterQueue = &rabbitMQPubSub{}
+
+func (r *rabbitMQPubSub) deadQueue() string {
+	return r.daemonQueue + ".dead"
+}
+
+func (r *rabbitMQPubSub) List(ctx context.Context, filter DeadEventFilter, limit int) ([]DeadEvent, error) {
+	events := make([]DeadEvent, 0)
+
+	err := r.scanDead(ctx, filter, func(_ *amqp091.Channel, _ amqp091.Delivery, event DeadEvent) (bool, error) {
+		events = append(events, event)
+
+		return limit > 0 && len(events) >= limit, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func (r *rabbitMQPubSub) Peek(ctx context.Context, id string) (DeadEvent, error) {
+	return peekDeadEvent(ctx, r, id)
+}
+
+// Replay publishes the matching dead events straight to the daemon queue, so the other daemons of
+// the service don't receive them again.
+func (r *rabbitMQPubSub) Replay(ctx context.Context, filter DeadEventFilter) (int, error) {
+	replayed := 0
+
+	err := r.scanDead(ctx, filter, func(channel *amqp091.Channel, d amqp091.Delivery, _ DeadEvent) (bool, error) {
+		confirmation, err := channel.PublishWithDeferredConfirmWithContext(
+			ctx,
+			"",
+			r.daemonQueue,
+			false, // mandatory
+			false, // immediate
+			amqp091.Publishing{
+				Headers:       replayHeaders(d.Headers),
+				ContentType:   d.ContentType,
+				DeliveryMode:  amqp091.Persistent,
+				MessageId:     d.MessageId,
+				CorrelationId: d.CorrelationId,
+				Type:          d.Type,
+				AppId:         d.AppId,
+				Timestamp:     d.Timestamp,
+				Body:          d.Body,
+			},
+		)
+		if err != nil {
+			return true, errors.Wrap(err, "publish")
+		}
+
+		acked, err := confirmation.WaitContext(ctx)
+		if err != nil {
+			return true, errors.Wrap(err, "wait publish confirmation")
+		}
+
+		if !acked {
+			return true, errors.New("event nacked by the broker")
+		}
+
+		if err := d.Ack(false); err != nil {
+			return true, errors.Wrap(err, "ack dead event")
+		}
+
+		replayed++
+
+		return false, nil
+	})
+
+	return replayed, err
+}
+
+func (r *rabbitMQPubSub) Purge(ctx context.Context, filter DeadEventFilter) (int, error) {
+	purged := 0
+
+	err := r.scanDead(ctx, filter, func(_ *amqp091.Channel, d amqp091.Delivery, _ DeadEvent) (bool, error) {
+		if err := d.Ack(false); err != nil {
+			return true, errors.Wrap(err, "ack dead event")
+		}
+
+		purged++
+
+		return false, nil
+	})
+
+	return purged, err
+}
+
+// scanDead gets the messages the dead queue had when the scan started, passing the matching ones to
+// fn until it stops. Messages fn doesn't ack are requeued when the scan channel closes, keeping
+// their order.
+func (r *rabbitMQPubSub) scanDead(
+	ctx context.Context,
+	filter DeadEventFilter,
+	fn func(channel *amqp091.Channel, d amqp091.Delivery, event DeadEvent) (stop bool, err error),
+) error {
+	conn, err := amqp091.Dial(r.dsn)
+	if err != nil {
+		return errors.Wrap(err, "connecting to rabbitmq")
+	}
+	defer conn.Close()
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return errors.Wrap(err, "channel open")
+	}
+	defer channel.Close()
+
+	if err := channel.Confirm(false); err != nil {
+		return errors.Wrap(err, "enable publish confirms")
+	}
+
+	queue, err := channel.QueueDeclarePassive(r.deadQueue(), true, false, false, false, nil)
+	if err != nil {
+		return errors.Wrap(err, "dead queue declare")
+	}
+
+	for range queue.Messages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		d, ok, err := channel.Get(r.deadQueue(), false)
+		if err != nil {
+			return errors.Wrap(err, "get dead event")
+		}
+
+		if !ok {
+			return nil
+		}
+
+		event := newDeadEvent(d)
+		if !filter.Match(event) {
+			continue
+		}
+
+		stop, err := fn(channel, d, event)
+		if err != nil {
+			return errors.Wrap(err, event.ID)
+		}
+
+		if stop {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func newDeadEvent(d amqp091.Delivery) DeadEvent {
+	envelope := envelopeFromDelivery(d)
+
+	event := DeadEvent{
+		ID:        envelope.ID,
+		EventName: envelope.Type,
+		Envelope:  envelope,
+		Data:      d.Body,
+	}
+
+	// events published without an id are picked by a hash of their payload
+	if event.ID == "" {
+		event.ID = payloadID(d.Body)
+	}
+
+	// the broker keeps the latest death first
+	deaths, _ := d.Headers["x-death"].([]interface{})
+	if len(deaths) == 0 {
+		return event
+	}
+
+	death, _ := deaths[0].(amqp091.Table)
+	event.Reason, _ = death["reason"].(string)
+	event.Queue, _ = death["queue"].(string)
+	event.Count, _ = death["count"].(int64)
+	event.DeadAt, _ = death["time"].(time.Time)
+
+	return event
+}
+
+// replayHeaders drops the dead-lettering headers, the broker adds them again if it dies again.
+func replayHeaders(headers amqp091.Table) amqp091.Table {
+	replay := amqp091.Table{}
+
+	for key, value := range headers {
+		if key == "x-death" || strings.HasPrefix(key, "x-first-death-") || strings.HasPrefix(key, "x-last-death-") {
+			continue
+		}
+
+		replay[key] = value
+	}
+
+	return replay
+}
@@ -0,0 +1,169 @@
+package distributed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_newDeadEvent(t *testing.T) {
+	deadAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	event := newDeadEvent(amqp091.Delivery{
+		MessageId: "1",
+		Headers: amqp091.Table{
+			eventNameHeader: "test_event",
+			"x-death": []interface{}{
+				amqp091.Table{"reason": "expired", "queue": "billing.retry", "count": int64(1), "time": deadAt.Add(time.Hour)},
+				amqp091.Table{"reason": "rejected", "queue": "billing", "count": int64(3), "time": deadAt},
+			},
+		},
+		Body: []byte(`{"sample_value":"x"}`),
+	})
+
+	assert.Equal(t, "1", event.ID)
+	assert.Equal(t, "test_event", event.EventName)
+	assert.Equal(t, []byte(`{"sample_value":"x"}`), event.Data)
+	// the latest death comes first
+	assert.Equal(t, "expired", event.Reason)
+	assert.Equal(t, "billing.retry", event.Queue)
+	assert.Equal(t, int64(1), event.Count)
+	assert.Equal(t, deadAt.Add(time.Hour), event.DeadAt)
+
+	undead := newDeadEvent(amqp091.Delivery{MessageId: "2", Headers: amqp091.Table{eventNameHeader: "test_event"}})
+	assert.Equal(t, "2", undead.ID)
+	assert.Empty(t, undead.Reason)
+	assert.Empty(t, undead.Queue)
+	assert.Zero(t, undead.Count)
+	assert.True(t, undead.DeadAt.IsZero())
+}
+
+// publishDead publishes events to the dead queue of billing as if the broker had dead-lettered them.
+func publishDead(t *testing.T, server *fakeAMQPServer, events ...DeadEvent) {
+	t.Helper()
+
+	conn, err := amqp091.Dial(server.URL())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	channel, err := conn.Channel()
+	require.NoError(t, err)
+	require.NoError(t, channel.Confirm(false))
+
+	for _, event := range events {
+		confirmation, err := channel.PublishWithDeferredConfirmWithContext(
+			context.Background(),
+			"",
+			"billing.dead",
+			false,
+			false,
+			amqp091.Publishing{
+				MessageId: event.ID,
+				Headers: amqp091.Table{
+					eventNameHeader:          event.EventName,
+					"x-first-death-reason":   event.Reason,
+					"x-first-death-queue":    event.Queue,
+					"x-first-death-exchange": "",
+					"x-death": []interface{}{amqp091.Table{
+						"reason": event.Reason,
+						"queue":  event.Queue,
+						"count":  event.Count,
+						"time":   event.DeadAt,
+					}},
+				},
+				Body: event.Data,
+			},
+		)
+		require.NoError(t, err)
+
+		acked, err := confirmation.WaitContext(context.Background())
+		require.NoError(t, err)
+		require.True(t, acked)
+	}
+}
+
+func TestRabbitMQPubSub_DeadLetterQueue(t *testing.T) {
+	server := newFakeAMQPServer(t)
+	server.declare("billing")
+	server.declare("billing.dead")
+
+	deadAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	dead := func(id string, name string) DeadEvent {
+		return DeadEvent{
+			ID:        id,
+			EventName: name,
+			Data:      []byte(id),
+			Reason:    "rejected",
+			Queue:     "billing",
+			Count:     1,
+			DeadAt:    deadAt,
+		}
+	}
+
+	publishDead(t, server, dead("1", "test_event"), dead("2", "other_event"), dead("3", "test_event"))
+
+	pubSub := &rabbitMQPubSub{dsn: server.URL(), daemonQueue: "billing"}
+	ctx := context.Background()
+
+	events, err := pubSub.List(ctx, DeadEventFilter{}, 0)
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, "1", events[0].ID)
+	assert.Equal(t, "test_event", events[0].EventName)
+	assert.Equal(t, []byte("1"), events[0].Data)
+	assert.Equal(t, "rejected", events[0].Reason)
+	assert.Equal(t, "billing", events[0].Queue)
+	assert.Equal(t, int64(1), events[0].Count)
+	assert.True(t, deadAt.Equal(events[0].DeadAt))
+
+	// listing gets the messages without acking them, closing the channel requeues them in order
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"1", "2", "3"}, server.ready("billing.dead"))
+	}, time.Second, time.Millisecond)
+
+	limited, err := pubSub.List(ctx, DeadEventFilter{EventNames: []string{"test_event"}}, 1)
+	require.NoError(t, err)
+	require.Len(t, limited, 1)
+	assert.Equal(t, "1", limited[0].ID)
+
+	event, err := pubSub.Peek(ctx, "2")
+	require.NoError(t, err)
+	assert.Equal(t, "other_event", event.EventName)
+
+	_, err = pubSub.Peek(ctx, "4")
+	require.ErrorIs(t, err, ErrDeadEventNotFound)
+
+	replayed, err := pubSub.Replay(ctx, DeadEventFilter{EventNames: []string{"test_event"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, replayed)
+
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"2"}, server.ready("billing.dead"))
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"1", "3"}, server.ready("billing"))
+
+	purged, err := pubSub.Purge(ctx, DeadEventFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, purged)
+
+	assert.Eventually(t, func() bool { return len(server.ready("billing.dead")) == 0 }, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"1", "3"}, server.ready("billing"))
+}
+
+func Test_replayHeaders(t *testing.T) {
+	headers := amqp091.Table{
+		eventNameHeader:          "test_event",
+		"x-death":                []interface{}{amqp091.Table{"reason": "rejected"}},
+		"x-first-death-reason":   "rejected",
+		"x-last-death-queue":     "billing",
+		"x-delivery-count":       int64(2),
+		"x-first-death-exchange": "",
+	}
+
+	assert.Equal(t, amqp091.Table{eventNameHeader: "test_event", "x-delivery-count": int64(2)}, replayHeaders(headers))
+	assert.Len(t, headers, 6, "the delivery headers are left untouched")
+}
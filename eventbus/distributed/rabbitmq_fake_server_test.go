@@ -0,0 +1,627 @@
+package distributed
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// fakeAMQPServer speaks just enough AMQP 0-9-1 to consume and inspect the dead letter queue against
+// it: channels, queue declares, confirmed publishes to the default exchange, consumers, gets, acks
+// and rejects. Exchange declares and binds are accepted but messages are only routed by queue name.
+// Unacked messages are requeued in their original order when their channel or connection closes.
+type fakeAMQPServer struct {
+	listener net.Listener
+
+	mu        sync.Mutex
+	conns     map[*fakeAMQPConn]struct{}
+	queues    map[string][]*fakeAMQPMessage
+	consumers map[string][]*fakeAMQPConsumer
+	nextTag   int
+}
+
+type fakeAMQPConsumer struct {
+	conn      *fakeAMQPConn
+	channelID uint16
+	channel   *fakeAMQPChannel
+	tag       string
+}
+
+// fakeAMQPDelivery is a message pushed to a consumer, written once s.mu is released.
+type fakeAMQPDelivery struct {
+	consumer *fakeAMQPConsumer
+	tag      uint64
+	message  *fakeAMQPMessage
+}
+
+type fakeAMQPMessage struct {
+	routingKey string
+	properties []byte
+	body       []byte
+}
+
+type fakeAMQPConn struct {
+	server *fakeAMQPServer
+	conn   net.Conn
+
+	writeMu sync.Mutex
+	once    sync.Once
+
+	// guarded by server.mu
+	channels map[uint16]*fakeAMQPChannel
+}
+
+type fakeAMQPChannel struct {
+	confirm   bool
+	published uint64
+	delivered uint64
+	unacked   map[uint64]fakeAMQPUnacked
+
+	// publish being assembled from its content frames
+	pending  *fakeAMQPMessage
+	bodySize uint64
+}
+
+type fakeAMQPUnacked struct {
+	queue   string
+	message *fakeAMQPMessage
+}
+
+func newFakeAMQPServer(t *testing.T) *fakeAMQPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &fakeAMQPServer{
+		listener:  listener,
+		conns:     make(map[*fakeAMQPConn]struct{}),
+		queues:    make(map[string][]*fakeAMQPMessage),
+		consumers: make(map[string][]*fakeAMQPConsumer),
+	}
+
+	go server.accept()
+
+	t.Cleanup(func() {
+		_ = listener.Close()
+
+		server.mu.Lock()
+		conns := make([]*fakeAMQPConn, 0, len(server.conns))
+		for conn := range server.conns {
+			conns = append(conns, conn)
+		}
+		server.mu.Unlock()
+
+		for _, conn := range conns {
+			conn.close()
+		}
+	})
+
+	return server
+}
+
+func (s *fakeAMQPServer) URL() string {
+	return "amqp://guest:guest@" + s.listener.Addr().String() + "/"
+}
+
+// declare creates an empty queue.
+func (s *fakeAMQPServer) declare(queue string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.queues[queue]; !ok {
+		s.queues[queue] = nil
+	}
+}
+
+// ready returns the bodies of the messages waiting in queue.
+func (s *fakeAMQPServer) ready(queue string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var bodies []string
+
+	for _, message := range s.queues[queue] {
+		bodies = append(bodies, string(message.body))
+	}
+
+	return bodies
+}
+
+// consumerCount returns the number of consumers of queue.
+func (s *fakeAMQPServer) consumerCount(queue string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.consumers[queue])
+}
+
+func (s *fakeAMQPServer) accept() {
+	for {
+		netConn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		conn := &fakeAMQPConn{server: s, conn: netConn, channels: make(map[uint16]*fakeAMQPChannel)}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		go conn.serve()
+	}
+}
+
+func (c *fakeAMQPConn) close() {
+	c.once.Do(func() {
+		_ = c.conn.Close()
+
+		s := c.server
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.conns, c)
+
+		for _, channel := range c.channels {
+			s.closeChannel(channel)
+		}
+	})
+}
+
+func (c *fakeAMQPConn) serve() {
+	defer c.close()
+
+	reader := bufio.NewReader(c.conn)
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return
+	}
+
+	// connection.start: version 0-9, no server properties
+	c.writeMethod(0, 10, 10, func(w *fakeAMQPWriter) {
+		w.octet(0)
+		w.octet(9)
+		w.long(0)
+		w.longstr("PLAIN")
+		w.longstr("en_US")
+	})
+
+	for {
+		frameType, channelID, payload, err := readFakeAMQPFrame(reader)
+		if err != nil {
+			return
+		}
+
+		if !c.handleFrame(frameType, channelID, payload) {
+			return
+		}
+	}
+}
+
+func (c *fakeAMQPConn) handleFrame(frameType byte, channelID uint16, payload []byte) bool {
+	switch frameType {
+	case 1: // method
+		r := &fakeAMQPReader{buf: payload}
+
+		return c.handleMethod(channelID, r.short(), r.short(), r)
+
+	case 2: // content header
+		r := &fakeAMQPReader{buf: payload}
+		r.short() // class
+		r.short() // weight
+		size := r.longlong()
+
+		c.server.mu.Lock()
+		channel := c.channels[channelID]
+		channel.pending.properties = append([]byte(nil), r.rest()...)
+		channel.bodySize = size
+		c.server.mu.Unlock()
+
+		if size == 0 {
+			c.publish(channelID)
+		}
+
+	case 3: // content body
+		c.server.mu.Lock()
+		channel := c.channels[channelID]
+		channel.pending.body = append(channel.pending.body, payload...)
+		complete := uint64(len(channel.pending.body)) >= channel.bodySize
+		c.server.mu.Unlock()
+
+		if complete {
+			c.publish(channelID)
+		}
+	}
+
+	return true
+}
+
+//nolint:cyclop,funlen
+func (c *fakeAMQPConn) handleMethod(channelID uint16, class uint16, method uint16, r *fakeAMQPReader) bool {
+	s := c.server
+
+	switch {
+	case class == 10 && method == 11: // connection.start-ok
+		c.writeMethod(0, 10, 30, func(w *fakeAMQPWriter) {
+			w.short(2047)
+			w.long(131072)
+			w.short(0)
+		})
+
+	case class == 10 && method == 31: // connection.tune-ok
+
+	case class == 10 && method == 40: // connection.open
+		c.writeMethod(0, 10, 41, func(w *fakeAMQPWriter) { w.shortstr("") })
+
+	case class == 10 && method == 50: // connection.close
+		c.writeMethod(0, 10, 51, nil)
+
+		return false
+
+	case class == 20 && method == 10: // channel.open
+		s.mu.Lock()
+		c.channels[channelID] = &fakeAMQPChannel{unacked: make(map[uint64]fakeAMQPUnacked)}
+		s.mu.Unlock()
+
+		c.writeMethod(channelID, 20, 11, func(w *fakeAMQPWriter) { w.longstr("") })
+
+	case class == 20 && method == 40: // channel.close
+		s.mu.Lock()
+		if channel, ok := c.channels[channelID]; ok {
+			s.closeChannel(channel)
+			delete(c.channels, channelID)
+		}
+		s.mu.Unlock()
+
+		c.writeMethod(channelID, 20, 41, nil)
+
+	case class == 40 && method == 10: // exchange.declare
+		c.writeMethod(channelID, 40, 11, nil)
+
+	case class == 50 && method == 10: // queue.declare
+		r.short()
+		name := r.shortstr()
+
+		s.mu.Lock()
+		if _, ok := s.queues[name]; !ok {
+			s.queues[name] = nil
+		}
+
+		messages := len(s.queues[name])
+		s.mu.Unlock()
+
+		c.writeMethod(channelID, 50, 11, func(w *fakeAMQPWriter) {
+			w.shortstr(name)
+			w.long(uint32(messages)) //nolint:gosec
+			w.long(0)
+		})
+
+	case class == 50 && method == 20: // queue.bind
+		c.writeMethod(channelID, 50, 21, nil)
+
+	case class == 60 && method == 10: // basic.qos
+		c.writeMethod(channelID, 60, 11, nil)
+
+	case class == 60 && method == 20: // basic.consume
+		r.short()
+		queue, tag := r.shortstr(), r.shortstr()
+
+		s.mu.Lock()
+		if tag == "" {
+			s.nextTag++
+			tag = fmt.Sprintf("ctag-%d", s.nextTag)
+		}
+
+		consumer := &fakeAMQPConsumer{conn: c, channelID: channelID, channel: c.channels[channelID], tag: tag}
+		s.consumers[queue] = append(s.consumers[queue], consumer)
+		s.mu.Unlock()
+
+		c.writeMethod(channelID, 60, 21, func(w *fakeAMQPWriter) { w.shortstr(tag) })
+		s.dispatch(queue)
+
+	case class == 60 && method == 70: // basic.get
+		r.short()
+		queue := r.shortstr()
+
+		s.mu.Lock()
+		var (
+			message *fakeAMQPMessage
+			tag     uint64
+			count   int
+		)
+
+		if messages := s.queues[queue]; len(messages) > 0 {
+			message = messages[0]
+			s.queues[queue] = messages[1:]
+			count = len(messages) - 1
+
+			channel := c.channels[channelID]
+			channel.delivered++
+			tag = channel.delivered
+			channel.unacked[tag] = fakeAMQPUnacked{queue: queue, message: message}
+		}
+		s.mu.Unlock()
+
+		if message == nil {
+			c.writeMethod(channelID, 60, 72, func(w *fakeAMQPWriter) { w.shortstr("") })
+
+			break
+		}
+
+		c.writeMethod(channelID, 60, 71, func(w *fakeAMQPWriter) {
+			w.longlong(tag)
+			w.octet(0)
+			w.shortstr("")
+			w.shortstr(message.routingKey)
+			w.long(uint32(count)) //nolint:gosec
+		}, message)
+
+	case class == 60 && method == 40: // basic.publish
+		r.short()
+		r.shortstr() // exchange, only the default one is supported
+		routingKey := r.shortstr()
+
+		s.mu.Lock()
+		c.channels[channelID].pending = &fakeAMQPMessage{routingKey: routingKey}
+		s.mu.Unlock()
+
+	case class == 60 && method == 80: // basic.ack
+		tag := r.longlong()
+
+		s.mu.Lock()
+		delete(c.channels[channelID].unacked, tag)
+		s.mu.Unlock()
+
+	case class == 60 && (method == 90 || method == 120): // basic.reject, basic.nack
+		tag := r.longlong()
+		bits := r.octet()
+		requeue := bits&1 != 0
+
+		if method == 120 {
+			requeue = bits&0b10 != 0
+		}
+
+		s.mu.Lock()
+		channel := c.channels[channelID]
+		unacked, ok := channel.unacked[tag]
+		if ok && requeue {
+			s.queues[unacked.queue] = append([]*fakeAMQPMessage{unacked.message}, s.queues[unacked.queue]...)
+		}
+		delete(channel.unacked, tag)
+		s.mu.Unlock()
+
+		if ok && requeue {
+			s.dispatch(unacked.queue)
+		}
+
+	case class == 85 && method == 10: // confirm.select
+		s.mu.Lock()
+		c.channels[channelID].confirm = true
+		s.mu.Unlock()
+
+		c.writeMethod(channelID, 85, 11, nil)
+	}
+
+	return true
+}
+
+func (c *fakeAMQPConn) publish(channelID uint16) {
+	s := c.server
+
+	s.mu.Lock()
+	channel := c.channels[channelID]
+	message := channel.pending
+	channel.pending = nil
+
+	if _, ok := s.queues[message.routingKey]; ok {
+		s.queues[message.routingKey] = append(s.queues[message.routingKey], message)
+	}
+
+	if channel.confirm {
+		channel.published++
+	}
+
+	confirm, tag := channel.confirm, channel.published
+	s.mu.Unlock()
+
+	if confirm {
+		c.writeMethod(channelID, 60, 80, func(w *fakeAMQPWriter) {
+			w.longlong(tag)
+			w.octet(0)
+		})
+	}
+
+	s.dispatch(message.routingKey)
+}
+
+// dispatch pushes the ready messages of queue to its consumers in turn.
+func (s *fakeAMQPServer) dispatch(queue string) {
+	s.mu.Lock()
+
+	var deliveries []fakeAMQPDelivery
+
+	for consumers := s.consumers[queue]; len(consumers) > 0 && len(s.queues[queue]) > 0; {
+		consumer := consumers[len(deliveries)%len(consumers)]
+		message := s.queues[queue][0]
+		s.queues[queue] = s.queues[queue][1:]
+
+		consumer.channel.delivered++
+		tag := consumer.channel.delivered
+		consumer.channel.unacked[tag] = fakeAMQPUnacked{queue: queue, message: message}
+
+		deliveries = append(deliveries, fakeAMQPDelivery{consumer: consumer, tag: tag, message: message})
+	}
+	s.mu.Unlock()
+
+	for _, delivery := range deliveries {
+		delivery.consumer.conn.writeMethod(delivery.consumer.channelID, 60, 60, func(w *fakeAMQPWriter) { // basic.deliver
+			w.shortstr(delivery.consumer.tag)
+			w.longlong(delivery.tag)
+			w.octet(0)
+			w.shortstr("")
+			w.shortstr(delivery.message.routingKey)
+		}, delivery.message)
+	}
+}
+
+// closeChannel cancels the consumers of channel and requeues its unacked messages in front of their
+// queues, keeping the order they were delivered in. It must hold s.mu.
+func (s *fakeAMQPServer) closeChannel(channel *fakeAMQPChannel) {
+	for queue, consumers := range s.consumers {
+		kept := consumers[:0]
+
+		for _, consumer := range consumers {
+			if consumer.channel != channel {
+				kept = append(kept, consumer)
+			}
+		}
+
+		s.consumers[queue] = kept
+	}
+
+	tags := make([]uint64, 0, len(channel.unacked))
+	for tag := range channel.unacked {
+		tags = append(tags, tag)
+	}
+
+	sort.Slice(tags, func(i, j int) bool { return tags[i] > tags[j] })
+
+	for _, tag := range tags {
+		unacked := channel.unacked[tag]
+		s.queues[unacked.queue] = append([]*fakeAMQPMessage{unacked.message}, s.queues[unacked.queue]...)
+	}
+
+	channel.unacked = map[uint64]fakeAMQPUnacked{}
+}
+
+// writeMethod writes a method frame, followed by the content frames of message when given.
+func (c *fakeAMQPConn) writeMethod(
+	channelID uint16,
+	class uint16,
+	method uint16,
+	args func(w *fakeAMQPWriter),
+	message ...*fakeAMQPMessage,
+) {
+	w := &fakeAMQPWriter{}
+	w.short(class)
+	w.short(method)
+
+	if args != nil {
+		args(w)
+	}
+
+	var frames bytes.Buffer
+
+	writeFakeAMQPFrame(&frames, 1, channelID, w.buf.Bytes())
+
+	for _, m := range message {
+		header := &fakeAMQPWriter{}
+		header.short(60)
+		header.short(0)
+		header.longlong(uint64(len(m.body)))
+		header.buf.Write(m.properties)
+
+		writeFakeAMQPFrame(&frames, 2, channelID, header.buf.Bytes())
+
+		if len(m.body) > 0 {
+			writeFakeAMQPFrame(&frames, 3, channelID, m.body)
+		}
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	_, _ = c.conn.Write(frames.Bytes())
+}
+
+func writeFakeAMQPFrame(w *bytes.Buffer, frameType byte, channelID uint16, payload []byte) {
+	w.WriteByte(frameType)
+	_ = binary.Write(w, binary.BigEndian, channelID)
+	_ = binary.Write(w, binary.BigEndian, uint32(len(payload))) //nolint:gosec
+	w.Write(payload)
+	w.WriteByte(0xCE)
+}
+
+func readFakeAMQPFrame(r *bufio.Reader) (byte, uint16, []byte, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(header[3:])+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, 0, nil, err
+	}
+
+	return header[0], binary.BigEndian.Uint16(header[1:3]), payload[:len(payload)-1], nil
+}
+
+type fakeAMQPReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *fakeAMQPReader) octet() byte {
+	v := r.buf[r.pos]
+	r.pos++
+
+	return v
+}
+
+func (r *fakeAMQPReader) short() uint16 {
+	v := binary.BigEndian.Uint16(r.buf[r.pos:])
+	r.pos += 2
+
+	return v
+}
+
+func (r *fakeAMQPReader) longlong() uint64 {
+	v := binary.BigEndian.Uint64(r.buf[r.pos:])
+	r.pos += 8
+
+	return v
+}
+
+func (r *fakeAMQPReader) shortstr() string {
+	size := int(r.octet())
+	v := string(r.buf[r.pos : r.pos+size])
+	r.pos += size
+
+	return v
+}
+
+func (r *fakeAMQPReader) rest() []byte {
+	return r.buf[r.pos:]
+}
+
+type fakeAMQPWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *fakeAMQPWriter) octet(v byte) { w.buf.WriteByte(v) }
+
+func (w *fakeAMQPWriter) short(v uint16) { _ = binary.Write(&w.buf, binary.BigEndian, v) }
+
+func (w *fakeAMQPWriter) long(v uint32) { _ = binary.Write(&w.buf, binary.BigEndian, v) }
+
+func (w *fakeAMQPWriter) longlong(v uint64) { _ = binary.Write(&w.buf, binary.BigEndian, v) }
+
+func (w *fakeAMQPWriter) shortstr(v string) {
+	w.octet(byte(len(v)))
+	w.buf.WriteString(v)
+}
+
+func (w *fakeAMQPWriter) longstr(v string) {
+	w.long(uint32(len(v))) //nolint:gosec
+	w.buf.WriteString(v)
+}
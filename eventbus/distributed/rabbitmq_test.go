@@ -0,0 +1,146 @@
+package distributed
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingAcknowledger counts how the deliveries were settled.
+type countingAcknowledger struct {
+	acked  int
+	nacked int
+}
+
+func (a *countingAcknowledger) Ack(uint64, bool) error {
+	a.acked++
+
+	return nil
+}
+
+func (a *countingAcknowledger) Nack(uint64, bool, bool) error {
+	a.nacked++
+
+	return nil
+}
+
+func (a *countingAcknowledger) Reject(uint64, bool) error {
+	a.nacked++
+
+	return nil
+}
+
+func Test_envelopeFromDelivery(t *testing.T) {
+	envelope := envelopeFromDelivery(amqp091.Delivery{
+		MessageId: "1",
+		AppId:     "billing",
+		Headers:   amqp091.Table{eventNameHeader: "test_event"},
+		Body:      []byte(`{}`),
+	})
+	assert.Equal(t, "1", envelope.ID)
+	assert.Equal(t, "test_event", envelope.Type)
+	assert.Equal(t, "billing", envelope.Producer)
+	assert.Equal(t, 1, envelope.Version)
+
+	// no id is made up for events published without one
+	envelope = envelopeFromDelivery(amqp091.Delivery{Headers: amqp091.Table{eventNameHeader: "test_event"}, Body: []byte(`{}`)})
+	assert.Empty(t, envelope.ID)
+}
+
+func TestRabbitMQPubSub_handleDeliveryWithoutID(t *testing.T) {
+	bus, _ := newTestInMemoryBus(t)
+	calls := 0
+
+	require.NoError(t, bus.Register(&testEventType{}, func(ctx context.Context, event testEventType) error {
+		calls++
+
+		return nil
+	}, WithHandlerName("handler")))
+
+	pubSub := &rabbitMQPubSub{logger: bus.logger, daemonQueue: "billing"}
+	acknowledger := &countingAcknowledger{}
+
+	// distinct events published without an id, e.g. by with_dlq_backup, may share their body
+	for range 2 {
+		pubSub.handleDelivery(context.Background(), amqp091.Delivery{
+			Acknowledger: acknowledger,
+			Headers:      amqp091.Table{eventNameHeader: "test_event"},
+			Body:         []byte(`{"sample_value":"same"}`),
+		}, bus.receivedEventFromPubSubHandler)
+	}
+
+	assert.Equal(t, 2, calls, "the second event was skipped as already handled")
+	assert.Equal(t, 2, acknowledger.acked)
+	assert.Zero(t, acknowledger.nacked)
+
+	// the dead letter queue still picks them by their payload
+	dead := newDeadEvent(amqp091.Delivery{
+		Headers: amqp091.Table{eventNameHeader: "test_event"},
+		Body:    []byte(`{"sample_value":"same"}`),
+	})
+	assert.Equal(t, payloadID([]byte(`{"sample_value":"same"}`)), dead.ID)
+}
+
+func TestRabbitMQPubSub_ListenToEventsShutdown(t *testing.T) {
+	bus, _ := newTestInMemoryBus(t)
+	server := newFakeAMQPServer(t)
+
+	// no shutdown timeout: it waits for the in-flight handler however long it takes
+	pubSub := &rabbitMQPubSub{
+		dsn:           server.URL(),
+		daemonQueue:   "billing",
+		logger:        bus.logger,
+		consumerConns: make(map[*amqp091.Connection]struct{}),
+	}
+
+	handled := make(chan string, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+
+	go func() {
+		done <- pubSub.ListenToEvents(ctx, func(_ context.Context, envelope eventbus.Envelope, _ []byte) error {
+			handled <- envelope.ID
+
+			return nil
+		})
+	}()
+
+	require.Eventually(t, func() bool { return server.consumerCount("billing") == 1 }, 5*time.Second, time.Millisecond)
+
+	conn, err := amqp091.Dial(server.URL())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	channel, err := conn.Channel()
+	require.NoError(t, err)
+	require.NoError(t, channel.PublishWithContext(ctx, "", "billing", false, false, amqp091.Publishing{
+		MessageId: "1",
+		Headers:   amqp091.Table{eventNameHeader: "test_event"},
+		Body:      []byte(`{}`),
+	}))
+
+	select {
+	case id := <-handled:
+		assert.Equal(t, "1", id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the event wasn't handled")
+	}
+
+	// the queue is idle now, no delivery comes to notice the cancellation
+	cancel()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("ListenToEvents didn't return on an idle queue")
+	}
+
+	assert.Empty(t, server.ready("billing"))
+	assert.Zero(t, server.consumerCount("billing"))
+}
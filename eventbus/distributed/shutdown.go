@@ -0,0 +1,25 @@
+package distributed
+
+import (
+	"context"
+	"time"
+)
+
+// waitHandling waits for done up to timeout, then cancels the handler context and gives up on it: an
+// event it didn't settle is delivered again. A zero timeout waits indefinitely.
+func waitHandling(done <-chan struct{}, timeout time.Duration, cancel context.CancelFunc) {
+	if timeout <= 0 {
+		<-done
+
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		cancel()
+	}
+}
@@ -0,0 +1,259 @@
+package eventbus
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/braiphub/go-core/trace"
+	"github.com/google/uuid"
+)
+
+// Envelope headers, set next to the trace context ones.
+const (
+	HeaderEventID       = "event_id"
+	HeaderEventType     = "event_type"
+	HeaderEventVersion  = "event_version"
+	HeaderOccurredAt    = "occurred_at"
+	HeaderProducer      = "producer"
+	HeaderCorrelationID = "correlation_id"
+	HeaderCausationID   = "causation_id"
+	HeaderTenantID      = "tenant_id"
+	HeaderOrigin        = "origin"
+)
+
+const defaultEventVersion = 1
+
+type (
+	envelopeContextKey      struct{}
+	correlationIDContextKey struct{}
+	tenantIDContextKey      struct{}
+)
+
+// Envelope carries the metadata of an event. It's created on publish from the publishing context,
+// handlers get it with EnvelopeFromContext.
+type Envelope struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	Version    int       `json:"version"`
+	OccurredAt time.Time `json:"occurred_at"`
+	// Producer is the service that published the event.
+	Producer string `json:"producer,omitempty"`
+	// CorrelationID is shared by every event of a request, CausationID is the ID of the event being
+	// handled when this one was published.
+	CorrelationID string            `json:"correlation_id,omitempty"`
+	CausationID   string            `json:"causation_id,omitempty"`
+	TraceContext  map[string]string `json:"trace_context,omitempty"`
+	TenantID      string            `json:"tenant_id,omitempty"`
+	// Origin marks the events relayed between buses, e.g. by a bridge, so they aren't relayed back.
+	Origin string `json:"origin,omitempty"`
+}
+
+// Versioned events set the version of their envelope, it defaults to 1.
+type Versioned interface {
+	EventVersion() int
+}
+
+// NewEnvelope creates the envelope of an event published with ctx. The correlation and tenant IDs
+// come from ctx (see WithCorrelationID and WithTenantID), or from the envelope of the event being
+// handled, which is also the cause of the new one. Without a correlation ID the event starts a new
+// correlation with its own ID.
+func NewEnvelope(ctx context.Context, eventType string, version int, producer string) Envelope {
+	envelope := Envelope{
+		ID:            uuid.NewString(),
+		Type:          eventType,
+		Version:       version,
+		OccurredAt:    time.Now().UTC(),
+		Producer:      producer,
+		CorrelationID: CorrelationIDFromContext(ctx),
+		TenantID:      TenantIDFromContext(ctx),
+	}
+
+	if envelope.Version <= 0 {
+		envelope.Version = defaultEventVersion
+	}
+
+	if parent, ok := EnvelopeFromContext(ctx); ok {
+		envelope.CausationID = parent.ID
+
+		if envelope.CorrelationID == "" {
+			envelope.CorrelationID = parent.CorrelationID
+		}
+
+		if envelope.TenantID == "" {
+			envelope.TenantID = parent.TenantID
+		}
+	}
+
+	if envelope.CorrelationID == "" {
+		envelope.CorrelationID = envelope.ID
+	}
+
+	carrier := make(map[string]any)
+	trace.Inject(ctx, carrier)
+
+	for key, value := range carrier {
+		if s, ok := value.(string); ok {
+			if envelope.TraceContext == nil {
+				envelope.TraceContext = make(map[string]string)
+			}
+
+			envelope.TraceContext[key] = s
+		}
+	}
+
+	return envelope
+}
+
+// VersionOf returns the version of event, see Versioned.
+func VersionOf(event any) int {
+	if versioned, ok := event.(Versioned); ok {
+		return versioned.EventVersion()
+	}
+
+	return defaultEventVersion
+}
+
+// ContextWithEnvelope returns a copy of ctx carrying the envelope of the event being handled, with
+// its correlation and tenant IDs.
+func ContextWithEnvelope(ctx context.Context, envelope Envelope) context.Context {
+	ctx = context.WithValue(ctx, envelopeContextKey{}, envelope)
+
+	if envelope.CorrelationID != "" {
+		ctx = WithCorrelationID(ctx, envelope.CorrelationID)
+	}
+
+	if envelope.TenantID != "" {
+		ctx = WithTenantID(ctx, envelope.TenantID)
+	}
+
+	return ctx
+}
+
+// ExtractEnvelope is ContextWithEnvelope for events received from another process: ctx also carries
+// the remote span context of the envelope.
+func ExtractEnvelope(ctx context.Context, envelope Envelope) context.Context {
+	if len(envelope.TraceContext) > 0 {
+		carrier := make(map[string]any, len(envelope.TraceContext))
+		for key, value := range envelope.TraceContext {
+			carrier[key] = value
+		}
+
+		ctx = trace.Extract(ctx, carrier)
+	}
+
+	return ContextWithEnvelope(ctx, envelope)
+}
+
+// EnvelopeFromContext returns the envelope of the event being handled.
+func EnvelopeFromContext(ctx context.Context) (Envelope, bool) {
+	if ctx == nil {
+		return Envelope{}, false
+	}
+
+	envelope, ok := ctx.Value(envelopeContextKey{}).(Envelope)
+
+	return envelope, ok
+}
+
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDContextKey{}, correlationID)
+}
+
+func CorrelationIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	correlationID, _ := ctx.Value(correlationIDContextKey{}).(string)
+
+	return correlationID
+}
+
+func WithTenantID(ctx context.Context, tenantID string) context.Context {
+	return context.WithValue(ctx, tenantIDContextKey{}, tenantID)
+}
+
+func TenantIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	tenantID, _ := ctx.Value(tenantIDContextKey{}).(string)
+
+	return tenantID
+}
+
+// Headers encodes the envelope as message headers, e.g. amqp tables.
+func (e Envelope) Headers() map[string]any {
+	headers := map[string]any{
+		HeaderEventID:      e.ID,
+		HeaderEventType:    e.Type,
+		HeaderEventVersion: strconv.Itoa(e.Version),
+		HeaderOccurredAt:   e.OccurredAt.Format(time.RFC3339Nano),
+	}
+
+	optional := map[string]string{
+		HeaderProducer:      e.Producer,
+		HeaderCorrelationID: e.CorrelationID,
+		HeaderCausationID:   e.CausationID,
+		HeaderTenantID:      e.TenantID,
+		HeaderOrigin:        e.Origin,
+	}
+
+	for key, value := range optional {
+		if value != "" {
+			headers[key] = value
+		}
+	}
+
+	for key, value := range e.TraceContext {
+		headers[key] = value
+	}
+
+	return headers
+}
+
+// EnvelopeFromHeaders decodes an envelope encoded by Headers. Messages published without it return
+// an envelope with the zero value fields.
+func EnvelopeFromHeaders(headers map[string]any) Envelope {
+	header := func(key string) string {
+		switch value := headers[key].(type) {
+		case string:
+			return value
+		case []byte:
+			return string(value)
+		default:
+			return ""
+		}
+	}
+
+	envelope := Envelope{
+		ID:            header(HeaderEventID),
+		Type:          header(HeaderEventType),
+		Producer:      header(HeaderProducer),
+		CorrelationID: header(HeaderCorrelationID),
+		CausationID:   header(HeaderCausationID),
+		TenantID:      header(HeaderTenantID),
+		Origin:        header(HeaderOrigin),
+	}
+
+	envelope.Version, _ = strconv.Atoi(header(HeaderEventVersion))
+	envelope.OccurredAt, _ = time.Parse(time.RFC3339Nano, header(HeaderOccurredAt))
+
+	// keep only the fields known by the propagator
+	carrier := make(map[string]any)
+	trace.Inject(trace.Extract(context.Background(), headers), carrier)
+
+	for key, value := range carrier {
+		if s, ok := value.(string); ok {
+			if envelope.TraceContext == nil {
+				envelope.TraceContext = make(map[string]string)
+			}
+
+			envelope.TraceContext[key] = s
+		}
+	}
+
+	return envelope
+}
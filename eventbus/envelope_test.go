@@ -0,0 +1,73 @@
+package eventbus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type versionedEvent struct{}
+
+func (versionedEvent) Topic() string { return "versioned" }
+
+func (versionedEvent) EventVersion() int { return 3 }
+
+func TestNewEnvelope(t *testing.T) {
+	root := NewEnvelope(context.Background(), "order.created", 0, "orders")
+
+	assert.NotEmpty(t, root.ID)
+	assert.Equal(t, 1, root.Version)
+	assert.Equal(t, "orders", root.Producer)
+	// a new correlation starts with the event
+	assert.Equal(t, root.ID, root.CorrelationID)
+	assert.Empty(t, root.CausationID)
+
+	ctx := ContextWithEnvelope(context.Background(), Envelope{ID: "parent", CorrelationID: "request-1", TenantID: "tenant-1"})
+	child := NewEnvelope(ctx, "order.paid", 2, "payments")
+
+	assert.Equal(t, "parent", child.CausationID)
+	assert.Equal(t, "request-1", child.CorrelationID)
+	assert.Equal(t, "tenant-1", child.TenantID)
+	assert.Equal(t, 2, child.Version)
+
+	// ctx values win over the parent envelope
+	child = NewEnvelope(WithTenantID(ctx, "tenant-2"), "order.paid", 1, "payments")
+	assert.Equal(t, "tenant-2", child.TenantID)
+}
+
+func TestEnvelope_Headers(t *testing.T) {
+	envelope := Envelope{
+		ID:            "1",
+		Type:          "order.created",
+		Version:       2,
+		OccurredAt:    time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC),
+		Producer:      "orders",
+		CorrelationID: "request-1",
+		CausationID:   "0",
+		TenantID:      "tenant-1",
+		Origin:        "bridge-1",
+	}
+
+	assert.Equal(t, envelope, EnvelopeFromHeaders(envelope.Headers()))
+	assert.Equal(t, Envelope{}, EnvelopeFromHeaders(map[string]any{}))
+}
+
+func TestEmit_Envelope(t *testing.T) {
+	bus := New(Config{Producer: "orders"})
+
+	var envelope Envelope
+
+	On(bus, func(ctx context.Context, event versionedEvent) error {
+		envelope, _ = EnvelopeFromContext(ctx)
+
+		return nil
+	})
+
+	assert.NoError(t, Emit(WithCorrelationID(context.Background(), "request-1"), bus, versionedEvent{}))
+	assert.Equal(t, "versioned", envelope.Type)
+	assert.Equal(t, 3, envelope.Version)
+	assert.Equal(t, "orders", envelope.Producer)
+	assert.Equal(t, "request-1", envelope.CorrelationID)
+}
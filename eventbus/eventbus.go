@@ -1,6 +1,8 @@
 package eventbus
 
 import (
+	"sync"
+
 	"github.com/asaskevich/EventBus"
 	"github.com/braiphub/go-core/log"
 )
@@ -12,10 +14,20 @@ type Bus struct {
 	config       Config
 	logger       log.LoggerI
 	errorHandler ErrorHandler
+
+	handlersMu      sync.RWMutex
+	handlers        map[string][]eventHandler
+	allHandlers     []eventHandler
+	publishHandlers []publishHandler
+
+	poolsMu sync.Mutex
+	pools   []*asyncPool
 }
 
 type Config struct {
 	PanicOnSubscribeFailed bool
+	// Producer names the service in the envelopes of the emitted events.
+	Producer string
 }
 
 type OptionFn func(*Bus)
@@ -0,0 +1,350 @@
+package eventbuscmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/braiphub/go-core/command"
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/pkg/errors"
+)
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+var (
+	ErrUnknownFormat   = errors.New("unknown format")
+	ErrEmptySelection  = errors.New("select events with --id, --event or --older-than, or pass --all")
+	ErrInvalidDuration = errors.New("invalid duration")
+)
+
+func filterOptions() []command.Option {
+	return []command.Option{
+		{
+			Name:        "id",
+			Description: "Dead event ids",
+			Type:        command.StringSliceOption,
+		},
+		{
+			Name:        "event",
+			Shorthand:   "e",
+			Description: "Event types",
+			Type:        command.StringSliceOption,
+		},
+		{
+			Name:        "older-than",
+			Description: "Only events dead-lettered longer than this ago (e.g. 72h)",
+			Type:        command.StringOption,
+		},
+	}
+}
+
+func selectionOptions() []command.Option {
+	return append(filterOptions(), command.Option{
+		Name:        "all",
+		Description: "Select every dead event when no filter is given",
+		Default:     false,
+		Type:        command.BoolOption,
+	})
+}
+
+func parseFilter(args *command.Args) (distributed.DeadEventFilter, error) {
+	filter := distributed.DeadEventFilter{
+		IDs:        args.GetStringSlice("id"),
+		EventNames: args.GetStringSlice("event"),
+	}
+
+	if olderThan := args.GetString("older-than"); olderThan != "" {
+		age, err := time.ParseDuration(olderThan)
+		if err != nil {
+			return filter, errors.Wrap(ErrInvalidDuration, olderThan)
+		}
+
+		filter.DeadBefore = time.Now().Add(-age)
+	}
+
+	return filter, nil
+}
+
+// parseSelection parses the filter of commands changing the queue, an empty one needs --all.
+func parseSelection(args *command.Args) (distributed.DeadEventFilter, error) {
+	filter, err := parseFilter(args)
+	if err != nil {
+		return filter, err
+	}
+
+	if filter.IsEmpty() && !args.GetBool("all") {
+		return filter, ErrEmptySelection
+	}
+
+	return filter, nil
+}
+
+// DLQListCommand lists the dead-lettered events with their death reason
+type DLQListCommand struct {
+	dlq    distributed.DeadLetterQueue
+	stdout io.Writer
+}
+
+// NewDLQListCommand creates a new DLQListCommand
+func NewDLQListCommand(dlq distributed.DeadLetterQueue) *DLQListCommand {
+	return &DLQListCommand{
+		dlq:    dlq,
+		stdout: os.Stdout,
+	}
+}
+
+// Name returns the command signature
+func (c *DLQListCommand) Name() string {
+	return "eventbus:dlq-list"
+}
+
+// Description returns the command description
+func (c *DLQListCommand) Description() string {
+	return "List the events of the daemon dead letter queue"
+}
+
+// DefineOptions returns the command options/flags
+func (c *DLQListCommand) DefineOptions() []command.Option {
+	return append(filterOptions(),
+		command.Option{
+			Name:        "limit",
+			Shorthand:   "l",
+			Description: "Maximum number of events to list (0 lists all)",
+			Default:     50,
+			Type:        command.IntOption,
+		},
+		command.Option{
+			Name:        "format",
+			Shorthand:   "f",
+			Description: "Output format (table or json)",
+			Default:     formatTable,
+			Type:        command.StringOption,
+		},
+	)
+}
+
+// Handle executes the command
+func (c *DLQListCommand) Handle(ctx context.Context, args *command.Args) error {
+	filter, err := parseFilter(args)
+	if err != nil {
+		return err
+	}
+
+	events, err := c.dlq.List(ctx, filter, args.GetInt("limit", 50))
+	if err != nil {
+		return errors.Wrap(err, "list dead events")
+	}
+
+	switch format := args.GetString("format", formatTable); format {
+	case formatTable:
+		writer := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "ID\tEVENT\tREASON\tQUEUE\tCOUNT\tDEAD AT")
+
+		for _, event := range events {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%s\t%d\t%s\n",
+				event.ID,
+				event.EventName,
+				event.Reason,
+				event.Queue,
+				event.Count,
+				event.DeadAt.Format(time.RFC3339),
+			)
+		}
+
+		return writer.Flush()
+
+	case formatJSON:
+		docs := make([]deadEventDoc, 0, len(events))
+		for _, event := range events {
+			docs = append(docs, newDeadEventDoc(event))
+		}
+
+		return writeJSON(c.stdout, docs)
+
+	default:
+		return errors.Wrap(ErrUnknownFormat, format)
+	}
+}
+
+// DLQPeekCommand prints a dead-lettered event with its payload
+type DLQPeekCommand struct {
+	dlq    distributed.DeadLetterQueue
+	stdout io.Writer
+}
+
+// NewDLQPeekCommand creates a new DLQPeekCommand
+func NewDLQPeekCommand(dlq distributed.DeadLetterQueue) *DLQPeekCommand {
+	return &DLQPeekCommand{
+		dlq:    dlq,
+		stdout: os.Stdout,
+	}
+}
+
+// Name returns the command signature
+func (c *DLQPeekCommand) Name() string {
+	return "eventbus:dlq-peek"
+}
+
+// Description returns the command description
+func (c *DLQPeekCommand) Description() string {
+	return "Print a dead-lettered event and its payload"
+}
+
+// DefineOptions returns the command options/flags
+func (c *DLQPeekCommand) DefineOptions() []command.Option {
+	return []command.Option{
+		{
+			Name:        "id",
+			Description: "Dead event id",
+			Required:    true,
+			Type:        command.StringOption,
+		},
+	}
+}
+
+// Handle executes the command
+func (c *DLQPeekCommand) Handle(ctx context.Context, args *command.Args) error {
+	event, err := c.dlq.Peek(ctx, args.GetString("id"))
+	if err != nil {
+		return errors.Wrap(err, "peek dead event")
+	}
+
+	return writeJSON(c.stdout, newDeadEventDoc(event))
+}
+
+// DLQReplayCommand moves dead-lettered events back to the daemon queue
+type DLQReplayCommand struct {
+	dlq    distributed.DeadLetterQueue
+	stdout io.Writer
+}
+
+// NewDLQReplayCommand creates a new DLQReplayCommand
+func NewDLQReplayCommand(dlq distributed.DeadLetterQueue) *DLQReplayCommand {
+	return &DLQReplayCommand{
+		dlq:    dlq,
+		stdout: os.Stdout,
+	}
+}
+
+// Name returns the command signature
+func (c *DLQReplayCommand) Name() string {
+	return "eventbus:dlq-replay"
+}
+
+// Description returns the command description
+func (c *DLQReplayCommand) Description() string {
+	return "Replay dead-lettered events to the daemon queue"
+}
+
+// DefineOptions returns the command options/flags
+func (c *DLQReplayCommand) DefineOptions() []command.Option {
+	return selectionOptions()
+}
+
+// Handle executes the command
+func (c *DLQReplayCommand) Handle(ctx context.Context, args *command.Args) error {
+	filter, err := parseSelection(args)
+	if err != nil {
+		return err
+	}
+
+	replayed, err := c.dlq.Replay(ctx, filter)
+	fmt.Fprintf(c.stdout, "replayed %d events\n", replayed)
+
+	if err != nil {
+		return errors.Wrap(err, "replay dead events")
+	}
+
+	return nil
+}
+
+// DLQPurgeCommand deletes dead-lettered events
+type DLQPurgeCommand struct {
+	dlq    distributed.DeadLetterQueue
+	stdout io.Writer
+}
+
+// NewDLQPurgeCommand creates a new DLQPurgeCommand
+func NewDLQPurgeCommand(dlq distributed.DeadLetterQueue) *DLQPurgeCommand {
+	return &DLQPurgeCommand{
+		dlq:    dlq,
+		stdout: os.Stdout,
+	}
+}
+
+// Name returns the command signature
+func (c *DLQPurgeCommand) Name() string {
+	return "eventbus:dlq-purge"
+}
+
+// Description returns the command description
+func (c *DLQPurgeCommand) Description() string {
+	return "Delete dead-lettered events"
+}
+
+// DefineOptions returns the command options/flags
+func (c *DLQPurgeCommand) DefineOptions() []command.Option {
+	return selectionOptions()
+}
+
+// Handle executes the command
+func (c *DLQPurgeCommand) Handle(ctx context.Context, args *command.Args) error {
+	filter, err := parseSelection(args)
+	if err != nil {
+		return err
+	}
+
+	purged, err := c.dlq.Purge(ctx, filter)
+	fmt.Fprintf(c.stdout, "purged %d events\n", purged)
+
+	if err != nil {
+		return errors.Wrap(err, "purge dead events")
+	}
+
+	return nil
+}
+
+type deadEventDoc struct {
+	ID        string          `json:"id"`
+	EventName string          `json:"event_name"`
+	Reason    string          `json:"reason"`
+	Queue     string          `json:"queue"`
+	Count     int64           `json:"count"`
+	DeadAt    time.Time       `json:"dead_at"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+}
+
+func newDeadEventDoc(event distributed.DeadEvent) deadEventDoc {
+	doc := deadEventDoc{
+		ID:        event.ID,
+		EventName: event.EventName,
+		Reason:    event.Reason,
+		Queue:     event.Queue,
+		Count:     event.Count,
+		DeadAt:    event.DeadAt,
+	}
+
+	// payloads are json, anything else is printed as a string
+	if json.Valid(event.Data) {
+		doc.Payload = event.Data
+	} else if quoted, err := json.Marshal(string(event.Data)); err == nil {
+		doc.Payload = quoted
+	}
+
+	return doc
+}
+
+func writeJSON(out io.Writer, value any) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(value)
+}
@@ -0,0 +1,307 @@
+package eventbuscmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/command"
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDLQ returns an in-memory pub/sub with three dead events: evt-1 and evt-3 are order_placed
+// events, evt-2 an order_paid one with a payload that isn't json.
+func newTestDLQ(t *testing.T) *distributed.InMemoryPubSub {
+	t.Helper()
+
+	pubSub := distributed.NewInMemoryPubSub()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	for _, event := range []struct{ id, eventType, data string }{
+		{id: "evt-1", eventType: "order_placed", data: `{"order_id":"1"}`},
+		{id: "evt-2", eventType: "order_paid", data: "order 1 paid"},
+		{id: "evt-3", eventType: "order_placed", data: `{"order_id":"2"}`},
+	} {
+		envelope := eventbus.Envelope{ID: event.id, Type: event.eventType}
+		require.NoError(t, pubSub.Publish(ctx, envelope, []byte(event.data)))
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		_ = pubSub.ListenToEvents(ctx, func(context.Context, eventbus.Envelope, []byte) error {
+			return errors.New("failed")
+		})
+	}()
+
+	require.Eventually(t, func() bool { return len(pubSub.Dead()) == 3 }, 5*time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+
+	return pubSub
+}
+
+// deadAt returns the dead_at of the dead events by id, as printed in tables and json.
+func deadAt(t *testing.T, pubSub *distributed.InMemoryPubSub) (table map[string]string, doc map[string]string) {
+	t.Helper()
+
+	table, doc = make(map[string]string), make(map[string]string)
+
+	for _, event := range pubSub.Dead() {
+		marshaled, err := json.Marshal(event.DeadAt)
+		require.NoError(t, err)
+
+		table[event.ID] = event.DeadAt.Format(time.RFC3339)
+		doc[event.ID] = string(marshaled)
+	}
+
+	return table, doc
+}
+
+func TestDLQListCommand_Handle(t *testing.T) {
+	pubSub := newTestDLQ(t)
+	tableDeadAt, docDeadAt := deadAt(t, pubSub)
+
+	tests := []struct {
+		name    string
+		args    *command.Args
+		want    string
+		wantErr error
+	}{
+		{
+			name: "table",
+			args: command.NewArgs(),
+			want: "ID     EVENT         REASON    QUEUE  COUNT  DEAD AT\n" +
+				"evt-1  order_placed  rejected         1      " + tableDeadAt["evt-1"] + "\n" +
+				"evt-2  order_paid    rejected         1      " + tableDeadAt["evt-2"] + "\n" +
+				"evt-3  order_placed  rejected         1      " + tableDeadAt["evt-3"] + "\n",
+		},
+		{
+			name: "filtered by event with a limit",
+			args: command.NewArgs().SetOption("event", []string{"order_placed"}).SetOption("limit", 1),
+			want: "ID     EVENT         REASON    QUEUE  COUNT  DEAD AT\n" +
+				"evt-1  order_placed  rejected         1      " + tableDeadAt["evt-1"] + "\n",
+		},
+		{
+			name: "older than",
+			args: command.NewArgs().SetOption("older-than", "1h"),
+			want: "ID  EVENT  REASON  QUEUE  COUNT  DEAD AT\n",
+		},
+		{
+			name: "json",
+			args: command.NewArgs().SetOption("id", []string{"evt-1", "evt-2"}).SetOption("format", "json"),
+			want: fmt.Sprintf(`[
+  {
+    "id": "evt-1",
+    "event_name": "order_placed",
+    "reason": "rejected",
+    "queue": "",
+    "count": 1,
+    "dead_at": %s,
+    "payload": {"order_id": "1"}
+  },
+  {
+    "id": "evt-2",
+    "event_name": "order_paid",
+    "reason": "rejected",
+    "queue": "",
+    "count": 1,
+    "dead_at": %s,
+    "payload": "order 1 paid"
+  }
+]`, docDeadAt["evt-1"], docDeadAt["evt-2"]),
+		},
+		{
+			name:    "invalid duration",
+			args:    command.NewArgs().SetOption("older-than", "3 days"),
+			wantErr: ErrInvalidDuration,
+		},
+		{
+			name:    "unknown format",
+			args:    command.NewArgs().SetOption("format", "yaml"),
+			wantErr: ErrUnknownFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			cmd := NewDLQListCommand(pubSub)
+			cmd.stdout = stdout
+
+			err := cmd.Handle(context.Background(), tt.args)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			if tt.args.GetString("format") == formatJSON {
+				assert.JSONEq(t, tt.want, stdout.String())
+			} else {
+				assert.Equal(t, tt.want, stdout.String())
+			}
+		})
+	}
+}
+
+func TestDLQPeekCommand_Handle(t *testing.T) {
+	pubSub := newTestDLQ(t)
+	_, docDeadAt := deadAt(t, pubSub)
+
+	stdout := &bytes.Buffer{}
+	cmd := NewDLQPeekCommand(pubSub)
+	cmd.stdout = stdout
+
+	require.NoError(t, cmd.Handle(context.Background(), command.NewArgs().SetOption("id", "evt-3")))
+	assert.JSONEq(t, fmt.Sprintf(`{
+  "id": "evt-3",
+  "event_name": "order_placed",
+  "reason": "rejected",
+  "queue": "",
+  "count": 1,
+  "dead_at": %s,
+  "payload": {"order_id": "2"}
+}`, docDeadAt["evt-3"]), stdout.String())
+
+	err := cmd.Handle(context.Background(), command.NewArgs().SetOption("id", "evt-4"))
+	assert.ErrorIs(t, err, distributed.ErrDeadEventNotFound)
+}
+
+func TestDLQReplayCommand_Handle(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     *command.Args
+		want     string
+		wantDead []string
+		wantErr  error
+	}{
+		{
+			name:     "by event",
+			args:     command.NewArgs().SetOption("event", []string{"order_placed"}),
+			want:     "replayed 2 events\n",
+			wantDead: []string{"evt-2"},
+		},
+		{
+			name:     "older than",
+			args:     command.NewArgs().SetOption("older-than", "1h"),
+			want:     "replayed 0 events\n",
+			wantDead: []string{"evt-1", "evt-2", "evt-3"},
+		},
+		{
+			name:     "all",
+			args:     command.NewArgs().SetOption("all", true),
+			want:     "replayed 3 events\n",
+			wantDead: []string{},
+		},
+		{
+			name:     "without a filter",
+			args:     command.NewArgs(),
+			wantDead: []string{"evt-1", "evt-2", "evt-3"},
+			wantErr:  ErrEmptySelection,
+		},
+		{
+			name:     "invalid duration",
+			args:     command.NewArgs().SetOption("older-than", "3 days").SetOption("all", true),
+			wantDead: []string{"evt-1", "evt-2", "evt-3"},
+			wantErr:  ErrInvalidDuration,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pubSub := newTestDLQ(t)
+			stdout := &bytes.Buffer{}
+			cmd := NewDLQReplayCommand(pubSub)
+			cmd.stdout = stdout
+
+			err := cmd.Handle(context.Background(), tt.args)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.want, stdout.String())
+			assert.Equal(t, tt.wantDead, deadIDs(pubSub))
+			// replayed events are back in the daemon queue
+			assert.Equal(t, 3-len(tt.wantDead), pubSub.Pending())
+		})
+	}
+}
+
+func TestDLQPurgeCommand_Handle(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     *command.Args
+		want     string
+		wantDead []string
+		wantErr  error
+	}{
+		{
+			name:     "by id",
+			args:     command.NewArgs().SetOption("id", []string{"evt-2", "evt-4"}),
+			want:     "purged 1 events\n",
+			wantDead: []string{"evt-1", "evt-3"},
+		},
+		{
+			name:     "older than",
+			args:     command.NewArgs().SetOption("older-than", "1h"),
+			want:     "purged 0 events\n",
+			wantDead: []string{"evt-1", "evt-2", "evt-3"},
+		},
+		{
+			name:     "all",
+			args:     command.NewArgs().SetOption("all", true),
+			want:     "purged 3 events\n",
+			wantDead: []string{},
+		},
+		{
+			name:     "without a filter",
+			args:     command.NewArgs().SetOption("all", false),
+			wantDead: []string{"evt-1", "evt-2", "evt-3"},
+			wantErr:  ErrEmptySelection,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pubSub := newTestDLQ(t)
+			stdout := &bytes.Buffer{}
+			cmd := NewDLQPurgeCommand(pubSub)
+			cmd.stdout = stdout
+
+			err := cmd.Handle(context.Background(), tt.args)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.want, stdout.String())
+			assert.Equal(t, tt.wantDead, deadIDs(pubSub))
+			assert.Zero(t, pubSub.Pending())
+		})
+	}
+}
+
+func deadIDs(pubSub *distributed.InMemoryPubSub) []string {
+	ids := make([]string, 0)
+	for _, event := range pubSub.Dead() {
+		ids = append(ids, event.ID)
+	}
+
+	return ids
+}
@@ -0,0 +1,190 @@
+package eventbuscmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/braiphub/go-core/command"
+	"github.com/braiphub/go-core/eventbus/projection"
+	"github.com/pkg/errors"
+)
+
+// ProjectionsCommand runs the projections as a daemon
+type ProjectionsCommand struct {
+	runner *projection.Runner
+}
+
+// NewProjectionsCommand creates a new ProjectionsCommand
+func NewProjectionsCommand(runner *projection.Runner) *ProjectionsCommand {
+	return &ProjectionsCommand{runner: runner}
+}
+
+// Name returns the command signature
+func (c *ProjectionsCommand) Name() string {
+	return "eventbus:projections"
+}
+
+// Description returns the command description
+func (c *ProjectionsCommand) Description() string {
+	return "Keep the projections up to date with the event store until stopped"
+}
+
+// DefineOptions returns the command options/flags
+func (c *ProjectionsCommand) DefineOptions() []command.Option {
+	return nil
+}
+
+// Handle executes the command
+func (c *ProjectionsCommand) Handle(ctx context.Context, _ *command.Args) error {
+	return c.runner.Run(ctx)
+}
+
+// ProjectionRebuildCommand rebuilds a projection read model from scratch
+type ProjectionRebuildCommand struct {
+	runner *projection.Runner
+	stdout io.Writer
+}
+
+// NewProjectionRebuildCommand creates a new ProjectionRebuildCommand
+func NewProjectionRebuildCommand(runner *projection.Runner) *ProjectionRebuildCommand {
+	return &ProjectionRebuildCommand{
+		runner: runner,
+		stdout: os.Stdout,
+	}
+}
+
+// Name returns the command signature
+func (c *ProjectionRebuildCommand) Name() string {
+	return "eventbus:projection-rebuild"
+}
+
+// Description returns the command description
+func (c *ProjectionRebuildCommand) Description() string {
+	return "Reset a projection read model and handle every event again (stop the projections daemon first)"
+}
+
+// DefineOptions returns the command options/flags
+func (c *ProjectionRebuildCommand) DefineOptions() []command.Option {
+	return []command.Option{
+		{
+			Name:        "name",
+			Shorthand:   "n",
+			Description: "Projection name",
+			Required:    true,
+			Type:        command.StringOption,
+		},
+	}
+}
+
+// Handle executes the command
+func (c *ProjectionRebuildCommand) Handle(ctx context.Context, args *command.Args) error {
+	name := args.GetString("name")
+
+	handled, err := c.runner.Rebuild(ctx, name)
+	if err != nil {
+		return errors.Wrap(err, "rebuild projection")
+	}
+
+	fmt.Fprintf(c.stdout, "rebuilt %s from %d events\n", name, handled)
+
+	return nil
+}
+
+// ProjectionStatusCommand prints the progress of the projections
+type ProjectionStatusCommand struct {
+	runner *projection.Runner
+	stdout io.Writer
+}
+
+// NewProjectionStatusCommand creates a new ProjectionStatusCommand
+func NewProjectionStatusCommand(runner *projection.Runner) *ProjectionStatusCommand {
+	return &ProjectionStatusCommand{
+		runner: runner,
+		stdout: os.Stdout,
+	}
+}
+
+// Name returns the command signature
+func (c *ProjectionStatusCommand) Name() string {
+	return "eventbus:projection-status"
+}
+
+// Description returns the command description
+func (c *ProjectionStatusCommand) Description() string {
+	return "Print the lag, last event and last error of the projections"
+}
+
+// DefineOptions returns the command options/flags
+func (c *ProjectionStatusCommand) DefineOptions() []command.Option {
+	return []command.Option{
+		{
+			Name:        "format",
+			Shorthand:   "f",
+			Description: "Output format (table or json)",
+			Default:     formatTable,
+			Type:        command.StringOption,
+		},
+	}
+}
+
+// Handle executes the command
+func (c *ProjectionStatusCommand) Handle(ctx context.Context, args *command.Args) error {
+	statuses, err := c.runner.Status(ctx)
+	if err != nil {
+		return errors.Wrap(err, "projection status")
+	}
+
+	switch format := args.GetString("format", formatTable); format {
+	case formatTable:
+		writer := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "NAME\tPOSITION\tLAG\tLAST EVENT\tLAST EVENT AT\tFAILURES\tLAST ERROR")
+
+		for _, status := range statuses {
+			fmt.Fprintf(writer, "%s\t%d\t%d\t%s\t%s\t%d\t%s\n",
+				status.Name,
+				status.Position,
+				status.Lag,
+				status.LastEventID,
+				formatTime(status.LastEventAt),
+				status.Failures,
+				status.LastError,
+			)
+		}
+
+		return writer.Flush()
+
+	case formatJSON:
+		docs := make([]projectionStatusDoc, 0, len(statuses))
+		for _, status := range statuses {
+			docs = append(docs, projectionStatusDoc(status))
+		}
+
+		return writeJSON(c.stdout, docs)
+
+	default:
+		return errors.Wrap(ErrUnknownFormat, format)
+	}
+}
+
+type projectionStatusDoc struct {
+	Name        string    `json:"name"`
+	Position    uint64    `json:"position"`
+	Lag         int64     `json:"lag"`
+	LastEventID string    `json:"last_event_id,omitempty"`
+	LastEventAt time.Time `json:"last_event_at,omitzero"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at,omitzero"`
+	Failures    int       `json:"failures"`
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Format(time.RFC3339)
+}
@@ -0,0 +1,197 @@
+package eventbuscmd
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/command"
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/braiphub/go-core/eventbus/eventstore"
+	"github.com/braiphub/go-core/eventbus/projection"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type orderPlaced struct {
+	OrderID string `json:"order_id"`
+}
+
+func (orderPlaced) EventType() string { return "order_placed" }
+
+// sliceSource is a projection.Source of already decoded events.
+type sliceSource struct {
+	events []eventstore.RecordedEvent
+}
+
+func (s *sliceSource) Register(...distributed.EventInterface) {}
+
+func (s *sliceSource) append(events ...distributed.EventInterface) {
+	for _, event := range events {
+		position := uint64(len(s.events) + 1)
+
+		s.events = append(s.events, eventstore.RecordedEvent{
+			Position: position,
+			Envelope: eventbus.Envelope{
+				ID:         strconv.FormatUint(position, 10),
+				Type:       event.EventType(),
+				OccurredAt: time.Date(2026, 1, 2, 3, 4, int(position), 0, time.UTC),
+			},
+			Event: event,
+		})
+	}
+}
+
+func (s *sliceSource) LoadAll(
+	_ context.Context,
+	afterPosition uint64,
+	limit int,
+	_ ...string,
+) ([]eventstore.RecordedEvent, error) {
+	var events []eventstore.RecordedEvent
+
+	for _, event := range s.events {
+		if event.Position > afterPosition && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+func (s *sliceSource) Count(_ context.Context, afterPosition uint64, _ ...string) (int64, error) {
+	return int64(len(s.events)) - int64(afterPosition), nil
+}
+
+// newTestRunner returns a runner with the orders projection caught up with three events, and the
+// order_totals one failing twice at the first event.
+func newTestRunner(t *testing.T) (*projection.Runner, *[]string) {
+	t.Helper()
+
+	var orders []string
+
+	source := &sliceSource{}
+	checkpoints := projection.NewInMemoryCheckpointStore()
+
+	ordersProjection := projection.New("orders", projection.WithReset(func(context.Context) error {
+		orders = nil
+
+		return nil
+	}))
+	require.NoError(t, ordersProjection.Register(&orderPlaced{}, func(_ context.Context, event orderPlaced) error {
+		orders = append(orders, event.OrderID)
+
+		return nil
+	}))
+
+	totalsProjection := projection.New("order_totals")
+	require.NoError(t, totalsProjection.Register(&orderPlaced{}, func(context.Context, orderPlaced) error {
+		return nil
+	}))
+
+	runner := projection.NewRunner(source, checkpoints)
+	require.NoError(t, runner.Add(ordersProjection, totalsProjection))
+
+	source.append(orderPlaced{OrderID: "1"}, orderPlaced{OrderID: "2"}, orderPlaced{OrderID: "3"})
+
+	_, err := runner.CatchUp(context.Background(), "orders")
+	require.NoError(t, err)
+
+	require.NoError(t, checkpoints.Save(context.Background(), projection.Checkpoint{
+		Name:        "order_totals",
+		LastError:   "failed",
+		LastErrorAt: time.Date(2026, 1, 2, 4, 0, 0, 0, time.UTC),
+		Failures:    2,
+	}))
+
+	return runner, &orders
+}
+
+func TestProjectionStatusCommand_Handle(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    *command.Args
+		want    string
+		wantErr error
+	}{
+		{
+			name: "table",
+			args: command.NewArgs(),
+			want: "NAME          POSITION  LAG  LAST EVENT  LAST EVENT AT         FAILURES  LAST ERROR\n" +
+				"order_totals  0         3                -                     2         failed\n" +
+				"orders        3         0    3           2026-01-02T03:04:03Z  0         \n",
+		},
+		{
+			name: "json",
+			args: command.NewArgs().SetOption("format", "json"),
+			want: `[
+  {
+    "name": "order_totals",
+    "position": 0,
+    "lag": 3,
+    "last_error": "failed",
+    "last_error_at": "2026-01-02T04:00:00Z",
+    "failures": 2
+  },
+  {
+    "name": "orders",
+    "position": 3,
+    "lag": 0,
+    "last_event_id": "3",
+    "last_event_at": "2026-01-02T03:04:03Z",
+    "failures": 0
+  }
+]`,
+		},
+		{
+			name:    "unknown format",
+			args:    command.NewArgs().SetOption("format", "yaml"),
+			wantErr: ErrUnknownFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner, _ := newTestRunner(t)
+			stdout := &bytes.Buffer{}
+			cmd := NewProjectionStatusCommand(runner)
+			cmd.stdout = stdout
+
+			err := cmd.Handle(context.Background(), tt.args)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			if tt.args.GetString("format") == formatJSON {
+				assert.JSONEq(t, tt.want, stdout.String())
+			} else {
+				assert.Equal(t, tt.want, stdout.String())
+			}
+		})
+	}
+}
+
+func TestProjectionRebuildCommand_Handle(t *testing.T) {
+	runner, orders := newTestRunner(t)
+	stdout := &bytes.Buffer{}
+	cmd := NewProjectionRebuildCommand(runner)
+	cmd.stdout = stdout
+
+	require.NoError(t, cmd.Handle(context.Background(), command.NewArgs().SetOption("name", "orders")))
+	assert.Equal(t, "rebuilt orders from 3 events\n", stdout.String())
+	assert.Equal(t, []string{"1", "2", "3"}, *orders)
+
+	// projections without a reset can't be rebuilt
+	err := cmd.Handle(context.Background(), command.NewArgs().SetOption("name", "order_totals"))
+	assert.ErrorIs(t, err, projection.ErrRebuildUnsupported)
+
+	err = cmd.Handle(context.Background(), command.NewArgs().SetOption("name", "unknown"))
+	assert.ErrorIs(t, err, projection.ErrUnknownProjection)
+}
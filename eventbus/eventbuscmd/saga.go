@@ -0,0 +1,268 @@
+package eventbuscmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/braiphub/go-core/command"
+	"github.com/braiphub/go-core/eventbus/saga"
+	"github.com/pkg/errors"
+)
+
+// SagaListCommand lists the saga instances, e.g. the stuck ones
+type SagaListCommand struct {
+	manager *saga.Manager
+	stdout  io.Writer
+}
+
+// NewSagaListCommand creates a new SagaListCommand
+func NewSagaListCommand(manager *saga.Manager) *SagaListCommand {
+	return &SagaListCommand{
+		manager: manager,
+		stdout:  os.Stdout,
+	}
+}
+
+// Name returns the command signature
+func (c *SagaListCommand) Name() string {
+	return "eventbus:saga-list"
+}
+
+// Description returns the command description
+func (c *SagaListCommand) Description() string {
+	return "List the saga instances with their status and step"
+}
+
+// DefineOptions returns the command options/flags
+func (c *SagaListCommand) DefineOptions() []command.Option {
+	return []command.Option{
+		{
+			Name:        "saga",
+			Shorthand:   "s",
+			Description: "Saga name",
+			Type:        command.StringOption,
+		},
+		{
+			Name:        "status",
+			Description: "Instance statuses (running, compensating, completed, compensated or aborted)",
+			Type:        command.StringSliceOption,
+		},
+		{
+			Name:        "stuck",
+			Description: "Only the stuck instances",
+			Default:     false,
+			Type:        command.BoolOption,
+		},
+		{
+			Name:        "format",
+			Shorthand:   "f",
+			Description: "Output format (table or json)",
+			Default:     formatTable,
+			Type:        command.StringOption,
+		},
+	}
+}
+
+// Handle executes the command
+func (c *SagaListCommand) Handle(ctx context.Context, args *command.Args) error {
+	filter := saga.Filter{
+		Saga:  args.GetString("saga"),
+		Stuck: args.GetBool("stuck"),
+	}
+
+	for _, status := range args.GetStringSlice("status") {
+		filter.Statuses = append(filter.Statuses, saga.Status(status))
+	}
+
+	instances, err := c.manager.List(ctx, filter)
+	if err != nil {
+		return errors.Wrap(err, "list saga instances")
+	}
+
+	switch format := args.GetString("format", formatTable); format {
+	case formatTable:
+		writer := tabwriter.NewWriter(c.stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, "SAGA\tID\tSTATUS\tSTEP\tSTUCK\tDEADLINE\tUPDATED AT\tERROR")
+
+		for _, instance := range instances {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t%d\t%t\t%s\t%s\t%s\n",
+				instance.Saga,
+				instance.ID,
+				instance.Status,
+				instance.Step,
+				instance.Stuck,
+				formatTime(instance.Deadline),
+				formatTime(instance.UpdatedAt),
+				instance.Error,
+			)
+		}
+
+		return writer.Flush()
+
+	case formatJSON:
+		docs := make([]sagaInstanceDoc, 0, len(instances))
+		for _, instance := range instances {
+			docs = append(docs, newSagaInstanceDoc(instance, false))
+		}
+
+		return writeJSON(c.stdout, docs)
+
+	default:
+		return errors.Wrap(ErrUnknownFormat, format)
+	}
+}
+
+// SagaShowCommand prints a saga instance with its data and history
+type SagaShowCommand struct {
+	manager *saga.Manager
+	stdout  io.Writer
+}
+
+// NewSagaShowCommand creates a new SagaShowCommand
+func NewSagaShowCommand(manager *saga.Manager) *SagaShowCommand {
+	return &SagaShowCommand{
+		manager: manager,
+		stdout:  os.Stdout,
+	}
+}
+
+// Name returns the command signature
+func (c *SagaShowCommand) Name() string {
+	return "eventbus:saga-show"
+}
+
+// Description returns the command description
+func (c *SagaShowCommand) Description() string {
+	return "Print a saga instance with its data and history"
+}
+
+// DefineOptions returns the command options/flags
+func (c *SagaShowCommand) DefineOptions() []command.Option {
+	return instanceOptions()
+}
+
+// Handle executes the command
+func (c *SagaShowCommand) Handle(ctx context.Context, args *command.Args) error {
+	instance, err := c.manager.Get(ctx, args.GetString("saga"), args.GetString("id"))
+	if err != nil {
+		return errors.Wrap(err, "get saga instance")
+	}
+
+	return writeJSON(c.stdout, newSagaInstanceDoc(instance, true))
+}
+
+// SagaResolveCommand resolves a stuck saga instance by hand
+type SagaResolveCommand struct {
+	manager *saga.Manager
+	stdout  io.Writer
+}
+
+// NewSagaResolveCommand creates a new SagaResolveCommand
+func NewSagaResolveCommand(manager *saga.Manager) *SagaResolveCommand {
+	return &SagaResolveCommand{
+		manager: manager,
+		stdout:  os.Stdout,
+	}
+}
+
+// Name returns the command signature
+func (c *SagaResolveCommand) Name() string {
+	return "eventbus:saga-resolve"
+}
+
+// Description returns the command description
+func (c *SagaResolveCommand) Description() string {
+	return "Retry, skip or compensate the step of a saga instance, or abort it"
+}
+
+// DefineOptions returns the command options/flags
+func (c *SagaResolveCommand) DefineOptions() []command.Option {
+	return append(instanceOptions(), command.Option{
+		Name:        "resolution",
+		Shorthand:   "r",
+		Description: "Resolution (retry, skip, compensate or abort)",
+		Required:    true,
+		Type:        command.StringOption,
+	})
+}
+
+// Handle executes the command
+func (c *SagaResolveCommand) Handle(ctx context.Context, args *command.Args) error {
+	instance, err := c.manager.Resolve(
+		ctx,
+		args.GetString("saga"),
+		args.GetString("id"),
+		saga.Resolution(args.GetString("resolution")),
+	)
+	if err != nil {
+		return errors.Wrap(err, "resolve saga instance")
+	}
+
+	fmt.Fprintf(c.stdout, "%s %s is %s at step %d\n", instance.Saga, instance.ID, instance.Status, instance.Step)
+
+	if instance.Stuck {
+		fmt.Fprintf(c.stdout, "still stuck: %s\n", instance.Error)
+	}
+
+	return nil
+}
+
+func instanceOptions() []command.Option {
+	return []command.Option{
+		{
+			Name:        "saga",
+			Shorthand:   "s",
+			Description: "Saga name",
+			Required:    true,
+			Type:        command.StringOption,
+		},
+		{
+			Name:        "id",
+			Description: "Instance id",
+			Required:    true,
+			Type:        command.StringOption,
+		},
+	}
+}
+
+type sagaInstanceDoc struct {
+	Saga      string              `json:"saga"`
+	ID        string              `json:"id"`
+	Status    saga.Status         `json:"status"`
+	Step      int                 `json:"step"`
+	Completed int                 `json:"completed"`
+	Stuck     bool                `json:"stuck"`
+	Error     string              `json:"error,omitempty"`
+	Deadline  time.Time           `json:"deadline,omitzero"`
+	CreatedAt time.Time           `json:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at"`
+	Data      json.RawMessage     `json:"data,omitempty"`
+	History   []saga.HistoryEntry `json:"history,omitempty"`
+}
+
+func newSagaInstanceDoc(instance *saga.Instance, detailed bool) sagaInstanceDoc {
+	doc := sagaInstanceDoc{
+		Saga:      instance.Saga,
+		ID:        instance.ID,
+		Status:    instance.Status,
+		Step:      instance.Step,
+		Completed: instance.Completed,
+		Stuck:     instance.Stuck,
+		Error:     instance.Error,
+		Deadline:  instance.Deadline,
+		CreatedAt: instance.CreatedAt,
+		UpdatedAt: instance.UpdatedAt,
+	}
+
+	if detailed {
+		doc.Data = instance.Data
+		doc.History = instance.History
+	}
+
+	return doc
+}
@@ -0,0 +1,290 @@
+package eventbuscmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/command"
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/braiphub/go-core/eventbus/saga"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stockReserved struct {
+	OrderID string `json:"order_id"`
+}
+
+func (stockReserved) EventType() string { return "stock_reserved" }
+
+type paymentCharged struct {
+	OrderID string `json:"order_id"`
+}
+
+func (paymentCharged) EventType() string { return "payment_charged" }
+
+func orderID(event distributed.EventInterface) string {
+	switch e := event.(type) {
+	case orderPlaced:
+		return e.OrderID
+	case stockReserved:
+		return e.OrderID
+	case paymentCharged:
+		return e.OrderID
+	}
+
+	return ""
+}
+
+// newTestManager returns a manager of the checkout saga, whose charge step always fails to start,
+// with the instances:
+//   - checkout order-1 running the reserve step
+//   - checkout order-2 stuck starting the charge step
+//   - checkout order-3 completed
+//   - refund order-1 running
+func newTestManager(t *testing.T) *saga.Manager {
+	t.Helper()
+
+	ctx := context.Background()
+	store := saga.NewInMemoryStore()
+	manager := saga.NewManager(store)
+
+	require.NoError(t, manager.Add(saga.NewDefinition("checkout", orderPlaced{}, orderID).
+		Step("reserve", saga.CompleteOn(stockReserved{}, orderID)).
+		Step("charge",
+			saga.StepAction(func(context.Context, *saga.Instance, distributed.EventInterface) error {
+				return errors.New("card declined")
+			}),
+			saga.CompleteOn(paymentCharged{}, orderID),
+		),
+	))
+
+	at := func(minute int) time.Time { return time.Date(2026, 1, 2, 10, minute, 0, 0, time.UTC) }
+
+	for _, instance := range []*saga.Instance{
+		{
+			Saga:      "checkout",
+			ID:        "order-1",
+			Status:    saga.StatusRunning,
+			Data:      []byte(`{"order_id":"1"}`),
+			Deadline:  at(30),
+			CreatedAt: at(0),
+			UpdatedAt: at(1),
+		},
+		{
+			Saga:      "checkout",
+			ID:        "order-2",
+			Status:    saga.StatusRunning,
+			Step:      1,
+			Completed: 1,
+			Data:      []byte(`{"order_id":"2"}`),
+			Stuck:     true,
+			Error:     "step charge: card declined",
+			History: []saga.HistoryEntry{
+				{At: at(5), Step: "reserve", Action: "step started", Event: "order_placed"},
+				{At: at(6), Step: "reserve", Action: "step completed", Event: "stock_reserved"},
+				{At: at(6), Step: "charge", Action: "step started", Event: "stock_reserved", Error: "card declined"},
+			},
+			CreatedAt: at(5),
+			UpdatedAt: at(6),
+		},
+		{
+			Saga:      "checkout",
+			ID:        "order-3",
+			Status:    saga.StatusCompleted,
+			Step:      2,
+			Completed: 2,
+			CreatedAt: at(10),
+			UpdatedAt: at(12),
+		},
+		{
+			Saga:      "refund",
+			ID:        "order-1",
+			Status:    saga.StatusRunning,
+			CreatedAt: at(15),
+			UpdatedAt: at(15),
+		},
+	} {
+		require.NoError(t, store.Create(ctx, instance))
+	}
+
+	return manager
+}
+
+func TestSagaListCommand_Handle(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    *command.Args
+		want    string
+		wantErr error
+	}{
+		{
+			name: "table",
+			args: command.NewArgs(),
+			want: "SAGA      ID       STATUS     STEP  STUCK  DEADLINE              UPDATED AT            ERROR\n" +
+				"checkout  order-1  running    0     false  2026-01-02T10:30:00Z  2026-01-02T10:01:00Z  \n" +
+				"checkout  order-2  running    1     true   -                     2026-01-02T10:06:00Z  step charge: card declined\n" +
+				"checkout  order-3  completed  2     false  -                     2026-01-02T10:12:00Z  \n" +
+				"refund    order-1  running    0     false  -                     2026-01-02T10:15:00Z  \n",
+		},
+		{
+			name: "filtered by saga and status",
+			args: command.NewArgs().SetOption("saga", "checkout").SetOption("status", []string{"completed"}),
+			want: "SAGA      ID       STATUS     STEP  STUCK  DEADLINE  UPDATED AT            ERROR\n" +
+				"checkout  order-3  completed  2     false  -         2026-01-02T10:12:00Z  \n",
+		},
+		{
+			name: "stuck",
+			args: command.NewArgs().SetOption("stuck", true).SetOption("format", "json"),
+			want: `[
+  {
+    "saga": "checkout",
+    "id": "order-2",
+    "status": "running",
+    "step": 1,
+    "completed": 1,
+    "stuck": true,
+    "error": "step charge: card declined",
+    "created_at": "2026-01-02T10:05:00Z",
+    "updated_at": "2026-01-02T10:06:00Z"
+  }
+]`,
+		},
+		{
+			name:    "unknown format",
+			args:    command.NewArgs().SetOption("format", "yaml"),
+			wantErr: ErrUnknownFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			cmd := NewSagaListCommand(newTestManager(t))
+			cmd.stdout = stdout
+
+			err := cmd.Handle(context.Background(), tt.args)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			if tt.args.GetString("format") == formatJSON {
+				assert.JSONEq(t, tt.want, stdout.String())
+			} else {
+				assert.Equal(t, tt.want, stdout.String())
+			}
+		})
+	}
+}
+
+func TestSagaShowCommand_Handle(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	cmd := NewSagaShowCommand(newTestManager(t))
+	cmd.stdout = stdout
+
+	err := cmd.Handle(context.Background(), command.NewArgs().SetOption("saga", "checkout").SetOption("id", "order-2"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+  "saga": "checkout",
+  "id": "order-2",
+  "status": "running",
+  "step": 1,
+  "completed": 1,
+  "stuck": true,
+  "error": "step charge: card declined",
+  "created_at": "2026-01-02T10:05:00Z",
+  "updated_at": "2026-01-02T10:06:00Z",
+  "data": {"order_id": "2"},
+  "history": [
+    {"at": "2026-01-02T10:05:00Z", "step": "reserve", "action": "step started", "event": "order_placed"},
+    {"at": "2026-01-02T10:06:00Z", "step": "reserve", "action": "step completed", "event": "stock_reserved"},
+    {"at": "2026-01-02T10:06:00Z", "step": "charge", "action": "step started", "event": "stock_reserved", "error": "card declined"}
+  ]
+}`, stdout.String())
+
+	err = cmd.Handle(context.Background(), command.NewArgs().SetOption("saga", "checkout").SetOption("id", "order-4"))
+	assert.ErrorIs(t, err, saga.ErrInstanceNotFound)
+}
+
+func TestSagaResolveCommand_Handle(t *testing.T) {
+	tests := []struct {
+		name       string
+		saga       string
+		id         string
+		resolution string
+		want       string
+		wantErr    error
+	}{
+		{
+			name:       "abort",
+			saga:       "checkout",
+			id:         "order-1",
+			resolution: "abort",
+			want:       "checkout order-1 is aborted at step 0\n",
+		},
+		{
+			name:       "retry still stuck",
+			saga:       "checkout",
+			id:         "order-2",
+			resolution: "retry",
+			want:       "checkout order-2 is running at step 1\nstill stuck: step charge: card declined\n",
+		},
+		{
+			name:       "skip",
+			saga:       "checkout",
+			id:         "order-2",
+			resolution: "skip",
+			want:       "checkout order-2 is completed at step 2\n",
+		},
+		{
+			name:       "finished instance",
+			saga:       "checkout",
+			id:         "order-3",
+			resolution: "retry",
+			wantErr:    saga.ErrInstanceFinished,
+		},
+		{
+			name:       "unknown resolution",
+			saga:       "checkout",
+			id:         "order-1",
+			resolution: "ignore",
+			wantErr:    saga.ErrUnknownResolution,
+		},
+		{
+			name:       "unknown saga",
+			saga:       "refund",
+			id:         "order-1",
+			resolution: "abort",
+			wantErr:    saga.ErrUnknownSaga,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout := &bytes.Buffer{}
+			cmd := NewSagaResolveCommand(newTestManager(t))
+			cmd.stdout = stdout
+
+			err := cmd.Handle(context.Background(), command.NewArgs().
+				SetOption("saga", tt.saga).
+				SetOption("id", tt.id).
+				SetOption("resolution", tt.resolution))
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				assert.Empty(t, stdout.String())
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, stdout.String())
+		})
+	}
+}
@@ -0,0 +1,148 @@
+package eventstore
+
+import (
+	"context"
+
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/pkg/errors"
+	"gorm.io/gorm/clause"
+)
+
+// Aggregate is rebuilt by applying the events of its stream, in order.
+type Aggregate interface {
+	AggregateID() string
+	Apply(event distributed.EventInterface) error
+}
+
+// Snapshotter aggregates are restored from their latest snapshot, applying only the events after it.
+type Snapshotter interface {
+	Snapshot() ([]byte, error)
+	RestoreSnapshot(data []byte) error
+}
+
+// LoadAggregate rebuilds the aggregate from its stream, returning the stream version to save it with.
+func (s *Store) LoadAggregate(ctx context.Context, aggregate Aggregate) (int64, error) {
+	var version int64
+
+	if snapshotter, ok := aggregate.(Snapshotter); ok {
+		snapshot, found, err := s.latestSnapshot(ctx, aggregate.AggregateID())
+		if err != nil {
+			return 0, err
+		}
+
+		if found {
+			if err := snapshotter.RestoreSnapshot(snapshot.Data); err != nil {
+				return 0, errors.Wrap(err, "restore snapshot")
+			}
+
+			version = snapshot.Version
+		}
+	}
+
+	events, err := s.Load(ctx, aggregate.AggregateID(), version)
+	if err != nil {
+		return 0, err
+	}
+
+	return replay(aggregate, version, events)
+}
+
+// SaveAggregate appends the events to the aggregate stream, expecting the version it was loaded with,
+// and applies them to the aggregate. It returns the new stream version.
+func (s *Store) SaveAggregate(
+	ctx context.Context,
+	aggregate Aggregate,
+	expectedVersion int64,
+	events ...distributed.EventInterface,
+) (int64, error) {
+	version, err := s.Append(ctx, aggregate.AggregateID(), expectedVersion, events...)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, event := range events {
+		if err := aggregate.Apply(event); err != nil {
+			return 0, errors.Wrap(err, "apply "+event.EventType())
+		}
+	}
+
+	snapshotter, ok := aggregate.(Snapshotter)
+	if !ok || !s.shouldSnapshot(version-int64(len(events)), version) {
+		return version, nil
+	}
+
+	// the events are saved, a failed snapshot only makes the next loads slower
+	if err := s.SaveSnapshot(ctx, aggregate.AggregateID(), version, snapshotter); err != nil && s.logger != nil {
+		s.logger.WithContext(ctx).Error("save snapshot", err)
+	}
+
+	return version, nil
+}
+
+// SaveSnapshot stores the snapshot of a stream at version, replacing an older one.
+func (s *Store) SaveSnapshot(ctx context.Context, streamID string, version int64, snapshotter Snapshotter) error {
+	data, err := snapshotter.Snapshot()
+	if err != nil {
+		return errors.Wrap(err, "snapshot")
+	}
+
+	err = s.database.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "stream_id"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"version":    version,
+				"data":       data,
+				"created_at": clause.Expr{SQL: "CURRENT_TIMESTAMP"},
+			}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				clause.Lt{Column: clause.Column{Table: snapshotsTableName, Name: "version"}, Value: version},
+			}},
+		}).
+		Create(&GormSnapshotModel{StreamID: streamID, Version: version, Data: data}).
+		Error
+	if err != nil {
+		return errors.Wrap(err, "save snapshot")
+	}
+
+	return nil
+}
+
+func (s *Store) latestSnapshot(ctx context.Context, streamID string) (GormSnapshotModel, bool, error) {
+	var snapshot GormSnapshotModel
+
+	result := s.database.WithContext(ctx).
+		Where("stream_id = ?", streamID).
+		Limit(1).
+		Find(&snapshot)
+	if result.Error != nil {
+		return GormSnapshotModel{}, false, errors.Wrap(result.Error, "find snapshot")
+	}
+
+	return snapshot, result.RowsAffected > 0, nil
+}
+
+// shouldSnapshot reports whether appending from one version to another crossed a snapshot interval.
+func (s *Store) shouldSnapshot(from, to int64) bool {
+	if s.snapshotEvery <= 0 {
+		return false
+	}
+
+	return to/s.snapshotEvery > from/s.snapshotEvery
+}
+
+// replay applies the events to the aggregate, checking they follow version.
+func replay(aggregate Aggregate, version int64, events []RecordedEvent) (int64, error) {
+	for _, event := range events {
+		if event.Version != version+1 {
+			return 0, errors.Errorf("stream %s: expected version %d, got %d", aggregate.AggregateID(), version+1, event.Version)
+		}
+
+		if err := aggregate.Apply(event.Event); err != nil {
+			return 0, errors.Wrapf(err, "apply %s version %d", event.Envelope.Type, event.Version)
+		}
+
+		version = event.Version
+	}
+
+	return version, nil
+}
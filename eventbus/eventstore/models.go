@@ -0,0 +1,65 @@
+package eventstore
+
+import "time"
+
+const (
+	streamsTableName   = "eventstore_streams"
+	eventsTableName    = "eventstore_events"
+	snapshotsTableName = "eventstore_snapshots"
+	outboxTableName    = "eventstore_outbox"
+)
+
+// GormStreamModel holds the version of a stream, the row is locked to append to it.
+type GormStreamModel struct {
+	StreamID  string `gorm:"primaryKey;size:255"`
+	Version   int64
+	UpdatedAt time.Time
+}
+
+func (GormStreamModel) TableName() string {
+	return streamsTableName
+}
+
+// GormEventModel is an appended event. Position orders the events of every stream.
+type GormEventModel struct {
+	Position   uint64 `gorm:"primaryKey;autoIncrement"`
+	StreamID   string `gorm:"size:255;uniqueIndex:idx_eventstore_stream_version"`
+	Version    int64  `gorm:"uniqueIndex:idx_eventstore_stream_version"`
+	EventID    string `gorm:"size:64;uniqueIndex"`
+	EventType  string `gorm:"size:255;index"`
+	Envelope   []byte
+	Data       []byte
+	OccurredAt time.Time
+}
+
+func (GormEventModel) TableName() string {
+	return eventsTableName
+}
+
+type GormSnapshotModel struct {
+	StreamID  string `gorm:"primaryKey;size:255"`
+	Version   int64
+	Data      []byte
+	CreatedAt time.Time
+}
+
+func (GormSnapshotModel) TableName() string {
+	return snapshotsTableName
+}
+
+// GormOutboxModel is an appended event waiting to be published, see RunOutbox. An event parked after
+// failing its max attempts stays in the table with its last error, reset its attempts to publish it.
+type GormOutboxModel struct {
+	ID        uint   `gorm:"primary_key"`
+	EventID   string `gorm:"size:64"`
+	EventType string `gorm:"size:255"`
+	Envelope  []byte
+	Data      []byte
+	Attempts  int
+	LastError string
+	CreatedAt time.Time
+}
+
+func (GormOutboxModel) TableName() string {
+	return outboxTableName
+}
@@ -0,0 +1,34 @@
+package eventstore
+
+import "github.com/braiphub/go-core/log"
+
+type Option func(*Store)
+
+// WithProducer sets the producer of the appended events envelopes, usually the service name.
+func WithProducer(producer string) Option {
+	return func(s *Store) {
+		s.producer = producer
+	}
+}
+
+// WithSnapshotEvery makes SaveAggregate snapshot the aggregates implementing Snapshotter every n
+// events. Zero disables the snapshots.
+func WithSnapshotEvery(n int64) Option {
+	return func(s *Store) {
+		s.snapshotEvery = n
+	}
+}
+
+// WithOutboxMaxAttempts sets how many times RunOutbox tries to publish an event before parking it, 10
+// by default. Zero or less never parks the events.
+func WithOutboxMaxAttempts(n int) Option {
+	return func(s *Store) {
+		s.maxAttempts = n
+	}
+}
+
+func WithLogger(logger log.LoggerI) Option {
+	return func(s *Store) {
+		s.logger = logger
+	}
+}
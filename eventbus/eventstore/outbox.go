@@ -0,0 +1,146 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultOutboxInterval    = time.Second
+	defaultOutboxMaxAttempts = 10
+	outboxBatchSize          = 100
+)
+
+// Publisher publishes the outbox events, *distributed.EventBus implements it.
+type Publisher interface {
+	PublishEnvelope(ctx context.Context, envelope eventbus.Envelope, data []byte) error
+}
+
+// assert meets contract
+var _ Publisher = &distributed.EventBus{}
+
+// RunOutbox publishes the appended events through publisher every interval until ctx is done. Events
+// are published at least once and in append order: several instances can run it at the same time,
+// an advisory lock lets a single one relay at once. An event failing to publish holds the ones after
+// it back until it's parked, see WithOutboxMaxAttempts.
+func (s *Store) RunOutbox(ctx context.Context, publisher Publisher, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultOutboxInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			published, err := s.relayOutbox(ctx, publisher, outboxBatchSize)
+			if err != nil && s.logger != nil {
+				s.logger.WithContext(ctx).Error("relay outbox events", err)
+			}
+
+			if err != nil || published < outboxBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayOutbox publishes up to limit outbox events, deleting the published ones. It stops at the first
+// publish error, recording it on the event and keeping the remaining ones for the next run. Parked
+// events are skipped, and nothing is published while another instance relays.
+func (s *Store) relayOutbox(ctx context.Context, publisher Publisher, limit int) (int, error) {
+	var (
+		published  int
+		publishErr error
+	)
+
+	err := s.database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// publishing in append order takes a single relay, SQLite, used in tests, has a single writer
+		if tx.Dialector.Name() == postgresDialect {
+			var locked bool
+
+			err := tx.Raw("SELECT pg_try_advisory_xact_lock(hashtext(?))", outboxTableName).Scan(&locked).Error
+			if err != nil {
+				return errors.Wrap(err, "lock outbox")
+			}
+
+			if !locked {
+				return nil
+			}
+		}
+
+		var models []GormOutboxModel
+
+		query := tx.Order("id").Limit(limit)
+		if s.maxAttempts > 0 {
+			query = query.Where("attempts < ?", s.maxAttempts)
+		}
+
+		if err := query.Find(&models).Error; err != nil {
+			return errors.Wrap(err, "find outbox events")
+		}
+
+		ids := make([]uint, 0, len(models))
+
+		for _, model := range models {
+			if publishErr = publishOutboxEvent(ctx, publisher, model); publishErr != nil {
+				err := tx.Model(&model).Updates(map[string]interface{}{
+					"attempts":   gorm.Expr("attempts + 1"),
+					"last_error": publishErr.Error(),
+				}).Error
+				if err != nil {
+					return errors.Wrap(err, "update outbox event")
+				}
+
+				if s.maxAttempts > 0 && model.Attempts+1 >= s.maxAttempts {
+					publishErr = errors.Wrapf(publishErr, "event %s parked after %d attempts", model.EventID, s.maxAttempts)
+				}
+
+				break
+			}
+
+			ids = append(ids, model.ID)
+		}
+
+		if len(ids) > 0 {
+			if err := tx.Delete(&GormOutboxModel{}, ids).Error; err != nil {
+				return errors.Wrap(err, "delete outbox events")
+			}
+		}
+
+		published = len(ids)
+
+		// commit the deletes of what was published
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if publishErr != nil {
+		return published, errors.Wrap(publishErr, "publish outbox event")
+	}
+
+	return published, nil
+}
+
+func publishOutboxEvent(ctx context.Context, publisher Publisher, model GormOutboxModel) error {
+	var envelope eventbus.Envelope
+	if err := json.Unmarshal(model.Envelope, &envelope); err != nil {
+		return errors.Wrap(err, "unmarshal envelope")
+	}
+
+	return publisher.PublishEnvelope(ctx, envelope, model.Data)
+}
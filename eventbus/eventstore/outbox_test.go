@@ -0,0 +1,137 @@
+package eventstore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePublisher records the published envelopes, failing the event types in fail.
+type fakePublisher struct {
+	mu        sync.Mutex
+	fail      map[string]bool
+	published []string
+}
+
+func (p *fakePublisher) PublishEnvelope(_ context.Context, envelope eventbus.Envelope, data []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.fail[envelope.Type] {
+		return errors.New("broker down")
+	}
+
+	p.published = append(p.published, string(data))
+
+	return nil
+}
+
+func (p *fakePublisher) setFail(eventType string, fail bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.fail[eventType] = fail
+}
+
+func (p *fakePublisher) events() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]string(nil), p.published...)
+}
+
+func outboxModels(t *testing.T, store *Store) []GormOutboxModel {
+	t.Helper()
+
+	var models []GormOutboxModel
+	require.NoError(t, store.database.Order("id").Find(&models).Error)
+
+	return models
+}
+
+func TestStore_relayOutbox(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t, WithOutboxMaxAttempts(2))
+	publisher := &fakePublisher{fail: map[string]bool{"order_paid": true}}
+
+	_, err := store.Append(ctx, "order-1", ExpectedNoStream, orderPlaced{Total: 1}, &orderPaid{})
+	require.NoError(t, err)
+	_, err = store.Append(ctx, "order-2", ExpectedNoStream, orderPlaced{Total: 2})
+	require.NoError(t, err)
+
+	// the failing event holds the ones after it back
+	published, err := store.relayOutbox(ctx, publisher, 10)
+	require.ErrorContains(t, err, "broker down")
+	assert.Equal(t, 1, published)
+	assert.Equal(t, []string{`{"total":1}`}, publisher.events())
+
+	models := outboxModels(t, store)
+	require.Len(t, models, 2)
+	assert.Equal(t, "order_paid", models[0].EventType)
+	assert.Equal(t, 1, models[0].Attempts)
+	assert.Equal(t, "broker down", models[0].LastError)
+	assert.Zero(t, models[1].Attempts)
+
+	// the last attempt parks it
+	_, err = store.relayOutbox(ctx, publisher, 10)
+	require.ErrorContains(t, err, "parked after 2 attempts: broker down")
+
+	published, err = store.relayOutbox(ctx, publisher, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Equal(t, []string{`{"total":1}`, `{"total":2}`}, publisher.events())
+
+	// parked events stay in the outbox, skipped by the relay
+	models = outboxModels(t, store)
+	require.Len(t, models, 1)
+	assert.Equal(t, 2, models[0].Attempts)
+
+	published, err = store.relayOutbox(ctx, publisher, 10)
+	require.NoError(t, err)
+	assert.Zero(t, published)
+
+	// resetting the attempts publishes it again
+	publisher.setFail("order_paid", false)
+	require.NoError(t, store.database.Model(&models[0]).Update("attempts", 0).Error)
+
+	published, err = store.relayOutbox(ctx, publisher, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 1, published)
+	assert.Empty(t, outboxModels(t, store))
+}
+
+func TestStore_RunOutbox(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	store, _ := newTestStore(t)
+	publisher := &fakePublisher{fail: map[string]bool{}}
+
+	for i := range outboxBatchSize + 1 {
+		_, err := store.Append(ctx, "order-1", int64(i), orderPlaced{Total: i})
+		require.NoError(t, err)
+	}
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		store.RunOutbox(ctx, publisher, time.Hour)
+	}()
+
+	// a full batch is followed by the next one right away, in append order
+	require.Eventually(t, func() bool { return len(publisher.events()) == outboxBatchSize+1 }, 5*time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+
+	events := publisher.events()
+	assert.Equal(t, `{"total":0}`, events[0])
+	assert.Equal(t, `{"total":100}`, events[outboxBatchSize])
+	assert.Empty(t, outboxModels(t, store))
+}
@@ -0,0 +1,349 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"sync"
+
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/braiphub/go-core/log"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const postgresDialect = "postgres"
+
+const (
+	// ExpectedAnyVersion appends to the stream whatever its version is.
+	ExpectedAnyVersion int64 = -1
+	// ExpectedNoStream appends only to a stream without events.
+	ExpectedNoStream int64 = 0
+)
+
+var (
+	ErrConcurrencyConflict = errors.New("stream version conflict")
+	ErrUnknownEventType    = errors.New("unknown event type")
+	ErrNoEvents            = errors.New("no events to append")
+)
+
+// RecordedEvent is an event read from a stream.
+type RecordedEvent struct {
+	StreamID string
+	Version  int64
+	// Position orders the events of every stream.
+	Position uint64
+	Envelope eventbus.Envelope
+	// Event is the decoded data, a value of the registered type.
+	Event distributed.EventInterface
+	Data  []byte
+}
+
+// Store is an append-only event store backed by Postgres through GORM. The tables can be created with
+// Migrate. Appended events are published by RunOutbox.
+type Store struct {
+	database      *gorm.DB
+	logger        log.LoggerI
+	producer      string
+	snapshotEvery int64
+	maxAttempts   int
+
+	mu       sync.RWMutex
+	registry map[string]reflect.Type
+}
+
+func New(database *gorm.DB, opts ...Option) *Store {
+	store := &Store{
+		database:    database,
+		maxAttempts: defaultOutboxMaxAttempts,
+		registry:    make(map[string]reflect.Type),
+	}
+
+	for _, opt := range opts {
+		opt(store)
+	}
+
+	return store
+}
+
+// Migrate creates the event store tables.
+func (s *Store) Migrate(ctx context.Context) error {
+	err := s.database.WithContext(ctx).AutoMigrate(
+		&GormStreamModel{},
+		&GormEventModel{},
+		&GormSnapshotModel{},
+		&GormOutboxModel{},
+	)
+	if err != nil {
+		return errors.Wrap(err, "migrate")
+	}
+
+	return nil
+}
+
+// Register registers the event types read from the streams, by their EventType.
+func (s *Store) Register(events ...distributed.EventInterface) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range events {
+		eventType := reflect.TypeOf(event)
+		if eventType.Kind() == reflect.Ptr {
+			eventType = eventType.Elem()
+		}
+
+		s.registry[event.EventType()] = eventType
+	}
+}
+
+// decode unmarshals data into a value of the type registered for name, or a pointer to it when only
+// the pointer implements EventInterface.
+func (s *Store) decode(name string, data []byte) (distributed.EventInterface, error) {
+	s.mu.RLock()
+	eventType, ok := s.registry[name]
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownEventType, name)
+	}
+
+	ptr := reflect.New(eventType)
+	if err := json.Unmarshal(data, ptr.Interface()); err != nil {
+		return nil, errors.Wrap(err, "unmarshal "+name)
+	}
+
+	if event, ok := ptr.Elem().Interface().(distributed.EventInterface); ok {
+		return event, nil
+	}
+
+	return ptr.Interface().(distributed.EventInterface), nil
+}
+
+// Append appends events to the stream if it's at expectedVersion, returning the new stream version.
+// The events are also added to the outbox in the same transaction. ErrConcurrencyConflict is
+// returned when the stream was changed by someone else, reload it and try again.
+func (s *Store) Append(
+	ctx context.Context,
+	streamID string,
+	expectedVersion int64,
+	events ...distributed.EventInterface,
+) (int64, error) {
+	if len(events) == 0 {
+		return 0, ErrNoEvents
+	}
+
+	var version int64
+
+	err := s.database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		current, err := lockStream(tx, streamID, expectedVersion)
+		if err != nil {
+			return err
+		}
+
+		models := make([]GormEventModel, 0, len(events))
+		outbox := make([]GormOutboxModel, 0, len(events))
+
+		for i, event := range events {
+			data, err := json.Marshal(event)
+			if err != nil {
+				return errors.Wrap(err, "marshal "+event.EventType())
+			}
+
+			envelope := eventbus.NewEnvelope(ctx, event.EventType(), eventbus.VersionOf(event), s.producer)
+
+			encoded, err := json.Marshal(envelope)
+			if err != nil {
+				return errors.Wrap(err, "marshal envelope")
+			}
+
+			models = append(models, GormEventModel{
+				StreamID:   streamID,
+				Version:    current + int64(i) + 1,
+				EventID:    envelope.ID,
+				EventType:  envelope.Type,
+				Envelope:   encoded,
+				Data:       data,
+				OccurredAt: envelope.OccurredAt,
+			})
+
+			outbox = append(outbox, GormOutboxModel{
+				EventID:   envelope.ID,
+				EventType: envelope.Type,
+				Envelope:  encoded,
+				Data:      data,
+			})
+		}
+
+		version = current + int64(len(events))
+
+		result := tx.Model(&GormStreamModel{}).
+			Where("stream_id = ? AND version = ?", streamID, current).
+			Update("version", version)
+		if result.Error != nil {
+			return errors.Wrap(result.Error, "update stream version")
+		}
+
+		if result.RowsAffected == 0 {
+			return errors.Wrap(ErrConcurrencyConflict, streamID)
+		}
+
+		// positions must become visible in order for the readers of LoadAll, so the appends to every
+		// stream are serialized from here to the commit. SQLite, used in tests, has a single writer.
+		if tx.Dialector.Name() == postgresDialect {
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", eventsTableName).Error; err != nil {
+				return errors.Wrap(err, "lock events")
+			}
+		}
+
+		if err := tx.Create(&models).Error; err != nil {
+			return errors.Wrap(err, "create events")
+		}
+
+		if err := tx.Create(&outbox).Error; err != nil {
+			return errors.Wrap(err, "create outbox events")
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+// lockStream returns the current version of the stream, creating it, and checks it's the expected
+// one. The version update of Append is what serializes concurrent appends.
+func lockStream(tx *gorm.DB, streamID string, expectedVersion int64) (int64, error) {
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&GormStreamModel{StreamID: streamID}).
+		Error
+	if err != nil {
+		return 0, errors.Wrap(err, "create stream")
+	}
+
+	if expectedVersion != ExpectedAnyVersion {
+		return expectedVersion, nil
+	}
+
+	var stream GormStreamModel
+
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("stream_id = ?", streamID).
+		First(&stream).
+		Error
+	if err != nil {
+		return 0, errors.Wrap(err, "lock stream")
+	}
+
+	return stream.Version, nil
+}
+
+// Version returns the version of the stream, zero when it has no events.
+func (s *Store) Version(ctx context.Context, streamID string) (int64, error) {
+	var stream GormStreamModel
+
+	err := s.database.WithContext(ctx).
+		Where("stream_id = ?", streamID).
+		Limit(1).
+		Find(&stream).
+		Error
+	if err != nil {
+		return 0, errors.Wrap(err, "find stream")
+	}
+
+	return stream.Version, nil
+}
+
+// Load reads the events of the stream after the given version, in order.
+func (s *Store) Load(ctx context.Context, streamID string, afterVersion int64) ([]RecordedEvent, error) {
+	var models []GormEventModel
+
+	err := s.database.WithContext(ctx).
+		Where("stream_id = ? AND version > ?", streamID, afterVersion).
+		Order("version").
+		Find(&models).
+		Error
+	if err != nil {
+		return nil, errors.Wrap(err, "find events")
+	}
+
+	return s.recorded(models)
+}
+
+// LoadAll reads up to limit events of every stream after the given position, in order. Passing
+// event types reads only events of those types.
+func (s *Store) LoadAll(
+	ctx context.Context,
+	afterPosition uint64,
+	limit int,
+	eventTypes ...string,
+) ([]RecordedEvent, error) {
+	var models []GormEventModel
+
+	query := s.database.WithContext(ctx).Where("position > ?", afterPosition)
+	if len(eventTypes) > 0 {
+		query = query.Where("event_type IN ?", eventTypes)
+	}
+
+	if err := query.Order("position").Limit(limit).Find(&models).Error; err != nil {
+		return nil, errors.Wrap(err, "find events")
+	}
+
+	return s.recorded(models)
+}
+
+// Count returns the number of events of every stream after the given position, of the given types
+// when passed.
+func (s *Store) Count(ctx context.Context, afterPosition uint64, eventTypes ...string) (int64, error) {
+	var count int64
+
+	query := s.database.WithContext(ctx).Model(&GormEventModel{}).Where("position > ?", afterPosition)
+	if len(eventTypes) > 0 {
+		query = query.Where("event_type IN ?", eventTypes)
+	}
+
+	if err := query.Count(&count).Error; err != nil {
+		return 0, errors.Wrap(err, "count events")
+	}
+
+	return count, nil
+}
+
+func (s *Store) recorded(models []GormEventModel) ([]RecordedEvent, error) {
+	events := make([]RecordedEvent, 0, len(models))
+
+	for _, model := range models {
+		event, err := s.recordedEvent(model)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s version %d", model.StreamID, model.Version)
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+func (s *Store) recordedEvent(model GormEventModel) (RecordedEvent, error) {
+	var envelope eventbus.Envelope
+	if err := json.Unmarshal(model.Envelope, &envelope); err != nil {
+		return RecordedEvent{}, errors.Wrap(err, "unmarshal envelope")
+	}
+
+	event, err := s.decode(model.EventType, model.Data)
+	if err != nil {
+		return RecordedEvent{}, err
+	}
+
+	return RecordedEvent{
+		StreamID: model.StreamID,
+		Version:  model.Version,
+		Position: model.Position,
+		Envelope: envelope,
+		Event:    event,
+		Data:     model.Data,
+	}, nil
+}
@@ -0,0 +1,340 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type orderPlaced struct {
+	Total int `json:"total"`
+}
+
+func (orderPlaced) EventType() string { return "order_placed" }
+
+type orderPaid struct{}
+
+func (*orderPaid) EventType() string { return "order_paid" }
+
+type order struct {
+	id    string
+	total int
+	paid  bool
+}
+
+func (o *order) AggregateID() string { return o.id }
+
+func (o *order) Apply(event distributed.EventInterface) error {
+	switch e := event.(type) {
+	case orderPlaced:
+		o.total = e.Total
+	case *orderPaid:
+		if o.paid {
+			return errors.New("already paid")
+		}
+
+		o.paid = true
+	}
+
+	return nil
+}
+
+func (o *order) Snapshot() ([]byte, error) { return json.Marshal(o.total) }
+
+func (o *order) RestoreSnapshot(data []byte) error { return json.Unmarshal(data, &o.total) }
+
+// newTestStore returns a store on an in-memory SQLite database, with the event store tables.
+func newTestStore(t *testing.T, opts ...Option) (*Store, *gorm.DB) {
+	t.Helper()
+
+	database, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	// every connection to an in-memory database opens a new, empty one
+	sqlDB, err := database.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	store := New(database, append([]Option{WithProducer("orders")}, opts...)...)
+	store.Register(orderPlaced{}, &orderPaid{})
+	require.NoError(t, store.Migrate(context.Background()))
+
+	return store, database
+}
+
+func TestStore_decode(t *testing.T) {
+	store := New(nil)
+	store.Register(&orderPlaced{}, &orderPaid{})
+
+	event, err := store.decode("order_placed", []byte(`{"total":10}`))
+	require.NoError(t, err)
+	assert.Equal(t, orderPlaced{Total: 10}, event)
+
+	// only the pointer implements the interface
+	event, err = store.decode("order_paid", []byte(`{}`))
+	require.NoError(t, err)
+	assert.Equal(t, &orderPaid{}, event)
+
+	_, err = store.decode("order_refunded", []byte(`{}`))
+	assert.ErrorIs(t, err, ErrUnknownEventType)
+
+	_, err = store.decode("order_placed", []byte(`{`))
+	assert.Error(t, err)
+}
+
+func TestStore_recordedEvent(t *testing.T) {
+	store := New(nil)
+	store.Register(orderPlaced{})
+
+	envelope := eventbus.Envelope{ID: "1", Type: "order_placed", Version: 1, CorrelationID: "1"}
+	encoded, err := json.Marshal(envelope)
+	require.NoError(t, err)
+
+	event, err := store.recordedEvent(GormEventModel{
+		Position:  7,
+		StreamID:  "order-1",
+		Version:   2,
+		EventType: "order_placed",
+		Envelope:  encoded,
+		Data:      []byte(`{"total":5}`),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, RecordedEvent{
+		StreamID: "order-1",
+		Version:  2,
+		Position: 7,
+		Envelope: envelope,
+		Event:    orderPlaced{Total: 5},
+		Data:     []byte(`{"total":5}`),
+	}, event)
+}
+
+func Test_replay(t *testing.T) {
+	tests := []struct {
+		name        string
+		version     int64
+		events      []RecordedEvent
+		wantVersion int64
+		wantOrder   order
+		wantErr     string
+	}{
+		{
+			name:    "from the start",
+			version: 0,
+			events: []RecordedEvent{
+				{Version: 1, Event: orderPlaced{Total: 10}},
+				{Version: 2, Event: &orderPaid{}},
+			},
+			wantVersion: 2,
+			wantOrder:   order{id: "order-1", total: 10, paid: true},
+		},
+		{
+			name:        "from a snapshot",
+			version:     1,
+			events:      []RecordedEvent{{Version: 2, Event: &orderPaid{}}},
+			wantVersion: 2,
+			wantOrder:   order{id: "order-1", paid: true},
+		},
+		{
+			name:        "no events",
+			version:     3,
+			wantVersion: 3,
+			wantOrder:   order{id: "order-1"},
+		},
+		{
+			name:      "version gap",
+			events:    []RecordedEvent{{Version: 2, Event: &orderPaid{}}},
+			wantOrder: order{id: "order-1"},
+			wantErr:   "stream order-1: expected version 1, got 2",
+		},
+		{
+			name:    "apply error",
+			version: 0,
+			events: []RecordedEvent{
+				{Version: 1, Event: &orderPaid{}},
+				{Version: 2, Event: &orderPaid{}, Envelope: eventbus.Envelope{Type: "order_paid"}},
+			},
+			wantOrder: order{id: "order-1", paid: true},
+			wantErr:   "apply order_paid version 2: already paid",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aggregate := &order{id: "order-1"}
+
+			version, err := replay(aggregate, tt.version, tt.events)
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.wantVersion, version)
+			}
+
+			assert.Equal(t, tt.wantOrder, *aggregate)
+		})
+	}
+}
+
+func TestStore_shouldSnapshot(t *testing.T) {
+	assert.False(t, New(nil).shouldSnapshot(0, 100))
+
+	store := New(nil, WithSnapshotEvery(10))
+
+	assert.False(t, store.shouldSnapshot(0, 9))
+	assert.True(t, store.shouldSnapshot(9, 10))
+	assert.True(t, store.shouldSnapshot(8, 12))
+	assert.False(t, store.shouldSnapshot(10, 19))
+	assert.True(t, store.shouldSnapshot(10, 25))
+}
+
+func TestStore_Append(t *testing.T) {
+	ctx := context.Background()
+	store, _ := newTestStore(t)
+
+	_, err := store.Append(ctx, "order-1", ExpectedNoStream)
+	require.ErrorIs(t, err, ErrNoEvents)
+
+	version, err := store.Append(ctx, "order-1", ExpectedNoStream, orderPlaced{Total: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+
+	// the stream has events already
+	_, err = store.Append(ctx, "order-1", ExpectedNoStream, orderPlaced{Total: 20})
+	require.ErrorIs(t, err, ErrConcurrencyConflict)
+
+	// someone else appended since version 1 was read
+	version, err = store.Append(ctx, "order-1", 1, &orderPaid{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+
+	_, err = store.Append(ctx, "order-1", 1, &orderPaid{})
+	require.ErrorIs(t, err, ErrConcurrencyConflict)
+
+	version, err = store.Append(ctx, "order-2", ExpectedAnyVersion, orderPlaced{Total: 5}, &orderPaid{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+
+	version, err = store.Append(ctx, "order-2", ExpectedAnyVersion, orderPlaced{Total: 7})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), version)
+
+	version, err = store.Version(ctx, "order-1")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+
+	version, err = store.Version(ctx, "order-3")
+	require.NoError(t, err)
+	assert.Zero(t, version)
+
+	events, err := store.Load(ctx, "order-1", 0)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, orderPlaced{Total: 10}, events[0].Event)
+	assert.Equal(t, "order_placed", events[0].Envelope.Type)
+	assert.Equal(t, "orders", events[0].Envelope.Producer)
+	assert.Equal(t, int64(2), events[1].Version)
+	assert.Equal(t, &orderPaid{}, events[1].Event)
+
+	events, err = store.Load(ctx, "order-2", 1)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, int64(2), events[0].Version)
+
+	// the rejected appends left nothing behind
+	all, err := store.LoadAll(ctx, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, all, 5)
+
+	for i, event := range all {
+		assert.Equal(t, uint64(i+1), event.Position)
+	}
+
+	assert.Equal(t, "order-2", all[2].StreamID)
+
+	placed, err := store.LoadAll(ctx, 1, 2, "order_placed")
+	require.NoError(t, err)
+	require.Len(t, placed, 2)
+	assert.Equal(t, uint64(3), placed[0].Position)
+	assert.Equal(t, uint64(5), placed[1].Position)
+
+	count, err := store.Count(ctx, 1, "order_placed")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), count)
+
+	count, err = store.Count(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), count)
+}
+
+func TestStore_SaveAggregate(t *testing.T) {
+	ctx := context.Background()
+	store, database := newTestStore(t, WithSnapshotEvery(2))
+
+	aggregate := &order{id: "order-1"}
+
+	version, err := store.SaveAggregate(ctx, aggregate, ExpectedNoStream, orderPlaced{Total: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), version)
+	assert.Equal(t, order{id: "order-1", total: 10}, *aggregate)
+
+	_, err = store.SaveAggregate(ctx, &order{id: "order-1"}, ExpectedNoStream, orderPlaced{Total: 10})
+	require.ErrorIs(t, err, ErrConcurrencyConflict)
+
+	// crossing version 2 snapshots the total
+	version, err = store.SaveAggregate(ctx, aggregate, version, &orderPaid{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+
+	var snapshot GormSnapshotModel
+	require.NoError(t, database.First(&snapshot, "stream_id = ?", "order-1").Error)
+	assert.Equal(t, int64(2), snapshot.Version)
+	assert.Equal(t, []byte("10"), snapshot.Data)
+
+	// an older snapshot doesn't replace it
+	require.NoError(t, store.SaveSnapshot(ctx, "order-1", 1, &order{total: 99}))
+	require.NoError(t, database.First(&snapshot, "stream_id = ?", "order-1").Error)
+	assert.Equal(t, int64(2), snapshot.Version)
+	assert.Equal(t, []byte("10"), snapshot.Data)
+
+	// the snapshot keeps the total only, the aggregate is restored from it
+	loaded := &order{id: "order-1"}
+	version, err = store.LoadAggregate(ctx, loaded)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+	assert.Equal(t, order{id: "order-1", total: 10}, *loaded)
+
+	require.NoError(t, store.SaveSnapshot(ctx, "order-1", 3, &order{total: 30}))
+	require.NoError(t, database.First(&snapshot, "stream_id = ?", "order-1").Error)
+	assert.Equal(t, int64(3), snapshot.Version)
+	assert.Equal(t, []byte("30"), snapshot.Data)
+
+	// without snapshots every event is applied
+	unsnapshotted := &unsnapshottedOrder{order{id: "order-1"}}
+	version, err = store.LoadAggregate(ctx, unsnapshotted)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), version)
+	assert.Equal(t, order{id: "order-1", total: 10, paid: true}, unsnapshotted.order)
+}
+
+// unsnapshottedOrder hides the Snapshotter methods of order.
+type unsnapshottedOrder struct {
+	order order
+}
+
+func (o *unsnapshottedOrder) AggregateID() string { return o.order.AggregateID() }
+
+func (o *unsnapshottedOrder) Apply(event distributed.EventInterface) error {
+	return o.order.Apply(event)
+}
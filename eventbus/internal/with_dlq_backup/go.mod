@@ -1,26 +0,0 @@
-module github.com/braiphub/go-core/eventbus
-
-go 1.21.6
-
-require (
-	github.com/braiphub/go-core/log v0.0.1
-	github.com/golang/mock v1.6.0
-	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826
-	github.com/pkg/errors v0.9.1
-	github.com/rabbitmq/amqp091-go v1.9.0
-	github.com/stretchr/testify v1.8.4
-	github.com/wagslane/go-rabbitmq v0.12.4
-)
-
-require (
-	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/fatih/color v1.15.0 // indirect
-	github.com/mattn/go-colorable v0.1.13 // indirect
-	github.com/mattn/go-isatty v0.0.17 // indirect
-	github.com/pmezard/go-difflib v1.0.0 // indirect
-	go.uber.org/atomic v1.11.0 // indirect
-	go.uber.org/multierr v1.11.0 // indirect
-	go.uber.org/zap v1.24.0 // indirect
-	golang.org/x/sys v0.8.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
-)
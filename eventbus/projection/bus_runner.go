@@ -0,0 +1,177 @@
+package projection
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/braiphub/go-core/eventbus/eventstore"
+	"github.com/pkg/errors"
+)
+
+// Subscriber registers the handlers of the projection events, *distributed.EventBus implements it.
+type Subscriber interface {
+	Register(event distributed.EventInterface, handler interface{}, opts ...distributed.HandlerOption) error
+}
+
+// assert meets contract
+var _ Subscriber = &distributed.EventBus{}
+
+// BusRunner feeds the projections from the distributed bus, for services that publish their events
+// without appending them to an event store. The checkpoint position counts the events handled, and
+// an event redelivered with the id of the last one handled is skipped. There's no log to read again:
+// a BusRunner can't catch up or rebuild, events published before Subscribe never reach it.
+//
+// A failing handler returns its error to the bus, which retries it or dead-letters the event.
+type BusRunner struct {
+	checkpoints CheckpointStore
+
+	mu          sync.Mutex
+	projections map[string]*runnerProjection
+}
+
+func NewBusRunner(checkpoints CheckpointStore) *BusRunner {
+	return &BusRunner{
+		checkpoints: checkpoints,
+		projections: make(map[string]*runnerProjection),
+	}
+}
+
+// Add adds projections to the runner, call it before Subscribe.
+func (r *BusRunner) Add(projections ...*Projection) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, projection := range projections {
+		if _, ok := r.projections[projection.name]; ok {
+			return errors.Wrap(ErrDuplicateProjection, projection.name)
+		}
+
+		r.projections[projection.name] = &runnerProjection{Projection: projection}
+	}
+
+	return nil
+}
+
+// Subscribe registers a handler on bus for each event of each projection, named
+// "projection:<name>:<event type>".
+func (r *BusRunner) Subscribe(bus Subscriber) error {
+	for _, projection := range r.list() {
+		for _, model := range projection.models {
+			handler, ptr := r.eventHandler(projection, model)
+
+			name := "projection:" + projection.name + ":" + model.EventType()
+			if err := bus.Register(ptr, handler, distributed.WithHandlerName(name)); err != nil {
+				return errors.Wrap(err, "register "+model.EventType())
+			}
+		}
+	}
+
+	return nil
+}
+
+// eventHandler returns a func(context.Context, T) error handler passing the events of the type T of
+// model to the projection, with the *T model the bus registers it with.
+func (r *BusRunner) eventHandler(
+	projection *runnerProjection,
+	model distributed.EventInterface,
+) (interface{}, distributed.EventInterface) {
+	eventType := reflect.TypeOf(model)
+	if eventType.Kind() == reflect.Ptr {
+		eventType = eventType.Elem()
+	}
+
+	handlerType := reflect.FuncOf(
+		[]reflect.Type{reflect.TypeOf((*context.Context)(nil)).Elem(), eventType},
+		[]reflect.Type{reflect.TypeOf((*error)(nil)).Elem()},
+		false,
+	)
+
+	handler := reflect.MakeFunc(handlerType, func(args []reflect.Value) []reflect.Value {
+		ctx, _ := args[0].Interface().(context.Context)
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		ptr := reflect.New(eventType)
+		ptr.Elem().Set(args[1])
+
+		err := r.handle(ctx, projection, ptr.Interface().(distributed.EventInterface))
+
+		return []reflect.Value{reflect.ValueOf(&err).Elem()}
+	})
+
+	return handler.Interface(), reflect.New(eventType).Interface().(distributed.EventInterface)
+}
+
+// handle passes the event to the projection and saves its checkpoint.
+func (r *BusRunner) handle(ctx context.Context, projection *runnerProjection, event distributed.EventInterface) error {
+	envelope, _ := eventbus.EnvelopeFromContext(ctx)
+	if envelope.Type == "" {
+		envelope.Type = event.EventType()
+	}
+
+	projection.mu.Lock()
+	defer projection.mu.Unlock()
+
+	checkpoint, err := r.checkpoints.Load(ctx, projection.name)
+	if err != nil {
+		return errors.Wrap(err, "load checkpoint")
+	}
+
+	// redelivered after its checkpoint was saved
+	if envelope.ID != "" && envelope.ID == checkpoint.LastEventID {
+		return nil
+	}
+
+	recorded := eventstore.RecordedEvent{
+		Position: checkpoint.Position + 1,
+		Envelope: envelope,
+		Event:    event,
+	}
+
+	if err := projection.handle(ctx, recorded); err != nil {
+		if saveErr := saveFailure(ctx, r.checkpoints, &checkpoint, err); saveErr != nil {
+			return saveErr
+		}
+
+		return errors.Wrapf(err, "projection %s", projection.name)
+	}
+
+	return saveHandled(ctx, r.checkpoints, &checkpoint, recorded)
+}
+
+// Status reports the progress of every projection, sorted by name. The lag is always zero, the bus
+// doesn't tell how many events are waiting.
+func (r *BusRunner) Status(ctx context.Context) ([]Status, error) {
+	projections := r.list()
+	statuses := make([]Status, 0, len(projections))
+
+	for _, projection := range projections {
+		checkpoint, err := r.checkpoints.Load(ctx, projection.name)
+		if err != nil {
+			return nil, errors.Wrap(err, projection.name)
+		}
+
+		statuses = append(statuses, Status{
+			Name:        projection.name,
+			Position:    checkpoint.Position,
+			LastEventID: checkpoint.LastEventID,
+			LastEventAt: checkpoint.LastEventAt,
+			LastError:   checkpoint.LastError,
+			LastErrorAt: checkpoint.LastErrorAt,
+			Failures:    checkpoint.Failures,
+		})
+	}
+
+	return statuses, nil
+}
+
+func (r *BusRunner) list() []*runnerProjection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return sortedProjections(r.projections)
+}
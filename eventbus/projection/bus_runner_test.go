@@ -0,0 +1,92 @@
+package projection
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/braiphub/go-core/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestBusRunner(t *testing.T) {
+	ctx := context.Background()
+	model := &totals{unpaid: make(map[string]int)}
+
+	logger := log.NewMockLoggerI(gomock.NewController(t))
+	logger.EXPECT().Debug(gomock.Any(), gomock.Any()).AnyTimes()
+	logger.EXPECT().Error(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+	pubSub := distributed.NewInMemoryPubSub()
+	bus, err := distributed.New("orders", "projections", distributed.WithLogger(logger), distributed.WithPubSub(pubSub))
+	require.NoError(t, err)
+
+	runner := NewBusRunner(NewInMemoryCheckpointStore())
+	require.NoError(t, runner.Add(newTotalsProjection(t, model)))
+	assert.ErrorIs(t, runner.Add(New("unpaid_totals")), ErrDuplicateProjection)
+	require.NoError(t, runner.Subscribe(bus))
+
+	listenCtx, cancel := context.WithCancel(ctx)
+	errCh := make(chan error, 1)
+
+	go func() { errCh <- bus.StartListen(listenCtx) }()
+
+	handled := func() bool { return pubSub.Pending() == 0 }
+
+	require.NoError(t, bus.Publish(ctx, orderPlaced{OrderID: "1", Total: 10}, orderPlaced{OrderID: "2", Total: 20}))
+	require.NoError(t, bus.Publish(ctx, &orderPaid{OrderID: "1"}))
+	require.Eventually(t, handled, time.Second, time.Millisecond)
+
+	model.mu.Lock()
+	assert.Equal(t, map[string]int{"2": 20}, model.unpaid)
+	model.failFor = "3"
+	model.mu.Unlock()
+
+	// a failing event is dead-lettered, the checkpoint keeps its position
+	require.NoError(t, bus.Publish(ctx, orderPlaced{OrderID: "3", Total: 30}))
+	require.Eventually(t, func() bool { return len(pubSub.Dead()) == 1 }, time.Second, time.Millisecond)
+
+	statuses, err := runner.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "unpaid_totals", statuses[0].Name)
+	assert.Equal(t, uint64(3), statuses[0].Position)
+	assert.Equal(t, "failed", statuses[0].LastError)
+	assert.Equal(t, 1, statuses[0].Failures)
+
+	model.mu.Lock()
+	model.failFor = ""
+	model.mu.Unlock()
+
+	dlq, err := bus.DeadLetterQueue()
+	require.NoError(t, err)
+
+	_, err = dlq.Replay(ctx, distributed.DeadEventFilter{})
+	require.NoError(t, err)
+	require.Eventually(t, handled, time.Second, time.Millisecond)
+
+	// the last event handled is skipped when redelivered
+	envelope := eventbus.Envelope{ID: "order-4", Type: "order_placed", OccurredAt: time.Unix(4, 0)}
+	require.NoError(t, bus.PublishEnvelope(ctx, envelope, []byte(`{"order_id":"4","total":40}`)))
+	require.NoError(t, bus.PublishEnvelope(ctx, envelope, []byte(`{"order_id":"4","total":45}`)))
+	require.Eventually(t, handled, time.Second, time.Millisecond)
+
+	model.mu.Lock()
+	assert.Equal(t, map[string]int{"2": 20, "3": 30, "4": 40}, model.unpaid)
+	model.mu.Unlock()
+
+	statuses, err = runner.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(5), statuses[0].Position)
+	assert.Equal(t, "order-4", statuses[0].LastEventID)
+	assert.Equal(t, time.Unix(4, 0), statuses[0].LastEventAt)
+	assert.Zero(t, statuses[0].Failures)
+	assert.Empty(t, pubSub.Dead())
+
+	cancel()
+	assert.NoError(t, <-errCh)
+}
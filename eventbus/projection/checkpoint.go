@@ -0,0 +1,63 @@
+package projection
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Checkpoint is the progress of a projection: the position of the last event it handled and the
+// last error it got.
+type Checkpoint struct {
+	Name        string
+	Position    uint64
+	LastEventID string
+	LastEventAt time.Time
+	LastError   string
+	LastErrorAt time.Time
+	// Failures counts the errors in a row, it's reset when an event is handled.
+	Failures  int
+	UpdatedAt time.Time
+}
+
+// CheckpointStore keeps the checkpoints of the projections.
+type CheckpointStore interface {
+	// Load returns the checkpoint of the projection, a zero one when it never ran.
+	Load(ctx context.Context, name string) (Checkpoint, error)
+	Save(ctx context.Context, checkpoint Checkpoint) error
+}
+
+// assert meets contract
+var _ CheckpointStore = &InMemoryCheckpointStore{}
+
+// InMemoryCheckpointStore keeps the checkpoints in process, so the projections are rebuilt on start.
+// Use it for read models kept in memory, and a GormCheckpointStore for persisted ones.
+type InMemoryCheckpointStore struct {
+	mu          sync.Mutex
+	checkpoints map[string]Checkpoint
+}
+
+func NewInMemoryCheckpointStore() *InMemoryCheckpointStore {
+	return &InMemoryCheckpointStore{checkpoints: make(map[string]Checkpoint)}
+}
+
+func (s *InMemoryCheckpointStore) Load(_ context.Context, name string) (Checkpoint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	checkpoint, ok := s.checkpoints[name]
+	if !ok {
+		return Checkpoint{Name: name}, nil
+	}
+
+	return checkpoint, nil
+}
+
+func (s *InMemoryCheckpointStore) Save(_ context.Context, checkpoint Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkpoints[checkpoint.Name] = checkpoint
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package projection
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const checkpointsTableName = "eventbus_projection_checkpoints"
+
+type GormCheckpointModel struct {
+	Name        string `gorm:"primaryKey;size:255"`
+	Position    uint64
+	LastEventID string
+	LastEventAt *time.Time
+	LastError   string
+	LastErrorAt *time.Time
+	Failures    int
+	UpdatedAt   time.Time
+}
+
+func (GormCheckpointModel) TableName() string {
+	return checkpointsTableName
+}
+
+// assert meets contract
+var _ CheckpointStore = &GormCheckpointStore{}
+
+// GormCheckpointStore keeps the checkpoints in the database. The table can be created by migrating
+// GormCheckpointModel, keep it in the database of the read models to update them with the checkpoint.
+type GormCheckpointStore struct {
+	database *gorm.DB
+}
+
+func NewGormCheckpointStore(database *gorm.DB) *GormCheckpointStore {
+	return &GormCheckpointStore{database: database}
+}
+
+func (s *GormCheckpointStore) Load(ctx context.Context, name string) (Checkpoint, error) {
+	var model GormCheckpointModel
+
+	result := s.database.WithContext(ctx).
+		Where("name = ?", name).
+		Limit(1).
+		Find(&model)
+	if result.Error != nil {
+		return Checkpoint{}, errors.Wrap(result.Error, "find checkpoint")
+	}
+
+	if result.RowsAffected == 0 {
+		return Checkpoint{Name: name}, nil
+	}
+
+	return Checkpoint{
+		Name:        model.Name,
+		Position:    model.Position,
+		LastEventID: model.LastEventID,
+		LastEventAt: timeValue(model.LastEventAt),
+		LastError:   model.LastError,
+		LastErrorAt: timeValue(model.LastErrorAt),
+		Failures:    model.Failures,
+		UpdatedAt:   model.UpdatedAt,
+	}, nil
+}
+
+func (s *GormCheckpointStore) Save(ctx context.Context, checkpoint Checkpoint) error {
+	model := GormCheckpointModel{
+		Name:        checkpoint.Name,
+		Position:    checkpoint.Position,
+		LastEventID: checkpoint.LastEventID,
+		LastEventAt: timePtr(checkpoint.LastEventAt),
+		LastError:   checkpoint.LastError,
+		LastErrorAt: timePtr(checkpoint.LastErrorAt),
+		Failures:    checkpoint.Failures,
+		UpdatedAt:   checkpoint.UpdatedAt,
+	}
+
+	err := s.database.WithContext(ctx).
+		Clauses(clause.OnConflict{UpdateAll: true}).
+		Create(&model).
+		Error
+	if err != nil {
+		return errors.Wrap(err, "save checkpoint")
+	}
+
+	return nil
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
+
+func timeValue(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+
+	return *t
+}
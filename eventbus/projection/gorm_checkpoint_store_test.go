@@ -0,0 +1,70 @@
+package projection
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestGormCheckpointStore(t *testing.T) {
+	ctx := context.Background()
+
+	database, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	// every connection to an in-memory database opens a new, empty one
+	sqlDB, err := database.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	require.NoError(t, database.AutoMigrate(&GormCheckpointModel{}))
+
+	store := NewGormCheckpointStore(database)
+
+	checkpoint, err := store.Load(ctx, "unpaid_totals")
+	require.NoError(t, err)
+	assert.Equal(t, Checkpoint{Name: "unpaid_totals"}, checkpoint)
+
+	now := time.Now().Truncate(time.Second)
+	failed := Checkpoint{
+		Name:        "unpaid_totals",
+		Position:    3,
+		LastEventID: "3",
+		LastEventAt: now.Add(-time.Minute),
+		LastError:   "failed",
+		LastErrorAt: now,
+		Failures:    2,
+		UpdatedAt:   now,
+	}
+	require.NoError(t, store.Save(ctx, failed))
+
+	checkpoint, err = store.Load(ctx, "unpaid_totals")
+	require.NoError(t, err)
+	assert.Equal(t, failed.Position, checkpoint.Position)
+	assert.Equal(t, failed.LastEventID, checkpoint.LastEventID)
+	assert.True(t, failed.LastEventAt.Equal(checkpoint.LastEventAt))
+	assert.Equal(t, failed.LastError, checkpoint.LastError)
+	assert.True(t, failed.LastErrorAt.Equal(checkpoint.LastErrorAt))
+	assert.Equal(t, 2, checkpoint.Failures)
+
+	// saving again replaces it, clearing the error
+	require.NoError(t, store.Save(ctx, Checkpoint{Name: "unpaid_totals", Position: 4, LastEventID: "4", UpdatedAt: now}))
+
+	checkpoint, err = store.Load(ctx, "unpaid_totals")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), checkpoint.Position)
+	assert.Empty(t, checkpoint.LastError)
+	assert.True(t, checkpoint.LastErrorAt.IsZero())
+	assert.True(t, checkpoint.LastEventAt.IsZero())
+	assert.Zero(t, checkpoint.Failures)
+
+	var count int64
+	require.NoError(t, database.Model(&GormCheckpointModel{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+}
@@ -0,0 +1,151 @@
+package projection
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/braiphub/go-core/eventbus/eventstore"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInvalidEventHandler = errors.New("invalid event handler")
+	ErrRebuildUnsupported  = errors.New("projection has no reset func to rebuild it")
+)
+
+// Projection is a named consumer of events maintaining a read model, fed from the event store by a
+// Runner or from the distributed bus by a BusRunner. Its handlers must be idempotent: an event is
+// handled again when the process stops before its checkpoint is saved.
+type Projection struct {
+	name     string
+	reset    func(ctx context.Context) error
+	models   []distributed.EventInterface
+	handlers map[string][]interface{}
+}
+
+type ProjectionOption func(*Projection)
+
+// WithReset sets the func clearing the read model, needed to rebuild it.
+func WithReset(reset func(ctx context.Context) error) ProjectionOption {
+	return func(p *Projection) {
+		p.reset = reset
+	}
+}
+
+func New(name string, opts ...ProjectionOption) *Projection {
+	projection := &Projection{
+		name:     name,
+		handlers: make(map[string][]interface{}),
+	}
+
+	for _, opt := range opts {
+		opt(projection)
+	}
+
+	return projection
+}
+
+func (p *Projection) Name() string {
+	return p.name
+}
+
+// Register - Handler func should have signature: (context.Context, EventInterface) error
+func (p *Projection) Register(event distributed.EventInterface, handler interface{}) error {
+	eventType := reflect.TypeOf(event)
+	if eventType.Kind() == reflect.Ptr {
+		eventType = eventType.Elem()
+	}
+
+	if err := validateHandler(eventType, handler); err != nil {
+		return errors.Wrap(err, event.EventType())
+	}
+
+	if _, ok := p.handlers[event.EventType()]; !ok {
+		p.models = append(p.models, event)
+	}
+
+	p.handlers[event.EventType()] = append(p.handlers[event.EventType()], handler)
+
+	return nil
+}
+
+// EventTypes returns the types of the events the projection handles.
+func (p *Projection) EventTypes() []string {
+	types := make([]string, 0, len(p.models))
+	for _, model := range p.models {
+		types = append(types, model.EventType())
+	}
+
+	return types
+}
+
+func validateHandler(eventType reflect.Type, handler interface{}) error {
+	handlerType := reflect.TypeOf(handler)
+
+	switch {
+	case handlerType == nil || handlerType.Kind() != reflect.Func:
+		return errors.Wrap(ErrInvalidEventHandler, "handler isn't a func")
+
+	case handlerType.NumIn() != 2:
+		return errors.Wrap(ErrInvalidEventHandler, "handler must take a context and the event")
+
+	case handlerType.In(0) != reflect.TypeOf((*context.Context)(nil)).Elem():
+		return errors.Wrap(ErrInvalidEventHandler, "first handler param isn't a context.Context")
+
+	case !eventType.AssignableTo(handlerType.In(1)) && !reflect.PointerTo(eventType).AssignableTo(handlerType.In(1)):
+		return errors.Wrapf(ErrInvalidEventHandler, "second handler param doesn't accept %s", eventType)
+
+	case handlerType.NumOut() > 0 && handlerType.Out(handlerType.NumOut()-1) != reflect.TypeOf((*error)(nil)).Elem():
+		return errors.Wrap(ErrInvalidEventHandler, "last handler return isn't an error")
+	}
+
+	return nil
+}
+
+// handle passes the event to its handlers, with its envelope in ctx.
+func (p *Projection) handle(ctx context.Context, event eventstore.RecordedEvent) error {
+	ctx = eventbus.ContextWithEnvelope(ctx, event.Envelope)
+
+	for _, handler := range p.handlers[event.Envelope.Type] {
+		if err := callHandler(ctx, handler, event.Event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// callHandler calls handler with the event as the value or pointer it takes.
+func callHandler(ctx context.Context, handler interface{}, event interface{}) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = errors.Errorf("handler panic: %v", recovered)
+		}
+	}()
+
+	handlerValue := reflect.ValueOf(handler)
+	param := handlerValue.Type().In(1)
+
+	eventValue := reflect.ValueOf(event)
+
+	switch {
+	case eventValue.Type().AssignableTo(param):
+	case eventValue.Kind() == reflect.Ptr:
+		eventValue = eventValue.Elem()
+	default:
+		ptr := reflect.New(eventValue.Type())
+		ptr.Elem().Set(eventValue)
+		eventValue = ptr
+	}
+
+	result := handlerValue.Call([]reflect.Value{reflect.ValueOf(ctx), eventValue})
+	if len(result) > 0 {
+		if err, ok := result[len(result)-1].Interface().(error); ok && err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,323 @@
+package projection
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/braiphub/go-core/eventbus/eventstore"
+	"github.com/braiphub/go-core/log"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultInterval  = time.Second
+	defaultBatchSize = 100
+)
+
+var (
+	ErrDuplicateProjection = errors.New("projection already added")
+	ErrUnknownProjection   = errors.New("unknown projection")
+)
+
+// Source is the event log the projections read, *eventstore.Store implements it. A Runner feeds the
+// projections from the log only: events published on the distributed bus without being appended to
+// the store never reach them. Services that don't append their events feed them with a BusRunner.
+type Source interface {
+	Register(events ...distributed.EventInterface)
+	LoadAll(ctx context.Context, afterPosition uint64, limit int, eventTypes ...string) ([]eventstore.RecordedEvent, error)
+	Count(ctx context.Context, afterPosition uint64, eventTypes ...string) (int64, error)
+}
+
+// assert meets contract
+var _ Source = &eventstore.Store{}
+
+// Status reports the progress of a projection.
+type Status struct {
+	Name     string
+	Position uint64
+	// Lag is the number of events the projection didn't handle yet.
+	Lag         int64
+	LastEventID string
+	LastEventAt time.Time
+	LastError   string
+	LastErrorAt time.Time
+	Failures    int
+}
+
+// Runner keeps the projections up to date with the source, saving their checkpoints.
+type Runner struct {
+	source      Source
+	checkpoints CheckpointStore
+	logger      log.LoggerI
+	interval    time.Duration
+	batchSize   int
+
+	mu          sync.Mutex
+	projections map[string]*runnerProjection
+}
+
+type runnerProjection struct {
+	*Projection
+
+	// serializes catching up and rebuilding the projection
+	mu sync.Mutex
+}
+
+type Option func(*Runner)
+
+func WithLogger(logger log.LoggerI) Option {
+	return func(r *Runner) {
+		r.logger = logger
+	}
+}
+
+// WithInterval sets how often Run polls the source for new events, every second by default.
+func WithInterval(interval time.Duration) Option {
+	return func(r *Runner) {
+		r.interval = interval
+	}
+}
+
+// WithBatchSize sets how many events are read at a time, 100 by default.
+func WithBatchSize(size int) Option {
+	return func(r *Runner) {
+		r.batchSize = size
+	}
+}
+
+func NewRunner(source Source, checkpoints CheckpointStore, opts ...Option) *Runner {
+	runner := &Runner{
+		source:      source,
+		checkpoints: checkpoints,
+		interval:    defaultInterval,
+		batchSize:   defaultBatchSize,
+		projections: make(map[string]*runnerProjection),
+	}
+
+	for _, opt := range opts {
+		opt(runner)
+	}
+
+	return runner
+}
+
+// Add adds projections to the runner, registering their events in the source.
+func (r *Runner) Add(projections ...*Projection) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, projection := range projections {
+		if _, ok := r.projections[projection.name]; ok {
+			return errors.Wrap(ErrDuplicateProjection, projection.name)
+		}
+
+		r.source.Register(projection.models...)
+		r.projections[projection.name] = &runnerProjection{Projection: projection}
+	}
+
+	return nil
+}
+
+// Run catches up the projections every interval until ctx is done. A failing projection retries from
+// its checkpoint on the next run, without stopping the others.
+func (r *Runner) Run(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, projection := range r.list() {
+			if _, err := r.catchUp(ctx, projection); err != nil && ctx.Err() == nil && r.logger != nil {
+				r.logger.WithContext(ctx).Error("projection "+projection.name, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// CatchUp handles the events the projection didn't handle yet, returning how many it handled.
+func (r *Runner) CatchUp(ctx context.Context, name string) (int, error) {
+	projection, err := r.get(name)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.catchUp(ctx, projection)
+}
+
+// Rebuild resets the read model of the projection and handles every event again. When the projection
+// runs in other processes, stop them first.
+func (r *Runner) Rebuild(ctx context.Context, name string) (int, error) {
+	projection, err := r.get(name)
+	if err != nil {
+		return 0, err
+	}
+
+	if projection.reset == nil {
+		return 0, errors.Wrap(ErrRebuildUnsupported, name)
+	}
+
+	projection.mu.Lock()
+
+	if err := projection.reset(ctx); err != nil {
+		projection.mu.Unlock()
+
+		return 0, errors.Wrap(err, "reset read model")
+	}
+
+	err = r.checkpoints.Save(ctx, Checkpoint{Name: name, UpdatedAt: time.Now()})
+
+	projection.mu.Unlock()
+
+	if err != nil {
+		return 0, errors.Wrap(err, "reset checkpoint")
+	}
+
+	return r.catchUp(ctx, projection)
+}
+
+// Status reports the progress of every projection, sorted by name.
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	projections := r.list()
+	statuses := make([]Status, 0, len(projections))
+
+	for _, projection := range projections {
+		checkpoint, err := r.checkpoints.Load(ctx, projection.name)
+		if err != nil {
+			return nil, errors.Wrap(err, projection.name)
+		}
+
+		lag, err := r.source.Count(ctx, checkpoint.Position, projection.EventTypes()...)
+		if err != nil {
+			return nil, errors.Wrap(err, projection.name)
+		}
+
+		statuses = append(statuses, Status{
+			Name:        projection.name,
+			Position:    checkpoint.Position,
+			Lag:         lag,
+			LastEventID: checkpoint.LastEventID,
+			LastEventAt: checkpoint.LastEventAt,
+			LastError:   checkpoint.LastError,
+			LastErrorAt: checkpoint.LastErrorAt,
+			Failures:    checkpoint.Failures,
+		})
+	}
+
+	return statuses, nil
+}
+
+func (r *Runner) get(name string) (*runnerProjection, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	projection, ok := r.projections[name]
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownProjection, name)
+	}
+
+	return projection, nil
+}
+
+func (r *Runner) list() []*runnerProjection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return sortedProjections(r.projections)
+}
+
+func sortedProjections(byName map[string]*runnerProjection) []*runnerProjection {
+	projections := make([]*runnerProjection, 0, len(byName))
+	for _, projection := range byName {
+		projections = append(projections, projection)
+	}
+
+	sort.Slice(projections, func(i, j int) bool { return projections[i].name < projections[j].name })
+
+	return projections
+}
+
+// catchUp handles the events after the checkpoint in batches, saving the checkpoint after each
+// event. It stops at the first handler error, recording it in the checkpoint.
+func (r *Runner) catchUp(ctx context.Context, projection *runnerProjection) (int, error) {
+	projection.mu.Lock()
+	defer projection.mu.Unlock()
+
+	if len(projection.models) == 0 {
+		return 0, nil
+	}
+
+	checkpoint, err := r.checkpoints.Load(ctx, projection.name)
+	if err != nil {
+		return 0, errors.Wrap(err, "load checkpoint")
+	}
+
+	handled := 0
+
+	for {
+		events, err := r.source.LoadAll(ctx, checkpoint.Position, r.batchSize, projection.EventTypes()...)
+		if err != nil {
+			return handled, errors.Wrap(err, "load events")
+		}
+
+		for _, event := range events {
+			if err := ctx.Err(); err != nil {
+				return handled, err
+			}
+
+			if err := projection.handle(ctx, event); err != nil {
+				if saveErr := saveFailure(ctx, r.checkpoints, &checkpoint, err); saveErr != nil {
+					return handled, saveErr
+				}
+
+				return handled, errors.Wrapf(err, "handle %s at position %d", event.Envelope.Type, event.Position)
+			}
+
+			if err := saveHandled(ctx, r.checkpoints, &checkpoint, event); err != nil {
+				return handled, err
+			}
+
+			handled++
+		}
+
+		if len(events) < r.batchSize {
+			return handled, nil
+		}
+	}
+}
+
+// saveHandled moves the checkpoint to the event, clearing its failures.
+func saveHandled(ctx context.Context, checkpoints CheckpointStore, checkpoint *Checkpoint, event eventstore.RecordedEvent) error {
+	checkpoint.Position = event.Position
+	checkpoint.LastEventID = event.Envelope.ID
+	checkpoint.LastEventAt = event.Envelope.OccurredAt
+	checkpoint.Failures = 0
+	checkpoint.UpdatedAt = time.Now()
+
+	if err := checkpoints.Save(ctx, *checkpoint); err != nil {
+		return errors.Wrap(err, "save checkpoint")
+	}
+
+	return nil
+}
+
+// saveFailure records the handler error in the checkpoint, keeping its position.
+func saveFailure(ctx context.Context, checkpoints CheckpointStore, checkpoint *Checkpoint, err error) error {
+	checkpoint.LastError = err.Error()
+	checkpoint.LastErrorAt = time.Now()
+	checkpoint.Failures++
+	checkpoint.UpdatedAt = time.Now()
+
+	if err := checkpoints.Save(ctx, *checkpoint); err != nil {
+		return errors.Wrap(err, "save checkpoint")
+	}
+
+	return nil
+}
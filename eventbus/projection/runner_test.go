@@ -0,0 +1,247 @@
+package projection
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/eventbus"
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/braiphub/go-core/eventbus/eventstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type orderPlaced struct {
+	OrderID string `json:"order_id"`
+	Total   int    `json:"total"`
+}
+
+func (orderPlaced) EventType() string { return "order_placed" }
+
+type orderPaid struct {
+	OrderID string `json:"order_id"`
+}
+
+func (*orderPaid) EventType() string { return "order_paid" }
+
+// memorySource is a Source of already decoded events.
+type memorySource struct {
+	mu     sync.Mutex
+	events []eventstore.RecordedEvent
+}
+
+func (s *memorySource) Register(...distributed.EventInterface) {}
+
+func (s *memorySource) append(events ...distributed.EventInterface) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, event := range events {
+		position := uint64(len(s.events) + 1)
+
+		s.events = append(s.events, eventstore.RecordedEvent{
+			Position: position,
+			Envelope: eventbus.Envelope{
+				ID:         strconv.FormatUint(position, 10),
+				Type:       event.EventType(),
+				OccurredAt: time.Unix(int64(position), 0),
+			},
+			Event: event,
+		})
+	}
+}
+
+func (s *memorySource) LoadAll(
+	_ context.Context,
+	afterPosition uint64,
+	limit int,
+	eventTypes ...string,
+) ([]eventstore.RecordedEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var events []eventstore.RecordedEvent
+
+	for _, event := range s.events {
+		if event.Position > afterPosition && slices.Contains(eventTypes, event.Envelope.Type) && len(events) < limit {
+			events = append(events, event)
+		}
+	}
+
+	return events, nil
+}
+
+func (s *memorySource) Count(ctx context.Context, afterPosition uint64, eventTypes ...string) (int64, error) {
+	events, err := s.LoadAll(ctx, afterPosition, len(s.events), eventTypes...)
+
+	return int64(len(events)), err
+}
+
+// totals is the read model of the tests, the total of the unpaid orders.
+type totals struct {
+	mu      sync.Mutex
+	unpaid  map[string]int
+	failFor string
+}
+
+func newTotalsProjection(t *testing.T, model *totals) *Projection {
+	t.Helper()
+
+	projection := New("unpaid_totals", WithReset(func(context.Context) error {
+		model.mu.Lock()
+		defer model.mu.Unlock()
+
+		model.unpaid = make(map[string]int)
+
+		return nil
+	}))
+
+	require.NoError(t, projection.Register(&orderPlaced{}, func(ctx context.Context, event orderPlaced) error {
+		model.mu.Lock()
+		defer model.mu.Unlock()
+
+		if event.OrderID == model.failFor {
+			return errors.New("failed")
+		}
+
+		model.unpaid[event.OrderID] = event.Total
+
+		return nil
+	}))
+	require.NoError(t, projection.Register(&orderPaid{}, func(ctx context.Context, event *orderPaid) error {
+		envelope, ok := eventbus.EnvelopeFromContext(ctx)
+		require.True(t, ok)
+		require.Equal(t, "order_paid", envelope.Type)
+
+		model.mu.Lock()
+		defer model.mu.Unlock()
+
+		delete(model.unpaid, event.OrderID)
+
+		return nil
+	}))
+
+	return projection
+}
+
+type otherEvent struct{}
+
+func (otherEvent) EventType() string { return "other_event" }
+
+func TestProjection_Register(t *testing.T) {
+	projection := New("test")
+
+	assert.NoError(t, projection.Register(&orderPlaced{}, func(context.Context, orderPlaced) error { return nil }))
+	assert.NoError(t, projection.Register(&orderPlaced{}, func(context.Context, *orderPlaced) {}))
+	assert.NoError(t, projection.Register(orderPlaced{}, func(context.Context, distributed.EventInterface) error { return nil }))
+
+	assert.ErrorIs(t, projection.Register(&orderPlaced{}, "handler"), ErrInvalidEventHandler)
+	assert.ErrorIs(t, projection.Register(&orderPlaced{}, func(orderPlaced) error { return nil }), ErrInvalidEventHandler)
+	assert.ErrorIs(t, projection.Register(&orderPlaced{}, func(context.Context, orderPaid) error { return nil }), ErrInvalidEventHandler)
+	assert.ErrorIs(t, projection.Register(&orderPlaced{}, func(context.Context, orderPlaced) string { return "" }), ErrInvalidEventHandler)
+
+	assert.Equal(t, []string{"order_placed"}, projection.EventTypes())
+}
+
+func TestRunner(t *testing.T) {
+	ctx := context.Background()
+	source := &memorySource{}
+	model := &totals{unpaid: make(map[string]int)}
+	checkpoints := NewInMemoryCheckpointStore()
+
+	runner := NewRunner(source, checkpoints, WithBatchSize(2))
+	require.NoError(t, runner.Add(newTotalsProjection(t, model)))
+	assert.ErrorIs(t, runner.Add(New("unpaid_totals")), ErrDuplicateProjection)
+
+	source.append(
+		orderPlaced{OrderID: "1", Total: 10},
+		otherEvent{},
+		orderPlaced{OrderID: "2", Total: 20},
+		&orderPaid{OrderID: "1"},
+	)
+
+	handled, err := runner.CatchUp(ctx, "unpaid_totals")
+	require.NoError(t, err)
+	assert.Equal(t, 3, handled)
+	assert.Equal(t, map[string]int{"2": 20}, model.unpaid)
+
+	// a failing event stops the projection at its position
+	model.failFor = "3"
+	source.append(orderPlaced{OrderID: "3", Total: 30}, orderPlaced{OrderID: "4", Total: 40})
+
+	handled, err = runner.CatchUp(ctx, "unpaid_totals")
+	assert.ErrorContains(t, err, "handle order_placed at position 5: failed")
+	assert.Zero(t, handled)
+
+	statuses, err := runner.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "unpaid_totals", statuses[0].Name)
+	assert.Equal(t, uint64(4), statuses[0].Position)
+	assert.Equal(t, int64(2), statuses[0].Lag)
+	assert.Equal(t, "4", statuses[0].LastEventID)
+	assert.Equal(t, time.Unix(4, 0), statuses[0].LastEventAt)
+	assert.Equal(t, "failed", statuses[0].LastError)
+	assert.Equal(t, 1, statuses[0].Failures)
+
+	model.failFor = ""
+
+	handled, err = runner.CatchUp(ctx, "unpaid_totals")
+	require.NoError(t, err)
+	assert.Equal(t, 2, handled)
+	assert.Equal(t, map[string]int{"2": 20, "3": 30, "4": 40}, model.unpaid)
+
+	statuses, err = runner.Status(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, statuses[0].Lag)
+	assert.Zero(t, statuses[0].Failures)
+
+	// rebuild from scratch
+	model.unpaid["stale"] = 1
+
+	handled, err = runner.Rebuild(ctx, "unpaid_totals")
+	require.NoError(t, err)
+	assert.Equal(t, 5, handled)
+	assert.Equal(t, map[string]int{"2": 20, "3": 30, "4": 40}, model.unpaid)
+
+	_, err = runner.CatchUp(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrUnknownProjection)
+}
+
+func TestRunner_Rebuild_Unsupported(t *testing.T) {
+	runner := NewRunner(&memorySource{}, NewInMemoryCheckpointStore())
+	require.NoError(t, runner.Add(New("no_reset")))
+
+	_, err := runner.Rebuild(context.Background(), "no_reset")
+	assert.ErrorIs(t, err, ErrRebuildUnsupported)
+}
+
+func TestRunner_Run(t *testing.T) {
+	source := &memorySource{}
+	model := &totals{unpaid: make(map[string]int)}
+
+	runner := NewRunner(source, NewInMemoryCheckpointStore(), WithInterval(time.Millisecond))
+	require.NoError(t, runner.Add(newTotalsProjection(t, model)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+
+	go func() { errCh <- runner.Run(ctx) }()
+
+	source.append(orderPlaced{OrderID: "1", Total: 10})
+
+	assert.Eventually(t, func() bool {
+		model.mu.Lock()
+		defer model.mu.Unlock()
+
+		return model.unpaid["1"] == 10
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-errCh)
+}
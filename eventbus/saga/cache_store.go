@@ -0,0 +1,211 @@
+package saga
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/braiphub/go-core/cache"
+	"github.com/pkg/errors"
+)
+
+const (
+	cacheKeyPrefix = "eventbus:saga:"
+	// an unfinished instance has a key of its own under this prefix, listed by List
+	cacheOpenKeyPrefix = "eventbus:saga-open:"
+	defaultFinishedTTL = 7 * 24 * time.Hour
+)
+
+// Cache is the cache of a CacheStore, setting keys only when they don't exist and scanning the keys
+// matching a pattern, e.g.: *redis.RedisAdapter.
+type Cache interface {
+	cache.Cacherer
+	SetNX(ctx context.Context, key string, value interface{}, duration time.Duration) (bool, error)
+	Scan(ctx context.Context, pattern string) ([]string, error)
+}
+
+// assert meets contract
+var _ Store = &CacheStore{}
+
+// CacheStore keeps the instances in a Cache, e.g.: redis. Each unfinished instance is marked by a key
+// of its own, so processes never overwrite each other's marks, and List scans the marks. Create is
+// atomic, a redelivered start event can't create an instance twice, but the cache has no
+// transactions, so the version check of Save isn't atomic across processes: run the sagas of a
+// definition in a single daemon. Finished instances expire after finishedTTL and aren't listed.
+type CacheStore struct {
+	cache       Cache
+	finishedTTL time.Duration
+
+	// serializes the version checks in process
+	mu sync.Mutex
+}
+
+// NewCacheStore creates a store keeping finished instances for finishedTTL, 7 days when <= 0.
+func NewCacheStore(cacher Cache, finishedTTL time.Duration) *CacheStore {
+	if finishedTTL <= 0 {
+		finishedTTL = defaultFinishedTTL
+	}
+
+	return &CacheStore{
+		cache:       cacher,
+		finishedTTL: finishedTTL,
+	}
+}
+
+func (s *CacheStore) Create(ctx context.Context, instance *Instance) error {
+	created := *instance
+	created.Version = 1
+
+	data, err := json.Marshal(&created)
+	if err != nil {
+		return errors.Wrap(err, "marshal saga instance")
+	}
+
+	key := s.key(instance.Saga, instance.ID)
+
+	ok, err := s.cache.SetNX(ctx, key, data, s.expiration(instance))
+	if err != nil {
+		return errors.Wrap(err, "create saga instance")
+	}
+
+	if !ok {
+		return errors.Wrap(ErrInstanceExists, instance.ID)
+	}
+
+	instance.Version = created.Version
+
+	return s.mark(ctx, key, instance)
+}
+
+func (s *CacheStore) Get(ctx context.Context, saga, id string) (*Instance, error) {
+	return s.get(ctx, saga, id)
+}
+
+func (s *CacheStore) Save(ctx context.Context, instance *Instance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.get(ctx, instance.Saga, instance.ID)
+	if err != nil {
+		return err
+	}
+
+	if stored.Version != instance.Version {
+		return errors.Wrap(ErrConcurrencyConflict, instance.ID)
+	}
+
+	instance.Version++
+
+	if err := s.set(ctx, instance); err != nil {
+		instance.Version--
+
+		return err
+	}
+
+	return nil
+}
+
+func (s *CacheStore) List(ctx context.Context, filter Filter) ([]*Instance, error) {
+	open, err := s.cache.Scan(ctx, cacheOpenKeyPrefix+"*")
+	if err != nil {
+		return nil, errors.Wrap(err, "list saga instances")
+	}
+
+	instances := make([]*Instance, 0)
+
+	for _, key := range open {
+		instance, err := s.cache.Get(ctx, cacheKeyPrefix+strings.TrimPrefix(key, cacheOpenKeyPrefix))
+
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			continue
+		case err != nil:
+			return nil, errors.Wrap(err, "get saga instance")
+		}
+
+		var decoded Instance
+		if err := json.Unmarshal(instance, &decoded); err != nil {
+			return nil, errors.Wrap(err, "unmarshal saga instance")
+		}
+
+		// the mark outlives the instance when the process stopped between their writes
+		if !decoded.Status.IsFinal() && filter.Match(&decoded) {
+			instances = append(instances, &decoded)
+		}
+	}
+
+	sortInstances(instances)
+
+	return instances, nil
+}
+
+func (s *CacheStore) get(ctx context.Context, saga, id string) (*Instance, error) {
+	data, err := s.cache.Get(ctx, s.key(saga, id))
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, errors.Wrap(ErrInstanceNotFound, id)
+	case err != nil:
+		return nil, errors.Wrap(err, "get saga instance")
+	}
+
+	var instance Instance
+	if err := json.Unmarshal(data, &instance); err != nil {
+		return nil, errors.Wrap(err, "unmarshal saga instance")
+	}
+
+	return &instance, nil
+}
+
+// set stores the instance, marking it while it's unfinished.
+func (s *CacheStore) set(ctx context.Context, instance *Instance) error {
+	data, err := json.Marshal(instance)
+	if err != nil {
+		return errors.Wrap(err, "marshal saga instance")
+	}
+
+	key := s.key(instance.Saga, instance.ID)
+
+	if err := s.cache.Set(ctx, key, data, s.expiration(instance)); err != nil {
+		return errors.Wrap(err, "set saga instance")
+	}
+
+	return s.mark(ctx, key, instance)
+}
+
+// mark marks the instance stored at key while it's unfinished, and unmarks it once it finished.
+func (s *CacheStore) mark(ctx context.Context, key string, instance *Instance) error {
+	if !instance.Status.IsFinal() {
+		if err := s.cache.Set(ctx, s.openKey(key), []byte{}, 0); err != nil {
+			return errors.Wrap(err, "mark saga instance")
+		}
+
+		return nil
+	}
+
+	if err := s.cache.Delete(ctx, s.openKey(key)); err != nil {
+		return errors.Wrap(err, "unmark saga instance")
+	}
+
+	return nil
+}
+
+// expiration keeps the unfinished instances, and the finished ones for finishedTTL.
+func (s *CacheStore) expiration(instance *Instance) time.Duration {
+	if instance.Status.IsFinal() {
+		return s.finishedTTL
+	}
+
+	return 0
+}
+
+func (s *CacheStore) key(saga, id string) string {
+	return cacheKeyPrefix + saga + ":" + id
+}
+
+func (s *CacheStore) openKey(key string) string {
+	return cacheOpenKeyPrefix + strings.TrimPrefix(key, cacheKeyPrefix)
+}
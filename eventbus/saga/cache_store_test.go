@@ -0,0 +1,262 @@
+package saga
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryCache is a Cache without expiration, its Scan matches prefix* patterns only.
+type memoryCache struct {
+	mu     sync.Mutex
+	values map[string][]byte
+	ttls   map[string]time.Duration
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{
+		values: make(map[string][]byte),
+		ttls:   make(map[string]time.Duration),
+	}
+}
+
+func (c *memoryCache) TestConnection(context.Context) error { return nil }
+
+func (c *memoryCache) Set(_ context.Context, key string, value interface{}, duration time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[key] = value.([]byte)
+	c.ttls[key] = duration
+
+	return nil
+}
+
+func (c *memoryCache) SetNX(_ context.Context, key string, value interface{}, duration time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.values[key]; ok {
+		return false, nil
+	}
+
+	c.values[key] = value.([]byte)
+	c.ttls[key] = duration
+
+	return true, nil
+}
+
+func (c *memoryCache) Get(_ context.Context, key string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.values[key]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+
+	return value, nil
+}
+
+func (c *memoryCache) GetString(ctx context.Context, key string) (string, error) {
+	value, err := c.Get(ctx, key)
+
+	return string(value), err
+}
+
+func (c *memoryCache) GetInt(context.Context, string) (int, error) { return 0, nil }
+
+func (c *memoryCache) GetUint(context.Context, string) (uint, error) { return 0, nil }
+
+func (c *memoryCache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.values, key)
+
+	return nil
+}
+
+func (c *memoryCache) Scan(_ context.Context, pattern string) ([]string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var keys []string
+
+	for key := range c.values {
+		if strings.HasPrefix(key, strings.TrimSuffix(pattern, "*")) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"in memory": func(*testing.T) Store { return NewInMemoryStore() },
+		"cache":     func(*testing.T) Store { return NewCacheStore(newMemoryCache(), 0) },
+		"gorm":      func(t *testing.T) Store { return NewGormStore(newTestDatabase(t)) },
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			store := newStore(t)
+			now := time.Now().UTC()
+
+			first := &Instance{Saga: "checkout", ID: "1", Status: StatusRunning, CreatedAt: now, Deadline: now}
+			second := &Instance{Saga: "checkout", ID: "2", Status: StatusRunning, CreatedAt: now.Add(time.Second)}
+
+			require.NoError(t, store.Create(ctx, second))
+			require.NoError(t, store.Create(ctx, first))
+			assert.ErrorIs(t, store.Create(ctx, &Instance{Saga: "checkout", ID: "1"}), ErrInstanceExists)
+			assert.Equal(t, int64(1), first.Version)
+
+			_, err := store.Get(ctx, "checkout", "3")
+			assert.ErrorIs(t, err, ErrInstanceNotFound)
+
+			stale, err := store.Get(ctx, "checkout", "1")
+			require.NoError(t, err)
+
+			first.Stuck = true
+			require.NoError(t, store.Save(ctx, first))
+			assert.Equal(t, int64(2), first.Version)
+			assert.ErrorIs(t, store.Save(ctx, stale), ErrConcurrencyConflict)
+
+			instances, err := store.List(ctx, Filter{Saga: "checkout"})
+			require.NoError(t, err)
+			require.Len(t, instances, 2)
+			assert.Equal(t, "1", instances[0].ID)
+			assert.Equal(t, "2", instances[1].ID)
+
+			instances, err = store.List(ctx, Filter{Stuck: true})
+			require.NoError(t, err)
+			require.Len(t, instances, 1)
+			assert.Equal(t, "1", instances[0].ID)
+
+			instances, err = store.List(ctx, Filter{DeadlineBefore: now.Add(time.Second)})
+			require.NoError(t, err)
+			require.Len(t, instances, 1)
+			assert.Equal(t, "1", instances[0].ID)
+
+			second.Status = StatusCompleted
+			require.NoError(t, store.Save(ctx, second))
+
+			instances, err = store.List(ctx, Filter{Statuses: []Status{StatusRunning}})
+			require.NoError(t, err)
+			require.Len(t, instances, 1)
+			assert.Equal(t, "1", instances[0].ID)
+		})
+	}
+}
+
+func TestCacheStore_FinishedTTL(t *testing.T) {
+	ctx := context.Background()
+	cacher := newMemoryCache()
+	store := NewCacheStore(cacher, time.Hour)
+
+	instance := &Instance{Saga: "checkout", ID: "1", Status: StatusRunning}
+	require.NoError(t, store.Create(ctx, instance))
+	assert.Zero(t, cacher.ttls["eventbus:saga:checkout:1"])
+
+	instance.Status = StatusCompensated
+	require.NoError(t, store.Save(ctx, instance))
+	assert.Equal(t, time.Hour, cacher.ttls["eventbus:saga:checkout:1"])
+
+	// finished instances are unmarked
+	open, err := cacher.Scan(ctx, cacheOpenKeyPrefix+"*")
+	require.NoError(t, err)
+	assert.Empty(t, open)
+
+	_, err = store.Get(ctx, "checkout", "1")
+	assert.NoError(t, err)
+}
+
+func TestCacheStore_List(t *testing.T) {
+	ctx := context.Background()
+	cacher := newMemoryCache()
+
+	// two processes creating instances don't overwrite each other's marks
+	first, second := NewCacheStore(cacher, 0), NewCacheStore(cacher, 0)
+
+	var wg sync.WaitGroup
+
+	for i, store := range []*CacheStore{first, second} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := range 10 {
+				instance := &Instance{Saga: "checkout", ID: strconv.Itoa(i*10 + j), Status: StatusRunning}
+				assert.NoError(t, store.Create(ctx, instance))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	instances, err := first.List(ctx, Filter{})
+	require.NoError(t, err)
+	assert.Len(t, instances, 20)
+
+	// a mark left behind by a process stopped between the writes of a finished instance
+	finished := &Instance{Saga: "checkout", ID: "finished", Status: StatusCompleted}
+	require.NoError(t, first.Create(ctx, finished))
+	require.NoError(t, cacher.Set(ctx, cacheOpenKeyPrefix+"checkout:finished", []byte{}, 0))
+	// and one left by an instance that expired
+	require.NoError(t, cacher.Set(ctx, cacheOpenKeyPrefix+"checkout:expired", []byte{}, 0))
+
+	instances, err = second.List(ctx, Filter{})
+	require.NoError(t, err)
+	assert.Len(t, instances, 20)
+}
+
+func TestCacheStore_CreateConcurrently(t *testing.T) {
+	ctx := context.Background()
+	cacher := newMemoryCache()
+
+	// a start event redelivered to two processes creates the instance once
+	var (
+		wg      sync.WaitGroup
+		created = make(chan string, 2)
+	)
+
+	for i, store := range []*CacheStore{NewCacheStore(cacher, 0), NewCacheStore(cacher, 0)} {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			instance := &Instance{Saga: "checkout", ID: "1", Status: StatusRunning, Error: strconv.Itoa(i)}
+
+			err := store.Create(ctx, instance)
+			if err == nil {
+				created <- instance.Error
+
+				return
+			}
+
+			assert.ErrorIs(t, err, ErrInstanceExists)
+			assert.Zero(t, instance.Version)
+		}()
+	}
+
+	wg.Wait()
+	close(created)
+
+	require.Len(t, created, 1)
+
+	instance, err := NewCacheStore(cacher, 0).Get(ctx, "checkout", "1")
+	require.NoError(t, err)
+	assert.Equal(t, <-created, instance.Error)
+	assert.Equal(t, int64(1), instance.Version)
+}
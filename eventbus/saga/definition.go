@@ -0,0 +1,140 @@
+package saga
+
+import (
+	"context"
+	"time"
+
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/pkg/errors"
+)
+
+var ErrInvalidDefinition = errors.New("invalid saga definition")
+
+// Action runs a step or its compensation, usually publishing the command of another service. The
+// event is the one that triggered it, nil on timeouts and manual resolutions. Changes to the
+// instance data are saved with the instance.
+type Action func(ctx context.Context, instance *Instance, event distributed.EventInterface) error
+
+// Correlate returns the id of the saga instance an event belongs to, empty for events of no instance.
+type Correlate func(event distributed.EventInterface) string
+
+// Definition lists the steps of a saga, run in order. An instance starts on the start event, each
+// step runs its action and waits for one of its completion or failure events. When a step fails or
+// times out, the compensations of the completed steps run in reverse order.
+type Definition struct {
+	name       string
+	startEvent distributed.EventInterface
+	correlate  Correlate
+	steps      []*Step
+}
+
+// Step is a step of a saga definition, see the Step* options.
+type Step struct {
+	name         string
+	action       Action
+	compensation Action
+	timeout      time.Duration
+	completeOn   map[string]Correlate
+	failOn       map[string]Correlate
+	models       []distributed.EventInterface
+}
+
+type StepOption func(*Step)
+
+// NewDefinition defines a saga started by startEvent, correlate returns the id of the new instance.
+func NewDefinition(name string, startEvent distributed.EventInterface, correlate Correlate) *Definition {
+	return &Definition{
+		name:       name,
+		startEvent: startEvent,
+		correlate:  correlate,
+	}
+}
+
+func (d *Definition) Name() string {
+	return d.name
+}
+
+// Step appends a step to the saga.
+func (d *Definition) Step(name string, opts ...StepOption) *Definition {
+	step := &Step{
+		name:       name,
+		completeOn: make(map[string]Correlate),
+		failOn:     make(map[string]Correlate),
+	}
+
+	for _, opt := range opts {
+		opt(step)
+	}
+
+	d.steps = append(d.steps, step)
+
+	return d
+}
+
+// StepAction sets the action starting the step.
+func StepAction(action Action) StepOption {
+	return func(s *Step) {
+		s.action = action
+	}
+}
+
+// StepCompensation sets the action undoing the step once it completed.
+func StepCompensation(compensation Action) StepOption {
+	return func(s *Step) {
+		s.compensation = compensation
+	}
+}
+
+// StepTimeout fails the step when it doesn't complete in time, see Manager.CheckTimeouts.
+func StepTimeout(timeout time.Duration) StepOption {
+	return func(s *Step) {
+		s.timeout = timeout
+	}
+}
+
+// CompleteOn completes the step when the event of the instance is received.
+func CompleteOn(event distributed.EventInterface, correlate Correlate) StepOption {
+	return func(s *Step) {
+		s.completeOn[event.EventType()] = correlate
+		s.models = append(s.models, event)
+	}
+}
+
+// FailOn fails the step when the event of the instance is received.
+func FailOn(event distributed.EventInterface, correlate Correlate) StepOption {
+	return func(s *Step) {
+		s.failOn[event.EventType()] = correlate
+		s.models = append(s.models, event)
+	}
+}
+
+func (d *Definition) validate() error {
+	switch {
+	case d.name == "":
+		return errors.Wrap(ErrInvalidDefinition, "empty name")
+
+	case d.startEvent == nil || d.correlate == nil:
+		return errors.Wrap(ErrInvalidDefinition, d.name+": no start event")
+
+	case len(d.steps) == 0:
+		return errors.Wrap(ErrInvalidDefinition, d.name+": no steps")
+	}
+
+	for _, step := range d.steps {
+		if len(step.completeOn) == 0 {
+			return errors.Wrapf(ErrInvalidDefinition, "%s: step %s has no completion event", d.name, step.name)
+		}
+	}
+
+	return nil
+}
+
+// models returns the events the saga handles.
+func (d *Definition) models() []distributed.EventInterface {
+	models := []distributed.EventInterface{d.startEvent}
+	for _, step := range d.steps {
+		models = append(models, step.models...)
+	}
+
+	return models
+}
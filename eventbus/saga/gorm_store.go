@@ -0,0 +1,207 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const instancesTableName = "eventbus_saga_instances"
+
+type GormInstanceModel struct {
+	Saga      string `gorm:"primaryKey;size:255"`
+	ID        string `gorm:"primaryKey;size:255"`
+	Status    string `gorm:"size:32;index"`
+	Step      int
+	Completed int
+	Data      []byte
+	Deadline  *time.Time `gorm:"index"`
+	Stuck     bool       `gorm:"index"`
+	Error     string
+	History   []byte
+	Version   int64
+	CreatedAt time.Time `gorm:"index"`
+	UpdatedAt time.Time
+}
+
+func (GormInstanceModel) TableName() string {
+	return instancesTableName
+}
+
+// assert meets contract
+var _ Store = &GormStore{}
+
+// GormStore keeps the instances in the database, e.g.: postgres. The table can be created by
+// migrating GormInstanceModel.
+type GormStore struct {
+	database *gorm.DB
+}
+
+func NewGormStore(database *gorm.DB) *GormStore {
+	return &GormStore{database: database}
+}
+
+func (s *GormStore) Create(ctx context.Context, instance *Instance) error {
+	instance.Version = 1
+
+	model, err := newGormInstanceModel(instance)
+	if err != nil {
+		return err
+	}
+
+	result := s.database.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model)
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "create saga instance")
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.Wrap(ErrInstanceExists, instance.ID)
+	}
+
+	return nil
+}
+
+func (s *GormStore) Get(ctx context.Context, saga, id string) (*Instance, error) {
+	var model GormInstanceModel
+
+	result := s.database.WithContext(ctx).
+		Where("saga = ? AND id = ?", saga, id).
+		Limit(1).
+		Find(&model)
+	if result.Error != nil {
+		return nil, errors.Wrap(result.Error, "find saga instance")
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, errors.Wrap(ErrInstanceNotFound, id)
+	}
+
+	return model.instance()
+}
+
+func (s *GormStore) Save(ctx context.Context, instance *Instance) error {
+	model, err := newGormInstanceModel(instance)
+	if err != nil {
+		return err
+	}
+
+	model.Version++
+
+	result := s.database.WithContext(ctx).
+		Model(&GormInstanceModel{}).
+		Where("saga = ? AND id = ? AND version = ?", instance.Saga, instance.ID, instance.Version).
+		Select("*").
+		Omit("saga", "id", "created_at").
+		Updates(&model)
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "update saga instance")
+	}
+
+	if result.RowsAffected == 0 {
+		return errors.Wrap(ErrConcurrencyConflict, instance.ID)
+	}
+
+	instance.Version = model.Version
+
+	return nil
+}
+
+func (s *GormStore) List(ctx context.Context, filter Filter) ([]*Instance, error) {
+	query := s.database.WithContext(ctx)
+
+	if filter.Saga != "" {
+		query = query.Where("saga = ?", filter.Saga)
+	}
+
+	if len(filter.Statuses) > 0 {
+		query = query.Where("status IN ?", filter.Statuses)
+	}
+
+	if filter.Stuck {
+		query = query.Where("stuck = ?", true)
+	}
+
+	if !filter.DeadlineBefore.IsZero() {
+		query = query.Where("deadline < ?", filter.DeadlineBefore)
+	}
+
+	var models []GormInstanceModel
+	if err := query.Order("created_at, id").Find(&models).Error; err != nil {
+		return nil, errors.Wrap(err, "find saga instances")
+	}
+
+	instances := make([]*Instance, 0, len(models))
+
+	for _, model := range models {
+		instance, err := model.instance()
+		if err != nil {
+			return nil, err
+		}
+
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
+
+func newGormInstanceModel(instance *Instance) (GormInstanceModel, error) {
+	history, err := json.Marshal(instance.History)
+	if err != nil {
+		return GormInstanceModel{}, errors.Wrap(err, "marshal saga history")
+	}
+
+	model := GormInstanceModel{
+		Saga:      instance.Saga,
+		ID:        instance.ID,
+		Status:    string(instance.Status),
+		Step:      instance.Step,
+		Completed: instance.Completed,
+		Data:      instance.Data,
+		Stuck:     instance.Stuck,
+		Error:     instance.Error,
+		History:   history,
+		Version:   instance.Version,
+		CreatedAt: instance.CreatedAt,
+		UpdatedAt: instance.UpdatedAt,
+	}
+
+	if !instance.Deadline.IsZero() {
+		model.Deadline = &instance.Deadline
+	}
+
+	return model, nil
+}
+
+func (model GormInstanceModel) instance() (*Instance, error) {
+	instance := &Instance{
+		Saga:      model.Saga,
+		ID:        model.ID,
+		Status:    Status(model.Status),
+		Step:      model.Step,
+		Completed: model.Completed,
+		Data:      model.Data,
+		Stuck:     model.Stuck,
+		Error:     model.Error,
+		Version:   model.Version,
+		CreatedAt: model.CreatedAt,
+		UpdatedAt: model.UpdatedAt,
+	}
+
+	if model.Deadline != nil {
+		instance.Deadline = *model.Deadline
+	}
+
+	if len(model.History) > 0 {
+		if err := json.Unmarshal(model.History, &instance.History); err != nil {
+			return nil, errors.Wrap(err, "unmarshal saga history")
+		}
+	}
+
+	return instance, nil
+}
@@ -0,0 +1,89 @@
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newTestDatabase returns an in-memory SQLite database with the instances table.
+func newTestDatabase(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	database, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	// every connection to an in-memory database opens a new, empty one
+	sqlDB, err := database.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	require.NoError(t, database.AutoMigrate(&GormInstanceModel{}))
+
+	return database
+}
+
+func TestGormStore_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := NewGormStore(newTestDatabase(t))
+	now := time.Now().UTC().Truncate(time.Second)
+
+	instance := &Instance{
+		Saga:      "checkout",
+		ID:        "1",
+		Status:    StatusCompensating,
+		Step:      1,
+		Completed: 2,
+		Data:      json.RawMessage(`{"order_id":"1"}`),
+		Deadline:  now.Add(time.Minute),
+		Stuck:     true,
+		Error:     "payment declined",
+		History: []HistoryEntry{
+			{At: now, Step: "reserve", Action: "completed", Event: "stock_reserved"},
+			{At: now, Step: "charge", Action: "failed", Error: "payment declined"},
+		},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	require.NoError(t, store.Create(ctx, instance))
+
+	stored, err := store.Get(ctx, "checkout", "1")
+	require.NoError(t, err)
+	assert.Equal(t, instance.Status, stored.Status)
+	assert.Equal(t, 1, stored.Step)
+	assert.Equal(t, 2, stored.Completed)
+	assert.JSONEq(t, `{"order_id":"1"}`, string(stored.Data))
+	assert.True(t, instance.Deadline.Equal(stored.Deadline))
+	assert.True(t, stored.Stuck)
+	assert.Equal(t, "payment declined", stored.Error)
+	require.Len(t, stored.History, 2)
+	assert.Equal(t, "stock_reserved", stored.History[0].Event)
+	assert.True(t, now.Equal(stored.History[1].At))
+	assert.Equal(t, int64(1), stored.Version)
+
+	// saving clears the fields zeroed on the instance
+	stored.Status = StatusCompensated
+	stored.Deadline = time.Time{}
+	stored.Stuck = false
+	stored.Error = ""
+	require.NoError(t, store.Save(ctx, stored))
+	assert.Equal(t, int64(2), stored.Version)
+
+	saved, err := store.Get(ctx, "checkout", "1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompensated, saved.Status)
+	assert.True(t, saved.Deadline.IsZero())
+	assert.False(t, saved.Stuck)
+	assert.Empty(t, saved.Error)
+	assert.True(t, now.Equal(saved.CreatedAt), "the creation time is kept")
+
+	_, err = store.Get(ctx, "other", "1")
+	assert.ErrorIs(t, err, ErrInstanceNotFound)
+}
@@ -0,0 +1,121 @@
+package saga
+
+import (
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type Status string
+
+const (
+	StatusRunning      Status = "running"
+	StatusCompensating Status = "compensating"
+	StatusCompleted    Status = "completed"
+	StatusCompensated  Status = "compensated"
+	// StatusAborted is set by ResolveAbort, the instance stops without running any action.
+	StatusAborted Status = "aborted"
+)
+
+// IsFinal reports whether the instance is done with its steps and compensations.
+func (s Status) IsFinal() bool {
+	return s == StatusCompleted || s == StatusCompensated || s == StatusAborted
+}
+
+// Instance is the persisted state of a running saga.
+type Instance struct {
+	Saga   string
+	ID     string
+	Status Status
+	// Step is the index of the step running, or being compensated.
+	Step int
+	// Completed is the number of steps completed and not compensated yet.
+	Completed int
+	// Data is the saga data, the start event until an action encodes something else.
+	Data json.RawMessage
+	// Deadline is the timeout of the running step, zero when it has none.
+	Deadline time.Time
+	// Stuck instances ignore their events until resolved, see Manager.Resolve. Error is the reason.
+	Stuck   bool
+	Error   string
+	History []HistoryEntry
+	// Version is the optimistic lock of the stores, incremented on save.
+	Version   int64
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// HistoryEntry records a transition of an instance.
+type HistoryEntry struct {
+	At     time.Time `json:"at"`
+	Step   string    `json:"step,omitempty"`
+	Action string    `json:"action"`
+	Event  string    `json:"event,omitempty"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// Decode unmarshals the instance data into v.
+func (i *Instance) Decode(v any) error {
+	if err := json.Unmarshal(i.Data, v); err != nil {
+		return errors.Wrap(err, "unmarshal saga data")
+	}
+
+	return nil
+}
+
+// Encode replaces the instance data with v.
+func (i *Instance) Encode(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "marshal saga data")
+	}
+
+	i.Data = data
+
+	return nil
+}
+
+func (i *Instance) record(step, action, event string, err error) {
+	entry := HistoryEntry{
+		At:     time.Now().UTC(),
+		Step:   step,
+		Action: action,
+		Event:  event,
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	i.History = append(i.History, entry)
+}
+
+// Filter selects instances, empty fields match every instance.
+type Filter struct {
+	Saga     string
+	Statuses []Status
+	// Stuck only matches the stuck instances.
+	Stuck bool
+	// DeadlineBefore matches the instances with a step deadline before it.
+	DeadlineBefore time.Time
+}
+
+func (f Filter) Match(instance *Instance) bool {
+	switch {
+	case f.Saga != "" && instance.Saga != f.Saga:
+		return false
+
+	case len(f.Statuses) > 0 && !slices.Contains(f.Statuses, instance.Status):
+		return false
+
+	case f.Stuck && !instance.Stuck:
+		return false
+
+	case !f.DeadlineBefore.IsZero() && (instance.Deadline.IsZero() || !instance.Deadline.Before(f.DeadlineBefore)):
+		return false
+	}
+
+	return true
+}
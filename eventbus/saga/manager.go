@@ -0,0 +1,569 @@
+package saga
+
+import (
+	"context"
+	stderrors "errors"
+	"hash/fnv"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/braiphub/go-core/log"
+	"github.com/braiphub/go-core/schedule"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultTimeoutInterval = 10 * time.Second
+	instanceLocks          = 64
+)
+
+var (
+	ErrDuplicateSaga     = errors.New("saga already added")
+	ErrUnknownSaga       = errors.New("unknown saga")
+	ErrInstanceFinished  = errors.New("saga instance is finished")
+	ErrUnknownResolution = errors.New("unknown resolution")
+	ErrStepTimeout       = errors.New("step timeout")
+)
+
+// Resolution resolves a stuck, or waiting, instance by hand.
+type Resolution string
+
+const (
+	// ResolveRetry runs the action of the step again, or resumes the compensations.
+	ResolveRetry Resolution = "retry"
+	// ResolveSkip completes the step without its event, or skips its compensation.
+	ResolveSkip Resolution = "skip"
+	// ResolveCompensate fails the step, compensating the completed ones.
+	ResolveCompensate Resolution = "compensate"
+	// ResolveAbort stops the instance without running any other action.
+	ResolveAbort Resolution = "abort"
+)
+
+// Subscriber registers the handlers of the saga events, *distributed.EventBus implements it.
+type Subscriber interface {
+	Register(event distributed.EventInterface, handler interface{}, opts ...distributed.HandlerOption) error
+}
+
+// assert meets contract
+var _ Subscriber = &distributed.EventBus{}
+
+// Manager runs the saga instances, moving them through their steps as their events are handled.
+// Actions failing mark the instance stuck until it's resolved, see Resolve. Actions run with the
+// instance locked, so they must publish their commands asynchronously.
+type Manager struct {
+	store  Store
+	logger log.LoggerI
+
+	mu          sync.RWMutex
+	definitions map[string]*Definition
+
+	// serialize the transitions of an instance in process, the store version does across processes
+	locks [instanceLocks]sync.Mutex
+}
+
+type Option func(*Manager)
+
+func WithLogger(logger log.LoggerI) Option {
+	return func(m *Manager) {
+		m.logger = logger
+	}
+}
+
+func NewManager(store Store, opts ...Option) *Manager {
+	manager := &Manager{
+		store:       store,
+		definitions: make(map[string]*Definition),
+	}
+
+	for _, opt := range opts {
+		opt(manager)
+	}
+
+	return manager
+}
+
+func (m *Manager) Add(definitions ...*Definition) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, definition := range definitions {
+		if err := definition.validate(); err != nil {
+			return err
+		}
+
+		if _, ok := m.definitions[definition.name]; ok {
+			return errors.Wrap(ErrDuplicateSaga, definition.name)
+		}
+
+		m.definitions[definition.name] = definition
+	}
+
+	return nil
+}
+
+// Subscribe registers a handler on bus for each event of the sagas, passing them to Handle.
+func (m *Manager) Subscribe(bus Subscriber) error {
+	registered := make(map[string]bool)
+
+	for _, definition := range m.list() {
+		for _, model := range definition.models() {
+			if registered[model.EventType()] {
+				continue
+			}
+
+			registered[model.EventType()] = true
+
+			handler, ptr := m.eventHandler(model)
+
+			err := bus.Register(ptr, handler, distributed.WithHandlerName("saga:"+model.EventType()))
+			if err != nil {
+				return errors.Wrap(err, "register "+model.EventType())
+			}
+		}
+	}
+
+	return nil
+}
+
+// eventHandler returns a func(context.Context, T) error handler for the event type T of model, with
+// the *T model the bus registers it with.
+func (m *Manager) eventHandler(model distributed.EventInterface) (interface{}, distributed.EventInterface) {
+	eventType := reflect.TypeOf(model)
+	if eventType.Kind() == reflect.Ptr {
+		eventType = eventType.Elem()
+	}
+
+	handlerType := reflect.FuncOf(
+		[]reflect.Type{reflect.TypeOf((*context.Context)(nil)).Elem(), eventType},
+		[]reflect.Type{reflect.TypeOf((*error)(nil)).Elem()},
+		false,
+	)
+
+	handler := reflect.MakeFunc(handlerType, func(args []reflect.Value) []reflect.Value {
+		ctx, _ := args[0].Interface().(context.Context)
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		ptr := reflect.New(eventType)
+		ptr.Elem().Set(args[1])
+
+		err := m.Handle(ctx, ptr.Interface().(distributed.EventInterface))
+
+		return []reflect.Value{reflect.ValueOf(&err).Elem()}
+	})
+
+	return handler.Interface(), reflect.New(eventType).Interface().(distributed.EventInterface)
+}
+
+// Handle starts the instances the event starts and moves the ones waiting for it.
+func (m *Manager) Handle(ctx context.Context, event distributed.EventInterface) error {
+	event = normalize(event)
+
+	var errs []error
+
+	for _, definition := range m.list() {
+		if definition.startEvent.EventType() == event.EventType() {
+			if id := definition.correlate(event); id != "" {
+				if err := m.start(ctx, definition, id, event); err != nil {
+					errs = append(errs, errors.Wrapf(err, "start %s %s", definition.name, id))
+				}
+			}
+		}
+
+		for _, id := range definition.correlateStep(event) {
+			if err := m.handleStepEvent(ctx, definition, id, event); err != nil {
+				errs = append(errs, errors.Wrapf(err, "%s %s", definition.name, id))
+			}
+		}
+	}
+
+	return stderrors.Join(errs...)
+}
+
+// normalize returns the event value, or a pointer to it when only the pointer is an EventInterface.
+func normalize(event distributed.EventInterface) distributed.EventInterface {
+	value := reflect.ValueOf(event)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return event
+	}
+
+	if elem, ok := value.Elem().Interface().(distributed.EventInterface); ok {
+		return elem
+	}
+
+	return event
+}
+
+// correlateStep returns the instances the event completes or fails a step of.
+func (d *Definition) correlateStep(event distributed.EventInterface) []string {
+	var ids []string
+
+	for _, step := range d.steps {
+		for _, correlations := range []map[string]Correlate{step.completeOn, step.failOn} {
+			correlate, ok := correlations[event.EventType()]
+			if !ok {
+				continue
+			}
+
+			if id := correlate(event); id != "" && !slices.Contains(ids, id) {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids
+}
+
+func (m *Manager) start(ctx context.Context, definition *Definition, id string, event distributed.EventInterface) error {
+	unlock := m.lock(definition.name, id)
+	defer unlock()
+
+	now := time.Now().UTC()
+	instance := &Instance{
+		Saga:      definition.name,
+		ID:        id,
+		Status:    StatusRunning,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err := instance.Encode(event); err != nil {
+		return err
+	}
+
+	instance.record("", "started", event.EventType(), nil)
+
+	if err := m.store.Create(ctx, instance); err != nil {
+		// the start event was redelivered
+		if errors.Is(err, ErrInstanceExists) {
+			return nil
+		}
+
+		return err
+	}
+
+	m.startStep(ctx, definition, instance, event)
+
+	return m.save(ctx, instance)
+}
+
+func (m *Manager) handleStepEvent(ctx context.Context, definition *Definition, id string, event distributed.EventInterface) error {
+	unlock := m.lock(definition.name, id)
+	defer unlock()
+
+	instance, err := m.store.Get(ctx, definition.name, id)
+	if errors.Is(err, ErrInstanceNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// late, duplicated or events of a stuck instance
+	if instance.Status != StatusRunning || instance.Stuck {
+		return nil
+	}
+
+	step := definition.steps[instance.Step]
+
+	if correlate, ok := step.completeOn[event.EventType()]; ok && correlate(event) == id {
+		m.completeStep(ctx, definition, instance, event)
+
+		return m.save(ctx, instance)
+	}
+
+	if correlate, ok := step.failOn[event.EventType()]; ok && correlate(event) == id {
+		m.failStep(ctx, definition, instance, event, nil)
+
+		return m.save(ctx, instance)
+	}
+
+	return nil
+}
+
+// startStep runs the action of the current step, marking the instance stuck when it fails.
+func (m *Manager) startStep(ctx context.Context, definition *Definition, instance *Instance, event distributed.EventInterface) {
+	step := definition.steps[instance.Step]
+
+	instance.Deadline = time.Time{}
+	if step.timeout > 0 {
+		instance.Deadline = time.Now().UTC().Add(step.timeout)
+	}
+
+	var err error
+	if step.action != nil {
+		err = step.action(ctx, instance, event)
+	}
+
+	instance.record(step.name, "step started", eventName(event), err)
+
+	if err != nil {
+		m.stuck(ctx, instance, errors.Wrap(err, "step "+step.name))
+	}
+}
+
+func (m *Manager) completeStep(ctx context.Context, definition *Definition, instance *Instance, event distributed.EventInterface) {
+	instance.record(definition.steps[instance.Step].name, "step completed", eventName(event), nil)
+
+	instance.Completed++
+	instance.Step++
+
+	if instance.Step < len(definition.steps) {
+		m.startStep(ctx, definition, instance, event)
+
+		return
+	}
+
+	instance.Status = StatusCompleted
+	instance.Deadline = time.Time{}
+	instance.record("", "completed", "", nil)
+}
+
+func (m *Manager) failStep(
+	ctx context.Context,
+	definition *Definition,
+	instance *Instance,
+	event distributed.EventInterface,
+	reason error,
+) {
+	instance.record(definition.steps[instance.Step].name, "step failed", eventName(event), reason)
+
+	instance.Status = StatusCompensating
+	instance.Deadline = time.Time{}
+
+	m.compensate(ctx, definition, instance, event)
+}
+
+// compensate runs the compensations of the completed steps in reverse order, stopping at the first
+// failing one.
+func (m *Manager) compensate(ctx context.Context, definition *Definition, instance *Instance, event distributed.EventInterface) {
+	for instance.Completed > 0 {
+		instance.Step = instance.Completed - 1
+		step := definition.steps[instance.Step]
+
+		var err error
+		if step.compensation != nil {
+			err = step.compensation(ctx, instance, event)
+		}
+
+		instance.record(step.name, "step compensated", eventName(event), err)
+
+		if err != nil {
+			m.stuck(ctx, instance, errors.Wrap(err, "compensation "+step.name))
+
+			return
+		}
+
+		instance.Completed--
+	}
+
+	instance.Status = StatusCompensated
+	instance.record("", "compensated", "", nil)
+}
+
+func (m *Manager) stuck(ctx context.Context, instance *Instance, err error) {
+	instance.Stuck = true
+	instance.Error = err.Error()
+
+	if m.logger != nil {
+		m.logger.WithContext(ctx).Error("saga "+instance.Saga+" "+instance.ID+" stuck", err)
+	}
+}
+
+func (m *Manager) save(ctx context.Context, instance *Instance) error {
+	instance.UpdatedAt = time.Now().UTC()
+
+	return m.store.Save(ctx, instance)
+}
+
+// CheckTimeouts fails the steps of the running instances past their deadline, returning how many.
+func (m *Manager) CheckTimeouts(ctx context.Context) (int, error) {
+	instances, err := m.store.List(ctx, Filter{
+		Statuses:       []Status{StatusRunning},
+		DeadlineBefore: time.Now().UTC(),
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "list timed out instances")
+	}
+
+	var (
+		timedOut int
+		errs     []error
+	)
+
+	for _, instance := range instances {
+		if instance.Stuck {
+			continue
+		}
+
+		ok, err := m.timeout(ctx, instance.Saga, instance.ID)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "%s %s", instance.Saga, instance.ID))
+		}
+
+		if ok {
+			timedOut++
+		}
+	}
+
+	return timedOut, stderrors.Join(errs...)
+}
+
+func (m *Manager) timeout(ctx context.Context, saga, id string) (bool, error) {
+	definition, err := m.get(saga)
+	if err != nil {
+		return false, err
+	}
+
+	unlock := m.lock(saga, id)
+	defer unlock()
+
+	// the instance may have moved since it was listed
+	instance, err := m.store.Get(ctx, saga, id)
+	if err != nil {
+		return false, err
+	}
+
+	if instance.Status != StatusRunning || instance.Stuck || instance.Deadline.IsZero() || instance.Deadline.After(time.Now()) {
+		return false, nil
+	}
+
+	m.failStep(ctx, definition, instance, nil, ErrStepTimeout)
+
+	return true, m.save(ctx, instance)
+}
+
+// TimeoutJob returns the job running CheckTimeouts every interval, 10 seconds when <= 0.
+func (m *Manager) TimeoutJob(interval time.Duration) schedule.Job {
+	if interval <= 0 {
+		interval = defaultTimeoutInterval
+	}
+
+	return schedule.NewJob(
+		func(ctx context.Context) error {
+			_, err := m.CheckTimeouts(ctx)
+
+			return err
+		},
+		schedule.WithName("saga timeouts"),
+		schedule.WithInterval(interval),
+	)
+}
+
+func (m *Manager) Get(ctx context.Context, saga, id string) (*Instance, error) {
+	return m.store.Get(ctx, saga, id)
+}
+
+func (m *Manager) List(ctx context.Context, filter Filter) ([]*Instance, error) {
+	return m.store.List(ctx, filter)
+}
+
+// Resolve applies a manual resolution to an unfinished instance, clearing its stuck flag.
+func (m *Manager) Resolve(ctx context.Context, saga, id string, resolution Resolution) (*Instance, error) {
+	definition, err := m.get(saga)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock := m.lock(saga, id)
+	defer unlock()
+
+	instance, err := m.store.Get(ctx, saga, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if instance.Status.IsFinal() {
+		return nil, errors.Wrap(ErrInstanceFinished, id)
+	}
+
+	instance.Stuck = false
+	instance.Error = ""
+	instance.record(definition.steps[instance.Step].name, "resolved "+string(resolution), "", nil)
+
+	compensating := instance.Status == StatusCompensating
+
+	switch resolution {
+	case ResolveRetry:
+		if compensating {
+			m.compensate(ctx, definition, instance, nil)
+		} else {
+			m.startStep(ctx, definition, instance, nil)
+		}
+
+	case ResolveSkip:
+		if compensating {
+			instance.Completed--
+			m.compensate(ctx, definition, instance, nil)
+		} else {
+			m.completeStep(ctx, definition, instance, nil)
+		}
+
+	case ResolveCompensate:
+		if compensating {
+			m.compensate(ctx, definition, instance, nil)
+		} else {
+			m.failStep(ctx, definition, instance, nil, nil)
+		}
+
+	case ResolveAbort:
+		instance.Status = StatusAborted
+		instance.Deadline = time.Time{}
+
+	default:
+		return nil, errors.Wrap(ErrUnknownResolution, string(resolution))
+	}
+
+	if err := m.save(ctx, instance); err != nil {
+		return nil, err
+	}
+
+	return instance, nil
+}
+
+func (m *Manager) get(saga string) (*Definition, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	definition, ok := m.definitions[saga]
+	if !ok {
+		return nil, errors.Wrap(ErrUnknownSaga, saga)
+	}
+
+	return definition, nil
+}
+
+func (m *Manager) list() []*Definition {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	definitions := make([]*Definition, 0, len(m.definitions))
+	for _, definition := range m.definitions {
+		definitions = append(definitions, definition)
+	}
+
+	return definitions
+}
+
+func (m *Manager) lock(saga, id string) func() {
+	hash := fnv.New32a()
+	_, _ = hash.Write([]byte(saga + ":" + id))
+
+	lock := &m.locks[hash.Sum32()%instanceLocks]
+	lock.Lock()
+
+	return lock.Unlock
+}
+
+func eventName(event distributed.EventInterface) string {
+	if event == nil {
+		return ""
+	}
+
+	return event.EventType()
+}
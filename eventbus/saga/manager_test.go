@@ -0,0 +1,353 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/eventbus/distributed"
+	"github.com/braiphub/go-core/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+type orderPlaced struct {
+	OrderID string `json:"order_id"`
+	Total   int    `json:"total"`
+}
+
+func (orderPlaced) EventType() string { return "order_placed" }
+
+type paymentCharged struct {
+	OrderID string `json:"order_id"`
+}
+
+func (paymentCharged) EventType() string { return "payment_charged" }
+
+type stockReserved struct {
+	OrderID string `json:"order_id"`
+}
+
+func (*stockReserved) EventType() string { return "stock_reserved" }
+
+type stockUnavailable struct {
+	OrderID string `json:"order_id"`
+}
+
+func (stockUnavailable) EventType() string { return "stock_unavailable" }
+
+func orderID(event distributed.EventInterface) string {
+	switch e := event.(type) {
+	case orderPlaced:
+		return e.OrderID
+	case paymentCharged:
+		return e.OrderID
+	case *stockReserved:
+		return e.OrderID
+	case stockUnavailable:
+		return e.OrderID
+	}
+
+	return ""
+}
+
+// commands records the actions run, failing the ones in fail.
+type commands struct {
+	mu   sync.Mutex
+	runs []string
+	fail map[string]error
+}
+
+func (c *commands) action(name string) Action {
+	return func(ctx context.Context, instance *Instance, event distributed.EventInterface) error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		if err := c.fail[name]; err != nil {
+			return err
+		}
+
+		c.runs = append(c.runs, name+":"+instance.ID)
+
+		return nil
+	}
+}
+
+func (c *commands) ran() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.runs...)
+}
+
+func newCheckoutManager(t *testing.T) (*Manager, *commands) {
+	t.Helper()
+
+	cmds := &commands{fail: make(map[string]error)}
+
+	definition := NewDefinition("checkout", orderPlaced{}, orderID).
+		Step("payment",
+			StepAction(cmds.action("charge")),
+			StepCompensation(cmds.action("refund")),
+			CompleteOn(paymentCharged{}, orderID),
+			StepTimeout(time.Minute),
+		).
+		Step("stock",
+			StepAction(cmds.action("reserve")),
+			StepCompensation(cmds.action("release")),
+			CompleteOn(&stockReserved{}, orderID),
+			FailOn(stockUnavailable{}, orderID),
+		).
+		Step("notification",
+			StepAction(cmds.action("notify")),
+			CompleteOn(paymentCharged{}, func(distributed.EventInterface) string { return "" }),
+		)
+
+	manager := NewManager(NewInMemoryStore())
+	require.NoError(t, manager.Add(definition))
+
+	return manager, cmds
+}
+
+func actions(instance *Instance) []string {
+	var actions []string
+	for _, entry := range instance.History {
+		actions = append(actions, entry.Step+" "+entry.Action)
+	}
+
+	return actions
+}
+
+func TestDefinition_validate(t *testing.T) {
+	manager := NewManager(NewInMemoryStore())
+
+	assert.ErrorIs(t, manager.Add(NewDefinition("", orderPlaced{}, orderID)), ErrInvalidDefinition)
+	assert.ErrorIs(t, manager.Add(NewDefinition("checkout", nil, orderID)), ErrInvalidDefinition)
+	assert.ErrorIs(t, manager.Add(NewDefinition("checkout", orderPlaced{}, orderID)), ErrInvalidDefinition)
+	assert.ErrorIs(t, manager.Add(NewDefinition("checkout", orderPlaced{}, orderID).Step("payment")), ErrInvalidDefinition)
+
+	definition := NewDefinition("checkout", orderPlaced{}, orderID).Step("payment", CompleteOn(paymentCharged{}, orderID))
+	assert.NoError(t, manager.Add(definition))
+	assert.ErrorIs(t, manager.Add(definition), ErrDuplicateSaga)
+}
+
+func TestManager_Completed(t *testing.T) {
+	ctx := context.Background()
+	manager, cmds := newCheckoutManager(t)
+
+	require.NoError(t, manager.Handle(ctx, orderPlaced{OrderID: "1", Total: 10}))
+	// the start event is redelivered
+	require.NoError(t, manager.Handle(ctx, &orderPlaced{OrderID: "1", Total: 10}))
+
+	instance, err := manager.Get(ctx, "checkout", "1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, instance.Status)
+	assert.Equal(t, 0, instance.Step)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), instance.Deadline, time.Second)
+
+	var data orderPlaced
+	require.NoError(t, instance.Decode(&data))
+	assert.Equal(t, orderPlaced{OrderID: "1", Total: 10}, data)
+
+	require.NoError(t, manager.Handle(ctx, paymentCharged{OrderID: "1"}))
+	// events of other instances and steps are ignored
+	require.NoError(t, manager.Handle(ctx, paymentCharged{OrderID: "2"}))
+	require.NoError(t, manager.Handle(ctx, paymentCharged{OrderID: "1"}))
+	require.NoError(t, manager.Handle(ctx, &stockReserved{OrderID: "1"}))
+
+	instance, err = manager.Get(ctx, "checkout", "1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusRunning, instance.Status)
+	assert.Equal(t, 2, instance.Step)
+	assert.Zero(t, instance.Deadline)
+
+	resolved, err := manager.Resolve(ctx, "checkout", "1", ResolveSkip)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompleted, resolved.Status)
+	assert.Equal(t, 3, resolved.Completed)
+
+	assert.Equal(t, []string{"charge:1", "reserve:1", "notify:1"}, cmds.ran())
+	assert.Equal(t, []string{
+		" started",
+		"payment step started",
+		"payment step completed",
+		"stock step started",
+		"stock step completed",
+		"notification step started",
+		"notification resolved skip",
+		"notification step completed",
+		" completed",
+	}, actions(resolved))
+
+	_, err = manager.Resolve(ctx, "checkout", "1", ResolveRetry)
+	assert.ErrorIs(t, err, ErrInstanceFinished)
+}
+
+func TestManager_Compensated(t *testing.T) {
+	ctx := context.Background()
+	manager, cmds := newCheckoutManager(t)
+
+	require.NoError(t, manager.Handle(ctx, orderPlaced{OrderID: "1"}))
+	require.NoError(t, manager.Handle(ctx, paymentCharged{OrderID: "1"}))
+	require.NoError(t, manager.Handle(ctx, stockUnavailable{OrderID: "1"}))
+
+	instance, err := manager.Get(ctx, "checkout", "1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompensated, instance.Status)
+	assert.Zero(t, instance.Completed)
+	assert.Equal(t, []string{"charge:1", "reserve:1", "refund:1"}, cmds.ran())
+}
+
+func TestManager_Stuck(t *testing.T) {
+	ctx := context.Background()
+	manager, cmds := newCheckoutManager(t)
+
+	cmds.fail["charge"] = errors.New("broker down")
+
+	require.NoError(t, manager.Handle(ctx, orderPlaced{OrderID: "1"}))
+
+	stuck, err := manager.List(ctx, Filter{Saga: "checkout", Stuck: true})
+	require.NoError(t, err)
+	require.Len(t, stuck, 1)
+	assert.Equal(t, "step payment: broker down", stuck[0].Error)
+
+	// stuck instances ignore their events
+	require.NoError(t, manager.Handle(ctx, paymentCharged{OrderID: "1"}))
+
+	delete(cmds.fail, "charge")
+
+	instance, err := manager.Resolve(ctx, "checkout", "1", ResolveRetry)
+	require.NoError(t, err)
+	assert.False(t, instance.Stuck)
+	assert.Empty(t, instance.Error)
+	assert.Equal(t, []string{"charge:1"}, cmds.ran())
+
+	require.NoError(t, manager.Handle(ctx, paymentCharged{OrderID: "1"}))
+
+	// a failing compensation gets stuck too
+	cmds.fail["refund"] = errors.New("refund failed")
+
+	instance, err = manager.Resolve(ctx, "checkout", "1", ResolveCompensate)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompensating, instance.Status)
+	assert.True(t, instance.Stuck)
+	assert.Equal(t, "compensation payment: refund failed", instance.Error)
+
+	instance, err = manager.Resolve(ctx, "checkout", "1", ResolveSkip)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompensated, instance.Status)
+
+	_, err = manager.Resolve(ctx, "unknown", "1", ResolveRetry)
+	assert.ErrorIs(t, err, ErrUnknownSaga)
+}
+
+func TestManager_Resolve_Abort(t *testing.T) {
+	ctx := context.Background()
+	manager, cmds := newCheckoutManager(t)
+
+	require.NoError(t, manager.Handle(ctx, orderPlaced{OrderID: "1"}))
+
+	_, err := manager.Resolve(ctx, "checkout", "1", Resolution("unknown"))
+	assert.ErrorIs(t, err, ErrUnknownResolution)
+
+	instance, err := manager.Resolve(ctx, "checkout", "1", ResolveAbort)
+	require.NoError(t, err)
+	assert.Equal(t, StatusAborted, instance.Status)
+
+	require.NoError(t, manager.Handle(ctx, paymentCharged{OrderID: "1"}))
+	assert.Equal(t, []string{"charge:1"}, cmds.ran())
+}
+
+func TestManager_CheckTimeouts(t *testing.T) {
+	ctx := context.Background()
+	manager, cmds := newCheckoutManager(t)
+
+	require.NoError(t, manager.Handle(ctx, orderPlaced{OrderID: "1"}))
+	require.NoError(t, manager.Handle(ctx, orderPlaced{OrderID: "2"}))
+
+	timedOut, err := manager.CheckTimeouts(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, timedOut)
+
+	instance, err := manager.Get(ctx, "checkout", "1")
+	require.NoError(t, err)
+
+	instance.Deadline = time.Now().Add(-time.Second)
+	require.NoError(t, manager.store.Save(ctx, instance))
+
+	timedOut, err = manager.CheckTimeouts(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, timedOut)
+
+	instance, err = manager.Get(ctx, "checkout", "1")
+	require.NoError(t, err)
+	assert.Equal(t, StatusCompensated, instance.Status)
+	assert.Equal(t, ErrStepTimeout.Error(), instance.History[len(instance.History)-2].Error)
+
+	// nothing completed, nothing to compensate
+	assert.Equal(t, []string{"charge:1", "charge:2"}, cmds.ran())
+
+	job := manager.TimeoutJob(0)
+	assert.Equal(t, "saga timeouts", job.Name)
+	require.NotNil(t, job.Interval)
+	assert.Equal(t, defaultTimeoutInterval, *job.Interval)
+	assert.NoError(t, job.Func(ctx))
+}
+
+// busStub keeps the registered handlers.
+type busStub struct {
+	handlers map[string]interface{}
+}
+
+func (b *busStub) Register(event distributed.EventInterface, handler interface{}, _ ...distributed.HandlerOption) error {
+	b.handlers[event.EventType()] = handler
+
+	return nil
+}
+
+func TestManager_Subscribe(t *testing.T) {
+	ctx := context.Background()
+	manager, cmds := newCheckoutManager(t)
+	bus := &busStub{handlers: make(map[string]interface{})}
+
+	require.NoError(t, manager.Subscribe(bus))
+	assert.Len(t, bus.handlers, 4)
+
+	require.NoError(t, bus.handlers["order_placed"].(func(context.Context, orderPlaced) error)(ctx, orderPlaced{OrderID: "1"}))
+	require.NoError(t, bus.handlers["payment_charged"].(func(context.Context, paymentCharged) error)(ctx, paymentCharged{OrderID: "1"}))
+	require.NoError(t, bus.handlers["stock_reserved"].(func(context.Context, stockReserved) error)(ctx, stockReserved{OrderID: "1"}))
+
+	assert.Equal(t, []string{"charge:1", "reserve:1", "notify:1"}, cmds.ran())
+}
+
+func TestManager_Subscribe_EventBus(t *testing.T) {
+	manager, cmds := newCheckoutManager(t)
+
+	logger := log.NewMockLoggerI(gomock.NewController(t))
+	logger.EXPECT().Debug(gomock.Any(), gomock.Any()).AnyTimes()
+
+	pubSub := distributed.NewInMemoryPubSub()
+
+	bus, err := distributed.New("orders", "checkout", distributed.WithLogger(logger), distributed.WithPubSub(pubSub))
+	require.NoError(t, err)
+	require.NoError(t, manager.Subscribe(bus))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _ = bus.StartListen(ctx) }()
+
+	require.NoError(t, bus.Publish(ctx, &orderPlaced{OrderID: "1"}, &paymentCharged{OrderID: "1"}, &stockUnavailable{OrderID: "1"}))
+
+	assert.Eventually(t, func() bool {
+		instance, err := manager.Get(ctx, "checkout", "1")
+
+		return err == nil && instance.Status == StatusCompensated
+	}, time.Second, time.Millisecond)
+
+	assert.Equal(t, []string{"charge:1", "reserve:1", "refund:1"}, cmds.ran())
+	assert.Empty(t, pubSub.Dead())
+}
@@ -0,0 +1,120 @@
+package saga
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/mohae/deepcopy"
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrInstanceNotFound    = errors.New("saga instance not found")
+	ErrInstanceExists      = errors.New("saga instance already exists")
+	ErrConcurrencyConflict = errors.New("saga instance changed by someone else")
+)
+
+// Store persists the saga instances.
+type Store interface {
+	// Create saves a new instance, ErrInstanceExists is returned when its id is taken.
+	Create(ctx context.Context, instance *Instance) error
+	Get(ctx context.Context, saga, id string) (*Instance, error)
+	// Save updates an instance if its version wasn't changed since it was read, incrementing it.
+	Save(ctx context.Context, instance *Instance) error
+	// List returns the matching instances, oldest first.
+	List(ctx context.Context, filter Filter) ([]*Instance, error)
+}
+
+// assert meets contract
+var _ Store = &InMemoryStore{}
+
+// InMemoryStore keeps the instances in process, e.g.: for tests.
+type InMemoryStore struct {
+	mu        sync.Mutex
+	instances map[instanceKey]*Instance
+}
+
+type instanceKey struct {
+	saga string
+	id   string
+}
+
+func NewInMemoryStore() *InMemoryStore {
+	return &InMemoryStore{instances: make(map[instanceKey]*Instance)}
+}
+
+func (s *InMemoryStore) Create(_ context.Context, instance *Instance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := instanceKey{saga: instance.Saga, id: instance.ID}
+	if _, ok := s.instances[key]; ok {
+		return errors.Wrap(ErrInstanceExists, instance.ID)
+	}
+
+	instance.Version = 1
+	s.instances[key] = deepcopy.Copy(instance).(*Instance)
+
+	return nil
+}
+
+func (s *InMemoryStore) Get(_ context.Context, saga, id string) (*Instance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instance, ok := s.instances[instanceKey{saga: saga, id: id}]
+	if !ok {
+		return nil, errors.Wrap(ErrInstanceNotFound, id)
+	}
+
+	return deepcopy.Copy(instance).(*Instance), nil
+}
+
+func (s *InMemoryStore) Save(_ context.Context, instance *Instance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := instanceKey{saga: instance.Saga, id: instance.ID}
+
+	stored, ok := s.instances[key]
+	if !ok {
+		return errors.Wrap(ErrInstanceNotFound, instance.ID)
+	}
+
+	if stored.Version != instance.Version {
+		return errors.Wrap(ErrConcurrencyConflict, instance.ID)
+	}
+
+	instance.Version++
+	s.instances[key] = deepcopy.Copy(instance).(*Instance)
+
+	return nil
+}
+
+func (s *InMemoryStore) List(_ context.Context, filter Filter) ([]*Instance, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	instances := make([]*Instance, 0)
+
+	for _, instance := range s.instances {
+		if filter.Match(instance) {
+			instances = append(instances, deepcopy.Copy(instance).(*Instance))
+		}
+	}
+
+	sortInstances(instances)
+
+	return instances, nil
+}
+
+func sortInstances(instances []*Instance) {
+	sort.Slice(instances, func(i, j int) bool {
+		if !instances[i].CreatedAt.Equal(instances[j].CreatedAt) {
+			return instances[i].CreatedAt.Before(instances[j].CreatedAt)
+		}
+
+		return instances[i].ID < instances[j].ID
+	})
+}
@@ -1,6 +1,7 @@
 package eventbus
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 
@@ -16,6 +17,7 @@ func Subscribe(topic string, eventHandler any) {
 	defaultInstance.Subscribe(topic, eventHandler)
 }
 
+// SubscribeAsync handles each publish in a new goroutine, see SubscribeAsyncBounded to bound them.
 func (b *Bus) SubscribeAsync(topic string, eventHandler any, transactional bool) {
 	topicLogField := log.Any("topic", topic)
 
@@ -96,15 +98,8 @@ func (b *Bus) decorate(f any) func(args ...any) {
 
 		rets := fnValue.Call(vArgs)
 
-		if b.logger == nil {
-			return
-		}
-
 		for _, ret := range rets {
-			if ret.IsNil() {
-				continue
-			}
-
+			// a nil error interface isn't an error, other kinds can't be checked with IsNil
 			err, ok := ret.Interface().(error)
 			if !ok || err == nil {
 				continue
@@ -120,3 +115,67 @@ func (b *Bus) decorate(f any) func(args ...any) {
 		}
 	}
 }
+
+type publishHandler func(ctx context.Context, topic string, args []any) error
+
+// OnPublish registers handler for the events of every topic published with Publish, it runs after
+// their subscribers. It gets the event envelope from its ctx, see EnvelopeFromContext.
+func (b *Bus) OnPublish(handler func(ctx context.Context, topic string, args []any) error) {
+	b.handlersMu.Lock()
+	defer b.handlersMu.Unlock()
+
+	b.publishHandlers = append(b.publishHandlers, handler)
+}
+
+// Publish calls the subscribers of topic with args, then the OnPublish handlers.
+func (b *Bus) Publish(topic string, args ...any) {
+	b.PublishWithContext(context.Background(), topic, args...)
+}
+
+// PublishWithContext is Publish with the envelope of the event created from ctx, see NewEnvelope.
+func (b *Bus) PublishWithContext(ctx context.Context, topic string, args ...any) {
+	b.Bus.Publish(topic, args...)
+
+	if b.hasPublishHandlers() {
+		envelope := NewEnvelope(ctx, topic, defaultEventVersion, b.config.Producer)
+		b.published(ContextWithEnvelope(ctx, envelope), topic, args)
+	}
+}
+
+// DeliverPublished calls the subscribers of a topic received with its envelope, e.g. from another
+// process, like Publish does.
+func (b *Bus) DeliverPublished(ctx context.Context, envelope Envelope, topic string, args ...any) {
+	b.Bus.Publish(topic, args...)
+	b.published(ContextWithEnvelope(ctx, envelope), topic, args)
+}
+
+func (b *Bus) hasPublishHandlers() bool {
+	b.handlersMu.RLock()
+	defer b.handlersMu.RUnlock()
+
+	return len(b.publishHandlers) > 0
+}
+
+// published calls the OnPublish handlers, reporting their errors.
+func (b *Bus) published(ctx context.Context, topic string, args []any) {
+	b.handlersMu.RLock()
+	handlers := append([]publishHandler(nil), b.publishHandlers...)
+	b.handlersMu.RUnlock()
+
+	for _, handler := range handlers {
+		err := handler(ctx, topic, args)
+		if err == nil {
+			continue
+		}
+
+		err = errors.Wrapf(err, "%s publish handler", topic)
+
+		if b.logger != nil {
+			b.logger.WithContext(ctx).Error("publish handler returned an error", err, log.Any("topic", topic))
+		}
+
+		if b.errorHandler != nil {
+			b.errorHandler(err)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBus_OnPublish(t *testing.T) {
+	var handled error
+
+	bus := New(Config{Producer: "orders"}, WithErrorHandler(func(err error) { handled = err }))
+
+	var calls []string
+
+	bus.Subscribe("user.created", func(id string, admin bool) {
+		calls = append(calls, "subscriber "+id)
+	})
+
+	var envelopes []Envelope
+
+	bus.OnPublish(func(ctx context.Context, topic string, args []any) error {
+		envelope, ok := EnvelopeFromContext(ctx)
+		require.True(t, ok)
+
+		envelopes = append(envelopes, envelope)
+		calls = append(calls, "publish "+topic+" "+args[0].(string))
+
+		return errors.New("failed")
+	})
+
+	bus.Publish("user.created", "1", false)
+
+	// the envelope comes from ctx
+	ctx := WithCorrelationID(context.Background(), "request-1")
+	bus.PublishWithContext(ctx, "user.created", "2", true)
+
+	// delivered events keep their envelope
+	bus.DeliverPublished(context.Background(), Envelope{ID: "remote", Origin: "billing"}, "user.created", "3", false)
+
+	assert.Equal(t, []string{
+		"subscriber 1", "publish user.created 1",
+		"subscriber 2", "publish user.created 2",
+		"subscriber 3", "publish user.created 3",
+	}, calls)
+	assert.EqualError(t, handled, "user.created publish handler: failed")
+
+	require.Len(t, envelopes, 3)
+	assert.Equal(t, "user.created", envelopes[0].Type)
+	assert.Equal(t, "orders", envelopes[0].Producer)
+	assert.NotEmpty(t, envelopes[0].ID)
+	assert.Equal(t, "request-1", envelopes[1].CorrelationID)
+	assert.Equal(t, Envelope{ID: "remote", Origin: "billing"}, envelopes[2])
+}
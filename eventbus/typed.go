@@ -0,0 +1,115 @@
+package eventbus
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/braiphub/go-core/log"
+	"github.com/pkg/errors"
+)
+
+// Event is an in-process event. The topic belongs to the type: Topic is called on its zero value,
+// so it must not depend on the event fields.
+type Event interface {
+	Topic() string
+}
+
+type eventHandler func(ctx context.Context, event Event) error
+
+// HandlerErrors holds the errors returned by the handlers of an emitted event, in the order the
+// handlers were registered.
+type HandlerErrors []error
+
+func (e HandlerErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (e HandlerErrors) Unwrap() []error {
+	return e
+}
+
+// On registers handler for the events of type E.
+func On[E Event](bus *Bus, handler func(ctx context.Context, event E) error) {
+	topic := TopicOf[E]()
+
+	bus.handlersMu.Lock()
+	defer bus.handlersMu.Unlock()
+
+	bus.handlers[topic] = append(bus.handlers[topic], func(ctx context.Context, event Event) error {
+		typed, ok := event.(E)
+		if !ok {
+			return fmt.Errorf("%s: unexpected event type %T", topic, event)
+		}
+
+		return handler(ctx, typed)
+	})
+}
+
+// OnAll registers handler for the events of every type, it runs after the handlers of the type.
+func (b *Bus) OnAll(handler func(ctx context.Context, event Event) error) {
+	b.handlersMu.Lock()
+	defer b.handlersMu.Unlock()
+
+	b.allHandlers = append(b.allHandlers, handler)
+}
+
+// Emit calls the handlers of the event type sequentially, in registration order. Every handler
+// runs, their errors are returned as HandlerErrors. Handlers get the event envelope from their ctx,
+// see EnvelopeFromContext.
+func Emit[E Event](ctx context.Context, bus *Bus, event E) error {
+	topic := TopicOf[E]()
+	ctx = ContextWithEnvelope(ctx, NewEnvelope(ctx, topic, VersionOf(event), bus.config.Producer))
+
+	return bus.dispatch(ctx, topic, event)
+}
+
+// Deliver calls the handlers of an event received with its envelope, e.g. from another process,
+// like Emit does.
+func (b *Bus) Deliver(ctx context.Context, envelope Envelope, event Event) error {
+	return b.dispatch(ContextWithEnvelope(ctx, envelope), event.Topic(), event)
+}
+
+func (b *Bus) dispatch(ctx context.Context, topic string, event Event) error {
+	b.handlersMu.RLock()
+	handlers := append(append([]eventHandler(nil), b.handlers[topic]...), b.allHandlers...)
+	b.handlersMu.RUnlock()
+
+	var errs HandlerErrors
+
+	for i, handler := range handlers {
+		err := handler(ctx, event)
+		if err == nil {
+			continue
+		}
+
+		err = errors.Wrapf(err, "%s handler %d of %d", topic, i+1, len(handlers))
+		errs = append(errs, err)
+
+		if b.logger != nil {
+			b.logger.WithContext(ctx).Error("event handler returned an error", err, log.Any("topic", topic))
+		}
+
+		if b.errorHandler != nil {
+			b.errorHandler(err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// TopicOf returns the topic of the events of type E.
+func TopicOf[E Event]() string {
+	var event E
+
+	return event.Topic()
+}
@@ -0,0 +1,110 @@
+package eventbus
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type orderCreated struct {
+	ID string
+}
+
+func (orderCreated) Topic() string { return "order.created" }
+
+type orderPaid struct {
+	ID string
+}
+
+func (orderPaid) Topic() string { return "order.paid" }
+
+type ctxKey struct{}
+
+func TestEmit(t *testing.T) {
+	bus := New(Config{})
+	errFirst := errors.New("first")
+	errThird := errors.New("third")
+
+	var calls []string
+
+	On(bus, func(_ context.Context, event orderCreated) error {
+		calls = append(calls, "first "+event.ID)
+
+		return errFirst
+	})
+	On(bus, func(ctx context.Context, event orderCreated) error {
+		calls = append(calls, "second "+ctx.Value(ctxKey{}).(string))
+
+		return nil
+	})
+	On(bus, func(_ context.Context, event orderCreated) error {
+		calls = append(calls, "third "+event.ID)
+
+		return errThird
+	})
+	On(bus, func(_ context.Context, event orderPaid) error {
+		calls = append(calls, "paid "+event.ID)
+
+		return nil
+	})
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request-1")
+	err := Emit(ctx, bus, orderCreated{ID: "1"})
+
+	// every handler runs and the errors keep the registration order
+	assert.Equal(t, []string{"first 1", "second request-1", "third 1"}, calls)
+	assert.ErrorIs(t, err, errFirst)
+	assert.ErrorIs(t, err, errThird)
+
+	var handlerErrs HandlerErrors
+	assert.ErrorAs(t, err, &handlerErrs)
+	assert.Len(t, handlerErrs, 2)
+	assert.ErrorIs(t, handlerErrs[0], errFirst)
+
+	assert.NoError(t, Emit(ctx, bus, orderPaid{ID: "2"}))
+	assert.Equal(t, "paid 2", calls[3])
+}
+
+func TestBus_decorate(t *testing.T) {
+	var handled error
+
+	bus := New(Config{}, WithErrorHandler(func(err error) { handled = err }))
+
+	// non-pointer returns used to panic on IsNil
+	assert.NotPanics(t, func() {
+		bus.decorate(func() (int, error) { return 1, nil })()
+	})
+	assert.NoError(t, handled)
+
+	bus.decorate(func() (int, error) { return 0, errors.New("failed") })()
+	assert.ErrorContains(t, handled, "failed")
+}
+
+func TestBus_OnAll(t *testing.T) {
+	bus := New(Config{Producer: "orders"})
+
+	var calls []string
+
+	On(bus, func(_ context.Context, event orderCreated) error {
+		calls = append(calls, "created "+event.ID)
+
+		return nil
+	})
+	bus.OnAll(func(ctx context.Context, event Event) error {
+		envelope, _ := EnvelopeFromContext(ctx)
+		calls = append(calls, "all "+event.Topic()+" "+envelope.Origin)
+
+		return errors.New("failed")
+	})
+
+	err := Emit(context.Background(), bus, orderCreated{ID: "1"})
+	assert.EqualError(t, err, "order.created handler 2 of 2: failed")
+
+	// delivered events keep their envelope
+	err = bus.Deliver(context.Background(), Envelope{ID: "remote", Origin: "billing"}, orderPaid{ID: "2"})
+	assert.EqualError(t, err, "order.paid handler 1 of 1: failed")
+
+	assert.Equal(t, []string{"created 1", "all order.created ", "all order.paid billing"}, calls)
+}
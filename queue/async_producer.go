@@ -0,0 +1,504 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/braiphub/go-core/log"
+	"github.com/braiphub/go-core/trace"
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	defaultAsyncBufferSize    = 10000
+	defaultAsyncBatchSize     = 100
+	defaultAsyncFlushInterval = 100 * time.Millisecond
+	defaultAsyncChannels      = 4
+)
+
+var (
+	ErrAsyncProducerClosed = errors.New("async producer closed")
+	ErrPublishNacked       = errors.New("publish nacked by broker")
+)
+
+type AsyncProducerConfig struct {
+	// BufferSize is how many messages are kept in memory, messages produced while it's full are
+	// written to the gorm fallback. Defaults to 10000.
+	BufferSize int
+	// BatchSize is how many messages are published before waiting for confirms. Defaults to 100.
+	BatchSize int
+	// FlushInterval is how long a message may wait in the buffer. Defaults to 100ms.
+	FlushInterval time.Duration
+	// Channels is how many confirm-mode channels publish batches in parallel. Defaults to 4.
+	Channels int
+}
+
+func WithAsyncBufferSize(size int) func(*AsyncProducerConfig) {
+	return func(c *AsyncProducerConfig) {
+		c.BufferSize = size
+	}
+}
+
+func WithAsyncBatchSize(size int) func(*AsyncProducerConfig) {
+	return func(c *AsyncProducerConfig) {
+		c.BatchSize = size
+	}
+}
+
+func WithAsyncFlushInterval(interval time.Duration) func(*AsyncProducerConfig) {
+	return func(c *AsyncProducerConfig) {
+		c.FlushInterval = interval
+	}
+}
+
+func WithAsyncChannels(channels int) func(*AsyncProducerConfig) {
+	return func(c *AsyncProducerConfig) {
+		c.Channels = channels
+	}
+}
+
+// batchPublisher publishes a batch, returning the error of each message (nil when confirmed).
+type batchPublisher interface {
+	Publish(ctx context.Context, batch []*pendingMessage) []error
+	Close() error
+}
+
+type pendingMessage struct {
+	seq        uint64
+	ctx        context.Context
+	routingKey string
+	message    Message
+	span       trace.SpanInterface
+}
+
+// AsyncProducer buffers produced messages in memory and publishes them in batches over a pool of
+// confirm-mode channels. Messages that can't be buffered or confirmed go to the gorm fallback.
+type AsyncProducer struct {
+	conn    *RabbitMQConnection
+	config  AsyncProducerConfig
+	buffer  chan *pendingMessage
+	batches chan []*pendingMessage
+	flushCh chan struct{}
+	workers sync.WaitGroup
+
+	stateMu  sync.RWMutex
+	closed   bool
+	spilling atomic.Bool
+
+	// messages are numbered as they're produced: every sequence number below lowest is settled,
+	// settled keeps the ones above it that finished out of order
+	pendingMu sync.Mutex
+	nextSeq   uint64
+	lowest    uint64
+	settled   map[uint64]struct{}
+	waiters   []flushWaiter
+}
+
+type flushWaiter struct {
+	seq  uint64
+	done chan struct{}
+}
+
+func (r *RabbitMQConnection) NewAsyncProducer(opts ...func(*AsyncProducerConfig)) *AsyncProducer {
+	return newAsyncProducer(r, func() batchPublisher {
+		return &confirmPublisher{conn: r}
+	}, opts...)
+}
+
+func newAsyncProducer(
+	conn *RabbitMQConnection,
+	newPublisher func() batchPublisher,
+	opts ...func(*AsyncProducerConfig),
+) *AsyncProducer {
+	config := AsyncProducerConfig{
+		BufferSize:    defaultAsyncBufferSize,
+		BatchSize:     defaultAsyncBatchSize,
+		FlushInterval: defaultAsyncFlushInterval,
+		Channels:      defaultAsyncChannels,
+	}
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	producer := &AsyncProducer{
+		conn:    conn,
+		config:  config,
+		buffer:  make(chan *pendingMessage, config.BufferSize),
+		batches: make(chan []*pendingMessage),
+		flushCh: make(chan struct{}, 1),
+		settled: make(map[uint64]struct{}),
+	}
+
+	for range config.Channels {
+		producer.workers.Add(1)
+
+		go producer.publishBatches(newPublisher())
+	}
+
+	go producer.collectBatches()
+
+	return producer
+}
+
+// Produce validates and buffers the message, it's published in the background.
+func (p *AsyncProducer) Produce(ctx context.Context, routingKey string, msg any) error {
+	message, err := buildMessage(msg)
+	if err != nil {
+		return errors.Wrap(err, "build message")
+	}
+
+	if p.conn.schemaRegistry != nil {
+		if err := p.conn.schemaRegistry.PrepareOutgoing(routingKey, &message); err != nil {
+			return errors.Wrap(err, "validate message schema")
+		}
+	}
+
+	ctx, span := p.conn.startProduceSpan(ctx, routingKey, message.Headers, message.Body)
+	pending := &pendingMessage{
+		ctx:        context.WithoutCancel(ctx),
+		routingKey: routingKey,
+		message:    message,
+		span:       span,
+	}
+
+	p.stateMu.RLock()
+	defer p.stateMu.RUnlock()
+
+	if p.closed {
+		finishSpan(span, ErrAsyncProducerClosed)
+
+		return ErrAsyncProducerClosed
+	}
+
+	p.pendingMu.Lock()
+	pending.seq = p.nextSeq
+	p.nextSeq++
+	p.pendingMu.Unlock()
+
+	select {
+	case p.buffer <- pending:
+		return nil
+	default:
+		err := p.conn.handlePublisherFallBack(ctx, routingKey, &message)
+		p.done(pending, err)
+
+		return err
+	}
+}
+
+// Flush publishes the buffered messages and waits until the ones produced before the call are
+// confirmed or written to the fallback.
+func (p *AsyncProducer) Flush(ctx context.Context) error {
+	p.pendingMu.Lock()
+	if p.lowest == p.nextSeq {
+		p.pendingMu.Unlock()
+
+		return nil
+	}
+
+	wait := flushWaiter{seq: p.nextSeq, done: make(chan struct{})}
+	p.waiters = append(p.waiters, wait)
+	p.pendingMu.Unlock()
+
+	select {
+	case p.flushCh <- struct{}{}:
+	default:
+	}
+
+	select {
+	case <-wait.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting messages, flushes the buffer and closes the channels. When ctx is done
+// first, the messages not handed to a channel yet are written to the fallback.
+func (p *AsyncProducer) Close(ctx context.Context) error {
+	p.stateMu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.buffer)
+	}
+	p.stateMu.Unlock()
+
+	done := make(chan struct{})
+
+	go func() {
+		p.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		p.spill()
+
+		return ctx.Err()
+	}
+}
+
+// spill writes what's left in the buffer and the batches waiting for a channel to the fallback,
+// batches being published are left to their channels.
+func (p *AsyncProducer) spill() {
+	p.spilling.Store(true)
+
+	for pending := range p.buffer {
+		p.fallback(pending)
+	}
+
+	for batch := range p.batches {
+		for _, pending := range batch {
+			p.fallback(pending)
+		}
+	}
+}
+
+func (p *AsyncProducer) collectBatches() {
+	defer close(p.batches)
+
+	ticker := time.NewTicker(p.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*pendingMessage, 0, p.config.BatchSize)
+
+	dispatch := func() {
+		if len(batch) == 0 {
+			return
+		}
+
+		p.batches <- batch
+		batch = make([]*pendingMessage, 0, p.config.BatchSize)
+	}
+
+	add := func(pending *pendingMessage) {
+		batch = append(batch, pending)
+		if len(batch) >= p.config.BatchSize {
+			dispatch()
+		}
+	}
+
+	for {
+		select {
+		case pending, ok := <-p.buffer:
+			if !ok {
+				dispatch()
+
+				return
+			}
+
+			add(pending)
+
+		case <-ticker.C:
+			dispatch()
+
+		case <-p.flushCh:
+			for drained := false; !drained; {
+				select {
+				case pending, ok := <-p.buffer:
+					if !ok {
+						dispatch()
+
+						return
+					}
+
+					add(pending)
+				default:
+					drained = true
+				}
+			}
+
+			dispatch()
+		}
+	}
+}
+
+func (p *AsyncProducer) publishBatches(publisher batchPublisher) {
+	defer p.workers.Done()
+
+	for batch := range p.batches {
+		if p.spilling.Load() {
+			for _, pending := range batch {
+				p.fallback(pending)
+			}
+
+			continue
+		}
+
+		var errs []error
+
+		_, err := p.conn.breaker.Execute(func() (any, error) {
+			errs = publisher.Publish(context.Background(), batch)
+
+			for _, err := range errs {
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			return nil, nil
+		})
+
+		for i, pending := range batch {
+			// the breaker is open when nothing was published
+			publishErr := err
+			if errs != nil {
+				publishErr = errs[i]
+			}
+
+			if publishErr == nil {
+				p.conn.metrics.MessageProduced(pending.routingKey)
+				p.done(pending, nil)
+
+				continue
+			}
+
+			p.fallback(pending)
+		}
+	}
+
+	if err := publisher.Close(); err != nil {
+		p.conn.logger.Error("close async publisher", err)
+	}
+}
+
+// fallback writes a message that couldn't be published to the gorm fallback.
+func (p *AsyncProducer) fallback(pending *pendingMessage) {
+	err := p.conn.handlePublisherFallBack(pending.ctx, pending.routingKey, &pending.message)
+	if err != nil {
+		p.conn.logger.WithContext(pending.ctx).Error(
+			"async publish message",
+			err,
+			log.Any("routing_key", pending.routingKey),
+		)
+	}
+
+	p.done(pending, err)
+}
+
+func (p *AsyncProducer) done(pending *pendingMessage, err error) {
+	finishSpan(pending.span, err)
+
+	p.pendingMu.Lock()
+	defer p.pendingMu.Unlock()
+
+	p.settled[pending.seq] = struct{}{}
+
+	for {
+		if _, ok := p.settled[p.lowest]; !ok {
+			break
+		}
+
+		delete(p.settled, p.lowest)
+		p.lowest++
+	}
+
+	released := 0
+
+	for _, wait := range p.waiters {
+		if wait.seq > p.lowest {
+			break
+		}
+
+		close(wait.done)
+		released++
+	}
+
+	p.waiters = p.waiters[released:]
+}
+
+// confirmPublisher owns a confirm-mode channel, reopened after failures.
+type confirmPublisher struct {
+	conn    *RabbitMQConnection
+	channel *amqp.Channel
+}
+
+func (c *confirmPublisher) Publish(ctx context.Context, batch []*pendingMessage) []error {
+	errs := make([]error, len(batch))
+
+	channel, err := c.open()
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+
+		return errs
+	}
+
+	pubCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+
+	confirms := make([]*amqp.DeferredConfirmation, len(batch))
+
+	for i, pending := range batch {
+		confirms[i], errs[i] = channel.PublishWithDeferredConfirmWithContext(
+			pubCtx,
+			c.conn.config.Exchange,
+			pending.routingKey,
+			false, // mandatory
+			false, // immediate
+			newPublishing(pending.message),
+		)
+	}
+
+	for i, confirm := range confirms {
+		if errs[i] != nil {
+			continue
+		}
+
+		acked, err := confirm.WaitContext(pubCtx)
+
+		switch {
+		case err != nil:
+			errs[i] = errors.Wrap(err, "wait confirm")
+		case !acked:
+			errs[i] = ErrPublishNacked
+		}
+	}
+
+	if channel.IsClosed() {
+		c.channel = nil
+	}
+
+	return errs
+}
+
+func (c *confirmPublisher) open() (*amqp.Channel, error) {
+	if c.channel != nil && !c.channel.IsClosed() {
+		return c.channel, nil
+	}
+
+	conn := c.conn.connection()
+	if conn == nil {
+		return nil, ErrConnectionClosed
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, errors.Wrap(err, "channel open")
+	}
+
+	if err := channel.Confirm(false); err != nil {
+		_ = channel.Close()
+
+		return nil, errors.Wrap(err, "confirm mode")
+	}
+
+	c.channel = channel
+
+	return channel, nil
+}
+
+func (c *confirmPublisher) Close() error {
+	if c.channel == nil || c.channel.IsClosed() {
+		return nil
+	}
+
+	return c.channel.Close()
+}
@@ -0,0 +1,184 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/log"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/mock/gomock"
+)
+
+type fakeBatchPublisher struct {
+	mu      sync.Mutex
+	batches [][]string
+	release chan struct{}
+	// hold blocks the batches starting with the routing key until its channel is closed
+	hold map[string]chan struct{}
+}
+
+func (f *fakeBatchPublisher) Publish(_ context.Context, batch []*pendingMessage) []error {
+	if f.release != nil {
+		<-f.release
+	}
+
+	if hold, ok := f.hold[batch[0].routingKey]; ok {
+		<-hold
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(batch))
+	for _, pending := range batch {
+		keys = append(keys, pending.routingKey)
+	}
+
+	f.batches = append(f.batches, keys)
+
+	return make([]error, len(batch))
+}
+
+func (f *fakeBatchPublisher) Close() error { return nil }
+
+func newTestAsyncProducer(
+	t *testing.T,
+	publisher *fakeBatchPublisher,
+	opts ...func(*AsyncProducerConfig),
+) *AsyncProducer {
+	t.Helper()
+
+	logger := log.NewMockLoggerI(gomock.NewController(t))
+	logger.EXPECT().WithContext(gomock.Any()).Return(logger).AnyTimes()
+	logger.EXPECT().Error(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+	conn := NewRabbitMQConnection(Config{Exchange: "events"}, WithLogger(logger))
+
+	return newAsyncProducer(conn, func() batchPublisher { return publisher }, opts...)
+}
+
+func TestAsyncProducer_Flush(t *testing.T) {
+	publisher := &fakeBatchPublisher{}
+	producer := newTestAsyncProducer(t, publisher, WithAsyncBatchSize(2), WithAsyncFlushInterval(time.Hour), WithAsyncChannels(1))
+	ctx := context.Background()
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		assert.NoError(t, producer.Produce(ctx, key, testOrder{ID: key}))
+	}
+
+	assert.NoError(t, producer.Flush(ctx))
+	assert.Equal(t, [][]string{{"a", "b"}, {"c", "d"}, {"e"}}, publisher.batches)
+
+	assert.NoError(t, producer.Close(ctx))
+	assert.ErrorIs(t, producer.Produce(ctx, "f", testOrder{ID: "f"}), ErrAsyncProducerClosed)
+}
+
+func TestAsyncProducer_FlushInterval(t *testing.T) {
+	publisher := &fakeBatchPublisher{}
+	producer := newTestAsyncProducer(t, publisher, WithAsyncFlushInterval(time.Millisecond))
+	ctx := context.Background()
+
+	assert.NoError(t, producer.Produce(ctx, "a", testOrder{ID: "a"}))
+
+	assert.Eventually(t, func() bool {
+		publisher.mu.Lock()
+		defer publisher.mu.Unlock()
+
+		return len(publisher.batches) == 1
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, producer.Close(ctx))
+}
+
+func TestAsyncProducer_Overflow(t *testing.T) {
+	publisher := &fakeBatchPublisher{release: make(chan struct{})}
+	producer := newTestAsyncProducer(t, publisher, WithAsyncBufferSize(1), WithAsyncBatchSize(1), WithAsyncChannels(1))
+	ctx := context.Background()
+
+	// one message is being published, one waits in the collector and one in the buffer: the next
+	// ones spill to the fallback, which isn't configured
+	var failed int
+
+	for range 4 {
+		if err := producer.Produce(ctx, "a", testOrder{ID: "a"}); err != nil {
+			failed++
+		}
+	}
+
+	assert.GreaterOrEqual(t, failed, 1)
+
+	close(publisher.release)
+
+	assert.NoError(t, producer.Flush(ctx))
+	assert.NoError(t, producer.Close(ctx))
+}
+
+func TestAsyncProducer_FlushProducedBefore(t *testing.T) {
+	publisher := &fakeBatchPublisher{hold: map[string]chan struct{}{
+		"a": make(chan struct{}),
+		"b": make(chan struct{}),
+	}}
+	producer := newTestAsyncProducer(t, publisher, WithAsyncBatchSize(1), WithAsyncChannels(2))
+	ctx := context.Background()
+
+	assert.NoError(t, producer.Produce(ctx, "a", testOrder{ID: "a"}))
+
+	flushed := make(chan error, 1)
+
+	go func() { flushed <- producer.Flush(ctx) }()
+
+	assert.Eventually(t, func() bool {
+		producer.pendingMu.Lock()
+		defer producer.pendingMu.Unlock()
+
+		return len(producer.waiters) == 1
+	}, time.Second, time.Millisecond)
+
+	// produced after Flush was called: it doesn't hold it
+	assert.NoError(t, producer.Produce(ctx, "b", testOrder{ID: "b"}))
+	close(publisher.hold["a"])
+
+	select {
+	case err := <-flushed:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Flush waited for a message produced after the call")
+	}
+
+	close(publisher.hold["b"])
+
+	assert.NoError(t, producer.Flush(ctx))
+	assert.ElementsMatch(t, [][]string{{"a"}, {"b"}}, publisher.batches)
+	assert.NoError(t, producer.Close(ctx))
+}
+
+func TestAsyncProducer_CloseTimeout(t *testing.T) {
+	publisher := &fakeBatchPublisher{release: make(chan struct{})}
+	producer := newTestAsyncProducer(t, publisher, WithAsyncBatchSize(1), WithAsyncChannels(1))
+	fallback := newTestGormFallback(t, &GormFallbackProducerModel{})
+	WithGormDatabaseFallback(fallback)(producer.conn)
+
+	ctx := context.Background()
+
+	// "a" is being published, "b" waits in the collector and the others in the buffer
+	for _, key := range []string{"a", "b", "c", "d"} {
+		assert.NoError(t, producer.Produce(ctx, key, testOrder{ID: key}))
+	}
+
+	closeCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, producer.Close(closeCtx), context.DeadlineExceeded)
+
+	// the messages not handed to a channel are written to the fallback instead of being lost
+	var keys []string
+	assert.NoError(t, fallback.database.Model(&GormFallbackProducerModel{}).Pluck("routing_key", &keys).Error)
+	assert.ElementsMatch(t, []string{"b", "c", "d"}, keys)
+
+	close(publisher.release)
+
+	assert.NoError(t, producer.Flush(ctx))
+	assert.Equal(t, [][]string{{"a"}}, publisher.batches)
+}
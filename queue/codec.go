@@ -0,0 +1,79 @@
+package queue
+
+import (
+	"encoding/json"
+	"mime"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const ContentTypeJSON = "application/json"
+
+var (
+	ErrUnsupportedContentType = errors.New("unsupported content type")
+	ErrDecodeMessage          = errors.New("decode message")
+)
+
+// Codec encodes and decodes message bodies of a given content type.
+type Codec interface {
+	ContentType() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+type JSONCodec struct{}
+
+var _ Codec = JSONCodec{}
+
+func (JSONCodec) ContentType() string {
+	return ContentTypeJSON
+}
+
+func (JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (JSONCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+var codecRegistry = struct { //nolint:gochecknoglobals
+	sync.RWMutex
+	codecs map[string]Codec
+}{
+	codecs: map[string]Codec{
+		ContentTypeJSON: JSONCodec{},
+	},
+}
+
+// RegisterCodec makes a codec available to typed consumers receiving its content type.
+func RegisterCodec(codec Codec) {
+	codecRegistry.Lock()
+	defer codecRegistry.Unlock()
+
+	codecRegistry.codecs[codec.ContentType()] = codec
+}
+
+// codecFor returns the codec registered for the content type; messages without a content type are
+// considered JSON.
+func codecFor(contentType string) (Codec, error) {
+	if contentType == "" {
+		return JSONCodec{}, nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, errors.Wrap(ErrUnsupportedContentType, contentType)
+	}
+
+	codecRegistry.RLock()
+	defer codecRegistry.RUnlock()
+
+	codec, ok := codecRegistry.codecs[mediaType]
+	if !ok {
+		return nil, errors.Wrap(ErrUnsupportedContentType, contentType)
+	}
+
+	return codec, nil
+}
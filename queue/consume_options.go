@@ -1,5 +1,7 @@
 package queue
 
+import "time"
+
 func WithPrefetch(count int) func(*ConsumeOptions) {
 	return func(o *ConsumeOptions) {
 		o.PrefetchCount = &count
@@ -11,3 +13,40 @@ func WithPriority(priority int) func(*ConsumeOptions) {
 		o.Priority = &priority
 	}
 }
+
+// WithConcurrency sets how many handlers run in parallel over the same channel.
+func WithConcurrency(workers int) func(*ConsumeOptions) {
+	return func(o *ConsumeOptions) {
+		o.Concurrency = &workers
+	}
+}
+
+// WithOrderingKey keeps messages sharing the same value for the given header
+// sequential when consuming with concurrency.
+func WithOrderingKey(header string) func(*ConsumeOptions) {
+	return func(o *ConsumeOptions) {
+		o.OrderingKey = &header
+	}
+}
+
+// WithIdempotency skips messages already processed, keyed by the message-id header.
+func WithIdempotency(store IdempotencyStore) func(*ConsumeOptions) {
+	return func(o *ConsumeOptions) {
+		o.Idempotency = store
+	}
+}
+
+// WithShutdownTimeout sets how long Consume waits for in-flight handlers once ctx is cancelled.
+func WithShutdownTimeout(timeout time.Duration) func(*ConsumeOptions) {
+	return func(o *ConsumeOptions) {
+		o.ShutdownTimeout = &timeout
+	}
+}
+
+// WithInProgressRetryDelay sets how long a consumer waits before requeueing a message that's being
+// handled elsewhere, see WithIdempotency. Defaults to 1 second.
+func WithInProgressRetryDelay(delay time.Duration) func(*ConsumeOptions) {
+	return func(o *ConsumeOptions) {
+		o.InProgressRetryDelay = &delay
+	}
+}
@@ -1,13 +1,19 @@
 package queue
 
 import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
-	"reflect"
+	"gorm.io/gorm/clause"
 )
 
 const (
-	fallbackProducerTableName = "fallback_producer_queue_messages"
+	fallbackProducerTableName  = "fallback_producer_queue_messages"
+	scheduledMessagesTableName = "scheduled_queue_messages"
 )
 
 type GormFallbackProducerInterface interface {
@@ -16,17 +22,53 @@ type GormFallbackProducerInterface interface {
 
 var _ GormFallbackProducerInterface = &GormFallbackProducerModel{}
 
+// GormFallbackProducerModel is a message kept while the broker is unavailable. ContentType and
+// MessageID must be passed along when it's published again; tables created before they were added
+// need the content_type and message_id columns, see GormFallback.Migrate.
 type GormFallbackProducerModel struct {
-	ID         uint `gorm:"primary_key"`
-	RoutingKey string
-	Headers    []byte
-	Body       []byte
+	ID          uint `gorm:"primary_key"`
+	RoutingKey  string
+	ContentType string
+	MessageID   string
+	Headers     []byte
+	Body        []byte
 }
 
 func (model GormFallbackProducerModel) TableName() string {
 	return fallbackProducerTableName
 }
 
+// GormScheduledMessageModel is a delayed message kept until the broker can hold it, see RunScheduler.
+type GormScheduledMessageModel struct {
+	ID          uint `gorm:"primary_key"`
+	RoutingKey  string
+	ContentType string
+	MessageID   string
+	Headers     []byte
+	Body        []byte
+	DeliverAt   time.Time `gorm:"index"`
+}
+
+func (GormScheduledMessageModel) TableName() string {
+	return scheduledMessagesTableName
+}
+
+func (model GormScheduledMessageModel) message() (Message, error) {
+	message := Message{
+		ContentType: model.ContentType,
+		MessageID:   model.MessageID,
+		Body:        model.Body,
+	}
+
+	if len(model.Headers) > 0 {
+		if err := json.Unmarshal(model.Headers, &message.Headers); err != nil {
+			return Message{}, errors.Wrap(err, "unmarshal headers")
+		}
+	}
+
+	return message, nil
+}
+
 type GormFallback struct {
 	produceModel GormFallbackProducerInterface
 	database     *gorm.DB
@@ -46,6 +88,15 @@ func NewGormFallBack(
 	}, nil
 }
 
+// Migrate creates the producer and scheduler tables, or adds their missing columns.
+func (f *GormFallback) Migrate(ctx context.Context) error {
+	if err := f.database.WithContext(ctx).AutoMigrate(f.produceModel, &GormScheduledMessageModel{}); err != nil {
+		return errors.Wrap(err, "migrate")
+	}
+
+	return nil
+}
+
 func validateProducerTableColumns(model GormFallbackProducerInterface) error {
 	if model.TableName() != fallbackProducerTableName {
 		return errors.New("produce table name must be: " + fallbackProducerTableName)
@@ -86,3 +137,83 @@ func hasFieldWithType(model any, fieldName string, expectedType reflect.Kind) bo
 
 	return field.Type.Kind() == expectedType
 }
+
+func (f *GormFallback) schedule(ctx context.Context, routingKey string, msg *Message, deliverAt time.Time) error {
+	headers, err := json.Marshal(msg.Headers)
+	if err != nil {
+		return errors.Wrap(err, "marshal headers")
+	}
+
+	model := &GormScheduledMessageModel{
+		RoutingKey:  routingKey,
+		ContentType: msg.ContentType,
+		MessageID:   msg.MessageID,
+		Headers:     headers,
+		Body:        msg.Body,
+		DeliverAt:   deliverAt,
+	}
+
+	if err := f.database.WithContext(ctx).Create(model).Error; err != nil {
+		return errors.Wrap(err, "create scheduled message")
+	}
+
+	return nil
+}
+
+// releaseScheduled passes the messages due until the given time to publish, deleting the published
+// ones. It stops at the first publish error, keeping the remaining messages for the next run.
+func (f *GormFallback) releaseScheduled(
+	ctx context.Context,
+	until time.Time,
+	limit int,
+	publish func(model GormScheduledMessageModel) error,
+) (int, error) {
+	var (
+		released   int
+		publishErr error
+	)
+
+	err := f.database.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var models []GormScheduledMessageModel
+
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("deliver_at <= ?", until).
+			Order("deliver_at").
+			Limit(limit).
+			Find(&models).
+			Error
+		if err != nil {
+			return errors.Wrap(err, "find scheduled messages")
+		}
+
+		ids := make([]uint, 0, len(models))
+
+		for _, model := range models {
+			if publishErr = publish(model); publishErr != nil {
+				break
+			}
+
+			ids = append(ids, model.ID)
+		}
+
+		if len(ids) > 0 {
+			if err := tx.Delete(&GormScheduledMessageModel{}, ids).Error; err != nil {
+				return errors.Wrap(err, "delete scheduled messages")
+			}
+		}
+
+		released = len(ids)
+
+		// commit the deletes of what was published
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if publishErr != nil {
+		return released, errors.Wrap(publishErr, "publish scheduled message")
+	}
+
+	return released, nil
+}
@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestDatabase(t *testing.T, models ...any) *gorm.DB {
+	t.Helper()
+
+	database, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	// every connection to an in-memory database opens a new, empty one
+	sqlDB, err := database.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	require.NoError(t, database.AutoMigrate(models...))
+
+	return database
+}
+
+func newTestGormFallback(t *testing.T, models ...any) *GormFallback {
+	t.Helper()
+
+	fallback, err := NewGormFallBack(newTestDatabase(t, models...), GormFallbackProducerModel{})
+	require.NoError(t, err)
+
+	return fallback
+}
+
+func TestRabbitMQConnection_handlePublisherFallBack(t *testing.T) {
+	logger := log.NewMockLoggerI(gomock.NewController(t))
+	fallback := newTestGormFallback(t, &GormFallbackProducerModel{})
+	conn := NewRabbitMQConnection(Config{}, WithLogger(logger), WithGormDatabaseFallback(fallback))
+
+	message, err := buildMessage(Message{
+		Headers:     map[string]any{"tenant": "acme"},
+		Body:        []byte("order,1"),
+		ContentType: "text/csv",
+		MessageID:   "order-1",
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, conn.handlePublisherFallBack(context.Background(), "order.created", &message))
+
+	var models []GormFallbackProducerModel
+	require.NoError(t, fallback.database.Find(&models).Error)
+	require.Len(t, models, 1)
+
+	assert.Equal(t, "order.created", models[0].RoutingKey)
+	assert.Equal(t, "text/csv", models[0].ContentType)
+	assert.Equal(t, "order-1", models[0].MessageID)
+	assert.Equal(t, []byte("order,1"), models[0].Body)
+
+	var headers map[string]any
+	require.NoError(t, json.Unmarshal(models[0].Headers, &headers))
+	assert.Equal(t, map[string]any{"tenant": "acme", MessageIDHeader: "order-1"}, headers)
+}
+
+func TestGormFallback_Migrate(t *testing.T) {
+	fallback := newTestGormFallback(t)
+
+	require.NoError(t, fallback.Migrate(context.Background()))
+
+	assert.True(t, fallback.database.Migrator().HasTable(fallbackProducerTableName))
+	assert.True(t, fallback.database.Migrator().HasColumn(&GormFallbackProducerModel{}, "MessageID"))
+	assert.True(t, fallback.database.Migrator().HasTable(scheduledMessagesTableName))
+}
+
+func newTestScheduledMessages(t *testing.T, fallback *GormFallback, deliverAt ...time.Time) {
+	t.Helper()
+
+	for i, at := range deliverAt {
+		message, err := buildMessage(Message{MessageID: fmt.Sprintf("reminder-%d", i+1), Body: []byte(`{}`)})
+		require.NoError(t, err)
+		require.NoError(t, fallback.schedule(context.Background(), "order.reminder", &message, at))
+	}
+}
+
+func scheduledMessageIDs(t *testing.T, fallback *GormFallback) []string {
+	t.Helper()
+
+	var ids []string
+	require.NoError(t, fallback.database.Model(&GormScheduledMessageModel{}).Order("deliver_at").Pluck("message_id", &ids).Error)
+
+	return ids
+}
+
+func TestGormFallback_releaseScheduled(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	fallback := newTestGormFallback(t, &GormFallbackProducerModel{}, &GormScheduledMessageModel{})
+
+	newTestScheduledMessages(t, fallback, now.Add(-3*time.Minute), now.Add(-2*time.Minute), now.Add(-time.Minute), now.Add(time.Hour))
+
+	var published []string
+
+	publishErr := errors.New("unknown")
+
+	// stops at the first failure: what was published is deleted, the rest waits for the next run
+	released, err := fallback.releaseScheduled(ctx, now, 10, func(model GormScheduledMessageModel) error {
+		if model.MessageID == "reminder-2" {
+			return publishErr
+		}
+
+		published = append(published, model.MessageID)
+
+		return nil
+	})
+	assert.ErrorIs(t, err, publishErr)
+	assert.Equal(t, 1, released)
+	assert.Equal(t, []string{"reminder-1"}, published)
+	assert.Equal(t, []string{"reminder-2", "reminder-3", "reminder-4"}, scheduledMessageIDs(t, fallback))
+
+	publish := func(model GormScheduledMessageModel) error {
+		published = append(published, model.MessageID)
+
+		return nil
+	}
+
+	// a partial batch leaves the remaining due messages for the next call
+	released, err = fallback.releaseScheduled(ctx, now, 1, publish)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, released)
+	assert.Equal(t, []string{"reminder-3", "reminder-4"}, scheduledMessageIDs(t, fallback))
+
+	released, err = fallback.releaseScheduled(ctx, now, 10, publish)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, released)
+	assert.Equal(t, []string{"reminder-1", "reminder-2", "reminder-3"}, published)
+	assert.Equal(t, []string{"reminder-4"}, scheduledMessageIDs(t, fallback))
+}
@@ -0,0 +1,297 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/braiphub/go-core/cache"
+	"github.com/braiphub/go-core/log"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MessageIDHeader is set by Produce on every message and used as idempotency key.
+const MessageIDHeader = "message-id"
+
+const (
+	defaultIdempotencyTTL     = 24 * time.Hour
+	defaultIdempotencyLockTTL = 5 * time.Minute
+	idempotencyTableName      = "processed_queue_messages"
+
+	idempotencyStatusProcessing = "processing"
+	idempotencyStatusProcessed  = "processed"
+)
+
+var (
+	ErrMessageProcessed  = errors.New("message already processed")
+	ErrMessageInProgress = errors.New("message is being processed")
+)
+
+// IdempotencyStore tracks which messages were processed. Acquire marks the key as being processed
+// and fails with ErrMessageProcessed or ErrMessageInProgress when it was already marked; the
+// in-progress mark expires after the lock ttl, so a consumer that dies mid-handler doesn't block
+// the redelivery. Release drops the mark after a handler failure so the message can be retried.
+type IdempotencyStore interface {
+	Acquire(ctx context.Context, key string) error
+	Complete(ctx context.Context, key string) error
+	Release(ctx context.Context, key string) error
+}
+
+type IdempotencyStoreConfig struct {
+	// TTL is how long processed keys are kept. Defaults to 24 hours.
+	TTL time.Duration
+	// LockTTL is how long an in-progress key blocks redeliveries. Defaults to 5 minutes.
+	LockTTL time.Duration
+}
+
+func WithIdempotencyTTL(ttl time.Duration) func(*IdempotencyStoreConfig) {
+	return func(c *IdempotencyStoreConfig) {
+		c.TTL = ttl
+	}
+}
+
+func WithIdempotencyLockTTL(ttl time.Duration) func(*IdempotencyStoreConfig) {
+	return func(c *IdempotencyStoreConfig) {
+		c.LockTTL = ttl
+	}
+}
+
+func newIdempotencyStoreConfig(opts []func(*IdempotencyStoreConfig)) IdempotencyStoreConfig {
+	config := IdempotencyStoreConfig{
+		TTL:     defaultIdempotencyTTL,
+		LockTTL: defaultIdempotencyLockTTL,
+	}
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	return config
+}
+
+// withIdempotency skips messages already processed by the queue consumers. Messages being handled
+// elsewhere fail with ErrMessageInProgress after the retry delay, consumers then requeue them
+// instead of dead-lettering.
+func withIdempotency(
+	queue string,
+	store IdempotencyStore,
+	retryDelay time.Duration,
+	logger log.LoggerI,
+	processMsgFn func(ctx context.Context, msg Message) error,
+) func(ctx context.Context, msg Message) error {
+	return func(ctx context.Context, msg Message) error {
+		id := messageID(msg)
+		if id == "" {
+			return processMsgFn(ctx, msg)
+		}
+
+		key := queue + ":" + id
+
+		switch err := store.Acquire(ctx, key); {
+		case errors.Is(err, ErrMessageProcessed):
+			return nil
+		case errors.Is(err, ErrMessageInProgress):
+			// without the delay the message bounces between the broker and the consumers until
+			// the other handler finishes
+			select {
+			case <-time.After(retryDelay):
+			case <-ctx.Done():
+			}
+
+			return err
+		case err != nil:
+			return errors.Wrap(err, "acquire idempotency key")
+		}
+
+		if err := processMsgFn(ctx, msg); err != nil {
+			if releaseErr := store.Release(context.WithoutCancel(ctx), key); releaseErr != nil && logger != nil {
+				logger.WithContext(ctx).Error("release idempotency key", releaseErr, log.Any("key", key))
+			}
+
+			return err
+		}
+
+		// the handler side effects already happened: a failure here must not send the message to
+		// the dead-letter queue, the key stays in progress until the lock ttl expires
+		if err := store.Complete(context.WithoutCancel(ctx), key); err != nil && logger != nil {
+			logger.WithContext(ctx).Error("complete idempotency key", err, log.Any("key", key))
+		}
+
+		return nil
+	}
+}
+
+func messageID(msg Message) string {
+	if id, ok := msg.Headers[MessageIDHeader].(string); ok && id != "" {
+		return id
+	}
+
+	return msg.MessageID
+}
+
+// IdempotencyCache is a cache.Cacherer able to set a key only when it's missing, e.g.: redis.RedisAdapter.
+type IdempotencyCache interface {
+	cache.Cacherer
+	SetNX(ctx context.Context, key string, value interface{}, duration time.Duration) (bool, error)
+}
+
+// CacheIdempotencyStore keeps the keys in a cache, e.g.: redis. Acquire claims the key with SetNX,
+// so concurrent consumers can't both take the same message.
+type CacheIdempotencyStore struct {
+	cache  IdempotencyCache
+	config IdempotencyStoreConfig
+}
+
+func NewCacheIdempotencyStore(cacher IdempotencyCache, opts ...func(*IdempotencyStoreConfig)) *CacheIdempotencyStore {
+	return &CacheIdempotencyStore{
+		cache:  cacher,
+		config: newIdempotencyStoreConfig(opts),
+	}
+}
+
+func (s *CacheIdempotencyStore) Acquire(ctx context.Context, key string) error {
+	acquired, err := s.cache.SetNX(ctx, s.key(key), idempotencyStatusProcessing, s.config.LockTTL)
+	if err != nil {
+		return errors.Wrap(err, "set idempotency key")
+	}
+
+	if acquired {
+		return nil
+	}
+
+	status, err := s.cache.GetString(ctx, s.key(key))
+
+	switch {
+	// expired right after SetNX: the redelivery takes it
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrMessageInProgress
+	case err != nil:
+		return errors.Wrap(err, "get idempotency key")
+	case status == idempotencyStatusProcessed:
+		return ErrMessageProcessed
+	default:
+		return ErrMessageInProgress
+	}
+}
+
+func (s *CacheIdempotencyStore) Complete(ctx context.Context, key string) error {
+	if err := s.cache.Set(ctx, s.key(key), idempotencyStatusProcessed, s.config.TTL); err != nil {
+		return errors.Wrap(err, "set idempotency key")
+	}
+
+	return nil
+}
+
+func (s *CacheIdempotencyStore) Release(ctx context.Context, key string) error {
+	if err := s.cache.Delete(ctx, s.key(key)); err != nil {
+		return errors.Wrap(err, "delete idempotency key")
+	}
+
+	return nil
+}
+
+func (s *CacheIdempotencyStore) key(key string) string {
+	return "queue:idempotency:" + key
+}
+
+type GormProcessedMessageModel struct {
+	MessageKey string    `gorm:"primaryKey;size:255"`
+	Status     string    `gorm:"size:16"`
+	ExpiresAt  time.Time `gorm:"index"`
+}
+
+func (GormProcessedMessageModel) TableName() string {
+	return idempotencyTableName
+}
+
+// GormIdempotencyStore keeps the keys in the processed_queue_messages table. Expired rows are
+// ignored by Acquire and removed by PurgeExpired.
+type GormIdempotencyStore struct {
+	database *gorm.DB
+	config   IdempotencyStoreConfig
+}
+
+func NewGormIdempotencyStore(database *gorm.DB, opts ...func(*IdempotencyStoreConfig)) *GormIdempotencyStore {
+	return &GormIdempotencyStore{
+		database: database,
+		config:   newIdempotencyStoreConfig(opts),
+	}
+}
+
+func (s *GormIdempotencyStore) Acquire(ctx context.Context, key string) error {
+	now := time.Now()
+	model := GormProcessedMessageModel{
+		MessageKey: key,
+		Status:     idempotencyStatusProcessing,
+		ExpiresAt:  now.Add(s.config.LockTTL),
+	}
+
+	result := s.database.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&model)
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "insert idempotency key")
+	}
+
+	if result.RowsAffected == 1 {
+		return nil
+	}
+
+	// take over expired keys: processed ones past their ttl or locks left by a dead consumer
+	result = s.database.WithContext(ctx).
+		Model(&GormProcessedMessageModel{}).
+		Where("message_key = ? AND expires_at < ?", key, now).
+		Updates(map[string]any{"status": model.Status, "expires_at": model.ExpiresAt})
+	if result.Error != nil {
+		return errors.Wrap(result.Error, "update idempotency key")
+	}
+
+	if result.RowsAffected == 1 {
+		return nil
+	}
+
+	var existing GormProcessedMessageModel
+	if err := s.database.WithContext(ctx).Where("message_key = ?", key).First(&existing).Error; err != nil {
+		return errors.Wrap(err, "get idempotency key")
+	}
+
+	if existing.Status == idempotencyStatusProcessed {
+		return ErrMessageProcessed
+	}
+
+	return ErrMessageInProgress
+}
+
+func (s *GormIdempotencyStore) Complete(ctx context.Context, key string) error {
+	err := s.database.WithContext(ctx).
+		Model(&GormProcessedMessageModel{}).
+		Where("message_key = ?", key).
+		Updates(map[string]any{"status": idempotencyStatusProcessed, "expires_at": time.Now().Add(s.config.TTL)}).
+		Error
+	if err != nil {
+		return errors.Wrap(err, "update idempotency key")
+	}
+
+	return nil
+}
+
+func (s *GormIdempotencyStore) Release(ctx context.Context, key string) error {
+	if err := s.database.WithContext(ctx).Where("message_key = ?", key).Delete(&GormProcessedMessageModel{}).Error; err != nil {
+		return errors.Wrap(err, "delete idempotency key")
+	}
+
+	return nil
+}
+
+// PurgeExpired deletes expired keys, it's meant to be scheduled periodically.
+func (s *GormIdempotencyStore) PurgeExpired(ctx context.Context) error {
+	err := s.database.WithContext(ctx).
+		Where("expires_at < ?", time.Now()).
+		Delete(&GormProcessedMessageModel{}).
+		Error
+	if err != nil {
+		return errors.Wrap(err, "delete expired idempotency keys")
+	}
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCacher struct {
+	mu     sync.Mutex
+	values map[string]any
+}
+
+func newTestCacher() *testCacher {
+	return &testCacher{values: make(map[string]any)}
+}
+
+func (c *testCacher) TestConnection(context.Context) error { return nil }
+
+func (c *testCacher) Set(_ context.Context, key string, value interface{}, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[key] = value
+
+	return nil
+}
+
+func (c *testCacher) SetNX(_ context.Context, key string, value interface{}, _ time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.values[key]; ok {
+		return false, nil
+	}
+
+	c.values[key] = value
+
+	return true, nil
+}
+
+func (c *testCacher) Get(ctx context.Context, key string) ([]byte, error) {
+	value, err := c.GetString(ctx, key)
+
+	return []byte(value), err
+}
+
+func (c *testCacher) GetString(_ context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	value, ok := c.values[key]
+	if !ok {
+		return "", sql.ErrNoRows
+	}
+
+	return value.(string), nil
+}
+
+func (c *testCacher) GetInt(context.Context, string) (int, error) { return 0, nil }
+
+func (c *testCacher) GetUint(context.Context, string) (uint, error) { return 0, nil }
+
+func (c *testCacher) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.values, key)
+
+	return nil
+}
+
+func TestInMemoryBroker_ConsumeWithIdempotency(t *testing.T) {
+	broker := newTestBroker(t)
+	store := NewCacheIdempotencyStore(newTestCacher())
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var calls int
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		broker.Consume(ctx, "orders", func(context.Context, Message) error {
+			calls++
+
+			return nil
+		}, WithIdempotency(store))
+	}()
+
+	waitConsumers(t, broker, "orders")
+
+	msg := Message{MessageID: "order-1", Body: []byte(`{"id":"1"}`)}
+
+	assert.NoError(t, broker.Produce(ctx, "order.created", msg))
+	assert.NoError(t, broker.Produce(ctx, "order.created", msg))
+	assert.NoError(t, broker.Produce(ctx, "order.created", testOrder{ID: "2"}))
+	assert.NoError(t, broker.WaitIdle(ctx))
+
+	cancel()
+	<-done
+
+	assert.Equal(t, 2, calls)
+}
+
+func Test_withIdempotency(t *testing.T) {
+	ctx := context.Background()
+	store := NewCacheIdempotencyStore(newTestCacher())
+	msg := Message{Headers: map[string]any{MessageIDHeader: "1"}}
+
+	var calls int
+
+	handlerErr := errors.New("unknown")
+	fn := withIdempotency("orders", store, 20*time.Millisecond, nil, func(context.Context, Message) error {
+		calls++
+
+		if calls == 1 {
+			return handlerErr
+		}
+
+		return nil
+	})
+
+	// a failed handler releases the key, so the retry is processed
+	assert.ErrorIs(t, fn(ctx, msg), handlerErr)
+	assert.NoError(t, fn(ctx, msg))
+	assert.NoError(t, fn(ctx, msg))
+	assert.Equal(t, 2, calls)
+
+	// a message being handled elsewhere is requeued after the retry delay
+	assert.NoError(t, store.Acquire(ctx, "orders:2"))
+
+	start := time.Now()
+
+	assert.ErrorIs(t, fn(ctx, Message{MessageID: "2"}), ErrMessageInProgress)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+}
+
+func testIdempotencyStoreAcquire(t *testing.T, store IdempotencyStore) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	// concurrent consumers can't both take the same key
+	var (
+		wg       sync.WaitGroup
+		acquired atomic.Int32
+	)
+
+	for range 10 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			switch err := store.Acquire(ctx, "orders:1"); {
+			case err == nil:
+				acquired.Add(1)
+			default:
+				assert.ErrorIs(t, err, ErrMessageInProgress)
+			}
+		}()
+	}
+
+	wg.Wait()
+	assert.Equal(t, int32(1), acquired.Load())
+
+	assert.NoError(t, store.Complete(ctx, "orders:1"))
+	assert.ErrorIs(t, store.Acquire(ctx, "orders:1"), ErrMessageProcessed)
+
+	assert.NoError(t, store.Acquire(ctx, "orders:2"))
+	assert.NoError(t, store.Release(ctx, "orders:2"))
+	assert.NoError(t, store.Acquire(ctx, "orders:2"))
+}
+
+func TestCacheIdempotencyStore(t *testing.T) {
+	testIdempotencyStoreAcquire(t, NewCacheIdempotencyStore(newTestCacher()))
+}
+
+func TestGormIdempotencyStore(t *testing.T) {
+	testIdempotencyStoreAcquire(t, NewGormIdempotencyStore(newTestDatabase(t, &GormProcessedMessageModel{})))
+}
+
+func TestGormIdempotencyStore_Expired(t *testing.T) {
+	ctx := context.Background()
+	database := newTestDatabase(t, &GormProcessedMessageModel{})
+	store := NewGormIdempotencyStore(database, WithIdempotencyTTL(time.Hour), WithIdempotencyLockTTL(time.Hour))
+
+	assert.NoError(t, database.Create([]GormProcessedMessageModel{
+		{MessageKey: "orders:1", Status: idempotencyStatusProcessing, ExpiresAt: time.Now().Add(-time.Minute)},
+		{MessageKey: "orders:2", Status: idempotencyStatusProcessed, ExpiresAt: time.Now().Add(-time.Minute)},
+		{MessageKey: "orders:3", Status: idempotencyStatusProcessed, ExpiresAt: time.Now().Add(time.Minute)},
+	}).Error)
+
+	// the lock left by a dead consumer and the processed key past its ttl are taken over
+	assert.NoError(t, store.Acquire(ctx, "orders:1"))
+	assert.NoError(t, store.Acquire(ctx, "orders:2"))
+	assert.ErrorIs(t, store.Acquire(ctx, "orders:3"), ErrMessageProcessed)
+
+	assert.NoError(t, database.Model(&GormProcessedMessageModel{}).
+		Where("message_key = ?", "orders:3").
+		Update("expires_at", time.Now().Add(-time.Minute)).Error)
+	assert.NoError(t, store.PurgeExpired(ctx))
+
+	var keys []string
+	assert.NoError(t, database.Model(&GormProcessedMessageModel{}).Order("message_key").Pluck("message_key", &keys).Error)
+	assert.Equal(t, []string{"orders:1", "orders:2"}, keys)
+}
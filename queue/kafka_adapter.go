@@ -0,0 +1,443 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/braiphub/go-core/log"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/segmentio/kafka-go"
+)
+
+// assert meets contract
+var _ QueueI = &KafkaAdapter{}
+
+const (
+	kafkaContentTypeHeader = "content-type"
+	defaultKafkaDeadSuffix = ".dead"
+	kafkaCommitTimeout     = 5 * time.Second
+	kafkaDeadLetterBackoff = 100 * time.Millisecond
+)
+
+type KafkaReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+type KafkaWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+type KafkaReaderFactory func(config kafka.ReaderConfig) KafkaReader
+
+type KafkaConfig struct {
+	Brokers []string
+	// GroupID is the consumer group used by Consume, usually the service name.
+	GroupID string
+	// KeyHeader, when set, names the header whose value is used as the kafka message key, so
+	// messages of the same aggregate land on the same partition.
+	KeyHeader string
+	// DeadLetterSuffix is appended to the topic name to build the dead-letter topic. Defaults to ".dead".
+	DeadLetterSuffix string
+}
+
+// KafkaAdapter implements QueueI on top of kafka topics: the routing key given to Produce is the
+// topic, Consume joins the configured consumer group and ConsumeStream joins an ephemeral group
+// reading from the latest offset.
+type KafkaAdapter struct {
+	config            KafkaConfig
+	logger            log.LoggerI
+	errorHandler      ErrorHandlerFunc
+	deferPanicHandler DeferPanicHandlerFunc
+	schemaRegistry    *SchemaRegistry
+	writer            KafkaWriter
+	newReader         KafkaReaderFactory
+	deadLetterBackoff time.Duration
+}
+
+func NewKafkaAdapter(config KafkaConfig, opts ...func(*KafkaAdapter)) *KafkaAdapter {
+	if config.DeadLetterSuffix == "" {
+		config.DeadLetterSuffix = defaultKafkaDeadSuffix
+	}
+
+	adapter := &KafkaAdapter{
+		config:            config,
+		deadLetterBackoff: kafkaDeadLetterBackoff,
+		newReader: func(config kafka.ReaderConfig) KafkaReader {
+			return kafka.NewReader(config)
+		},
+	}
+
+	for _, o := range opts {
+		o(adapter)
+	}
+
+	adapter.validate()
+
+	if adapter.writer == nil {
+		adapter.writer = &kafka.Writer{ //nolint:exhaustruct
+			Addr:                   kafka.TCP(config.Brokers...),
+			Balancer:               &kafka.Hash{},
+			RequiredAcks:           kafka.RequireAll,
+			AllowAutoTopicCreation: true,
+		}
+	}
+
+	return adapter
+}
+
+func WithKafkaLogger(logger log.LoggerI) func(*KafkaAdapter) {
+	return func(k *KafkaAdapter) {
+		k.logger = logger
+	}
+}
+
+func WithKafkaErrorHandler(fn ErrorHandlerFunc) func(*KafkaAdapter) {
+	return func(k *KafkaAdapter) {
+		k.errorHandler = fn
+	}
+}
+
+func WithKafkaDeferPanicHandler(fn DeferPanicHandlerFunc) func(*KafkaAdapter) {
+	return func(k *KafkaAdapter) {
+		k.deferPanicHandler = fn
+	}
+}
+
+// WithKafkaSchemaRegistry validates produced messages and upcasts consumed ones using the
+// registered schemas, as WithSchemaRegistry does for RabbitMQ.
+func WithKafkaSchemaRegistry(registry *SchemaRegistry) func(*KafkaAdapter) {
+	return func(k *KafkaAdapter) {
+		k.schemaRegistry = registry
+	}
+}
+
+// WithKafkaWriter replaces the default writer, e.g.: with an in-process fake.
+func WithKafkaWriter(writer KafkaWriter) func(*KafkaAdapter) {
+	return func(k *KafkaAdapter) {
+		k.writer = writer
+	}
+}
+
+// WithKafkaReaderFactory replaces how readers are created, e.g.: with an in-process fake.
+func WithKafkaReaderFactory(factory KafkaReaderFactory) func(*KafkaAdapter) {
+	return func(k *KafkaAdapter) {
+		k.newReader = factory
+	}
+}
+
+func (k *KafkaAdapter) validate() {
+	switch {
+	case k.logger == nil:
+		panic("kafka: missing logger")
+	case k.config.GroupID == "":
+		panic("kafka: missing consumer group id")
+	}
+}
+
+func (k *KafkaAdapter) Close() error {
+	return k.writer.Close()
+}
+
+func (k *KafkaAdapter) Produce(ctx context.Context, routingKey string, msg any) error {
+	message, err := buildMessage(msg)
+	if err != nil {
+		return errors.Wrap(err, "build message")
+	}
+
+	if k.schemaRegistry != nil {
+		if err := k.schemaRegistry.PrepareOutgoing(routingKey, &message); err != nil {
+			return errors.Wrap(err, "validate message schema")
+		}
+	}
+
+	if err := k.writer.WriteMessages(ctx, k.toKafkaMessage(routingKey, message)); err != nil {
+		return errors.Wrap(err, "write message")
+	}
+
+	return nil
+}
+
+// Consume reads the topic as part of the configured consumer group until ctx is cancelled. Offsets
+// are committed once the handler succeeds; failed messages are written to the dead-letter topic
+// before being committed. A dead-letter write is retried with backoff and, if it can't complete
+// before shutdown, the worker stops without reading past the uncommitted message. WithConcurrency
+// starts one group member per worker, ordering is kept per partition.
+func (k *KafkaAdapter) Consume(
+	ctx context.Context,
+	queue string,
+	processMsgFn func(ctx context.Context, msg Message) error,
+	opts ...func(*ConsumeOptions),
+) {
+	var options ConsumeOptions
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if k.schemaRegistry != nil {
+		processMsgFn = k.schemaRegistry.Wrap(processMsgFn)
+	}
+
+	if options.Idempotency != nil {
+		processMsgFn = withIdempotency(queue, options.Idempotency, options.inProgressRetryDelay(), k.logger, processMsgFn)
+	}
+
+	k.consume(ctx, queue, kafka.ReaderConfig{ //nolint:exhaustruct
+		Brokers:     k.config.Brokers,
+		GroupID:     k.config.GroupID,
+		Topic:       queue,
+		StartOffset: kafka.FirstOffset,
+	}, processMsgFn, options, true)
+}
+
+// ConsumeStream reads messages published from now on through an ephemeral consumer group, so
+// every stream consumer receives every message. Offsets aren't committed.
+func (k *KafkaAdapter) ConsumeStream(
+	ctx context.Context,
+	eventName string,
+	processMsgFn func(ctx context.Context, msg Message) error,
+) {
+	if k.schemaRegistry != nil {
+		processMsgFn = k.schemaRegistry.Wrap(processMsgFn)
+	}
+
+	k.consume(ctx, eventName, kafka.ReaderConfig{ //nolint:exhaustruct
+		Brokers:     k.config.Brokers,
+		GroupID:     fmt.Sprintf("%s.stream.%s", k.config.GroupID, uuid.New().String()),
+		Topic:       eventName,
+		StartOffset: kafka.LastOffset,
+	}, processMsgFn, ConsumeOptions{}, false)
+}
+
+func (k *KafkaAdapter) consume(
+	ctx context.Context,
+	topic string,
+	readerConfig kafka.ReaderConfig,
+	processMsgFn func(ctx context.Context, msg Message) error,
+	options ConsumeOptions,
+	commit bool,
+) {
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelHandlers()
+
+	var wg sync.WaitGroup
+
+	workers := options.workers()
+	readers := make([]KafkaReader, workers)
+
+	for i := range readers {
+		readers[i] = k.newReader(readerConfig)
+		wg.Add(1)
+
+		go func(reader KafkaReader) {
+			defer wg.Done()
+
+			if k.deferPanicHandler != nil {
+				defer k.deferPanicHandler(topic)
+			}
+
+			k.readLoop(ctx, handlerCtx, topic, reader, processMsgFn, commit)
+		}(readers[i])
+	}
+
+	k.logger.WithContext(ctx).Info(fmt.Sprintf("[*] Listening for messages in topic: %s (workers: %d)", topic, workers))
+
+	<-ctx.Done()
+
+	workersDone := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(workersDone)
+	}()
+
+	select {
+	case <-workersDone:
+	case <-time.After(options.shutdownTimeout()):
+		k.logger.WithContext(ctx).Warn(
+			"shutdown timeout reached with in-flight messages; they'll be redelivered",
+			log.Any("topic", topic),
+		)
+	}
+
+	for _, reader := range readers {
+		if err := reader.Close(); err != nil {
+			k.logger.WithContext(ctx).Error("close kafka reader", err, log.Any("topic", topic))
+		}
+	}
+}
+
+func (k *KafkaAdapter) readLoop(
+	ctx context.Context,
+	handlerCtx context.Context,
+	topic string,
+	reader KafkaReader,
+	processMsgFn func(ctx context.Context, msg Message) error,
+	commit bool,
+) {
+	for {
+		kafkaMsg, err := reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			k.logger.WithContext(ctx).Error("fetch kafka message", err, log.Any("topic", topic))
+
+			select {
+			case <-time.After(reconnectDelay):
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if !k.handleMessage(handlerCtx, topic, kafkaMsg, processMsgFn) {
+			// never read ahead of an uncommitted failure, the message is redelivered to the group
+			return
+		}
+
+		if !commit {
+			continue
+		}
+
+		commitCtx, cancel := context.WithTimeout(handlerCtx, kafkaCommitTimeout)
+		if err := reader.CommitMessages(commitCtx, kafkaMsg); err != nil {
+			k.logger.WithContext(ctx).Error("commit kafka message", err, log.Any("topic", topic))
+		}
+		cancel()
+	}
+}
+
+// handleMessage returns whether the message offset can be committed, it only returns false when
+// ctx was cancelled while the message was in progress elsewhere or while the dead-letter write
+// kept failing.
+func (k *KafkaAdapter) handleMessage(
+	ctx context.Context,
+	topic string,
+	kafkaMsg kafka.Message,
+	processMsgFn func(ctx context.Context, msg Message) error,
+) bool {
+	message := fromKafkaMessage(kafkaMsg)
+
+	err := processMsgFn(ctx, message)
+
+	// another consumer is handling a redelivered copy: the idempotency wrapper already waited the
+	// retry delay, retry until it's done instead of dead-lettering it
+	for errors.Is(err, ErrMessageInProgress) {
+		if ctx.Err() != nil {
+			return false
+		}
+
+		err = processMsgFn(ctx, message)
+	}
+
+	if err == nil {
+		return true
+	}
+
+	k.logger.WithContext(ctx).Error(
+		"process message error",
+		err,
+		log.Any("topic", topic),
+		log.Any("message_data", string(kafkaMsg.Value)),
+	)
+
+	if k.errorHandler != nil {
+		k.errorHandler(topic, kafkaMsg.Value, message.Headers, err)
+	}
+
+	deadLetter := kafkaMsg
+	deadLetter.Topic = topic + k.config.DeadLetterSuffix
+	deadLetter.Partition = 0
+	deadLetter.Offset = 0
+
+	return k.writeDeadLetter(ctx, topic, deadLetter)
+}
+
+// writeDeadLetter retries the write with exponential backoff, capped by reconnectDelay, until it
+// succeeds or ctx is cancelled.
+func (k *KafkaAdapter) writeDeadLetter(ctx context.Context, topic string, deadLetter kafka.Message) bool {
+	backoff := k.deadLetterBackoff
+
+	for {
+		err := k.writer.WriteMessages(ctx, deadLetter)
+		if err == nil {
+			return true
+		}
+
+		k.logger.WithContext(ctx).Error("write kafka dead-letter message", err, log.Any("topic", topic))
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return false
+		}
+
+		backoff = min(backoff*2, reconnectDelay) //nolint:mnd
+	}
+}
+
+func (k *KafkaAdapter) toKafkaMessage(topic string, message Message) kafka.Message {
+	headers := make([]kafka.Header, 0, len(message.Headers)+1)
+
+	for key, value := range message.Headers {
+		headers = append(headers, kafka.Header{Key: key, Value: headerValueBytes(value)})
+	}
+
+	headers = append(headers, kafka.Header{Key: kafkaContentTypeHeader, Value: []byte(message.ContentType)})
+
+	kafkaMsg := kafka.Message{ //nolint:exhaustruct
+		Topic:   topic,
+		Value:   message.Body,
+		Headers: headers,
+	}
+
+	if k.config.KeyHeader != "" {
+		if value, ok := message.Headers[k.config.KeyHeader]; ok && value != nil {
+			kafkaMsg.Key = headerValueBytes(value)
+		}
+	}
+
+	return kafkaMsg
+}
+
+func fromKafkaMessage(kafkaMsg kafka.Message) Message {
+	message := Message{
+		Headers:    make(map[string]any, len(kafkaMsg.Headers)),
+		Body:       kafkaMsg.Value,
+		RoutingKey: kafkaMsg.Topic,
+		Timestamp:  kafkaMsg.Time,
+	}
+
+	for _, header := range kafkaMsg.Headers {
+		switch header.Key {
+		case kafkaContentTypeHeader:
+			message.ContentType = string(header.Value)
+		case MessageIDHeader:
+			message.MessageID = string(header.Value)
+			message.Headers[header.Key] = message.MessageID
+		default:
+			message.Headers[header.Key] = string(header.Value)
+		}
+	}
+
+	return message
+}
+
+func headerValueBytes(value any) []byte {
+	switch v := value.(type) {
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	default:
+		return []byte(fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,417 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/log"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// fakeKafka is an in-process single partition broker.
+type fakeKafka struct {
+	mu        sync.Mutex
+	topics    map[string][]kafka.Message
+	cursors   map[string]int
+	committed map[string]int
+	notify    chan struct{}
+}
+
+func newFakeKafka() *fakeKafka {
+	return &fakeKafka{
+		topics:    make(map[string][]kafka.Message),
+		cursors:   make(map[string]int),
+		committed: make(map[string]int),
+		notify:    make(chan struct{}),
+	}
+}
+
+func (f *fakeKafka) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, msg := range msgs {
+		msg.Offset = int64(len(f.topics[msg.Topic]))
+		msg.Time = time.Now()
+		f.topics[msg.Topic] = append(f.topics[msg.Topic], msg)
+	}
+
+	close(f.notify)
+	f.notify = make(chan struct{})
+
+	return nil
+}
+
+func (f *fakeKafka) Close() error {
+	return nil
+}
+
+func (f *fakeKafka) messages(topic string) []kafka.Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]kafka.Message(nil), f.topics[topic]...)
+}
+
+func (f *fakeKafka) committedOffset(group, topic string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.committed[group+"/"+topic]
+}
+
+func (f *fakeKafka) newReader(config kafka.ReaderConfig) KafkaReader {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := config.GroupID + "/" + config.Topic
+	if _, ok := f.cursors[key]; !ok && config.StartOffset == kafka.LastOffset {
+		f.cursors[key] = len(f.topics[config.Topic])
+	}
+
+	return &fakeKafkaReader{broker: f, key: key, topic: config.Topic}
+}
+
+type fakeKafkaReader struct {
+	broker *fakeKafka
+	key    string
+	topic  string
+}
+
+func (r *fakeKafkaReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	for {
+		r.broker.mu.Lock()
+		cursor := r.broker.cursors[r.key]
+
+		if cursor < len(r.broker.topics[r.topic]) {
+			r.broker.cursors[r.key]++
+			msg := r.broker.topics[r.topic][cursor]
+			r.broker.mu.Unlock()
+
+			return msg, nil
+		}
+
+		notify := r.broker.notify
+		r.broker.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return kafka.Message{}, ctx.Err()
+		}
+	}
+}
+
+func (r *fakeKafkaReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.broker.mu.Lock()
+	defer r.broker.mu.Unlock()
+
+	for _, msg := range msgs {
+		if int(msg.Offset)+1 > r.broker.committed[r.key] {
+			r.broker.committed[r.key] = int(msg.Offset) + 1
+		}
+	}
+
+	return nil
+}
+
+func (r *fakeKafkaReader) Close() error {
+	return nil
+}
+
+func newTestKafkaAdapter(t *testing.T, broker *fakeKafka) *KafkaAdapter {
+	t.Helper()
+
+	logger := log.NewMockLoggerI(gomock.NewController(t))
+	logger.EXPECT().WithContext(gomock.Any()).Return(logger).AnyTimes()
+	logger.EXPECT().Info(gomock.Any()).AnyTimes()
+	logger.EXPECT().Error("process message error", gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+	return NewKafkaAdapter(
+		KafkaConfig{GroupID: "orders-service", KeyHeader: "order_id"},
+		WithKafkaLogger(logger),
+		WithKafkaWriter(broker),
+		WithKafkaReaderFactory(broker.newReader),
+	)
+}
+
+func TestKafkaAdapter_ProduceConsume(t *testing.T) {
+	broker := newFakeKafka()
+	adapter := newTestKafkaAdapter(t, broker)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	assert.NoError(t, adapter.Produce(ctx, "order.created", Message{
+		Headers:   map[string]any{"order_id": 10},
+		Body:      []byte(`{"id":"10"}`),
+		MessageID: "msg-1",
+	}))
+	assert.NoError(t, adapter.Produce(ctx, "order.created", testOrder{ID: "fail"}))
+
+	produced := broker.messages("order.created")
+	assert.Len(t, produced, 2)
+	assert.Equal(t, []byte("10"), produced[0].Key)
+
+	var received []Message
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		adapter.Consume(ctx, "order.created", func(_ context.Context, msg Message) error {
+			received = append(received, msg)
+
+			if string(msg.Body) == `{"id":"fail"}` {
+				return errors.New("unknown")
+			}
+
+			return nil
+		})
+	}()
+
+	assert.Eventually(t, func() bool {
+		return broker.committedOffset("orders-service", "order.created") == 2
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+
+	assert.Len(t, received, 2)
+	assert.Equal(t, "msg-1", received[0].MessageID)
+	assert.Equal(t, ContentTypeJSON, received[0].ContentType)
+	assert.Equal(t, "10", received[0].Headers["order_id"])
+	assert.Equal(t, "order.created", received[0].RoutingKey)
+	assert.Len(t, broker.messages("order.created.dead"), 1)
+}
+
+func TestKafkaAdapter_ConsumeStreamFromLatest(t *testing.T) {
+	broker := newFakeKafka()
+	adapter := newTestKafkaAdapter(t, broker)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	assert.NoError(t, adapter.Produce(ctx, "order.created", testOrder{ID: "old"}))
+
+	var (
+		mu       sync.Mutex
+		received []string
+	)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		adapter.ConsumeStream(ctx, "order.created", func(_ context.Context, msg Message) error {
+			order, err := Decode[testOrder](msg)
+			assert.NoError(t, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			received = append(received, order.ID)
+
+			return nil
+		})
+	}()
+
+	assert.Eventually(t, func() bool {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+
+		return len(broker.cursors) == 1
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, adapter.Produce(ctx, "order.created", testOrder{ID: "new"}))
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return len(received) == 1
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+
+	assert.Equal(t, []string{"new"}, received)
+}
+
+// failingDeadLetterWriter fails the first failures dead-letter writes.
+type failingDeadLetterWriter struct {
+	*fakeKafka
+	failures atomic.Int32
+}
+
+func (w *failingDeadLetterWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	if strings.HasSuffix(msgs[0].Topic, defaultKafkaDeadSuffix) && w.failures.Add(-1) >= 0 {
+		return errors.New("broker unavailable")
+	}
+
+	return w.fakeKafka.WriteMessages(ctx, msgs...)
+}
+
+func TestKafkaAdapter_DeadLetterWriteFailure(t *testing.T) {
+	tests := []struct {
+		name          string
+		failures      int32
+		wantCommitted int
+		wantProcessed int
+		wantDead      int
+	}{
+		{name: "retried until written", failures: 2, wantCommitted: 2, wantProcessed: 2, wantDead: 1},
+		{name: "worker stops without committing", failures: 1 << 20, wantCommitted: 0, wantProcessed: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := newFakeKafka()
+			writer := &failingDeadLetterWriter{fakeKafka: broker}
+			writer.failures.Store(tt.failures)
+
+			logger := log.NewMockLoggerI(gomock.NewController(t))
+			logger.EXPECT().WithContext(gomock.Any()).Return(logger).AnyTimes()
+			logger.EXPECT().Info(gomock.Any()).AnyTimes()
+			logger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+			logger.EXPECT().Error(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+			logger.EXPECT().Error(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+			adapter := NewKafkaAdapter(
+				KafkaConfig{GroupID: "orders-service"},
+				WithKafkaLogger(logger),
+				WithKafkaWriter(writer),
+				WithKafkaReaderFactory(broker.newReader),
+			)
+			adapter.deadLetterBackoff = time.Millisecond
+
+			ctx, cancel := context.WithCancel(context.Background())
+
+			assert.NoError(t, adapter.Produce(ctx, "order.created", testOrder{ID: "fail"}))
+			assert.NoError(t, adapter.Produce(ctx, "order.created", testOrder{ID: "ok"}))
+
+			var processed atomic.Int32
+
+			done := make(chan struct{})
+
+			go func() {
+				defer close(done)
+
+				adapter.Consume(ctx, "order.created", func(_ context.Context, msg Message) error {
+					processed.Add(1)
+
+					if string(msg.Body) == `{"id":"fail"}` {
+						return errors.New("unknown")
+					}
+
+					return nil
+				}, WithShutdownTimeout(10*time.Millisecond))
+			}()
+
+			assert.Eventually(t, func() bool {
+				return broker.committedOffset("orders-service", "order.created") == tt.wantCommitted &&
+					int(processed.Load()) == tt.wantProcessed
+			}, time.Second, time.Millisecond)
+
+			cancel()
+			<-done
+
+			assert.Equal(t, tt.wantCommitted, broker.committedOffset("orders-service", "order.created"))
+			assert.Equal(t, tt.wantProcessed, int(processed.Load()))
+			assert.Len(t, broker.messages("order.created.dead"), tt.wantDead)
+		})
+	}
+}
+
+func TestKafkaAdapter_ConsumeInProgress(t *testing.T) {
+	broker := newFakeKafka()
+	adapter := newTestKafkaAdapter(t, broker)
+	store := NewCacheIdempotencyStore(newTestCacher())
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// another consumer is handling it
+	require.NoError(t, store.Acquire(ctx, "order.created:msg-1"))
+	require.NoError(t, adapter.Produce(ctx, "order.created", Message{MessageID: "msg-1", Body: []byte(`{"id":"1"}`)}))
+
+	var processed atomic.Int32
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		adapter.Consume(ctx, "order.created", func(context.Context, Message) error {
+			processed.Add(1)
+
+			return nil
+		}, WithIdempotency(store), WithInProgressRetryDelay(time.Millisecond))
+	}()
+
+	// it's retried, neither committed nor dead-lettered
+	time.Sleep(50 * time.Millisecond)
+	assert.Zero(t, processed.Load())
+	assert.Zero(t, broker.committedOffset("orders-service", "order.created"))
+	assert.Empty(t, broker.messages("order.created.dead"))
+
+	// the other consumer failed, so this one handles it
+	require.NoError(t, store.Release(ctx, "order.created:msg-1"))
+
+	assert.Eventually(t, func() bool {
+		return broker.committedOffset("orders-service", "order.created") == 1
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+
+	assert.Equal(t, int32(1), processed.Load())
+	assert.Empty(t, broker.messages("order.created.dead"))
+}
+
+func TestKafkaAdapter_SchemaRegistry(t *testing.T) {
+	broker := newFakeKafka()
+	legacy := newTestKafkaAdapter(t, broker)
+	adapter := newTestKafkaAdapter(t, broker)
+	WithKafkaSchemaRegistry(newTestSchemaRegistry(t))(adapter)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	assert.ErrorIs(t, adapter.Produce(ctx, "order.created", []byte(`{"id":"1","total":10}`)), ErrSchemaValidation)
+	assert.NoError(t, adapter.Produce(ctx, "order.created", testOrderV2{ID: "1", Amount: 10}))
+	// published by a service still on the previous version
+	assert.NoError(t, legacy.Produce(ctx, "order.created", Message{
+		Headers: map[string]any{SchemaVersionHeader: 1},
+		Body:    []byte(`{"id":"2"}`),
+	}))
+
+	var received []Message
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		adapter.Consume(ctx, "order.created", func(_ context.Context, msg Message) error {
+			received = append(received, msg)
+
+			return nil
+		})
+	}()
+
+	assert.Eventually(t, func() bool {
+		return broker.committedOffset("orders-service", "order.created") == 2
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+
+	require.Len(t, received, 2)
+	assert.JSONEq(t, `{"id":"1","amount":10}`, string(received[0].Body))
+	assert.JSONEq(t, `{"id":"2","amount":0}`, string(received[1].Body))
+	assert.Equal(t, 2, received[1].Headers[SchemaVersionHeader])
+}
@@ -0,0 +1,574 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// assert meets contract
+var _ QueueI = &InMemoryBroker{}
+
+var (
+	ErrExchangeNotFound = errors.New("exchange not found")
+	ErrQueueNotFound    = errors.New("queue not found")
+)
+
+const idlePollInterval = 5 * time.Millisecond
+
+// InMemoryBroker is a QueueI implementation that keeps exchanges, queues and bindings in memory.
+// It mimics the RabbitMQ semantics used by RabbitMQConnection: direct, fanout and topic exchanges,
+// manual ack, nack to the queue dead-letter exchange ("x-dead-letter-exchange" and
+// "x-dead-letter-routing-key" arguments) and redelivery of unsettled messages when a consumer
+// stops. It's meant for tests and local development.
+type InMemoryBroker struct {
+	exchange       string
+	schemaRegistry *SchemaRegistry
+	mu             sync.Mutex
+	exchanges      map[string]*memoryExchange
+	queues         map[string]*memoryQueue
+}
+
+type memoryExchange struct {
+	kind     string
+	bindings []memoryBinding
+}
+
+type memoryBinding struct {
+	queue      string
+	routingKey string
+}
+
+type memoryQueue struct {
+	name      string
+	arguments amqp.Table
+	ready     []Message
+	inFlight  int
+	consumers int
+	notify    chan struct{}
+}
+
+type memoryDelivery struct {
+	queue   string
+	msg     Message
+	settled atomic.Bool
+}
+
+// NewInMemoryBroker creates a broker whose Produce publishes to the given topic exchange.
+func NewInMemoryBroker(exchange string, opts ...func(*InMemoryBroker)) *InMemoryBroker {
+	broker := &InMemoryBroker{
+		exchange:  exchange,
+		exchanges: make(map[string]*memoryExchange),
+		queues:    make(map[string]*memoryQueue),
+	}
+
+	for _, o := range opts {
+		o(broker)
+	}
+
+	broker.exchanges[exchange] = &memoryExchange{kind: amqp.ExchangeTopic}
+
+	return broker
+}
+
+// WithInMemorySchemaRegistry validates published messages and upcasts consumed ones using the
+// registered schemas, as WithSchemaRegistry does for RabbitMQ.
+func WithInMemorySchemaRegistry(registry *SchemaRegistry) func(*InMemoryBroker) {
+	return func(b *InMemoryBroker) {
+		b.schemaRegistry = registry
+	}
+}
+
+func (b *InMemoryBroker) Setup(
+	ctx context.Context,
+	exchange RabbitMQExchangeConfig,
+	queues []RabbitMQQueueConfig,
+) error {
+	if err := b.DeclareExchange(ctx, exchange.Name, exchange.Type); err != nil {
+		return errors.Wrap(err, "declare exchange")
+	}
+
+	for _, queue := range queues {
+		if err := b.DeclareQueue(queue); err != nil {
+			return errors.Wrap(err, "declare queue")
+		}
+
+		if err := b.BindQueue(ctx, queue.Name, queue.Exchange, queue.RoutingKey); err != nil {
+			return errors.Wrap(err, "queue bind")
+		}
+	}
+
+	return nil
+}
+
+func (b *InMemoryBroker) DeclareExchange(_ context.Context, exchangeName string, exchangeType string) error {
+	switch exchangeType {
+	case amqp.ExchangeDirect, amqp.ExchangeFanout, amqp.ExchangeTopic:
+	default:
+		return errors.Errorf("unsupported exchange type: %s", exchangeType)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ex, ok := b.exchanges[exchangeName]; ok {
+		ex.kind = exchangeType
+
+		return nil
+	}
+
+	b.exchanges[exchangeName] = &memoryExchange{kind: exchangeType}
+
+	return nil
+}
+
+func (b *InMemoryBroker) DeclareQueue(queue RabbitMQQueueConfig) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.declareQueueLocked(queue.Name, queue.Arguments)
+
+	return nil
+}
+
+func (b *InMemoryBroker) BindQueue(_ context.Context, queueName string, exchangeName string, routingKey string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ex, ok := b.exchanges[exchangeName]
+	if !ok {
+		return errors.Wrap(ErrExchangeNotFound, exchangeName)
+	}
+
+	if _, ok := b.queues[queueName]; !ok {
+		return errors.Wrap(ErrQueueNotFound, queueName)
+	}
+
+	for _, binding := range ex.bindings {
+		if binding.queue == queueName && binding.routingKey == routingKey {
+			return nil
+		}
+	}
+
+	ex.bindings = append(ex.bindings, memoryBinding{queue: queueName, routingKey: routingKey})
+
+	return nil
+}
+
+func (b *InMemoryBroker) Produce(ctx context.Context, routingKey string, msg any) error {
+	return b.Publish(ctx, b.exchange, routingKey, msg)
+}
+
+// Publish routes the message through any declared exchange.
+func (b *InMemoryBroker) Publish(_ context.Context, exchange string, routingKey string, msg any) error {
+	message, err := buildMessage(msg)
+	if err != nil {
+		return errors.Wrap(err, "build message")
+	}
+
+	if b.schemaRegistry != nil {
+		if err := b.schemaRegistry.PrepareOutgoing(routingKey, &message); err != nil {
+			return errors.Wrap(err, "validate message schema")
+		}
+	}
+
+	message.RoutingKey = routingKey
+	message.Timestamp = time.Now()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.publishLocked(exchange, routingKey, message)
+}
+
+// Consume blocks until ctx is cancelled, the queue is declared when missing. Ordering keys aren't
+// supported: with concurrency enabled messages are handed to whichever worker is free.
+func (b *InMemoryBroker) Consume(
+	ctx context.Context,
+	queue string,
+	processMsgFn func(ctx context.Context, msg Message) error,
+	opts ...func(*ConsumeOptions),
+) {
+	var options ConsumeOptions
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if b.schemaRegistry != nil {
+		processMsgFn = b.schemaRegistry.Wrap(processMsgFn)
+	}
+
+	if options.Idempotency != nil {
+		processMsgFn = withIdempotency(queue, options.Idempotency, options.inProgressRetryDelay(), nil, processMsgFn)
+	}
+
+	b.consume(ctx, queue, processMsgFn, options)
+}
+
+// ConsumeStream consumes from an exclusive queue bound to the routing key, so every stream
+// consumer receives its own copy of the messages published while it's running.
+func (b *InMemoryBroker) ConsumeStream(
+	ctx context.Context,
+	eventName string,
+	processMsgFn func(ctx context.Context, msg Message) error,
+) {
+	queueName := fmt.Sprintf("%s.%s.stream.%s", b.exchange, eventName, uuid.New().String())
+
+	if b.schemaRegistry != nil {
+		processMsgFn = b.schemaRegistry.Wrap(processMsgFn)
+	}
+
+	b.mu.Lock()
+	b.declareQueueLocked(queueName, nil)
+	ex := b.exchanges[b.exchange]
+	ex.bindings = append(ex.bindings, memoryBinding{queue: queueName, routingKey: eventName})
+	b.mu.Unlock()
+
+	defer b.deleteQueue(queueName)
+
+	b.consume(ctx, queueName, processMsgFn, ConsumeOptions{})
+}
+
+// Messages returns the messages waiting to be consumed from queue.
+func (b *InMemoryBroker) Messages(queue string) []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[queue]
+	if !ok {
+		return nil
+	}
+
+	return append([]Message(nil), q.ready...)
+}
+
+// WaitIdle blocks until every queue with an active consumer is empty and no message is being
+// processed, which is useful to assert side effects in end-to-end tests.
+func (b *InMemoryBroker) WaitIdle(ctx context.Context) error {
+	ticker := time.NewTicker(idlePollInterval)
+	defer ticker.Stop()
+
+	for {
+		if b.idle() {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (b *InMemoryBroker) idle() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, q := range b.queues {
+		if q.inFlight > 0 || (q.consumers > 0 && len(q.ready) > 0) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (b *InMemoryBroker) consume(
+	ctx context.Context,
+	queue string,
+	processMsgFn func(ctx context.Context, msg Message) error,
+	options ConsumeOptions,
+) {
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelHandlers()
+
+	b.mu.Lock()
+	q := b.declareQueueLocked(queue, nil)
+	q.consumers++
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		q.consumers--
+		b.mu.Unlock()
+	}()
+
+	workers := options.workers()
+	current := make([]atomic.Pointer[memoryDelivery], workers)
+
+	var wg sync.WaitGroup
+
+	for i := range workers {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				delivery, ok := b.pop(ctx, q)
+				if !ok {
+					return
+				}
+
+				current[i].Store(delivery)
+				err := processMsgFn(handlerCtx, delivery.msg)
+				current[i].Store(nil)
+
+				if errors.Is(err, ErrMessageInProgress) {
+					b.requeue(delivery)
+
+					continue
+				}
+
+				if err != nil {
+					b.nack(delivery)
+
+					continue
+				}
+
+				b.ack(delivery)
+			}
+		}()
+	}
+
+	<-ctx.Done()
+
+	workersDone := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(workersDone)
+	}()
+
+	select {
+	case <-workersDone:
+	case <-time.After(options.shutdownTimeout()):
+		// unsettled messages go back to the queue, as rabbitmq does when the channel is closed
+		for i := range current {
+			if delivery := current[i].Load(); delivery != nil {
+				b.requeue(delivery)
+			}
+		}
+	}
+}
+
+func (b *InMemoryBroker) pop(ctx context.Context, q *memoryQueue) (*memoryDelivery, bool) {
+	for {
+		b.mu.Lock()
+
+		if ctx.Err() != nil {
+			b.mu.Unlock()
+
+			return nil, false
+		}
+
+		if len(q.ready) > 0 {
+			msg := q.ready[0]
+			q.ready = q.ready[1:]
+			q.inFlight++
+			b.mu.Unlock()
+
+			return &memoryDelivery{queue: q.name, msg: msg}, true
+		}
+
+		notify := q.notify
+		b.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return nil, false
+		}
+	}
+}
+
+func (b *InMemoryBroker) ack(delivery *memoryDelivery) {
+	if !delivery.settled.CompareAndSwap(false, true) {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if q, ok := b.queues[delivery.queue]; ok {
+		q.inFlight--
+	}
+}
+
+// nack discards the message, routing it to the dead-letter exchange when the queue has one.
+func (b *InMemoryBroker) nack(delivery *memoryDelivery) {
+	if !delivery.settled.CompareAndSwap(false, true) {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[delivery.queue]
+	if !ok {
+		return
+	}
+
+	q.inFlight--
+
+	exchange, ok := q.arguments["x-dead-letter-exchange"].(string)
+	if !ok {
+		return
+	}
+
+	routingKey, ok := q.arguments["x-dead-letter-routing-key"].(string)
+	if !ok {
+		routingKey = delivery.msg.RoutingKey
+	}
+
+	msg := delivery.msg
+	msg.Headers = cloneHeaders(msg.Headers)
+	msg.Headers["x-first-death-queue"] = q.name
+	msg.Headers["x-first-death-reason"] = "rejected"
+	msg.Redelivered = false
+
+	_ = b.publishLocked(exchange, routingKey, msg)
+}
+
+func (b *InMemoryBroker) requeue(delivery *memoryDelivery) {
+	if !delivery.settled.CompareAndSwap(false, true) {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[delivery.queue]
+	if !ok {
+		return
+	}
+
+	msg := delivery.msg
+	msg.Redelivered = true
+
+	q.inFlight--
+	q.ready = append([]Message{msg}, q.ready...)
+	q.signal()
+}
+
+func (b *InMemoryBroker) publishLocked(exchange string, routingKey string, msg Message) error {
+	ex, ok := b.exchanges[exchange]
+	if !ok {
+		return errors.Wrap(ErrExchangeNotFound, exchange)
+	}
+
+	routed := make(map[string]struct{})
+
+	for _, binding := range ex.bindings {
+		if _, ok := routed[binding.queue]; ok {
+			continue
+		}
+
+		if !ex.matches(binding.routingKey, routingKey) {
+			continue
+		}
+
+		q, ok := b.queues[binding.queue]
+		if !ok {
+			continue
+		}
+
+		routed[binding.queue] = struct{}{}
+
+		msg.Headers = cloneHeaders(msg.Headers)
+		msg.RoutingKey = routingKey
+		q.ready = append(q.ready, msg)
+		q.signal()
+	}
+
+	return nil
+}
+
+func (b *InMemoryBroker) declareQueueLocked(name string, arguments amqp.Table) *memoryQueue {
+	if q, ok := b.queues[name]; ok {
+		return q
+	}
+
+	q := &memoryQueue{
+		name:      name,
+		arguments: arguments,
+		notify:    make(chan struct{}),
+	}
+	b.queues[name] = q
+
+	return q
+}
+
+func (b *InMemoryBroker) deleteQueue(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.queues, name)
+
+	for _, ex := range b.exchanges {
+		bindings := ex.bindings[:0]
+
+		for _, binding := range ex.bindings {
+			if binding.queue != name {
+				bindings = append(bindings, binding)
+			}
+		}
+
+		ex.bindings = bindings
+	}
+}
+
+// signal wakes up every consumer waiting for messages.
+func (q *memoryQueue) signal() {
+	close(q.notify)
+	q.notify = make(chan struct{})
+}
+
+func (ex *memoryExchange) matches(bindingKey string, routingKey string) bool {
+	switch ex.kind {
+	case amqp.ExchangeFanout:
+		return true
+	case amqp.ExchangeTopic:
+		return matchTopic(bindingKey, routingKey)
+	default:
+		return bindingKey == routingKey
+	}
+}
+
+// matchTopic matches a routing key against an AMQP topic binding: "*" matches exactly one word
+// and "#" matches zero or more words.
+func matchTopic(pattern string, routingKey string) bool {
+	return matchTopicWords(strings.Split(pattern, "."), strings.Split(routingKey, "."))
+}
+
+func matchTopicWords(pattern []string, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if matchTopicWords(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+
+		return false
+
+	case "*":
+		return len(words) > 0 && matchTopicWords(pattern[1:], words[1:])
+
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && matchTopicWords(pattern[1:], words[1:])
+	}
+}
@@ -0,0 +1,252 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_matchTopic(t *testing.T) {
+	tests := []struct {
+		pattern    string
+		routingKey string
+		want       bool
+	}{
+		{pattern: "order.created", routingKey: "order.created", want: true},
+		{pattern: "order.created", routingKey: "order.updated", want: false},
+		{pattern: "order.*", routingKey: "order.created", want: true},
+		{pattern: "order.*", routingKey: "order.created.v2", want: false},
+		{pattern: "*.created", routingKey: "order.created", want: true},
+		{pattern: "order.#", routingKey: "order", want: true},
+		{pattern: "order.#", routingKey: "order.created.v2", want: true},
+		{pattern: "#.v2", routingKey: "order.created.v2", want: true},
+		{pattern: "#", routingKey: "anything.at.all", want: true},
+		{pattern: "order.#.v2", routingKey: "order.v2", want: true},
+		{pattern: "order.#.v2", routingKey: "order.created.v3", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.routingKey, func(t *testing.T) {
+			assert.Equal(t, tt.want, matchTopic(tt.pattern, tt.routingKey))
+		})
+	}
+}
+
+type testOrder struct {
+	ID string `json:"id"`
+}
+
+func newTestBroker(t *testing.T, opts ...func(*InMemoryBroker)) *InMemoryBroker {
+	t.Helper()
+
+	broker := NewInMemoryBroker("events", opts...)
+
+	err := broker.Setup(context.Background(), RabbitMQExchangeConfig{Name: "events", Type: amqp.ExchangeTopic}, []RabbitMQQueueConfig{
+		{Name: "orders.dead", Exchange: "events", RoutingKey: "orders.dead"},
+		{
+			Name:       "orders",
+			Exchange:   "events",
+			RoutingKey: "order.*",
+			Arguments: amqp.Table{
+				"x-dead-letter-exchange":    "events",
+				"x-dead-letter-routing-key": "orders.dead",
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	return broker
+}
+
+func waitConsumers(t *testing.T, broker *InMemoryBroker, queue string) {
+	t.Helper()
+
+	assert.Eventually(t, func() bool {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+
+		q, ok := broker.queues[queue]
+
+		return ok && q.consumers > 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestInMemoryBroker_ProduceConsume(t *testing.T) {
+	broker := newTestBroker(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var (
+		mu       sync.Mutex
+		received []testOrder
+	)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ConsumeTyped(ctx, broker, "orders", func(_ context.Context, order testOrder, meta Meta) error {
+			if order.ID == "fail" {
+				return errors.New("unknown")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			received = append(received, order)
+
+			assert.Equal(t, "order.created", meta.RoutingKey)
+
+			return nil
+		}, WithConcurrency(2))
+	}()
+
+	waitConsumers(t, broker, "orders")
+
+	assert.NoError(t, ProduceTyped(ctx, broker, "order.created", testOrder{ID: "1"}))
+	assert.NoError(t, ProduceTyped(ctx, broker, "order.created", testOrder{ID: "fail"}))
+	assert.NoError(t, broker.Produce(ctx, "order.created", []byte("{invalid")))
+	assert.NoError(t, broker.Produce(ctx, "payment.created", testOrder{ID: "unrouted"}))
+
+	waitCtx, waitCancel := context.WithTimeout(ctx, time.Second)
+	defer waitCancel()
+
+	assert.NoError(t, broker.WaitIdle(waitCtx))
+
+	cancel()
+	<-done
+
+	assert.Equal(t, []testOrder{{ID: "1"}}, received)
+
+	dead := broker.Messages("orders.dead")
+	assert.Len(t, dead, 2)
+
+	for _, msg := range dead {
+		assert.Equal(t, "orders", msg.Headers["x-first-death-queue"])
+	}
+}
+
+func TestInMemoryBroker_ConsumeStreamFanOut(t *testing.T) {
+	broker := newTestBroker(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	counts := make([]int, 3)
+
+	for i := range counts {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			broker.ConsumeStream(ctx, "order.created", func(context.Context, Message) error {
+				counts[i]++
+
+				return nil
+			})
+		}()
+	}
+
+	assert.Eventually(t, func() bool {
+		broker.mu.Lock()
+		defer broker.mu.Unlock()
+
+		var consumers int
+		for _, q := range broker.queues {
+			consumers += q.consumers
+		}
+
+		return consumers == len(counts)
+	}, time.Second, time.Millisecond)
+
+	assert.NoError(t, broker.Produce(ctx, "order.created", testOrder{ID: "1"}))
+	assert.NoError(t, broker.WaitIdle(ctx))
+
+	cancel()
+	wg.Wait()
+
+	assert.Equal(t, []int{1, 1, 1}, counts)
+	assert.Len(t, broker.Messages("orders"), 1)
+}
+
+func TestInMemoryBroker_RedeliverOnShutdown(t *testing.T) {
+	broker := newTestBroker(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		broker.Consume(ctx, "orders", func(context.Context, Message) error {
+			close(handling)
+			<-release
+
+			return nil
+		}, WithShutdownTimeout(10*time.Millisecond))
+	}()
+
+	waitConsumers(t, broker, "orders")
+
+	assert.NoError(t, broker.Produce(ctx, "order.created", testOrder{ID: "1"}))
+
+	<-handling
+	cancel()
+	<-done
+	close(release)
+
+	pending := broker.Messages("orders")
+	assert.Len(t, pending, 1)
+	assert.True(t, pending[0].Redelivered)
+}
+
+func TestInMemoryBroker_SchemaRegistry(t *testing.T) {
+	broker := newTestBroker(t, WithInMemorySchemaRegistry(newTestSchemaRegistry(t)))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	received := make(chan Message, 2)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		broker.Consume(ctx, "orders", func(_ context.Context, msg Message) error {
+			received <- msg
+
+			return nil
+		})
+	}()
+
+	waitConsumers(t, broker, "orders")
+
+	assert.ErrorIs(t, broker.Produce(ctx, "order.created", []byte(`{"id":"1","total":10}`)), ErrSchemaValidation)
+	assert.NoError(t, broker.Produce(ctx, "order.created", testOrderV2{ID: "1", Amount: 10}))
+
+	// a message published with the previous version is upcast before reaching the handler
+	broker.mu.Lock()
+	err := broker.publishLocked("events", "order.created", Message{
+		Headers:    map[string]any{SchemaVersionHeader: 1},
+		Body:       []byte(`{"id":"2"}`),
+		RoutingKey: "order.created",
+	})
+	broker.mu.Unlock()
+	assert.NoError(t, err)
+
+	latest, upcast := <-received, <-received
+
+	cancel()
+	<-done
+
+	assert.JSONEq(t, `{"id":"1","amount":10}`, string(latest.Body))
+	assert.Equal(t, 2, latest.Headers[SchemaVersionHeader])
+	assert.JSONEq(t, `{"id":"2","amount":0}`, string(upcast.Body))
+	assert.Equal(t, 2, upcast.Headers[SchemaVersionHeader])
+}
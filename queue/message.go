@@ -1,10 +1,31 @@
 package queue
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Message struct {
-	Headers map[string]any `json:"metadata"`
-	Body    []byte         `json:"body"`
+	Headers     map[string]any `json:"metadata"`
+	Body        []byte         `json:"body"`
+	ContentType string         `json:"content_type,omitempty"`
+	MessageID   string         `json:"message_id,omitempty"`
+	RoutingKey  string         `json:"routing_key,omitempty"`
+	Timestamp   time.Time      `json:"timestamp,omitzero"`
+	Redelivered bool           `json:"redelivered,omitempty"`
+	// CorrelationID and ReplyTo are set on RPC requests and replies, see Request.
+	CorrelationID string `json:"correlation_id,omitempty"`
+	ReplyTo       string `json:"reply_to,omitempty"`
+}
+
+// Meta holds the delivery metadata handed to typed handlers.
+type Meta struct {
+	MessageID   string
+	RoutingKey  string
+	ContentType string
+	Timestamp   time.Time
+	Redelivered bool
+	Headers     map[string]any
 }
 
 func NewMessage(data any, headers map[string]any) (*Message, error) {
@@ -27,9 +48,21 @@ func NewMessage(data any, headers map[string]any) (*Message, error) {
 	}
 
 	msg := &Message{
-		Headers: headers,
-		Body:    buf,
+		Headers:     headers,
+		Body:        buf,
+		ContentType: ContentTypeJSON,
 	}
 
 	return msg, nil
 }
+
+func (m Message) Meta() Meta {
+	return Meta{
+		MessageID:   m.MessageID,
+		RoutingKey:  m.RoutingKey,
+		ContentType: m.ContentType,
+		Timestamp:   m.Timestamp,
+		Redelivered: m.Redelivered,
+		Headers:     m.Headers,
+	}
+}
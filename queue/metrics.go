@@ -0,0 +1,69 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/braiphub/go-core/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const defaultLagInterval = 15 * time.Second
+
+// Metrics receives message-level events from producers and consumers. See the queueprom package
+// for a Prometheus implementation.
+type Metrics interface {
+	MessageProduced(routingKey string)
+	FallbackWritten(routingKey string)
+	BreakerStateChanged(name string, from string, to string)
+	MessageConsumed(queue string)
+	MessageAcked(queue string)
+	MessageNacked(queue string, requeue bool)
+	HandlerError(queue string)
+	HandlerDuration(queue string, duration time.Duration)
+	ConsumerLag(queue string, messages int)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) MessageProduced(string)                     {}
+func (noopMetrics) FallbackWritten(string)                     {}
+func (noopMetrics) BreakerStateChanged(string, string, string) {}
+func (noopMetrics) MessageConsumed(string)                     {}
+func (noopMetrics) MessageAcked(string)                        {}
+func (noopMetrics) MessageNacked(string, bool)                 {}
+func (noopMetrics) HandlerError(string)                        {}
+func (noopMetrics) HandlerDuration(string, time.Duration)      {}
+func (noopMetrics) ConsumerLag(string, int)                    {}
+
+// monitorLag reports the messages ready in queue, read through a passive declare, until ctx is done.
+func (r *RabbitMQConnection) monitorLag(ctx context.Context, queue string) {
+	ticker := time.NewTicker(r.lagInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if r.connection() == nil {
+			continue
+		}
+
+		err := r.withChannel(func(channel *amqp.Channel) error {
+			state, err := channel.QueueDeclarePassive(queue, true, false, false, false, nil)
+			if err != nil {
+				return err
+			}
+
+			r.metrics.ConsumerLag(queue, state.Messages)
+
+			return nil
+		})
+		if err != nil {
+			r.logger.WithContext(ctx).Error("inspect queue", err, log.Any("queue", queue))
+		}
+	}
+}
@@ -1,7 +1,10 @@
 package queue
 
 import (
+	"time"
+
 	"github.com/braiphub/go-core/log"
+	"github.com/braiphub/go-core/trace"
 )
 
 func WithLogger(logger log.LoggerI) func(*RabbitMQConnection) {
@@ -27,3 +30,53 @@ func WithGormDatabaseFallback(fallback *GormFallback) func(*RabbitMQConnection)
 		rm.databaseFallback = fallback
 	}
 }
+
+// WithTracer propagates the trace context through message headers and traces produced and consumed messages.
+func WithTracer(tracer trace.TracerInterface) func(*RabbitMQConnection) {
+	return func(rm *RabbitMQConnection) {
+		rm.tracer = tracer
+	}
+}
+
+// WithMetrics reports message-level metrics, including the consumer lag of consumed queues.
+func WithMetrics(metrics Metrics) func(*RabbitMQConnection) {
+	return func(rm *RabbitMQConnection) {
+		rm.metrics = metrics
+	}
+}
+
+// WithLagInterval sets how often the consumer lag is read. Defaults to 15 seconds.
+func WithLagInterval(interval time.Duration) func(*RabbitMQConnection) {
+	return func(rm *RabbitMQConnection) {
+		rm.lagInterval = interval
+	}
+}
+
+// WithSchemaRegistry validates produced messages and upcasts consumed ones using the registered schemas.
+func WithSchemaRegistry(registry *SchemaRegistry) func(*RabbitMQConnection) {
+	return func(rm *RabbitMQConnection) {
+		rm.schemaRegistry = registry
+	}
+}
+
+// WithReconnectDelay sets how long to wait between reconnection attempts. Defaults to 5 seconds.
+func WithReconnectDelay(delay time.Duration) func(*RabbitMQConnection) {
+	return func(rm *RabbitMQConnection) {
+		rm.reconnectDelay = delay
+	}
+}
+
+// WithChannelPoolSize sets how many idle channels are kept for publishing and declaring. Defaults to 16.
+func WithChannelPoolSize(size int) func(*RabbitMQConnection) {
+	return func(rm *RabbitMQConnection) {
+		rm.channelPoolSize = size
+	}
+}
+
+// WithMaxBrokerDelay sets the longest delay held by the broker, longer ones are kept by the gorm
+// fallback scheduler until they're within it. Defaults to the broker limit (~49 days).
+func WithMaxBrokerDelay(delay time.Duration) func(*RabbitMQConnection) {
+	return func(rm *RabbitMQConnection) {
+		rm.maxBrokerDelay = min(delay, brokerDelayLimit)
+	}
+}
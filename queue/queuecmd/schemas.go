@@ -0,0 +1,183 @@
+package queuecmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/braiphub/go-core/command"
+	"github.com/braiphub/go-core/queue"
+	"github.com/pkg/errors"
+)
+
+const (
+	formatMarkdown = "markdown"
+	formatJSON     = "json"
+)
+
+var ErrUnknownFormat = errors.New("unknown format")
+
+// SchemasCommand dumps the schema registry as documentation
+type SchemasCommand struct {
+	registry *queue.SchemaRegistry
+	stdout   io.Writer
+}
+
+// NewSchemasCommand creates a new SchemasCommand
+func NewSchemasCommand(registry *queue.SchemaRegistry) *SchemasCommand {
+	return &SchemasCommand{
+		registry: registry,
+		stdout:   os.Stdout,
+	}
+}
+
+// Name returns the command signature
+func (c *SchemasCommand) Name() string {
+	return "queue:schemas"
+}
+
+// Description returns the command description
+func (c *SchemasCommand) Description() string {
+	return "Dump the message schema registry as documentation"
+}
+
+// DefineOptions returns the command options/flags
+func (c *SchemasCommand) DefineOptions() []command.Option {
+	return []command.Option{
+		{
+			Name:        "format",
+			Shorthand:   "f",
+			Description: "Output format (markdown or json)",
+			Default:     formatMarkdown,
+			Type:        command.StringOption,
+		},
+		{
+			Name:        "output",
+			Shorthand:   "o",
+			Description: "Output file (defaults to stdout)",
+			Type:        command.StringOption,
+		},
+	}
+}
+
+// Handle executes the command
+func (c *SchemasCommand) Handle(_ context.Context, args *command.Args) error {
+	out := c.stdout
+
+	if path := args.GetString("output"); path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return errors.Wrap(err, "create output file")
+		}
+		defer file.Close()
+
+		out = file
+	}
+
+	docs := make([]schemaDoc, 0)
+	for _, schema := range c.registry.Schemas() {
+		docs = append(docs, newSchemaDoc(schema))
+	}
+
+	switch format := args.GetString("format", formatMarkdown); format {
+	case formatMarkdown:
+		return writeMarkdown(out, docs)
+	case formatJSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+
+		return encoder.Encode(docs)
+	default:
+		return errors.Wrap(ErrUnknownFormat, format)
+	}
+}
+
+type schemaDoc struct {
+	RoutingKey  string          `json:"routing_key"`
+	Version     int             `json:"version"`
+	Description string          `json:"description,omitempty"`
+	JSONSchema  json.RawMessage `json:"json_schema,omitempty"`
+	Type        string          `json:"type,omitempty"`
+	Fields      []fieldDoc      `json:"fields,omitempty"`
+}
+
+type fieldDoc struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+func newSchemaDoc(schema queue.Schema) schemaDoc {
+	doc := schemaDoc{
+		RoutingKey:  schema.RoutingKey,
+		Version:     schema.Version,
+		Description: schema.Description,
+		JSONSchema:  schema.JSONSchema,
+	}
+
+	if schema.Type == nil {
+		return doc
+	}
+
+	goType := reflect.TypeOf(schema.Type)
+	if goType.Kind() == reflect.Ptr {
+		goType = goType.Elem()
+	}
+
+	doc.Type = goType.String()
+
+	for i := range goType.NumField() {
+		field := goType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+
+		doc.Fields = append(doc.Fields, fieldDoc{Name: name, Type: field.Type.String()})
+	}
+
+	return doc
+}
+
+func writeMarkdown(out io.Writer, docs []schemaDoc) error {
+	var b strings.Builder
+
+	b.WriteString("# Message schemas\n")
+
+	for _, doc := range docs {
+		fmt.Fprintf(&b, "\n## %s (v%d)\n\n", doc.RoutingKey, doc.Version)
+
+		if doc.Description != "" {
+			fmt.Fprintf(&b, "%s\n\n", doc.Description)
+		}
+
+		if doc.Type != "" {
+			fmt.Fprintf(&b, "Type: `%s`\n\n| Field | Type |\n| --- | --- |\n", doc.Type)
+
+			for _, field := range doc.Fields {
+				fmt.Fprintf(&b, "| %s | `%s` |\n", field.Name, field.Type)
+			}
+
+			b.WriteString("\n")
+		}
+
+		if len(doc.JSONSchema) > 0 {
+			fmt.Fprintf(&b, "```json\n%s\n```\n", strings.TrimSpace(string(doc.JSONSchema)))
+		}
+	}
+
+	_, err := io.WriteString(out, b.String())
+
+	return err
+}
@@ -0,0 +1,128 @@
+package queuecmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/braiphub/go-core/command"
+	"github.com/braiphub/go-core/queue"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testOrder struct {
+	ID       string `json:"id"`
+	Amount   int    `json:"amount"`
+	Internal string `json:"-"`
+	Note     string
+}
+
+func newTestSchemasCommand(t *testing.T) (*SchemasCommand, *bytes.Buffer) {
+	t.Helper()
+
+	registry := queue.NewSchemaRegistry()
+	require.NoError(t, registry.Register(queue.Schema{
+		RoutingKey:  "order.created",
+		Version:     1,
+		Description: "An order was placed",
+		Type:        &testOrder{},
+	}))
+	require.NoError(t, registry.Register(queue.Schema{
+		RoutingKey: "payment.created",
+		Version:    1,
+		JSONSchema: []byte(`{"type": "object", "required": ["id"]}`),
+	}))
+
+	stdout := &bytes.Buffer{}
+	cmd := NewSchemasCommand(registry)
+	cmd.stdout = stdout
+
+	return cmd, stdout
+}
+
+func TestSchemasCommand_Handle(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    *command.Args
+		want    string
+		wantErr error
+	}{
+		{
+			name: "markdown",
+			args: command.NewArgs(),
+			want: "# Message schemas\n" +
+				"\n## order.created (v1)\n\n" +
+				"An order was placed\n\n" +
+				"Type: `queuecmd.testOrder`\n\n" +
+				"| Field | Type |\n| --- | --- |\n" +
+				"| id | `string` |\n" +
+				"| amount | `int` |\n" +
+				"| Note | `string` |\n\n" +
+				"\n## payment.created (v1)\n\n" +
+				"```json\n{\"type\": \"object\", \"required\": [\"id\"]}\n```\n",
+		},
+		{
+			name: "json",
+			args: command.NewArgs().SetOption("format", "json"),
+			want: `[
+  {
+    "routing_key": "order.created",
+    "version": 1,
+    "description": "An order was placed",
+    "type": "queuecmd.testOrder",
+    "fields": [
+      {"name": "id", "type": "string"},
+      {"name": "amount", "type": "int"},
+      {"name": "Note", "type": "string"}
+    ]
+  },
+  {
+    "routing_key": "payment.created",
+    "version": 1,
+    "json_schema": {"type": "object", "required": ["id"]}
+  }
+]`,
+		},
+		{
+			name:    "unknown format",
+			args:    command.NewArgs().SetOption("format", "yaml"),
+			wantErr: ErrUnknownFormat,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, stdout := newTestSchemasCommand(t)
+
+			err := cmd.Handle(context.Background(), tt.args)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			if tt.args.GetString("format") == formatJSON {
+				assert.JSONEq(t, tt.want, stdout.String())
+			} else {
+				assert.Equal(t, tt.want, stdout.String())
+			}
+		})
+	}
+}
+
+func TestSchemasCommand_HandleOutputFile(t *testing.T) {
+	cmd, stdout := newTestSchemasCommand(t)
+	path := filepath.Join(t.TempDir(), "schemas.md")
+
+	require.NoError(t, cmd.Handle(context.Background(), command.NewArgs().SetOption("output", path)))
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "## order.created (v1)")
+	assert.Empty(t, stdout.String())
+}
@@ -0,0 +1,139 @@
+package queuecmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/braiphub/go-core/command"
+	"github.com/braiphub/go-core/queue/topology"
+	"github.com/pkg/errors"
+)
+
+var ErrTopologyDrift = errors.New("topology drift detected")
+
+func topologyOptions(defaultFile string) []command.Option {
+	return []command.Option{
+		{
+			Name:        "file",
+			Shorthand:   "f",
+			Description: "Topology spec file (yaml)",
+			Default:     defaultFile,
+			Type:        command.StringOption,
+		},
+		{
+			Name:        "fail-on-drift",
+			Description: "Fail when the broker has resources that can't be changed in place",
+			Default:     false,
+			Type:        command.BoolOption,
+		},
+	}
+}
+
+// TopologyPlanCommand shows the changes needed to bring the broker to the topology spec
+type TopologyPlanCommand struct {
+	client      *topology.ManagementClient
+	defaultFile string
+	stdout      io.Writer
+}
+
+// NewTopologyPlanCommand creates a new TopologyPlanCommand
+func NewTopologyPlanCommand(client *topology.ManagementClient, defaultFile string) *TopologyPlanCommand {
+	return &TopologyPlanCommand{
+		client:      client,
+		defaultFile: defaultFile,
+		stdout:      os.Stdout,
+	}
+}
+
+// Name returns the command signature
+func (c *TopologyPlanCommand) Name() string {
+	return "queue:topology-plan"
+}
+
+// Description returns the command description
+func (c *TopologyPlanCommand) Description() string {
+	return "Diff the rabbitmq topology spec against the broker"
+}
+
+// DefineOptions returns the command options/flags
+func (c *TopologyPlanCommand) DefineOptions() []command.Option {
+	return topologyOptions(c.defaultFile)
+}
+
+// Handle executes the command
+func (c *TopologyPlanCommand) Handle(ctx context.Context, args *command.Args) error {
+	spec, err := topology.LoadFile(args.GetString("file", c.defaultFile))
+	if err != nil {
+		return err
+	}
+
+	plan, err := topology.NewPlan(ctx, c.client, spec)
+	if err != nil {
+		return errors.Wrap(err, "plan")
+	}
+
+	fmt.Fprint(c.stdout, plan.String())
+
+	return checkDrift(plan, args)
+}
+
+// TopologyApplyCommand creates the missing resources of the topology spec and updates its policies
+type TopologyApplyCommand struct {
+	client      *topology.ManagementClient
+	defaultFile string
+	stdout      io.Writer
+}
+
+// NewTopologyApplyCommand creates a new TopologyApplyCommand
+func NewTopologyApplyCommand(client *topology.ManagementClient, defaultFile string) *TopologyApplyCommand {
+	return &TopologyApplyCommand{
+		client:      client,
+		defaultFile: defaultFile,
+		stdout:      os.Stdout,
+	}
+}
+
+// Name returns the command signature
+func (c *TopologyApplyCommand) Name() string {
+	return "queue:topology-apply"
+}
+
+// Description returns the command description
+func (c *TopologyApplyCommand) Description() string {
+	return "Apply the rabbitmq topology spec to the broker"
+}
+
+// DefineOptions returns the command options/flags
+func (c *TopologyApplyCommand) DefineOptions() []command.Option {
+	return topologyOptions(c.defaultFile)
+}
+
+// Handle executes the command
+func (c *TopologyApplyCommand) Handle(ctx context.Context, args *command.Args) error {
+	spec, err := topology.LoadFile(args.GetString("file", c.defaultFile))
+	if err != nil {
+		return err
+	}
+
+	plan, err := topology.Apply(ctx, c.client, spec)
+	if plan != nil {
+		fmt.Fprint(c.stdout, plan.String())
+	}
+
+	if err != nil {
+		return errors.Wrap(err, "apply")
+	}
+
+	return checkDrift(plan, args)
+}
+
+func checkDrift(plan *topology.Plan, args *command.Args) error {
+	drift := plan.Drift()
+	if len(drift) == 0 || !args.GetBool("fail-on-drift") {
+		return nil
+	}
+
+	return errors.Wrapf(ErrTopologyDrift, "%d resource(s) must be recreated", len(drift))
+}
@@ -0,0 +1,162 @@
+package queueprom
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/braiphub/go-core/queue"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const defaultNamespace = "queue"
+
+// assert meets contract
+var _ queue.Metrics = &Metrics{}
+
+// Metrics implements queue.Metrics with prometheus collectors.
+type Metrics struct {
+	produced        *prometheus.CounterVec
+	fallbackWrites  *prometheus.CounterVec
+	breakerChanges  *prometheus.CounterVec
+	breakerState    *prometheus.GaugeVec
+	consumed        *prometheus.CounterVec
+	acked           *prometheus.CounterVec
+	nacked          *prometheus.CounterVec
+	handlerErrors   *prometheus.CounterVec
+	handlerDuration *prometheus.HistogramVec
+	consumerLag     *prometheus.GaugeVec
+}
+
+type config struct {
+	namespace string
+	buckets   []float64
+}
+
+func WithNamespace(namespace string) func(*config) {
+	return func(c *config) {
+		c.namespace = namespace
+	}
+}
+
+// WithDurationBuckets sets the handler duration histogram buckets, in seconds.
+func WithDurationBuckets(buckets []float64) func(*config) {
+	return func(c *config) {
+		c.buckets = buckets
+	}
+}
+
+// New creates the collectors and registers them in registerer.
+func New(registerer prometheus.Registerer, opts ...func(*config)) (*Metrics, error) {
+	cfg := config{
+		namespace: defaultNamespace,
+		buckets:   prometheus.DefBuckets,
+	}
+
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	counter := func(name, help string, labels ...string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{ //nolint:exhaustruct
+			Namespace: cfg.namespace,
+			Name:      name,
+			Help:      help,
+		}, labels)
+	}
+
+	gauge := func(name, help string, labels ...string) *prometheus.GaugeVec {
+		return prometheus.NewGaugeVec(prometheus.GaugeOpts{ //nolint:exhaustruct
+			Namespace: cfg.namespace,
+			Name:      name,
+			Help:      help,
+		}, labels)
+	}
+
+	metrics := &Metrics{
+		produced:       counter("messages_produced_total", "Messages published to the broker.", "routing_key"),
+		fallbackWrites: counter("fallback_writes_total", "Messages written to the fallback.", "routing_key"),
+		breakerChanges: counter(
+			"breaker_state_changes_total", "Circuit breaker state transitions.", "name", "from", "to",
+		),
+		breakerState:  gauge("breaker_state", "Circuit breaker state: 0 closed, 1 half-open, 2 open.", "name"),
+		consumed:      counter("messages_consumed_total", "Messages delivered to handlers.", "queue"),
+		acked:         counter("messages_acked_total", "Messages acked.", "queue"),
+		nacked:        counter("messages_nacked_total", "Messages nacked.", "queue", "requeue"),
+		handlerErrors: counter("handler_errors_total", "Handler errors.", "queue"),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{ //nolint:exhaustruct
+			Namespace: cfg.namespace,
+			Name:      "handler_duration_seconds",
+			Help:      "Handler duration.",
+			Buckets:   cfg.buckets,
+		}, []string{"queue"}),
+		consumerLag: gauge("consumer_lag_messages", "Messages ready in the queue.", "queue"),
+	}
+
+	for _, collector := range []prometheus.Collector{
+		metrics.produced,
+		metrics.fallbackWrites,
+		metrics.breakerChanges,
+		metrics.breakerState,
+		metrics.consumed,
+		metrics.acked,
+		metrics.nacked,
+		metrics.handlerErrors,
+		metrics.handlerDuration,
+		metrics.consumerLag,
+	} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return metrics, nil
+}
+
+func (m *Metrics) MessageProduced(routingKey string) {
+	m.produced.WithLabelValues(routingKey).Inc()
+}
+
+func (m *Metrics) FallbackWritten(routingKey string) {
+	m.fallbackWrites.WithLabelValues(routingKey).Inc()
+}
+
+func (m *Metrics) BreakerStateChanged(name string, from string, to string) {
+	m.breakerChanges.WithLabelValues(name, from, to).Inc()
+	m.breakerState.WithLabelValues(name).Set(breakerStateValue(to))
+}
+
+func (m *Metrics) MessageConsumed(queue string) {
+	m.consumed.WithLabelValues(queue).Inc()
+}
+
+func (m *Metrics) MessageAcked(queue string) {
+	m.acked.WithLabelValues(queue).Inc()
+}
+
+func (m *Metrics) MessageNacked(queue string, requeue bool) {
+	m.nacked.WithLabelValues(queue, strconv.FormatBool(requeue)).Inc()
+}
+
+func (m *Metrics) HandlerError(queue string) {
+	m.handlerErrors.WithLabelValues(queue).Inc()
+}
+
+func (m *Metrics) HandlerDuration(queue string, duration time.Duration) {
+	m.handlerDuration.WithLabelValues(queue).Observe(duration.Seconds())
+}
+
+func (m *Metrics) ConsumerLag(queue string, messages int) {
+	m.consumerLag.WithLabelValues(queue).Set(float64(messages))
+}
+
+// breakerStateValue maps gobreaker state names to the gauge value.
+func breakerStateValue(state string) float64 {
+	switch state {
+	case "half-open":
+		return 1
+	case "open":
+		return 2
+	default:
+		return 0
+	}
+}
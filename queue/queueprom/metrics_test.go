@@ -0,0 +1,34 @@
+package queueprom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+
+	metrics, err := New(registry)
+	require.NoError(t, err)
+
+	metrics.MessageProduced("order.created")
+	metrics.MessageProduced("order.created")
+	metrics.MessageNacked("orders", true)
+	metrics.BreakerStateChanged("rabbitmq", "closed", "open")
+	metrics.HandlerDuration("orders", 20*time.Millisecond)
+	metrics.ConsumerLag("orders", 42)
+
+	assert.InDelta(t, 2, testutil.ToFloat64(metrics.produced.WithLabelValues("order.created")), 0)
+	assert.InDelta(t, 1, testutil.ToFloat64(metrics.nacked.WithLabelValues("orders", "true")), 0)
+	assert.InDelta(t, 2, testutil.ToFloat64(metrics.breakerState.WithLabelValues("rabbitmq")), 0)
+	assert.InDelta(t, 42, testutil.ToFloat64(metrics.consumerLag.WithLabelValues("orders")), 0)
+	assert.Equal(t, 1, testutil.CollectAndCount(metrics.handlerDuration))
+
+	_, err = New(registry)
+	assert.Error(t, err)
+}
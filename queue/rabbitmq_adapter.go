@@ -3,9 +3,11 @@ package queue
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/braiphub/go-core/log"
+	"github.com/braiphub/go-core/trace"
 	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -34,19 +36,36 @@ type RabbitMQExchangeConfig struct {
 type RabbitMQConnection struct {
 	config            Config
 	logger            log.LoggerI
-	conn              *amqp.Connection
-	channel           *amqp.Channel
 	terminateCh       chan interface{}
 	errorHandler      ErrorHandlerFunc
 	deferPanicHandler DeferPanicHandlerFunc
 	databaseFallback  *GormFallback
 	breaker           *gobreaker.CircuitBreaker[any]
+	tracer            trace.TracerInterface
+	schemaRegistry    *SchemaRegistry
+	metrics           Metrics
+	lagInterval       time.Duration
+	reconnectDelay    time.Duration
+	channelPoolSize   int
+	maxBrokerDelay    time.Duration
+
+	// connMu guards the connection, its channel pool and connected, which is closed once a
+	// connection is established and replaced when it drops.
+	connMu    sync.RWMutex
+	conn      *amqp.Connection
+	channels  *channelPool
+	connected chan struct{}
+
+	rpcMu sync.Mutex
+	rpc   *rpcClient
 }
 
 type Config struct {
 	Dsn         string
 	ServiceName string
 	Exchange    string
+	// DelayStrategy is how ProduceDelayed holds messages. Defaults to DelayStagingQueue.
+	DelayStrategy DelayStrategy
 }
 
 const (
@@ -55,15 +74,23 @@ const (
 	publishTimeout       = 5 * time.Second
 )
 
-var ErrEmptyObject = errors.New("input object is empty")
+var (
+	ErrEmptyObject      = errors.New("input object is empty")
+	ErrConnectionClosed = errors.New("rabbitmq connection closed")
+)
 
 func NewRabbitMQConnection(config Config, opts ...func(*RabbitMQConnection)) *RabbitMQConnection {
 	rabbitMQ := &RabbitMQConnection{
-		config:      config,
-		logger:      nil,
-		conn:        nil,
-		channel:     nil,
-		terminateCh: make(chan interface{}),
+		config:          config,
+		logger:          nil,
+		conn:            nil,
+		terminateCh:     make(chan interface{}),
+		metrics:         noopMetrics{},
+		lagInterval:     defaultLagInterval,
+		reconnectDelay:  reconnectDelay,
+		channelPoolSize: defaultChannelPoolSize,
+		maxBrokerDelay:  brokerDelayLimit,
+		connected:       make(chan struct{}),
 	}
 
 	for _, o := range opts {
@@ -78,6 +105,8 @@ func NewRabbitMQConnection(config Config, opts ...func(*RabbitMQConnection)) *Ra
 			MaxRequests: 5,
 			ReadyToTrip: func(c gobreaker.Counts) bool { return c.ConsecutiveFailures >= maxReconnectAttempts },
 			OnStateChange: func(name string, from, to gobreaker.State) {
+				rabbitMQ.metrics.BreakerStateChanged(name, from.String(), to.String())
+
 				if to == gobreaker.StateOpen {
 					openErr := errors.Errorf("RabbitMQ circuit breaker changed from %s to %s", from.String(), to.String())
 					rabbitMQ.logger.Error(openErr.Error(), openErr)
@@ -112,7 +141,7 @@ func (r *RabbitMQConnection) Connect(ctx context.Context) error {
 			lastErr = err
 			msg := fmt.Sprintf("Error connecting to RabbitMQ: %v, (attempt: %d of %d)", err, attempt+1, maxReconnectAttempts)
 			r.logger.WithContext(ctx).Error(msg, nil)
-			time.Sleep(reconnectDelay)
+			time.Sleep(r.reconnectDelay)
 
 			continue
 		}
@@ -137,22 +166,11 @@ func (r *RabbitMQConnection) Setup(
 	exchange RabbitMQExchangeConfig,
 	queues []RabbitMQQueueConfig,
 ) error {
-	if r.conn == nil || r.conn.IsClosed() {
+	if r.connection() == nil {
 		r.logger.WithContext(ctx).Warn("RabbitMQ offline – skipping setup")
 		return nil
 	}
 
-	channel, err := r.conn.Channel()
-	if err != nil {
-		return errors.Wrap(err, "channel open")
-	}
-	defer func(channel *amqp.Channel) {
-		err := channel.Close()
-		if err != nil {
-			r.logger.Fatal("Erro ao fechar canal", log.Error(err))
-		}
-	}(channel)
-
 	if err := r.DeclareExchange(ctx, exchange.Name, exchange.Type); err != nil {
 		return errors.Wrap(err, "declare exchange")
 	}
@@ -170,122 +188,177 @@ func (r *RabbitMQConnection) Setup(
 	return nil
 }
 
-func (r *RabbitMQConnection) DeclareExchange(ctx context.Context, exchangeName string, exchangeType string) error {
-	channel, err := r.conn.Channel()
-	if err != nil {
-		return errors.Wrap(err, "channel open")
-	}
-	defer func(channel *amqp.Channel) {
-		err := channel.Close()
+func (r *RabbitMQConnection) DeclareExchange(_ context.Context, exchangeName string, exchangeType string) error {
+	return r.withChannel(func(channel *amqp.Channel) error {
+		err := channel.ExchangeDeclare(exchangeName, exchangeType, true, false, false, false, nil)
 		if err != nil {
-			r.logger.WithContext(ctx).Fatal("Erro ao fechar canal", log.Error(err))
+			return errors.Wrap(err, "exchange declare")
 		}
-	}(channel)
 
-	err = channel.ExchangeDeclare(exchangeName, exchangeType, true, false, false, false, nil)
-	if err != nil {
-		return errors.Wrap(err, "exchange declare")
-	}
-
-	return nil
+		return nil
+	})
 }
 
 func (r *RabbitMQConnection) DeclareQueue(queue RabbitMQQueueConfig) error {
-	channel, err := r.conn.Channel()
-	if err != nil {
-		return errors.Wrap(err, "channel open")
-	}
-	defer func(channel *amqp.Channel) {
-		if err := channel.Close(); err != nil {
-			return
+	return r.withChannel(func(channel *amqp.Channel) error {
+		_, err := channel.QueueDeclare(
+			queue.Name,
+			true,
+			false,
+			false,
+			false,
+			queue.Arguments,
+		)
+		if err != nil {
+			return errors.Wrap(err, "queue declare")
 		}
-	}(channel)
-
-	_, err = channel.QueueDeclare(
-		queue.Name,
-		true,
-		false,
-		false,
-		false,
-		queue.Arguments,
-	)
-	if err != nil {
-		return errors.Wrap(err, "queue declare")
-	}
 
-	return nil
+		return nil
+	})
 }
 
 func (r *RabbitMQConnection) BindQueue(
-	ctx context.Context,
+	_ context.Context,
 	queueName string,
 	exchangeName string,
 	routingKey string,
 ) error {
-	channel, err := r.conn.Channel()
-	if err != nil {
-		return errors.Wrap(err, "channel open")
-	}
-	defer func(channel *amqp.Channel) {
-		if err := channel.Close(); err != nil {
-			r.logger.WithContext(ctx).Warn("Erro ao fechar canal: %s", log.Error(err))
+	return r.withChannel(func(channel *amqp.Channel) error {
+		err := channel.QueueBind(queueName, routingKey, exchangeName, false, nil)
+		if err != nil {
+			return errors.Wrap(err, "queue bind")
 		}
-	}(channel)
-
-	err = channel.QueueBind(queueName, routingKey, exchangeName, false, nil)
-	if err != nil {
-		return errors.Wrap(err, "queue bind")
-	}
 
-	return nil
+		return nil
+	})
 }
 
 func (r *RabbitMQConnection) Close() {
 	r.terminateCh <- true
 
-	if r.conn != nil {
-		if err := r.conn.Close(); err != nil {
-			return
+	r.connMu.RLock()
+	conn := r.conn
+	r.connMu.RUnlock()
+
+	if conn != nil {
+		r.dropConnection(conn)
+	}
+}
+
+// connection returns the current connection, or nil while it's disconnected.
+func (r *RabbitMQConnection) connection() *amqp.Connection {
+	r.connMu.RLock()
+	defer r.connMu.RUnlock()
+
+	if r.conn == nil || r.conn.IsClosed() {
+		return nil
+	}
+
+	return r.conn
+}
+
+func (r *RabbitMQConnection) setConnection(conn *amqp.Connection) {
+	r.connMu.Lock()
+	defer r.connMu.Unlock()
+
+	if r.channels != nil {
+		r.channels.close()
+	}
+
+	r.conn = conn
+	r.channels = newChannelPool(conn, r.channelPoolSize)
+
+	select {
+	case <-r.connected:
+	default:
+		close(r.connected)
+	}
+}
+
+// dropConnection discards conn and its channels, unless it was already replaced.
+func (r *RabbitMQConnection) dropConnection(conn *amqp.Connection) {
+	r.connMu.Lock()
+
+	if r.conn != conn {
+		r.connMu.Unlock()
+
+		return
+	}
+
+	pool := r.channels
+	r.conn, r.channels = nil, nil
+	r.connected = make(chan struct{})
+	r.connMu.Unlock()
+
+	pool.close()
+	_ = conn.Close()
+}
+
+// waitConnection waits until a connection is established.
+func (r *RabbitMQConnection) waitConnection(ctx context.Context) {
+	r.connMu.RLock()
+	connected, conn := r.connected, r.conn
+	r.connMu.RUnlock()
+
+	select {
+	case <-connected:
+		// closed but not dropped yet: give manageConnection time to notice it
+		if conn != nil && conn.IsClosed() {
+			r.waitReconnect(ctx)
 		}
+	case <-ctx.Done():
 	}
 }
 
 func (r *RabbitMQConnection) manageConnection(ctx context.Context) {
 	for {
-		if r.conn == nil {
+		r.connMu.RLock()
+		conn := r.conn
+		r.connMu.RUnlock()
+
+		if conn == nil {
 			_, err := r.breaker.Execute(func() (any, error) {
 				return nil, r.tryConnect(ctx)
 			})
 			if err != nil {
 				r.logger.WithContext(ctx).Error("erro ao conectar, retry em", err)
 				select {
-				case <-time.After(reconnectDelay):
+				case <-time.After(r.reconnectDelay):
 					continue
 				case <-r.terminateCh:
 					return
 				}
 			}
+
+			continue
 		}
 
-		closeCh := r.conn.NotifyClose(make(chan *amqp.Error, 1))
+		closeCh := conn.NotifyClose(make(chan *amqp.Error, 1))
 		select {
 		case amqpErr := <-closeCh:
 			r.logger.WithContext(ctx).Error("RabbitMQ connection closed", amqpErr)
-			_ = r.conn.Close()
-			r.conn, r.channel = nil, nil
+			r.dropConnection(conn)
 
 			continue
 
 		case <-r.terminateCh:
-			if r.conn != nil {
-				_ = r.conn.Close()
-			}
+			r.dropConnection(conn)
+
 			return
 		}
 	}
 }
 
-func (r *RabbitMQConnection) channelConsumer(ctx context.Context, queue string, options ConsumeOptions) <-chan amqp.Delivery {
+// channelConsumer forwards deliveries from queue until ctx is cancelled, reopening the channel
+// whenever it drops. On cancellation the consumer is cancelled, deliveries not yet forwarded are
+// requeued and the output is closed; the channel itself is only closed once handlersDone is
+// closed, so in-flight handlers are still able to ack their messages.
+func (r *RabbitMQConnection) channelConsumer(
+	ctx context.Context,
+	queue string,
+	options ConsumeOptions,
+	handlersDone <-chan struct{},
+) <-chan amqp.Delivery {
 	args := make(amqp.Table)
 
 	if options.Priority != nil {
@@ -295,17 +368,24 @@ func (r *RabbitMQConnection) channelConsumer(ctx context.Context, queue string,
 	outChannel := make(chan amqp.Delivery)
 
 	go func(outChannel chan amqp.Delivery) {
+		defer close(outChannel)
+
 		for {
-			if r.conn == nil || r.conn.IsClosed() {
-				time.Sleep(reconnectDelay)
+			if ctx.Err() != nil {
+				return
+			}
+
+			conn := r.connection()
+			if conn == nil {
+				r.waitConnection(ctx)
 
 				continue
 			}
 
-			channel, err := r.conn.Channel()
+			channel, err := conn.Channel()
 			if err != nil {
 				r.logger.WithContext(ctx).Error("open channel error: %s\n", err)
-				time.Sleep(reconnectDelay)
+				r.waitReconnect(ctx)
 
 				continue
 			}
@@ -325,68 +405,109 @@ func (r *RabbitMQConnection) channelConsumer(ctx context.Context, queue string,
 			)
 			if err != nil {
 				r.logger.WithContext(ctx).Error("channel consume error: %s\n", err)
-				time.Sleep(reconnectDelay)
+				_ = channel.Close()
+				r.waitReconnect(ctx)
+
+				continue
+			}
 
+			if !r.forwardDeliveries(ctx, queue, messageCh, outChannel) {
+				// channel dropped: reconnect
 				continue
 			}
 
+			// ctx cancelled: stop receiving and give back whatever the broker already pushed
+			if err := channel.Cancel(r.config.ServiceName, false); err != nil {
+				r.logger.WithContext(ctx).Error("cancel consumer", err, log.Any("queue", queue))
+			}
+
 			for msg := range messageCh {
-				outChannel <- msg
+				r.requeue(ctx, queue, msg)
 			}
+
+			go func() {
+				<-handlersDone
+				_ = channel.Close()
+			}()
+
+			return
 		}
 	}(outChannel)
 
 	return outChannel
 }
 
-func (r *RabbitMQConnection) channelStreamConsumer(ctx context.Context, routingKey string) <-chan amqp.Delivery {
-	outChannel := make(chan amqp.Delivery)
+// forwardDeliveries returns true when ctx is cancelled and false when the delivery channel is closed.
+func (r *RabbitMQConnection) forwardDeliveries(
+	ctx context.Context,
+	queue string,
+	messageCh <-chan amqp.Delivery,
+	outChannel chan<- amqp.Delivery,
+) bool {
+	for {
+		select {
+		case msg, ok := <-messageCh:
+			if !ok {
+				return false
+			}
 
-	go func(outChannel chan amqp.Delivery) {
-		channel, err := r.conn.Channel()
-		if err != nil {
-			r.logger.WithContext(ctx).Error("open channel error: %s\n", err)
+			select {
+			case outChannel <- msg:
+			case <-ctx.Done():
+				r.requeue(ctx, queue, msg)
 
-			return
+				return true
+			}
+
+		case <-ctx.Done():
+			return true
 		}
-		defer channel.Close()
+	}
+}
 
-		queueName := fmt.Sprintf("%s.%s.stream.%s", r.config.Exchange, routingKey, uuid.New().String())
+func (r *RabbitMQConnection) waitReconnect(ctx context.Context) {
+	select {
+	case <-time.After(r.reconnectDelay):
+	case <-ctx.Done():
+	}
+}
 
-		queue, err := channel.QueueDeclare(queueName, false, true, false, false, nil)
-		if err != nil {
-			r.logger.WithContext(ctx).Error("stream queue declare", err)
+// channelStreamConsumer forwards deliveries from an auto-deleted queue bound to routingKey until ctx
+// is cancelled. The queue goes away with the connection, so a new one is declared after a drop.
+func (r *RabbitMQConnection) channelStreamConsumer(ctx context.Context, routingKey string) <-chan amqp.Delivery {
+	outChannel := make(chan amqp.Delivery)
 
-			return
-		}
+	go func(outChannel chan amqp.Delivery) {
+		defer close(outChannel)
 
-		if err := r.BindQueue(ctx, queue.Name, r.config.Exchange, routingKey); err != nil {
-			r.logger.WithContext(ctx).Error("stream queue bind", err)
+		for ctx.Err() == nil {
+			conn := r.connection()
+			if conn == nil {
+				r.waitConnection(ctx)
 
-			return
-		}
+				continue
+			}
 
-		messageCh, err := channel.Consume(
-			queue.Name,           // queue
-			r.config.ServiceName, // consumer name
-			false,                // auto-ack
-			false,                // exclusive
-			false,                // no-local
-			false,                // no-wait
-			nil,                  // args
-		)
-		if err != nil {
-			r.logger.WithContext(ctx).Error("channel consume error: %s\n", err)
+			channel, err := conn.Channel()
+			if err != nil {
+				r.logger.WithContext(ctx).Error("open channel error: %s\n", err)
+				r.waitReconnect(ctx)
 
-			return
-		}
+				continue
+			}
 
-		for {
-			select {
-			case msg := <-messageCh:
-				outChannel <- msg
+			messageCh, err := r.subscribeStream(channel, routingKey)
+			if err != nil {
+				r.logger.WithContext(ctx).Error("stream subscribe", err, log.Any("routing_key", routingKey))
+				_ = channel.Close()
+				r.waitReconnect(ctx)
+
+				continue
+			}
+
+			if r.forwardDeliveries(ctx, routingKey, messageCh, outChannel) {
+				_ = channel.Close()
 
-			case <-ctx.Done():
 				return
 			}
 		}
@@ -395,6 +516,34 @@ func (r *RabbitMQConnection) channelStreamConsumer(ctx context.Context, routingK
 	return outChannel
 }
 
+func (r *RabbitMQConnection) subscribeStream(channel *amqp.Channel, routingKey string) (<-chan amqp.Delivery, error) {
+	queueName := fmt.Sprintf("%s.%s.stream.%s", r.config.Exchange, routingKey, uuid.New().String())
+
+	queue, err := channel.QueueDeclare(queueName, false, true, false, false, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "stream queue declare")
+	}
+
+	if err := channel.QueueBind(queue.Name, routingKey, r.config.Exchange, false, nil); err != nil {
+		return nil, errors.Wrap(err, "stream queue bind")
+	}
+
+	messageCh, err := channel.Consume(
+		queue.Name,           // queue
+		r.config.ServiceName, // consumer name
+		false,                // auto-ack
+		false,                // exclusive
+		false,                // no-local
+		false,                // no-wait
+		nil,                  // args
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "channel consume")
+	}
+
+	return messageCh, nil
+}
+
 func (r *RabbitMQConnection) IsClosed() bool {
 	return r.breaker.State() == gobreaker.StateClosed
 }
@@ -405,13 +554,7 @@ func (r *RabbitMQConnection) tryConnect(ctx context.Context) error {
 		return err
 	}
 
-	ch, err := conn.Channel()
-	if err != nil {
-		conn.Close()
-		return err
-	}
-
-	r.conn, r.channel = conn, ch
+	r.setConnection(conn)
 	r.logger.WithContext(ctx).Info("rabbit-mq connection established")
 	return nil
 }
@@ -0,0 +1,193 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/log"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func newTestRabbitMQConnection(t *testing.T, server *fakeAMQPServer, opts ...func(*RabbitMQConnection)) *RabbitMQConnection {
+	t.Helper()
+
+	logger := log.NewMockLoggerI(gomock.NewController(t))
+	logger.EXPECT().WithContext(gomock.Any()).Return(logger).AnyTimes()
+	logger.EXPECT().Info(gomock.Any(), gomock.Any()).AnyTimes()
+	logger.EXPECT().Warn(gomock.Any(), gomock.Any()).AnyTimes()
+	logger.EXPECT().Error(gomock.Any(), gomock.Any(), gomock.Any()).AnyTimes()
+
+	opts = append([]func(*RabbitMQConnection){WithLogger(logger), WithReconnectDelay(10 * time.Millisecond)}, opts...)
+	conn := NewRabbitMQConnection(Config{Dsn: server.URL(), ServiceName: "test", Exchange: "events"}, opts...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	require.NoError(t, conn.Connect(ctx))
+	require.NoError(t, conn.Setup(ctx, RabbitMQExchangeConfig{Name: "events", Type: amqp.ExchangeTopic}, []RabbitMQQueueConfig{
+		{Name: "orders", Exchange: "events", RoutingKey: "order.*"},
+	}))
+
+	return conn
+}
+
+// produceEventually retries while the connection is being re-established. It waits for the connection
+// first: reconnecting goes through the breaker, which publishing while disconnected keeps open.
+func produceEventually(t *testing.T, conn *RabbitMQConnection, routingKey string, msg any) {
+	t.Helper()
+
+	require.Eventually(t, func() bool { return conn.connection() != nil }, 5*time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return conn.Produce(context.Background(), routingKey, msg) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func receive(t *testing.T, received <-chan string) string {
+	t.Helper()
+
+	select {
+	case body := <-received:
+		return body
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+
+		return ""
+	}
+}
+
+func TestRabbitMQConnection_ChannelPool(t *testing.T) {
+	server := newFakeAMQPServer(t)
+	conn := newTestRabbitMQConnection(t, server, WithChannelPoolSize(4))
+
+	opened := server.openedChannels()
+
+	var wg sync.WaitGroup
+
+	for range 4 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for range 25 {
+				assert.NoError(t, conn.Produce(context.Background(), "order.created", []byte(`{}`)))
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	// publishers take turns on the pooled channels instead of opening one per message
+	assert.LessOrEqual(t, server.openedChannels()-opened, 4)
+}
+
+func TestRabbitMQConnection_ConsumerRecovery(t *testing.T) {
+	server := newFakeAMQPServer(t)
+	conn := newTestRabbitMQConnection(t, server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan string, 10)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		conn.Consume(ctx, "orders", func(_ context.Context, msg Message) error {
+			received <- string(msg.Body)
+
+			return nil
+		})
+	}()
+
+	require.Eventually(t, func() bool { return server.consumers("orders") == 1 }, 5*time.Second, time.Millisecond)
+
+	produceEventually(t, conn, "order.created", []byte("before"))
+	assert.Equal(t, "before", receive(t, received))
+
+	server.dropConnections()
+
+	// the consumer is registered again on the new connection
+	require.Eventually(t, func() bool { return server.consumers("orders") == 1 }, 5*time.Second, time.Millisecond)
+
+	produceEventually(t, conn, "order.created", []byte("after"))
+
+	// "before" is delivered again when its ack was lost with the connection
+	for body := receive(t, received); body != "after"; body = receive(t, received) {
+		assert.Equal(t, "before", body)
+	}
+
+	cancel()
+	<-done
+}
+
+func TestRabbitMQConnection_ConsumeStreamRecovery(t *testing.T) {
+	server := newFakeAMQPServer(t)
+	conn := newTestRabbitMQConnection(t, server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan string, 10)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		conn.ConsumeStream(ctx, "order.paid", func(_ context.Context, msg Message) error {
+			received <- string(msg.Body)
+
+			return nil
+		})
+	}()
+
+	require.Eventually(t, func() bool { return server.boundConsumers("order.paid") == 1 }, 5*time.Second, time.Millisecond)
+
+	produceEventually(t, conn, "order.paid", []byte("before"))
+	assert.Equal(t, "before", receive(t, received))
+
+	server.dropConnections()
+
+	require.Eventually(t, func() bool { return server.boundConsumers("order.paid") == 1 }, 5*time.Second, time.Millisecond)
+
+	produceEventually(t, conn, "order.paid", []byte("after"))
+	assert.Equal(t, "after", receive(t, received))
+
+	cancel()
+	<-done
+}
+
+func TestRabbitMQConnection_ReconnectWhileProducing(t *testing.T) {
+	server := newFakeAMQPServer(t)
+	conn := newTestRabbitMQConnection(t, server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var wg sync.WaitGroup
+
+	for range 4 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for ctx.Err() == nil {
+				// publishes fail while disconnected, since there's no fallback
+				_ = conn.Produce(context.Background(), "order.created", []byte(`{}`))
+				_ = conn.DeclareQueue(RabbitMQQueueConfig{Name: "orders"})
+			}
+		}()
+	}
+
+	for range 3 {
+		time.Sleep(20 * time.Millisecond)
+		server.dropConnections()
+	}
+
+	cancel()
+	wg.Wait()
+
+	produceEventually(t, conn, "order.created", []byte(`{}`))
+}
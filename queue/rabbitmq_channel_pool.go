@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"sync"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const defaultChannelPoolSize = 16
+
+// channelPool keeps the idle channels of a connection, so publishing and declaring don't open a
+// channel per call. Consumers and confirm-mode publishers own their channels instead.
+type channelPool struct {
+	conn *amqp.Connection
+	size int
+
+	mu     sync.Mutex
+	idle   []*amqp.Channel
+	closed bool
+}
+
+func newChannelPool(conn *amqp.Connection, size int) *channelPool {
+	return &channelPool{
+		conn: conn,
+		size: size,
+		idle: make([]*amqp.Channel, 0, size),
+	}
+}
+
+func (p *channelPool) get() (*amqp.Channel, error) {
+	p.mu.Lock()
+
+	for len(p.idle) > 0 {
+		channel := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+
+		if !channel.IsClosed() {
+			p.mu.Unlock()
+
+			return channel, nil
+		}
+	}
+
+	p.mu.Unlock()
+
+	channel, err := p.conn.Channel()
+	if err != nil {
+		return nil, errors.Wrap(err, "channel open")
+	}
+
+	return channel, nil
+}
+
+// put returns channel to the pool, it's closed when the pool is full or closed.
+func (p *channelPool) put(channel *amqp.Channel) {
+	p.mu.Lock()
+
+	if !p.closed && len(p.idle) < p.size && !channel.IsClosed() {
+		p.idle = append(p.idle, channel)
+		p.mu.Unlock()
+
+		return
+	}
+
+	p.mu.Unlock()
+
+	_ = channel.Close()
+}
+
+func (p *channelPool) close() {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle, p.closed = nil, true
+	p.mu.Unlock()
+
+	for _, channel := range idle {
+		_ = channel.Close()
+	}
+}
+
+// withChannel runs fn on a pooled channel. The broker closes the channel on most errors, so it's
+// only returned to the pool when fn succeeds.
+func (r *RabbitMQConnection) withChannel(fn func(channel *amqp.Channel) error) error {
+	r.connMu.RLock()
+	pool := r.channels
+	r.connMu.RUnlock()
+
+	if pool == nil {
+		return ErrConnectionClosed
+	}
+
+	channel, err := pool.get()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(channel); err != nil {
+		_ = channel.Close()
+
+		return err
+	}
+
+	pool.put(channel)
+
+	return nil
+}
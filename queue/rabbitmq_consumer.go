@@ -3,77 +3,304 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
 
 	"github.com/braiphub/go-core/log"
+	"github.com/pkg/errors"
 	"github.com/rabbitmq/amqp091-go"
 )
 
 type JSONMessage map[string]interface{}
 
 type ConsumeOptions struct {
-	PrefetchCount   *int
-	Priority        *int
-	ConsumerTimeout *int
+	PrefetchCount        *int
+	Priority             *int
+	ConsumerTimeout      *int
+	Concurrency          *int
+	OrderingKey          *string
+	ShutdownTimeout      *time.Duration
+	Idempotency          IdempotencyStore
+	InProgressRetryDelay *time.Duration
 }
 
+const (
+	defaultShutdownTimeout      = 30 * time.Second
+	defaultInProgressRetryDelay = time.Second
+)
+
+func (o ConsumeOptions) workers() int {
+	if o.Concurrency == nil || *o.Concurrency < 1 {
+		return 1
+	}
+
+	return *o.Concurrency
+}
+
+func (o ConsumeOptions) shutdownTimeout() time.Duration {
+	if o.ShutdownTimeout == nil {
+		return defaultShutdownTimeout
+	}
+
+	return *o.ShutdownTimeout
+}
+
+func (o ConsumeOptions) inProgressRetryDelay() time.Duration {
+	if o.InProgressRetryDelay == nil {
+		return defaultInProgressRetryDelay
+	}
+
+	return *o.InProgressRetryDelay
+}
+
+// Consume blocks until ctx is cancelled. On cancellation it stops taking new deliveries,
+// requeues the ones not yet handed to a handler and waits for in-flight handlers up to the
+// shutdown timeout before closing the channel. A handler panic nacks the message and is passed to
+// the panic handler, the worker keeps consuming.
 func (r *RabbitMQConnection) Consume(
 	ctx context.Context,
 	queue string,
 	processMsgFn func(ctx context.Context, msg Message) error,
 	opts ...func(*ConsumeOptions),
 ) {
-	var (
-		forever chan struct{}
-		options ConsumeOptions
-	)
+	var options ConsumeOptions
 
 	for _, opt := range opts {
 		opt(&options)
 	}
 
+	if r.schemaRegistry != nil {
+		processMsgFn = r.schemaRegistry.Wrap(processMsgFn)
+	}
+
+	if options.Idempotency != nil {
+		processMsgFn = withIdempotency(queue, options.Idempotency, options.inProgressRetryDelay(), r.logger, processMsgFn)
+	}
+
+	// handlers must be able to finish their work after ctx is cancelled: they're only
+	// cancelled when the shutdown timeout is reached
+	handlerCtx, cancelHandlers := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancelHandlers()
+
+	if _, noop := r.metrics.(noopMetrics); !noop {
+		go r.monitorLag(ctx, queue)
+	}
+
+	handlersDone := make(chan struct{})
+	deliveries := r.channelConsumer(ctx, queue, options, handlersDone)
+	workers := options.workers()
+
+	var wg sync.WaitGroup
+
+	startWorker := func(deliveries <-chan amqp091.Delivery) {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			r.consumeWorker(ctx, handlerCtx, queue, deliveries, processMsgFn)
+		}()
+	}
+
+	switch {
+	case options.OrderingKey != nil && workers > 1:
+		// each worker owns a partition: messages sharing the same ordering key are
+		// always routed to the same worker, so they're processed sequentially
+		partitions := make([]chan amqp091.Delivery, workers)
+		for i := range partitions {
+			partitions[i] = make(chan amqp091.Delivery)
+			startWorker(partitions[i])
+		}
+
+		go r.partitionDeliveries(ctx, queue, deliveries, partitions, *options.OrderingKey)
+
+	default:
+		for range workers {
+			startWorker(deliveries)
+		}
+	}
+
+	r.logger.WithContext(ctx).Info(fmt.Sprintf("[*] Listening for messages in queue: %s (workers: %d)", queue, workers))
+
+	<-ctx.Done()
+
+	r.logger.WithContext(ctx).Info("[*] Stopping consumer, waiting for in-flight messages in queue: " + queue)
+
+	workersDone := make(chan struct{})
+
 	go func() {
-		if r.deferPanicHandler != nil {
-			defer r.deferPanicHandler(queue)
+		wg.Wait()
+		close(workersDone)
+	}()
+
+	select {
+	case <-workersDone:
+	case <-time.After(options.shutdownTimeout()):
+		r.logger.WithContext(ctx).Warn(
+			"shutdown timeout reached with in-flight messages; they'll be requeued by the broker",
+			log.Any("queue", queue),
+		)
+	}
+
+	// closing the channel requeues every unacknowledged delivery
+	close(handlersDone)
+
+	r.logger.WithContext(ctx).Info("[*] Consumer stopped for queue: " + queue)
+}
+
+func (r *RabbitMQConnection) consumeWorker(
+	ctx context.Context,
+	handlerCtx context.Context,
+	queue string,
+	deliveries <-chan amqp091.Delivery,
+	processMsgFn func(ctx context.Context, msg Message) error,
+) {
+	for msg := range deliveries {
+		if ctx.Err() != nil {
+			r.requeue(ctx, queue, msg)
+
+			continue
 		}
 
-		for msg := range r.channelConsumer(ctx, queue, options) {
-			func() {
-				message := Message{
-					Headers: msg.Headers,
-					Body:    msg.Body,
-				}
+		r.handleDelivery(handlerCtx, queue, msg, processMsgFn)
+	}
+}
 
-				// call message handler
-				err := processMsgFn(ctx, message)
+func (r *RabbitMQConnection) handleDelivery(
+	ctx context.Context,
+	queue string,
+	msg amqp091.Delivery,
+	processMsgFn func(ctx context.Context, msg Message) error,
+) {
+	ctx, span := r.startConsumeSpan(ctx, queue, msg)
 
-				// error: unacknownledge
-				if err != nil {
-					r.logger.WithContext(ctx).Error(
-						"process message error",
-						err,
-						log.Any("queue", queue),
-						getProcessMessageErrorField(msg),
-					)
+	r.metrics.MessageConsumed(queue)
+	start := time.Now()
 
-					r.callErrorHandler(queue, msg, err)
+	// call message handler
+	err := r.process(ctx, queue, msg, processMsgFn)
 
-					if err := msg.Nack(false, false); err != nil {
-						r.logger.WithContext(ctx).Error("nack message", err)
-					}
+	r.metrics.HandlerDuration(queue, time.Since(start))
+	finishSpan(span, err)
 
-					return
-				}
+	// another consumer is handling a redelivered copy: retry it later
+	if errors.Is(err, ErrMessageInProgress) {
+		r.requeue(ctx, queue, msg)
 
-				// ok: acknowledge
-				if err := msg.Ack(false); err != nil {
-					r.logger.WithContext(ctx).Error("ack message", err)
-				}
-			}()
+		return
+	}
+
+	// error: unacknownledge
+	if err != nil {
+		r.metrics.HandlerError(queue)
+
+		r.logger.WithContext(ctx).Error(
+			"process message error",
+			err,
+			log.Any("queue", queue),
+			getProcessMessageErrorField(msg),
+		)
+
+		r.callErrorHandler(queue, msg, err)
+
+		if err := msg.Nack(false, false); err != nil {
+			r.logger.WithContext(ctx).Error("nack message", err)
+		} else {
+			r.metrics.MessageNacked(queue, false)
+		}
+
+		return
+	}
+
+	// ok: acknowledge
+	if err := msg.Ack(false); err != nil {
+		r.logger.WithContext(ctx).Error("ack message", err)
+	} else {
+		r.metrics.MessageAcked(queue)
+	}
+}
+
+// process calls the message handler, turning a panic into an error so the message is nacked and
+// the worker keeps consuming. The panic handler is deferred around each call, so it can recover
+// and report the panic itself.
+func (r *RabbitMQConnection) process(
+	ctx context.Context,
+	queue string,
+	msg amqp091.Delivery,
+	processMsgFn func(ctx context.Context, msg Message) error,
+) (err error) {
+	returned := false
+
+	defer func() {
+		recovered := recover()
+
+		switch {
+		case returned:
+		case recovered != nil:
+			err = errors.Errorf("message handler panic: %v", recovered)
+		default:
+			// already recovered by the panic handler
+			err = errors.New("message handler panic")
+		}
+	}()
+
+	if r.deferPanicHandler != nil {
+		defer r.deferPanicHandler(queue)
+	}
+
+	err = processMsgFn(ctx, newMessageFromDelivery(msg))
+	returned = true
+
+	return err
+}
+
+func (r *RabbitMQConnection) requeue(ctx context.Context, queue string, msg amqp091.Delivery) {
+	if err := msg.Nack(false, true); err != nil {
+		r.logger.WithContext(ctx).Error("nack-requeue message", err)
+
+		return
+	}
+
+	r.metrics.MessageNacked(queue, true)
+}
+
+// partitionDeliveries routes each delivery to a partition chosen by the hash of the
+// ordering header. Deliveries without the header are spread in round-robin.
+func (r *RabbitMQConnection) partitionDeliveries(
+	ctx context.Context,
+	queue string,
+	deliveries <-chan amqp091.Delivery,
+	partitions []chan amqp091.Delivery,
+	orderingKey string,
+) {
+	defer func() {
+		for _, partition := range partitions {
+			close(partition)
 		}
 	}()
 
-	r.logger.WithContext(ctx).Info("[*] Listening for messages in queue: " + queue)
-	<-forever
+	var next int
+
+	for msg := range deliveries {
+		partition := partitions[next%len(partitions)]
+
+		if value, ok := msg.Headers[orderingKey]; ok && value != nil {
+			hash := fnv.New32a()
+			_, _ = hash.Write([]byte(fmt.Sprint(value)))
+
+			partition = partitions[hash.Sum32()%uint32(len(partitions))] //nolint:gosec
+		} else {
+			next++
+		}
+
+		select {
+		case partition <- msg:
+		case <-ctx.Done():
+			r.requeue(ctx, queue, msg)
+		}
+	}
 }
 
 func (r *RabbitMQConnection) callErrorHandler(queue string, msg amqp091.Delivery, err error) {
@@ -84,6 +311,8 @@ func (r *RabbitMQConnection) callErrorHandler(queue string, msg amqp091.Delivery
 	r.errorHandler(queue, msg.Body, nil, err)
 }
 
+// ConsumeStream consumes from an exclusive, auto-deleted queue bound to eventName, so only messages
+// published while it's running are received. See ConsumeFromStream to read durable streams.
 func (r *RabbitMQConnection) ConsumeStream(
 	ctx context.Context,
 	eventName string,
@@ -91,14 +320,17 @@ func (r *RabbitMQConnection) ConsumeStream(
 ) {
 	routingKey := eventName
 
+	if r.schemaRegistry != nil {
+		processMsgFn = r.schemaRegistry.Wrap(processMsgFn)
+	}
+
 	go func() {
 		for msg := range r.channelStreamConsumer(ctx, routingKey) {
-			message := Message{
-				Headers: msg.Headers,
-				Body:    msg.Body,
-			}
+			spanCtx, span := r.startConsumeSpan(ctx, routingKey, msg)
+			err := processMsgFn(spanCtx, newMessageFromDelivery(msg))
+			finishSpan(span, err)
 
-			if err := processMsgFn(ctx, message); err != nil {
+			if err != nil {
 				r.logger.WithContext(ctx).Error(
 					"process message error",
 					err,
@@ -120,6 +352,20 @@ func (r *RabbitMQConnection) ConsumeStream(
 	<-ctx.Done()
 }
 
+func newMessageFromDelivery(msg amqp091.Delivery) Message {
+	return Message{
+		Headers:       msg.Headers,
+		Body:          msg.Body,
+		ContentType:   msg.ContentType,
+		MessageID:     msg.MessageId,
+		RoutingKey:    msg.RoutingKey,
+		Timestamp:     msg.Timestamp,
+		Redelivered:   msg.Redelivered,
+		CorrelationID: msg.CorrelationId,
+		ReplyTo:       msg.ReplyTo,
+	}
+}
+
 func getProcessMessageErrorField(msg amqp091.Delivery) log.Field {
 	var jsonMessage JSONMessage
 
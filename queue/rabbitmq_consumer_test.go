@@ -0,0 +1,302 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// requeueMetrics counts the messages requeued per queue.
+type requeueMetrics struct {
+	noopMetrics
+
+	mu       sync.Mutex
+	requeued map[string]int
+}
+
+func (m *requeueMetrics) MessageNacked(queue string, requeue bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if requeue {
+		m.requeued[queue]++
+	}
+}
+
+func (m *requeueMetrics) count(queue string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.requeued[queue]
+}
+
+func TestRabbitMQConnection_ConsumeOrderingKey(t *testing.T) {
+	server := newFakeAMQPServer(t)
+	conn := newTestRabbitMQConnection(t, server)
+
+	// account-1 and account-2 hash to different partitions out of two
+	accounts := []string{"account-1", "account-2"}
+
+	const perAccount = 5
+
+	var (
+		mu       sync.Mutex
+		received = make(map[string][]string)
+		inFlight = make(map[string]int)
+		overlap  bool
+		waited   bool
+		wg       sync.WaitGroup
+	)
+
+	wg.Add(len(accounts) * perAccount)
+
+	// the first message of each account waits for the other one: it's only released when both
+	// are handled at the same time
+	var firstStarted sync.WaitGroup
+
+	firstStarted.Add(len(accounts))
+
+	parallel := make(chan struct{})
+
+	go func() {
+		firstStarted.Wait()
+		close(parallel)
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		conn.Consume(ctx, "orders", func(_ context.Context, msg Message) error {
+			defer wg.Done()
+
+			account, _ := msg.Headers["account"].(string)
+
+			mu.Lock()
+			inFlight[account]++
+			overlap = overlap || inFlight[account] > 1
+			first := len(received[account]) == 0
+			received[account] = append(received[account], string(msg.Body))
+			mu.Unlock()
+
+			if first {
+				firstStarted.Done()
+
+				select {
+				case <-parallel:
+				case <-time.After(5 * time.Second):
+					mu.Lock()
+					waited = true
+					mu.Unlock()
+				}
+			}
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			inFlight[account]--
+			mu.Unlock()
+
+			return nil
+		}, WithConcurrency(2), WithOrderingKey("account"))
+	}()
+
+	require.Eventually(t, func() bool { return server.consumers("orders") == 1 }, 5*time.Second, time.Millisecond)
+
+	want := make(map[string][]string)
+
+	for i := range perAccount {
+		for _, account := range accounts {
+			body := fmt.Sprintf("%s-%d", account, i)
+			want[account] = append(want[account], body)
+
+			require.NoError(t, conn.Produce(context.Background(), "order.created", Message{
+				Headers: map[string]any{"account": account},
+				Body:    []byte(body),
+			}))
+		}
+	}
+
+	wg.Wait()
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, want, received)
+	assert.False(t, overlap, "messages with the same ordering key were handled in parallel")
+	assert.False(t, waited, "messages with different ordering keys were not handled in parallel")
+}
+
+func TestRabbitMQConnection_ConsumeGracefulShutdown(t *testing.T) {
+	server := newFakeAMQPServer(t)
+	metrics := &requeueMetrics{requeued: make(map[string]int)}
+	conn := newTestRabbitMQConnection(t, server, WithMetrics(metrics))
+
+	started := make(chan string, 3)
+	release := make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		conn.Consume(ctx, "orders", func(_ context.Context, msg Message) error {
+			started <- string(msg.Body)
+			<-release
+
+			return nil
+		}, WithShutdownTimeout(5*time.Second))
+	}()
+
+	require.Eventually(t, func() bool { return server.consumers("orders") == 1 }, 5*time.Second, time.Millisecond)
+
+	for _, body := range []string{"first", "second", "third"} {
+		require.NoError(t, conn.Produce(context.Background(), "order.created", []byte(body)))
+	}
+
+	assert.Equal(t, "first", receive(t, started))
+
+	cancel()
+
+	// the consumer is cancelled right away, while the in-flight handler keeps running
+	require.Eventually(t, func() bool { return server.consumers("orders") == 0 }, 5*time.Second, time.Millisecond)
+
+	// deliveries never handed to the handler are requeued without waiting for it
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"second", "third"}, server.ready("orders"))
+	}, 5*time.Second, time.Millisecond)
+	// a message requeued before the consumer is cancelled may be pushed and requeued again
+	assert.GreaterOrEqual(t, metrics.count("orders"), 2)
+
+	select {
+	case <-done:
+		t.Fatal("Consume returned before the in-flight handler finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	<-done
+
+	// the in-flight message is acked before the channel is closed
+	assert.Equal(t, []string{"second", "third"}, server.ready("orders"))
+	assert.Empty(t, started)
+}
+
+func TestRabbitMQConnection_ConsumeShutdownTimeout(t *testing.T) {
+	server := newFakeAMQPServer(t)
+	conn := newTestRabbitMQConnection(t, server)
+
+	started := make(chan string, 1)
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		conn.Consume(ctx, "orders", func(_ context.Context, msg Message) error {
+			started <- string(msg.Body)
+			<-release
+
+			return nil
+		}, WithShutdownTimeout(50*time.Millisecond))
+	}()
+
+	require.Eventually(t, func() bool { return server.consumers("orders") == 1 }, 5*time.Second, time.Millisecond)
+	require.NoError(t, conn.Produce(context.Background(), "order.created", []byte("stuck")))
+	assert.Equal(t, "stuck", receive(t, started))
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Consume didn't return once the shutdown timeout was reached")
+	}
+
+	// closing the channel gives the unacked message back to the broker
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"stuck"}, server.ready("orders"))
+	}, 5*time.Second, time.Millisecond)
+}
+
+func TestRabbitMQConnection_ConsumePanic(t *testing.T) {
+	server := newFakeAMQPServer(t)
+
+	var (
+		mu        sync.Mutex
+		recovered []any
+		received  []string
+	)
+
+	conn := newTestRabbitMQConnection(t, server, WithDeferPanicHandler(func(queue string) {
+		if r := recover(); r != nil {
+			mu.Lock()
+			defer mu.Unlock()
+
+			recovered = append(recovered, fmt.Sprintf("%s: %v", queue, r))
+		}
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		conn.Consume(ctx, "orders", func(_ context.Context, msg Message) error {
+			if string(msg.Body) == "account-1-0" {
+				panic("boom")
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			received = append(received, string(msg.Body))
+
+			return nil
+		}, WithConcurrency(2), WithOrderingKey("account"))
+	}()
+
+	require.Eventually(t, func() bool { return server.consumers("orders") == 1 }, 5*time.Second, time.Millisecond)
+
+	for i := range 3 {
+		for _, account := range []string{"account-1", "account-2"} {
+			require.NoError(t, conn.Produce(context.Background(), "order.created", Message{
+				Headers: map[string]any{"account": account},
+				Body:    []byte(fmt.Sprintf("%s-%d", account, i)),
+			}))
+		}
+	}
+
+	// the worker owning account-1 keeps consuming its partition after the panic
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return len(received) == 5
+	}, 5*time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, []any{"orders: boom"}, recovered)
+	assert.Subset(t, received, []string{"account-1-1", "account-1-2", "account-2-0", "account-2-1", "account-2-2"})
+	// the panicking message was nacked without requeueing
+	assert.Empty(t, server.ready("orders"))
+}
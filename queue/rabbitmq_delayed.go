@@ -0,0 +1,355 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DelayStrategy selects how the broker holds delayed messages.
+type DelayStrategy string
+
+const (
+	// DelayStagingQueue holds messages in a "<exchange>.delay.<ms>" queue per delay, which dead-letters
+	// them to the exchange once their TTL expires. It's the default, no plugin is required. Delays of
+	// a minute or more are first held by a "<exchange>.delay.<ms>.remainder" queue of the delay
+	// truncated to the minute, or to the quarter hour above an hour, then by the queue of the
+	// remainder, so close delays share their queues. Messages are delivered up to a second late.
+	DelayStagingQueue DelayStrategy = "staging"
+	// DelayPluginExchange publishes to a "<exchange>.delayed" exchange of the rabbitmq_delayed_message_exchange
+	// plugin, bound to the exchange.
+	DelayPluginExchange DelayStrategy = "plugin"
+)
+
+const (
+	// brokerDelayLimit is the largest TTL or x-delay accepted by the broker (2^32-1 ms, ~49 days).
+	brokerDelayLimit = (1<<32 - 1) * time.Millisecond
+	// stagingQueueExpiry keeps staging queues after their last message expires, they're redeclared on publish.
+	stagingQueueExpiry       = time.Hour
+	defaultSchedulerInterval = 10 * time.Second
+	schedulerBatchSize       = 100
+	// delayRemainderHeader routes messages leaving a staging queue to the staging queue of their remainder.
+	delayRemainderHeader = "delay-remainder"
+)
+
+var ErrUnknownDelayStrategy = errors.New("unknown delay strategy")
+
+// ProduceAt publishes msg to be delivered at t, up to a second late with DelayStagingQueue. See ProduceDelayed.
+func (r *RabbitMQConnection) ProduceAt(ctx context.Context, routingKey string, msg any, t time.Time) error {
+	return r.ProduceDelayed(ctx, routingKey, msg, time.Until(t))
+}
+
+// ProduceDelayed publishes msg to be delivered after delay, held by the broker using the configured
+// DelayStrategy, up to a second late with DelayStagingQueue. Delays longer than the broker limit, or
+// messages the broker can't take, are kept by the gorm fallback scheduler, see RunScheduler.
+func (r *RabbitMQConnection) ProduceDelayed(
+	ctx context.Context,
+	routingKey string,
+	msg any,
+	delay time.Duration,
+) (err error) {
+	if delay <= 0 {
+		return r.Produce(ctx, routingKey, msg)
+	}
+
+	message, err := buildMessage(msg)
+	if err != nil {
+		return errors.Wrap(err, "build message")
+	}
+
+	if r.schemaRegistry != nil {
+		if err := r.schemaRegistry.PrepareOutgoing(routingKey, &message); err != nil {
+			return errors.Wrap(err, "validate message schema")
+		}
+	}
+
+	ctx, span := r.startProduceSpan(ctx, routingKey, message.Headers, message.Body)
+	defer func() { finishSpan(span, err) }()
+
+	deliverAt := time.Now().Add(delay)
+
+	if delay > r.maxBrokerDelay {
+		return r.handleScheduleFallback(ctx, routingKey, &message, deliverAt)
+	}
+
+	_, err = r.breaker.Execute(func() (any, error) {
+		return nil, r.publishDelayed(ctx, routingKey, message, delay)
+	})
+	if err != nil {
+		if errors.Is(err, ErrUnknownDelayStrategy) {
+			return err
+		}
+
+		return r.handleScheduleFallback(ctx, routingKey, &message, deliverAt)
+	}
+
+	r.metrics.MessageProduced(routingKey)
+
+	return nil
+}
+
+func (r *RabbitMQConnection) publishDelayed(ctx context.Context, routingKey string, message Message, delay time.Duration) error {
+	return r.withChannel(func(channel *amqp.Channel) error {
+		publishing := newPublishing(message)
+
+		var exchange string
+
+		switch r.config.DelayStrategy {
+		case DelayStagingQueue, "":
+			staged, remainder := stagingDelays(delay)
+
+			if staged < time.Minute {
+				name, err := r.declareStagingQueue(channel, r.stagingName(staged), staged, r.config.Exchange)
+				if err != nil {
+					return err
+				}
+
+				exchange = name
+
+				break
+			}
+
+			name, err := r.declareRemainderStaging(channel, staged, remainder)
+			if err != nil {
+				return err
+			}
+
+			exchange = name
+			publishing.Headers = cloneHeaders(publishing.Headers)
+			publishing.Headers[delayRemainderHeader] = remainder.Milliseconds()
+
+		case DelayPluginExchange:
+			name, err := r.declareDelayedExchange(channel)
+			if err != nil {
+				return err
+			}
+
+			exchange = name
+			publishing.Headers = cloneHeaders(publishing.Headers)
+			publishing.Headers["x-delay"] = delay.Milliseconds()
+
+		default:
+			return errors.Wrap(ErrUnknownDelayStrategy, string(r.config.DelayStrategy))
+		}
+
+		pubCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+		defer cancel()
+
+		return channel.PublishWithContext(pubCtx, exchange, routingKey, false, false, publishing)
+	})
+}
+
+// stagingDelays splits delay between the staging queues holding the message: under a minute it's
+// rounded up to the second and held by a single queue, otherwise it's truncated to the minute, or to
+// the quarter hour above an hour, and the remainder is rounded up to the second.
+func stagingDelays(delay time.Duration) (staged time.Duration, remainder time.Duration) {
+	resolution := 15 * time.Minute
+
+	switch {
+	case delay < time.Minute:
+		return roundUp(delay, time.Second), 0
+	case delay < time.Hour:
+		resolution = time.Minute
+	}
+
+	staged = delay.Truncate(resolution)
+
+	return staged, roundUp(delay-staged, time.Second)
+}
+
+func roundUp(delay time.Duration, resolution time.Duration) time.Duration {
+	if rounded := delay.Truncate(resolution); rounded < delay {
+		return rounded + resolution
+	}
+
+	return delay
+}
+
+func (r *RabbitMQConnection) stagingName(delay time.Duration) string {
+	return fmt.Sprintf("%s.delay.%d", r.config.Exchange, delay.Milliseconds())
+}
+
+// declareRemainderStaging declares the queue holding the staged part of a delay. It dead-letters to
+// the "<exchange>.delay.remainder" headers exchange, which routes the messages by their remainder
+// header to the staging queue of the remainder, or straight to the exchange when there's none.
+func (r *RabbitMQConnection) declareRemainderStaging(
+	channel *amqp.Channel,
+	staged time.Duration,
+	remainder time.Duration,
+) (string, error) {
+	remainderExchange := r.config.Exchange + ".delay.remainder"
+
+	if err := channel.ExchangeDeclare(remainderExchange, amqp.ExchangeHeaders, true, false, false, false, nil); err != nil {
+		return "", errors.Wrap(err, "declare remainder exchange")
+	}
+
+	destination := r.config.Exchange
+
+	if remainder > 0 {
+		name, err := r.declareStagingQueue(channel, r.stagingName(remainder), remainder, r.config.Exchange)
+		if err != nil {
+			return "", err
+		}
+
+		destination = name
+	}
+
+	err := channel.ExchangeBind(destination, "", remainderExchange, false, amqp.Table{
+		"x-match":            "all",
+		delayRemainderHeader: remainder.Milliseconds(),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "bind remainder exchange")
+	}
+
+	return r.declareStagingQueue(channel, r.stagingName(staged)+".remainder", staged, remainderExchange)
+}
+
+// declareStagingQueue declares the fanout exchange and the queue holding the messages for delay,
+// dead-lettering them to deadLetterExchange. Dead-lettering keeps the routing key, so the messages
+// are routed as if published to the exchange.
+func (r *RabbitMQConnection) declareStagingQueue(
+	channel *amqp.Channel,
+	name string,
+	delay time.Duration,
+	deadLetterExchange string,
+) (string, error) {
+	if err := channel.ExchangeDeclare(name, amqp.ExchangeFanout, true, false, false, false, nil); err != nil {
+		return "", errors.Wrap(err, "declare staging exchange")
+	}
+
+	_, err := channel.QueueDeclare(name, true, false, false, false, amqp.Table{
+		"x-message-ttl":          delay.Milliseconds(),
+		"x-dead-letter-exchange": deadLetterExchange,
+		"x-expires":              (delay + stagingQueueExpiry).Milliseconds(),
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "declare staging queue")
+	}
+
+	if err := channel.QueueBind(name, "", name, false, nil); err != nil {
+		return "", errors.Wrap(err, "bind staging queue")
+	}
+
+	return name, nil
+}
+
+func (r *RabbitMQConnection) declareDelayedExchange(channel *amqp.Channel) (string, error) {
+	name := r.config.Exchange + ".delayed"
+
+	err := channel.ExchangeDeclare(name, "x-delayed-message", true, false, false, false, amqp.Table{
+		"x-delayed-type": amqp.ExchangeTopic,
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "declare delayed exchange")
+	}
+
+	if err := channel.ExchangeBind(r.config.Exchange, "#", name, false, nil); err != nil {
+		return "", errors.Wrap(err, "bind delayed exchange")
+	}
+
+	return name, nil
+}
+
+func (r *RabbitMQConnection) handleScheduleFallback(
+	ctx context.Context,
+	routingKey string,
+	msg *Message,
+	deliverAt time.Time,
+) error {
+	if r.databaseFallback == nil {
+		return errors.New("database fallback not initialized and the message can't be delayed by rabbitmq")
+	}
+
+	if err := r.databaseFallback.schedule(ctx, routingKey, msg, deliverAt); err != nil {
+		return err
+	}
+
+	r.metrics.FallbackWritten(routingKey)
+
+	return nil
+}
+
+// RunScheduler hands the messages kept by the gorm fallback scheduler to the broker once their
+// delay is within the broker limit, until ctx is cancelled. Rows are locked while they're
+// published, so it's safe to run in every instance. The scheduled_queue_messages table is created
+// by GormFallback.Migrate.
+func (r *RabbitMQConnection) RunScheduler(ctx context.Context, interval time.Duration) {
+	if r.databaseFallback == nil {
+		r.logger.WithContext(ctx).Warn("database fallback not initialized – scheduler not started")
+
+		return
+	}
+
+	if interval <= 0 {
+		interval = defaultSchedulerInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for {
+			released, err := r.releaseScheduled(ctx)
+			if err != nil {
+				r.logger.WithContext(ctx).Error("release scheduled messages", err)
+			}
+
+			if err != nil || released < schedulerBatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *RabbitMQConnection) releaseScheduled(ctx context.Context) (int, error) {
+	return r.databaseFallback.releaseScheduled(
+		ctx,
+		time.Now().Add(r.maxBrokerDelay),
+		schedulerBatchSize,
+		func(model GormScheduledMessageModel) error {
+			message, err := model.message()
+			if err != nil {
+				return err
+			}
+
+			delay := time.Until(model.DeliverAt)
+
+			_, err = r.breaker.Execute(func() (any, error) {
+				if delay <= 0 {
+					return nil, r.withChannel(func(channel *amqp.Channel) error {
+						pubCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+						defer cancel()
+
+						return channel.PublishWithContext(
+							pubCtx,
+							r.config.Exchange,
+							model.RoutingKey,
+							false,
+							false,
+							newPublishing(message),
+						)
+					})
+				}
+
+				return nil, r.publishDelayed(ctx, model.RoutingKey, message, delay)
+			})
+			if err != nil {
+				return err
+			}
+
+			r.metrics.MessageProduced(model.RoutingKey)
+
+			return nil
+		},
+	)
+}
@@ -0,0 +1,166 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func Test_stagingDelays(t *testing.T) {
+	tests := []struct {
+		delay         time.Duration
+		wantStaged    time.Duration
+		wantRemainder time.Duration
+	}{
+		{delay: 10 * time.Millisecond, wantStaged: time.Second},
+		{delay: 1500 * time.Millisecond, wantStaged: 2 * time.Second},
+		{delay: 61 * time.Second, wantStaged: time.Minute, wantRemainder: time.Second},
+		{delay: 30 * time.Minute, wantStaged: 30 * time.Minute},
+		{delay: 30*time.Minute + 1500*time.Millisecond, wantStaged: 30 * time.Minute, wantRemainder: 2 * time.Second},
+		{delay: 61 * time.Minute, wantStaged: time.Hour, wantRemainder: time.Minute},
+		{delay: 25*time.Hour + 14*time.Minute + 59*time.Second, wantStaged: 25 * time.Hour, wantRemainder: 14*time.Minute + 59*time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.delay.String(), func(t *testing.T) {
+			staged, remainder := stagingDelays(tt.delay)
+			assert.Equal(t, tt.wantStaged, staged)
+			assert.Equal(t, tt.wantRemainder, remainder)
+			// it's never early, and at most a second late
+			assert.GreaterOrEqual(t, staged+remainder, tt.delay)
+			assert.Less(t, staged+remainder-tt.delay, time.Second)
+		})
+	}
+}
+
+func TestRabbitMQConnection_ProduceDelayed(t *testing.T) {
+	tests := []struct {
+		name     string
+		strategy DelayStrategy
+		delay    time.Duration
+		exchange string
+		wantErr  error
+	}{
+		{name: "staging queue", strategy: DelayStagingQueue, delay: 30 * time.Second, exchange: "events.delay.30000"},
+		{name: "default strategy", delay: 90 * time.Second, exchange: "events.delay.60000.remainder"},
+		{name: "plugin exchange", strategy: DelayPluginExchange, delay: 30 * time.Minute, exchange: "events.delayed"},
+		{name: "no delay", strategy: DelayPluginExchange, exchange: "events"},
+		{name: "unknown strategy", strategy: "wheel", delay: time.Minute, wantErr: ErrUnknownDelayStrategy},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeAMQPServer(t)
+			conn := newTestRabbitMQConnection(t, server)
+			conn.config.DelayStrategy = tt.strategy
+
+			err := conn.ProduceDelayed(context.Background(), "order.reminder", []byte(`{}`), tt.delay)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+
+			assert.NoError(t, err)
+			// publishes aren't confirmed, wait for the server to read it
+			assert.Eventually(t, func() bool {
+				return assert.ObjectsAreEqual([]string{"order.reminder"}, server.publishedTo(tt.exchange))
+			}, time.Second, time.Millisecond)
+		})
+	}
+}
+
+func TestRabbitMQConnection_ProduceDelayed_Remainder(t *testing.T) {
+	server := newFakeAMQPServer(t)
+	conn := newTestRabbitMQConnection(t, server)
+
+	require.NoError(t, conn.ProduceDelayed(context.Background(), "order.reminder", []byte(`{}`), 61*time.Minute+1500*time.Millisecond))
+	require.NoError(t, conn.ProduceDelayed(context.Background(), "order.reminder", []byte(`{}`), time.Hour))
+
+	assert.Eventually(t, func() bool {
+		return len(server.publishedTo("events.delay.3600000.remainder")) == 2
+	}, time.Second, time.Millisecond)
+
+	// the remainder rides along, rounded up to the second
+	headers := server.publishedHeaders("events.delay.3600000.remainder")
+	assert.Equal(t, int64(62000), headers[0][delayRemainderHeader])
+	assert.Equal(t, int64(0), headers[1][delayRemainderHeader])
+
+	// the staged queue hands the message to the remainder exchange
+	args := server.queueArgs("events.delay.3600000.remainder")
+	assert.Equal(t, int64(3600000), args["x-message-ttl"])
+	assert.Equal(t, "events.delay.remainder", args["x-dead-letter-exchange"])
+
+	// which routes it to the queue holding the remainder, or straight to the exchange
+	assert.Equal(t, []map[string]any{{"x-match": "all", delayRemainderHeader: int64(62000)}},
+		server.boundExchanges("events.delay.remainder", "events.delay.62000"))
+	assert.Equal(t, []map[string]any{{"x-match": "all", delayRemainderHeader: int64(0)}},
+		server.boundExchanges("events.delay.remainder", "events"))
+
+	args = server.queueArgs("events.delay.62000")
+	assert.Equal(t, int64(62000), args["x-message-ttl"])
+	assert.Equal(t, "events", args["x-dead-letter-exchange"])
+}
+
+func TestRabbitMQConnection_ProduceDelayed_OverBrokerLimit(t *testing.T) {
+	server := newFakeAMQPServer(t)
+	conn := newTestRabbitMQConnection(t, server, WithMaxBrokerDelay(time.Hour))
+
+	// without a gorm fallback there's nowhere to keep it
+	err := conn.ProduceAt(context.Background(), "order.reminder", []byte(`{}`), time.Now().Add(2*time.Hour))
+	assert.Error(t, err)
+	assert.Empty(t, server.publishedTo("events.delay.7200000"))
+}
+
+func TestRabbitMQConnection_RunScheduler(t *testing.T) {
+	server := newFakeAMQPServer(t)
+	fallback := newTestGormFallback(t, &GormFallbackProducerModel{}, &GormScheduledMessageModel{})
+	conn := newTestRabbitMQConnection(t, server, WithGormDatabaseFallback(fallback), WithMaxBrokerDelay(time.Hour))
+
+	now := time.Now()
+	newTestScheduledMessages(t, fallback, now.Add(-time.Minute), now.Add(30*time.Minute), now.Add(2*time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		conn.RunScheduler(ctx, 10*time.Millisecond)
+	}()
+
+	// the due message is published right away, the one within the broker limit is delayed by the
+	// broker, staged by the 29 whole minutes it's still due in, and the other one waits in the table
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"reminder-3"}, scheduledMessageIDs(t, fallback))
+	}, 5*time.Second, time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return len(server.publishedTo("events")) == 1 && len(server.publishedTo("events.delay.1740000.remainder")) == 1
+	}, 5*time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestRabbitMQConnection_RunSchedulerPublishFailure(t *testing.T) {
+	fallback := newTestGormFallback(t, &GormFallbackProducerModel{}, &GormScheduledMessageModel{})
+	// never connected: publishing fails
+	conn := NewRabbitMQConnection(
+		Config{Exchange: "events"},
+		WithLogger(log.NewMockLoggerI(gomock.NewController(t))),
+		WithGormDatabaseFallback(fallback),
+	)
+
+	newTestScheduledMessages(t, fallback, time.Now().Add(-time.Minute))
+
+	released, err := conn.releaseScheduled(context.Background())
+	assert.ErrorIs(t, err, ErrConnectionClosed)
+	assert.Zero(t, released)
+	assert.Equal(t, []string{"reminder-1"}, scheduledMessageIDs(t, fallback))
+}
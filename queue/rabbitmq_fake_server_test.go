@@ -0,0 +1,1131 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+)
+
+// fakeAMQPServer speaks just enough AMQP 0-9-1 to run the RabbitMQ adapter against it: channels,
+// declares, binds, publishes (confirmed or not, returned when unroutable), consumers, gets, acks
+// and nacks. Exchanges are topic. Stream queues keep every message and start consumers at their
+// x-stream-offset.
+type fakeAMQPServer struct {
+	listener net.Listener
+
+	mu               sync.Mutex
+	conns            map[*fakeAMQPConn]struct{}
+	queues           map[string]*fakeAMQPQueue
+	bindings         []fakeAMQPBinding
+	exchangeBindings []fakeAMQPExchangeBinding
+	channelOpens     int
+	nextQueue        int
+	published        []fakeAMQPMessage
+}
+
+type fakeAMQPBinding struct {
+	exchange   string
+	routingKey string
+	queue      string
+}
+
+// fakeAMQPExchangeBinding is only recorded, messages aren't routed through it.
+type fakeAMQPExchangeBinding struct {
+	destination string
+	source      string
+	args        map[string]any
+}
+
+type fakeAMQPQueue struct {
+	name       string
+	args       map[string]any
+	autoDelete bool
+	owner      *fakeAMQPConn
+	messages   []*fakeAMQPMessage
+	consumers  []*fakeAMQPConsumer
+	next       int
+	// maxLength drops the oldest messages, as x-overflow=drop-head does
+	maxLength int
+	// stream queues append to log instead of messages
+	stream bool
+	log    []*fakeAMQPMessage
+}
+
+type fakeAMQPMessage struct {
+	exchange    string
+	routingKey  string
+	properties  []byte
+	body        []byte
+	redelivered bool
+	// mandatory messages routed to no queue are returned to the publisher
+	mandatory bool
+}
+
+type fakeAMQPConsumer struct {
+	channel *fakeAMQPChannel
+	tag     string
+	queue   string
+	noAck   bool
+	// offset is the next stream message delivered to the consumer
+	offset int
+}
+
+type fakeAMQPConn struct {
+	server *fakeAMQPServer
+	conn   net.Conn
+
+	writeMu sync.Mutex
+	once    sync.Once
+
+	// guarded by server.mu
+	channels map[uint16]*fakeAMQPChannel
+}
+
+type fakeAMQPChannel struct {
+	conn      *fakeAMQPConn
+	id        uint16
+	confirm   bool
+	published uint64
+	delivered uint64
+	unacked   map[uint64]fakeAMQPUnacked
+	consumers map[string]*fakeAMQPConsumer
+	// replyTo is the queue of the direct reply-to consumer of the channel
+	replyTo string
+
+	// publish being assembled from its content frames
+	pending  *fakeAMQPMessage
+	bodySize uint64
+}
+
+type fakeAMQPUnacked struct {
+	queue   string
+	message *fakeAMQPMessage
+}
+
+// fakeAMQPDelivery is written after the server lock is released.
+type fakeAMQPDelivery struct {
+	channel *fakeAMQPChannel
+	tag     string
+	id      uint64
+	message *fakeAMQPMessage
+}
+
+func newFakeAMQPServer(t *testing.T) *fakeAMQPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &fakeAMQPServer{
+		listener: listener,
+		conns:    make(map[*fakeAMQPConn]struct{}),
+		queues:   make(map[string]*fakeAMQPQueue),
+	}
+
+	go server.accept()
+
+	t.Cleanup(func() {
+		_ = listener.Close()
+		server.dropConnections()
+	})
+
+	return server
+}
+
+func (s *fakeAMQPServer) URL() string {
+	return "amqp://guest:guest@" + s.listener.Addr().String() + "/"
+}
+
+// dropConnections closes every client connection, as a broker restart would.
+func (s *fakeAMQPServer) dropConnections() {
+	s.mu.Lock()
+	conns := make([]*fakeAMQPConn, 0, len(s.conns))
+	for conn := range s.conns {
+		conns = append(conns, conn)
+	}
+	s.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.close()
+	}
+}
+
+func (s *fakeAMQPServer) consumers(queue string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if q, ok := s.queues[queue]; ok {
+		return len(q.consumers)
+	}
+
+	return 0
+}
+
+// ready returns the bodies of the messages of queue waiting for a consumer.
+func (s *fakeAMQPServer) ready(queue string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var bodies []string
+
+	if q, ok := s.queues[queue]; ok {
+		for _, message := range q.messages {
+			bodies = append(bodies, string(message.body))
+		}
+	}
+
+	return bodies
+}
+
+// streamLength returns how many messages were appended to the stream queue.
+func (s *fakeAMQPServer) streamLength(queue string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if q, ok := s.queues[queue]; ok {
+		return len(q.log)
+	}
+
+	return 0
+}
+
+// boundConsumers counts the consumers of the queues bound to routingKey.
+func (s *fakeAMQPServer) boundConsumers(routingKey string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int
+
+	for _, binding := range s.bindings {
+		if q, ok := s.queues[binding.queue]; ok && binding.routingKey == routingKey {
+			count += len(q.consumers)
+		}
+	}
+
+	return count
+}
+
+// publishedTo returns the routing keys of the messages published to exchange.
+func (s *fakeAMQPServer) publishedTo(exchange string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var routingKeys []string
+
+	for _, message := range s.published {
+		if message.exchange == exchange {
+			routingKeys = append(routingKeys, message.routingKey)
+		}
+	}
+
+	return routingKeys
+}
+
+// queueArgs returns the arguments queue was declared with.
+func (s *fakeAMQPServer) queueArgs(queue string) map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if q, ok := s.queues[queue]; ok {
+		return q.args
+	}
+
+	return nil
+}
+
+// boundExchanges returns the arguments of the bindings from source to destination.
+func (s *fakeAMQPServer) boundExchanges(source string, destination string) []map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var args []map[string]any
+
+	for _, binding := range s.exchangeBindings {
+		if binding.source == source && binding.destination == destination {
+			args = append(args, binding.args)
+		}
+	}
+
+	return args
+}
+
+// publishedHeaders returns the headers of the messages published to exchange.
+func (s *fakeAMQPServer) publishedHeaders(exchange string) []map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var headers []map[string]any
+
+	for _, message := range s.published {
+		if message.exchange != exchange {
+			continue
+		}
+
+		r := &fakeAMQPReader{buf: message.properties}
+		flags := r.short()
+
+		if flags&(1<<15) != 0 { // content-type
+			r.shortstr()
+		}
+
+		if flags&(1<<14) != 0 { // content-encoding
+			r.shortstr()
+		}
+
+		if flags&(1<<13) == 0 { // headers
+			headers = append(headers, nil)
+
+			continue
+		}
+
+		headers = append(headers, r.table())
+	}
+
+	return headers
+}
+
+func (s *fakeAMQPServer) openedChannels() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.channelOpens
+}
+
+func (s *fakeAMQPServer) accept() {
+	for {
+		netConn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		conn := &fakeAMQPConn{server: s, conn: netConn, channels: make(map[uint16]*fakeAMQPChannel)}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		go conn.serve()
+	}
+}
+
+// close drops the connection, requeueing its unacked messages and deleting its auto-delete queues.
+func (c *fakeAMQPConn) close() {
+	c.once.Do(func() {
+		_ = c.conn.Close()
+
+		s := c.server
+		s.mu.Lock()
+
+		delete(s.conns, c)
+
+		for _, channel := range c.channels {
+			s.closeChannel(channel)
+		}
+
+		for name, q := range s.queues {
+			if q.owner == c {
+				delete(s.queues, name)
+			}
+		}
+
+		deliveries := s.dispatchAll()
+		s.mu.Unlock()
+
+		s.deliver(deliveries)
+	})
+}
+
+func (c *fakeAMQPConn) serve() {
+	defer c.close()
+
+	reader := bufio.NewReader(c.conn)
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return
+	}
+
+	// connection.start: version 0-9, no server properties
+	c.writeMethod(0, 10, 10, func(w *fakeAMQPWriter) {
+		w.octet(0)
+		w.octet(9)
+		w.long(0)
+		w.longstr("PLAIN")
+		w.longstr("en_US")
+	})
+
+	for {
+		frameType, channelID, payload, err := readFakeAMQPFrame(reader)
+		if err != nil {
+			return
+		}
+
+		if !c.handleFrame(frameType, channelID, payload) {
+			return
+		}
+	}
+}
+
+func (c *fakeAMQPConn) handleFrame(frameType byte, channelID uint16, payload []byte) bool {
+	switch frameType {
+	case 1: // method
+		r := &fakeAMQPReader{buf: payload}
+
+		return c.handleMethod(channelID, r.short(), r.short(), r)
+
+	case 2: // content header
+		r := &fakeAMQPReader{buf: payload}
+		r.short() // class
+		r.short() // weight
+		size := r.longlong()
+
+		c.server.mu.Lock()
+		channel := c.channels[channelID]
+		channel.pending.properties = append([]byte(nil), r.rest()...)
+		channel.bodySize = size
+		c.server.mu.Unlock()
+
+		if size == 0 {
+			c.publish(channelID)
+		}
+
+	case 3: // content body
+		c.server.mu.Lock()
+		channel := c.channels[channelID]
+		channel.pending.body = append(channel.pending.body, payload...)
+		complete := uint64(len(channel.pending.body)) >= channel.bodySize
+		c.server.mu.Unlock()
+
+		if complete {
+			c.publish(channelID)
+		}
+	}
+
+	return true
+}
+
+//nolint:cyclop,funlen
+func (c *fakeAMQPConn) handleMethod(channelID uint16, class uint16, method uint16, r *fakeAMQPReader) bool {
+	s := c.server
+
+	switch {
+	case class == 10 && method == 11: // connection.start-ok
+		c.writeMethod(0, 10, 30, func(w *fakeAMQPWriter) {
+			w.short(2047)
+			w.long(131072)
+			w.short(0)
+		})
+
+	case class == 10 && method == 31: // connection.tune-ok
+
+	case class == 10 && method == 40: // connection.open
+		c.writeMethod(0, 10, 41, func(w *fakeAMQPWriter) { w.shortstr("") })
+
+	case class == 10 && method == 50: // connection.close
+		c.writeMethod(0, 10, 51, nil)
+
+		return false
+
+	case class == 20 && method == 10: // channel.open
+		s.mu.Lock()
+		s.channelOpens++
+		c.channels[channelID] = &fakeAMQPChannel{
+			conn:      c,
+			id:        channelID,
+			unacked:   make(map[uint64]fakeAMQPUnacked),
+			consumers: make(map[string]*fakeAMQPConsumer),
+		}
+		s.mu.Unlock()
+
+		c.writeMethod(channelID, 20, 11, func(w *fakeAMQPWriter) { w.longstr("") })
+
+	case class == 20 && method == 40: // channel.close
+		s.mu.Lock()
+		if channel, ok := c.channels[channelID]; ok {
+			s.closeChannel(channel)
+			delete(c.channels, channelID)
+		}
+		deliveries := s.dispatchAll()
+		s.mu.Unlock()
+
+		c.writeMethod(channelID, 20, 41, nil)
+		s.deliver(deliveries)
+
+	case class == 40 && method == 10: // exchange.declare
+		c.writeMethod(channelID, 40, 11, nil)
+
+	case class == 40 && method == 30: // exchange.bind
+		r.short()
+		destination, source := r.shortstr(), r.shortstr()
+		r.shortstr()
+		r.octet()
+		args := r.table()
+
+		s.mu.Lock()
+		s.exchangeBindings = append(s.exchangeBindings, fakeAMQPExchangeBinding{destination: destination, source: source, args: args})
+		s.mu.Unlock()
+
+		c.writeMethod(channelID, 40, 31, nil)
+
+	case class == 50 && method == 10: // queue.declare
+		r.short()
+		name := r.shortstr()
+		bits := r.octet()
+		args := r.table()
+
+		s.mu.Lock()
+		if name == "" {
+			s.nextQueue++
+			name = fmt.Sprintf("amq.gen-%d", s.nextQueue)
+		}
+
+		q, ok := s.queues[name]
+		if !ok {
+			q = &fakeAMQPQueue{name: name, args: args, autoDelete: bits&(1<<3) != 0, stream: args["x-queue-type"] == "stream"}
+			if q.autoDelete || bits&(1<<2) != 0 {
+				q.owner = c
+			}
+
+			if maxLength, ok := args["x-max-length"].(int32); ok {
+				q.maxLength = int(maxLength)
+			}
+
+			s.queues[name] = q
+		}
+
+		messages, consumers := len(q.messages), len(q.consumers)
+		s.mu.Unlock()
+
+		c.writeMethod(channelID, 50, 11, func(w *fakeAMQPWriter) {
+			w.shortstr(name)
+			w.long(uint32(messages))  //nolint:gosec
+			w.long(uint32(consumers)) //nolint:gosec
+		})
+
+	case class == 50 && method == 20: // queue.bind
+		r.short()
+		queue, exchange, routingKey := r.shortstr(), r.shortstr(), r.shortstr()
+
+		s.mu.Lock()
+		s.bindings = append(s.bindings, fakeAMQPBinding{exchange: exchange, routingKey: routingKey, queue: queue})
+		s.mu.Unlock()
+
+		c.writeMethod(channelID, 50, 21, nil)
+
+	case class == 60 && method == 10: // basic.qos
+		c.writeMethod(channelID, 60, 11, nil)
+
+	case class == 60 && method == 20: // basic.consume
+		r.short()
+		queue, tag := r.shortstr(), r.shortstr()
+		noAck := r.octet()&0b10 != 0
+		args := r.table()
+
+		s.mu.Lock()
+		channel := c.channels[channelID]
+
+		// direct reply-to: replies are routed to a queue private to the channel
+		if queue == directReplyTo {
+			s.nextQueue++
+			queue = fmt.Sprintf("%s.%d", directReplyTo, s.nextQueue)
+			channel.replyTo = queue
+		}
+
+		q, ok := s.queues[queue]
+		if !ok {
+			q = &fakeAMQPQueue{name: queue}
+			s.queues[queue] = q
+		}
+
+		if queue == channel.replyTo {
+			q.owner = c
+		}
+
+		if tag == "" {
+			tag = fmt.Sprintf("ctag-%d", len(channel.consumers)+1)
+		}
+
+		consumer := &fakeAMQPConsumer{channel: channel, tag: tag, queue: queue, noAck: noAck}
+
+		switch offset := args["x-stream-offset"].(type) {
+		case int64:
+			consumer.offset = int(offset)
+		case string:
+			if offset != "first" {
+				consumer.offset = len(q.log)
+			}
+		default:
+			consumer.offset = len(q.log)
+		}
+
+		channel.consumers[tag] = consumer
+		q.consumers = append(q.consumers, consumer)
+		s.mu.Unlock()
+
+		c.writeMethod(channelID, 60, 21, func(w *fakeAMQPWriter) { w.shortstr(tag) })
+
+		s.mu.Lock()
+		deliveries := s.dispatchAll()
+		s.mu.Unlock()
+		s.deliver(deliveries)
+
+	case class == 60 && method == 30: // basic.cancel
+		tag := r.shortstr()
+
+		s.mu.Lock()
+		if channel, ok := c.channels[channelID]; ok {
+			if consumer, ok := channel.consumers[tag]; ok {
+				s.removeConsumer(consumer)
+				delete(channel.consumers, tag)
+			}
+		}
+		s.mu.Unlock()
+
+		c.writeMethod(channelID, 60, 31, func(w *fakeAMQPWriter) { w.shortstr(tag) })
+
+	case class == 60 && method == 70: // basic.get
+		r.short()
+		queue := r.shortstr()
+		noAck := r.octet()&1 != 0
+
+		s.mu.Lock()
+		var (
+			message *fakeAMQPMessage
+			tag     uint64
+			count   int
+		)
+
+		if q, ok := s.queues[queue]; ok && len(q.messages) > 0 {
+			message = q.messages[0]
+			q.messages = q.messages[1:]
+			count = len(q.messages)
+
+			channel := c.channels[channelID]
+			channel.delivered++
+			tag = channel.delivered
+
+			if !noAck {
+				channel.unacked[tag] = fakeAMQPUnacked{queue: queue, message: message}
+			}
+		}
+		s.mu.Unlock()
+
+		if message == nil {
+			c.writeMethod(channelID, 60, 72, func(w *fakeAMQPWriter) { w.shortstr("") })
+
+			break
+		}
+
+		c.writeMethod(channelID, 60, 71, func(w *fakeAMQPWriter) {
+			w.longlong(tag)
+
+			if message.redelivered {
+				w.octet(1)
+			} else {
+				w.octet(0)
+			}
+
+			w.shortstr(message.exchange)
+			w.shortstr(message.routingKey)
+			w.long(uint32(count)) //nolint:gosec
+		}, message)
+
+	case class == 60 && method == 40: // basic.publish
+		r.short()
+		exchange, routingKey := r.shortstr(), r.shortstr()
+		mandatory := r.octet()&1 != 0
+
+		s.mu.Lock()
+		c.channels[channelID].pending = &fakeAMQPMessage{exchange: exchange, routingKey: routingKey, mandatory: mandatory}
+		s.mu.Unlock()
+
+	case class == 60 && method == 80: // basic.ack
+		tag := r.longlong()
+
+		s.mu.Lock()
+		delete(c.channels[channelID].unacked, tag)
+		s.mu.Unlock()
+
+	case class == 60 && (method == 90 || method == 120): // basic.reject, basic.nack
+		tag := r.longlong()
+		bits := r.octet()
+		requeue := bits&1 != 0
+
+		if method == 120 {
+			requeue = bits&0b10 != 0
+		}
+
+		s.mu.Lock()
+		channel := c.channels[channelID]
+		if unacked, ok := channel.unacked[tag]; ok && requeue {
+			s.requeue(unacked)
+		}
+		delete(channel.unacked, tag)
+		deliveries := s.dispatchAll()
+		s.mu.Unlock()
+
+		s.deliver(deliveries)
+
+	case class == 85 && method == 10: // confirm.select
+		s.mu.Lock()
+		c.channels[channelID].confirm = true
+		s.mu.Unlock()
+
+		c.writeMethod(channelID, 85, 11, nil)
+	}
+
+	return true
+}
+
+func (c *fakeAMQPConn) publish(channelID uint16) {
+	s := c.server
+
+	s.mu.Lock()
+	channel := c.channels[channelID]
+	message := channel.pending
+	channel.pending = nil
+
+	if channel.replyTo != "" {
+		message.properties = rewriteFakeAMQPReplyTo(message.properties, channel.replyTo)
+	}
+	s.published = append(s.published, *message)
+
+	var routed bool
+
+	if message.exchange == "" {
+		if q, ok := s.queues[message.routingKey]; ok {
+			q.enqueue(message)
+			routed = true
+		}
+	}
+
+	for _, binding := range s.bindings {
+		q, ok := s.queues[binding.queue]
+		if ok && binding.exchange == message.exchange && matchTopic(binding.routingKey, message.routingKey) {
+			copied := *message
+			q.enqueue(&copied)
+			routed = true
+		}
+	}
+
+	if channel.confirm {
+		channel.published++
+	}
+
+	confirm, tag := channel.confirm, channel.published
+	deliveries := s.dispatchAll()
+	s.mu.Unlock()
+
+	// the broker returns the message before confirming it
+	if message.mandatory && !routed {
+		c.writeMethod(channelID, 60, 50, func(w *fakeAMQPWriter) { // basic.return
+			w.short(312)
+			w.shortstr("NO_ROUTE")
+			w.shortstr(message.exchange)
+			w.shortstr(message.routingKey)
+		}, message)
+	}
+
+	if confirm {
+		c.writeMethod(channelID, 60, 80, func(w *fakeAMQPWriter) {
+			w.longlong(tag)
+			w.octet(0)
+		})
+	}
+
+	s.deliver(deliveries)
+}
+
+func (q *fakeAMQPQueue) enqueue(message *fakeAMQPMessage) {
+	if q.stream {
+		q.log = append(q.log, message)
+
+		return
+	}
+
+	q.messages = append(q.messages, message)
+
+	if q.maxLength > 0 && len(q.messages) > q.maxLength {
+		q.messages = q.messages[len(q.messages)-q.maxLength:]
+	}
+}
+
+// dispatchAll hands the ready messages to consumers in round-robin, stream messages are handed to
+// every consumer from its offset. It must hold s.mu.
+func (s *fakeAMQPServer) dispatchAll() []fakeAMQPDelivery {
+	var deliveries []fakeAMQPDelivery
+
+	for _, q := range s.queues {
+		if q.stream {
+			deliveries = append(deliveries, s.dispatchStream(q)...)
+
+			continue
+		}
+
+		for len(q.messages) > 0 && len(q.consumers) > 0 {
+			consumer := q.consumers[q.next%len(q.consumers)]
+			q.next++
+
+			message := q.messages[0]
+			q.messages = q.messages[1:]
+
+			channel := consumer.channel
+			channel.delivered++
+
+			if !consumer.noAck {
+				channel.unacked[channel.delivered] = fakeAMQPUnacked{queue: q.name, message: message}
+			}
+
+			deliveries = append(deliveries, fakeAMQPDelivery{
+				channel: channel,
+				tag:     consumer.tag,
+				id:      channel.delivered,
+				message: message,
+			})
+		}
+	}
+
+	return deliveries
+}
+
+// dispatchStream delivers the stream messages with their offset in the x-stream-offset header. It
+// must hold s.mu.
+func (s *fakeAMQPServer) dispatchStream(q *fakeAMQPQueue) []fakeAMQPDelivery {
+	var deliveries []fakeAMQPDelivery
+
+	for _, consumer := range q.consumers {
+		for ; consumer.offset < len(q.log); consumer.offset++ {
+			message := *q.log[consumer.offset]
+			message.properties = withFakeAMQPHeader(message.properties, "x-stream-offset", int64(consumer.offset))
+
+			channel := consumer.channel
+			channel.delivered++
+
+			if !consumer.noAck {
+				channel.unacked[channel.delivered] = fakeAMQPUnacked{queue: q.name, message: &message}
+			}
+
+			deliveries = append(deliveries, fakeAMQPDelivery{
+				channel: channel,
+				tag:     consumer.tag,
+				id:      channel.delivered,
+				message: &message,
+			})
+		}
+	}
+
+	return deliveries
+}
+
+func (s *fakeAMQPServer) deliver(deliveries []fakeAMQPDelivery) {
+	for _, delivery := range deliveries {
+		message := delivery.message
+
+		delivery.channel.conn.writeMethod(delivery.channel.id, 60, 60, func(w *fakeAMQPWriter) {
+			w.shortstr(delivery.tag)
+			w.longlong(delivery.id)
+
+			if message.redelivered {
+				w.octet(1)
+			} else {
+				w.octet(0)
+			}
+
+			w.shortstr(message.exchange)
+			w.shortstr(message.routingKey)
+		}, message)
+	}
+}
+
+// closeChannel requeues the unacked messages of channel. It must hold s.mu.
+func (s *fakeAMQPServer) closeChannel(channel *fakeAMQPChannel) {
+	for _, consumer := range channel.consumers {
+		s.removeConsumer(consumer)
+	}
+
+	for _, unacked := range channel.unacked {
+		s.requeue(unacked)
+	}
+
+	channel.consumers = map[string]*fakeAMQPConsumer{}
+	channel.unacked = map[uint64]fakeAMQPUnacked{}
+}
+
+func (s *fakeAMQPServer) removeConsumer(consumer *fakeAMQPConsumer) {
+	q, ok := s.queues[consumer.queue]
+	if !ok {
+		return
+	}
+
+	for i, c := range q.consumers {
+		if c == consumer {
+			q.consumers = append(q.consumers[:i], q.consumers[i+1:]...)
+
+			return
+		}
+	}
+}
+
+func (s *fakeAMQPServer) requeue(unacked fakeAMQPUnacked) {
+	// stream messages are never removed, consumers read them again from their offset
+	if q, ok := s.queues[unacked.queue]; ok && !q.stream {
+		message := *unacked.message
+		message.redelivered = true
+		q.messages = append([]*fakeAMQPMessage{&message}, q.messages...)
+	}
+}
+
+// writeMethod writes a method frame, followed by the content frames of message when given.
+func (c *fakeAMQPConn) writeMethod(
+	channelID uint16,
+	class uint16,
+	method uint16,
+	args func(w *fakeAMQPWriter),
+	message ...*fakeAMQPMessage,
+) {
+	w := &fakeAMQPWriter{}
+	w.short(class)
+	w.short(method)
+
+	if args != nil {
+		args(w)
+	}
+
+	var frames bytes.Buffer
+
+	writeFakeAMQPFrame(&frames, 1, channelID, w.buf.Bytes())
+
+	for _, m := range message {
+		header := &fakeAMQPWriter{}
+		header.short(60)
+		header.short(0)
+		header.longlong(uint64(len(m.body)))
+		header.buf.Write(m.properties)
+
+		writeFakeAMQPFrame(&frames, 2, channelID, header.buf.Bytes())
+
+		if len(m.body) > 0 {
+			writeFakeAMQPFrame(&frames, 3, channelID, m.body)
+		}
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	_, _ = c.conn.Write(frames.Bytes())
+}
+
+// rewriteFakeAMQPReplyTo replaces the direct reply-to pseudo queue of the reply-to property by the
+// queue of the publishing channel, as the broker does.
+func rewriteFakeAMQPReplyTo(properties []byte, replyTo string) []byte {
+	r := &fakeAMQPReader{buf: properties}
+	flags := r.short()
+
+	if flags&(1<<9) == 0 {
+		return properties
+	}
+
+	if flags&(1<<15) != 0 { // content-type
+		r.shortstr()
+	}
+
+	if flags&(1<<14) != 0 { // content-encoding
+		r.shortstr()
+	}
+
+	if flags&(1<<13) != 0 { // headers
+		r.pos += 4 + int(binary.BigEndian.Uint32(r.buf[r.pos:]))
+	}
+
+	if flags&(1<<12) != 0 { // delivery-mode
+		r.octet()
+	}
+
+	if flags&(1<<11) != 0 { // priority
+		r.octet()
+	}
+
+	if flags&(1<<10) != 0 { // correlation-id
+		r.shortstr()
+	}
+
+	start := r.pos
+	if r.shortstr() != directReplyTo {
+		return properties
+	}
+
+	w := &fakeAMQPWriter{}
+	w.buf.Write(properties[:start])
+	w.shortstr(replyTo)
+	w.buf.Write(properties[r.pos:])
+
+	return w.buf.Bytes()
+}
+
+// withFakeAMQPHeader adds an int64 header to the message properties.
+func withFakeAMQPHeader(properties []byte, key string, value int64) []byte {
+	entry := &fakeAMQPWriter{}
+	entry.shortstr(key)
+	entry.octet('l')
+	entry.longlong(uint64(value)) //nolint:gosec
+
+	r := &fakeAMQPReader{buf: properties}
+	flags := r.short()
+
+	if flags&(1<<15) != 0 { // content-type
+		r.shortstr()
+	}
+
+	if flags&(1<<14) != 0 { // content-encoding
+		r.shortstr()
+	}
+
+	w := &fakeAMQPWriter{}
+	w.short(flags | 1<<13)
+	w.buf.Write(properties[2:r.pos])
+
+	table := entry.buf.Bytes()
+
+	if flags&(1<<13) != 0 { // headers
+		size := int(binary.BigEndian.Uint32(r.buf[r.pos:]))
+		r.pos += 4
+		table = append(r.buf[r.pos:r.pos+size:r.pos+size], table...)
+		r.pos += size
+	}
+
+	w.long(uint32(len(table))) //nolint:gosec
+	w.buf.Write(table)
+	w.buf.Write(properties[r.pos:])
+
+	return w.buf.Bytes()
+}
+
+func writeFakeAMQPFrame(w *bytes.Buffer, frameType byte, channelID uint16, payload []byte) {
+	w.WriteByte(frameType)
+	_ = binary.Write(w, binary.BigEndian, channelID)
+	_ = binary.Write(w, binary.BigEndian, uint32(len(payload))) //nolint:gosec
+	w.Write(payload)
+	w.WriteByte(0xCE)
+}
+
+func readFakeAMQPFrame(r *bufio.Reader) (byte, uint16, []byte, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(header[3:])+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, 0, nil, err
+	}
+
+	return header[0], binary.BigEndian.Uint16(header[1:3]), payload[:len(payload)-1], nil
+}
+
+type fakeAMQPReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *fakeAMQPReader) octet() byte {
+	v := r.buf[r.pos]
+	r.pos++
+
+	return v
+}
+
+func (r *fakeAMQPReader) short() uint16 {
+	v := binary.BigEndian.Uint16(r.buf[r.pos:])
+	r.pos += 2
+
+	return v
+}
+
+func (r *fakeAMQPReader) longlong() uint64 {
+	v := binary.BigEndian.Uint64(r.buf[r.pos:])
+	r.pos += 8
+
+	return v
+}
+
+func (r *fakeAMQPReader) shortstr() string {
+	size := int(r.octet())
+	v := string(r.buf[r.pos : r.pos+size])
+	r.pos += size
+
+	return v
+}
+
+func (r *fakeAMQPReader) long() uint32 {
+	v := binary.BigEndian.Uint32(r.buf[r.pos:])
+	r.pos += 4
+
+	return v
+}
+
+// table reads a field table, keeping the values of the types the adapter sends.
+func (r *fakeAMQPReader) table() map[string]any {
+	table := make(map[string]any)
+	size := int(r.long())
+	end := r.pos + size
+
+	for r.pos < end {
+		key := r.shortstr()
+
+		switch kind := r.octet(); kind {
+		case 't', 'b', 'B':
+			table[key] = r.octet()
+		case 's':
+			table[key] = int16(r.short()) //nolint:gosec
+		case 'I':
+			table[key] = int32(r.long()) //nolint:gosec
+		case 'l':
+			table[key] = int64(r.longlong()) //nolint:gosec
+		case 'T':
+			table[key] = r.longlong()
+		case 'V':
+			table[key] = nil
+		case 'S':
+			size := int(r.long())
+			table[key] = string(r.buf[r.pos : r.pos+size])
+			r.pos += size
+		default:
+			panic(fmt.Sprintf("fake amqp: unsupported field type %q", kind))
+		}
+	}
+
+	return table
+}
+
+func (r *fakeAMQPReader) rest() []byte {
+	return r.buf[r.pos:]
+}
+
+type fakeAMQPWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *fakeAMQPWriter) octet(v byte) { w.buf.WriteByte(v) }
+
+func (w *fakeAMQPWriter) short(v uint16) { _ = binary.Write(&w.buf, binary.BigEndian, v) }
+
+func (w *fakeAMQPWriter) long(v uint32) { _ = binary.Write(&w.buf, binary.BigEndian, v) }
+
+func (w *fakeAMQPWriter) longlong(v uint64) { _ = binary.Write(&w.buf, binary.BigEndian, v) }
+
+func (w *fakeAMQPWriter) shortstr(v string) {
+	w.octet(byte(len(v)))
+	w.buf.WriteString(v)
+}
+
+func (w *fakeAMQPWriter) longstr(v string) {
+	w.long(uint32(len(v))) //nolint:gosec
+	w.buf.WriteString(v)
+}
@@ -3,53 +3,49 @@ package queue
 import (
 	"context"
 	"encoding/json"
+	"github.com/google/uuid"
 	"github.com/pkg/errors"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
-func (r *RabbitMQConnection) Produce(ctx context.Context, routingKey string, msg any) error {
-	body, headers, err := r.buildMessageBodyAndHeaders(msg)
+func (r *RabbitMQConnection) Produce(ctx context.Context, routingKey string, msg any) (err error) {
+	message, err := buildMessage(msg)
 	if err != nil {
 		return errors.Wrap(err, "build message")
 	}
 
-	publishFn := func() (any, error) {
-		if r.conn == nil || r.conn.IsClosed() {
-			return nil, errors.New("rabbitmq connection closed")
+	if r.schemaRegistry != nil {
+		if err := r.schemaRegistry.PrepareOutgoing(routingKey, &message); err != nil {
+			return errors.Wrap(err, "validate message schema")
 		}
+	}
 
-		ch, err := r.conn.Channel()
-		if err != nil {
-			return nil, err
-		}
-		defer ch.Close()
-
-		pubCtx, cancel := context.WithTimeout(ctx, publishTimeout)
-		defer cancel()
-
-		return nil, ch.PublishWithContext(
-			pubCtx,
-			r.config.Exchange,
-			routingKey,
-			false, // mandatory
-			false, // immediate
-			amqp.Publishing{ //nolint:exhaustruct
-				ContentType:  "application/json",
-				Body:         body,
-				Headers:      headers,
-				DeliveryMode: amqp.Persistent,
-			},
-		)
+	ctx, span := r.startProduceSpan(ctx, routingKey, message.Headers, message.Body)
+	defer func() { finishSpan(span, err) }()
+
+	publishFn := func() (any, error) {
+		return nil, r.withChannel(func(ch *amqp.Channel) error {
+			pubCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+			defer cancel()
+
+			return ch.PublishWithContext(
+				pubCtx,
+				r.config.Exchange,
+				routingKey,
+				false, // mandatory
+				false, // immediate
+				newPublishing(message),
+			)
+		})
 	}
 
 	_, err = r.breaker.Execute(publishFn)
 	if err != nil {
-		return r.handlePublisherFallBack(ctx, routingKey, &Message{
-			Headers: headers,
-			Body:    body,
-		})
+		return r.handlePublisherFallBack(ctx, routingKey, &message)
 	}
 
+	r.metrics.MessageProduced(routingKey)
+
 	return nil
 }
 
@@ -88,41 +84,78 @@ func (r *RabbitMQConnection) handlePublisherFallBack(ctx context.Context, routin
 	}
 
 	model := &GormFallbackProducerModel{
-		RoutingKey: routingKey,
-		Headers:    headers,
-		Body:       msg.Body,
+		RoutingKey:  routingKey,
+		ContentType: msg.ContentType,
+		MessageID:   msg.MessageID,
+		Headers:     headers,
+		Body:        msg.Body,
 	}
 
 	if err := r.databaseFallback.database.WithContext(ctx).Debug().Create(model).Error; err != nil {
 		return errors.Wrap(err, "create fallback producer model")
 	}
 
+	r.metrics.FallbackWritten(routingKey)
+
 	return nil
 }
 
-func (r *RabbitMQConnection) buildMessageBodyAndHeaders(
-	msg any,
-) (body []byte, headers map[string]any, err error) {
+func newPublishing(message Message) amqp.Publishing {
+	return amqp.Publishing{ //nolint:exhaustruct
+		ContentType:   message.ContentType,
+		MessageId:     message.MessageID,
+		CorrelationId: message.CorrelationID,
+		ReplyTo:       message.ReplyTo,
+		Body:          message.Body,
+		Headers:       message.Headers,
+		DeliveryMode:  amqp.Persistent,
+	}
+}
+
+// buildMessage normalizes whatever is passed to Produce into a Message.
+func buildMessage(msg any) (Message, error) {
+	var message Message
+
 	switch m := msg.(type) {
 	case Message:
-		body = m.Body
-		headers = m.Headers
+		message = m
 	case *Message:
-		body = m.Body
-		headers = m.Headers
+		message = *m
 	case []byte:
-		body = m
+		message.Body = m
 	default:
 		buf, err := json.Marshal(msg)
 		if err != nil {
-			return nil, nil, errors.Wrap(err, "marshal msg")
+			return Message{}, errors.Wrap(err, "marshal msg")
 		}
-		body = buf
+		message.Body = buf
+	}
+
+	// copy headers, they're enriched before publishing and must not leak back to the caller
+	message.Headers = cloneHeaders(message.Headers)
+
+	if message.ContentType == "" {
+		message.ContentType = ContentTypeJSON
+	}
+
+	if message.MessageID == "" {
+		message.MessageID = messageID(message)
+	}
+
+	if message.MessageID == "" {
+		message.MessageID = uuid.NewString()
 	}
 
-	if headers == nil {
-		headers = make(map[string]any)
+	message.Headers[MessageIDHeader] = message.MessageID
+
+	return message, nil
+}
+
+func cloneHeaders(headers map[string]any) map[string]any {
+	clone := make(map[string]any, len(headers))
+	for k, v := range headers {
+		clone[k] = v
 	}
 
-	return body, headers, nil
+	return clone
 }
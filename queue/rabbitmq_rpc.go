@@ -0,0 +1,276 @@
+package queue
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/braiphub/go-core/log"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// RPCErrorHeader carries the handler error of a failed request in its reply.
+	RPCErrorHeader = "rpc-error"
+
+	directReplyTo         = "amq.rabbitmq.reply-to"
+	defaultRequestTimeout = 30 * time.Second
+)
+
+var (
+	ErrRPCHandler = errors.New("rpc handler failed")
+	ErrNoRoute    = errors.New("request not routed to any queue")
+)
+
+type rpcReply struct {
+	msg Message
+	err error
+}
+
+// rpcClient owns the channel consuming direct reply-to: the broker only delivers replies to the
+// channel the request was published on.
+type rpcClient struct {
+	channel *amqp.Channel
+
+	mu      sync.Mutex
+	pending map[string]chan rpcReply
+	closed  bool
+}
+
+// Request publishes msg and waits for its reply, using direct reply-to. Without a ctx deadline it
+// waits up to 30 seconds. A reply to a failed request returns ErrRPCHandler.
+func (r *RabbitMQConnection) Request(ctx context.Context, routingKey string, msg any) (reply Message, err error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, defaultRequestTimeout)
+		defer cancel()
+	}
+
+	message, err := buildMessage(msg)
+	if err != nil {
+		return Message{}, errors.Wrap(err, "build message")
+	}
+
+	if r.schemaRegistry != nil {
+		if err := r.schemaRegistry.PrepareOutgoing(routingKey, &message); err != nil {
+			return Message{}, errors.Wrap(err, "validate message schema")
+		}
+	}
+
+	ctx, span := r.startProduceSpan(ctx, routingKey, message.Headers, message.Body)
+	defer func() { finishSpan(span, err) }()
+
+	client, err := r.rpcClient()
+	if err != nil {
+		return Message{}, err
+	}
+
+	message.CorrelationID = uuid.NewString()
+	message.ReplyTo = directReplyTo
+
+	replyCh := client.register(message.CorrelationID)
+	defer client.unregister(message.CorrelationID)
+
+	err = client.channel.PublishWithContext(
+		ctx,
+		r.config.Exchange,
+		routingKey,
+		true,  // mandatory: fail fast when nobody serves routingKey
+		false, // immediate
+		newPublishing(message),
+	)
+	if err != nil {
+		return Message{}, errors.Wrap(err, "publish request")
+	}
+
+	select {
+	case result := <-replyCh:
+		if result.err != nil {
+			return Message{}, result.err
+		}
+
+		if handlerErr, ok := result.msg.Headers[RPCErrorHeader].(string); ok {
+			return result.msg, errors.Wrap(ErrRPCHandler, handlerErr)
+		}
+
+		return result.msg, nil
+
+	case <-ctx.Done():
+		return Message{}, errors.Wrap(ctx.Err(), "wait reply")
+	}
+}
+
+// Serve consumes requests from queue, publishing the handler result to their reply-to address. A
+// handler error is replied in the RPCErrorHeader header and the request is acked, since the caller
+// already knows it failed. It blocks until ctx is cancelled, like Consume.
+func (r *RabbitMQConnection) Serve(
+	ctx context.Context,
+	queue string,
+	handler func(ctx context.Context, msg Message) (any, error),
+	opts ...func(*ConsumeOptions),
+) {
+	r.Consume(ctx, queue, func(ctx context.Context, msg Message) error {
+		result, err := handler(ctx, msg)
+
+		if msg.ReplyTo == "" {
+			return err
+		}
+
+		reply, buildErr := buildMessage(result)
+		if err != nil {
+			r.logger.WithContext(ctx).Error("rpc handler error", err, log.Any("queue", queue))
+
+			reply, buildErr = buildMessage(Message{
+				Headers: map[string]any{RPCErrorHeader: err.Error()},
+				Body:    []byte(err.Error()),
+			})
+		}
+
+		if buildErr != nil {
+			return errors.Wrap(buildErr, "build reply")
+		}
+
+		return r.reply(ctx, msg, reply)
+	}, opts...)
+}
+
+func (r *RabbitMQConnection) reply(ctx context.Context, request Message, reply Message) (err error) {
+	reply.CorrelationID = request.CorrelationID
+
+	ctx, span := r.startProduceSpan(ctx, request.ReplyTo, reply.Headers, reply.Body)
+	defer func() { finishSpan(span, err) }()
+
+	err = r.withChannel(func(channel *amqp.Channel) error {
+		pubCtx, cancel := context.WithTimeout(ctx, publishTimeout)
+		defer cancel()
+
+		// replies go through the default exchange straight to the caller channel
+		return channel.PublishWithContext(pubCtx, "", request.ReplyTo, false, false, newPublishing(reply))
+	})
+	if err != nil {
+		return errors.Wrap(err, "publish reply")
+	}
+
+	return nil
+}
+
+// rpcClient returns the client consuming direct reply-to, opening it again after the channel drops.
+func (r *RabbitMQConnection) rpcClient() (*rpcClient, error) {
+	r.rpcMu.Lock()
+	defer r.rpcMu.Unlock()
+
+	if r.rpc != nil && !r.rpc.isClosed() {
+		return r.rpc, nil
+	}
+
+	conn := r.connection()
+	if conn == nil {
+		return nil, ErrConnectionClosed
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return nil, errors.Wrap(err, "channel open")
+	}
+
+	// direct reply-to must be consumed in no-ack mode
+	deliveries, err := channel.Consume(directReplyTo, "", true, false, false, false, nil)
+	if err != nil {
+		_ = channel.Close()
+
+		return nil, errors.Wrap(err, "consume replies")
+	}
+
+	client := &rpcClient{
+		channel: channel,
+		pending: make(map[string]chan rpcReply),
+	}
+
+	go client.dispatch(deliveries, channel.NotifyReturn(make(chan amqp.Return, 1)))
+
+	r.rpc = client
+
+	return client, nil
+}
+
+func (c *rpcClient) dispatch(deliveries <-chan amqp.Delivery, returns <-chan amqp.Return) {
+	for {
+		select {
+		case msg, ok := <-deliveries:
+			if !ok {
+				c.close()
+
+				return
+			}
+
+			c.resolve(msg.CorrelationId, rpcReply{msg: newMessageFromDelivery(msg)})
+
+		case returned, ok := <-returns:
+			if !ok {
+				returns = nil
+
+				continue
+			}
+
+			c.resolve(returned.CorrelationId, rpcReply{err: errors.Wrap(ErrNoRoute, returned.RoutingKey)})
+		}
+	}
+}
+
+func (c *rpcClient) register(correlationID string) <-chan rpcReply {
+	replyCh := make(chan rpcReply, 1)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		replyCh <- rpcReply{err: ErrConnectionClosed}
+
+		return replyCh
+	}
+
+	c.pending[correlationID] = replyCh
+
+	return replyCh
+}
+
+func (c *rpcClient) unregister(correlationID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.pending, correlationID)
+}
+
+// resolve hands the reply to its request, replies of requests that gave up are dropped.
+func (c *rpcClient) resolve(correlationID string, reply rpcReply) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if replyCh, ok := c.pending[correlationID]; ok {
+		replyCh <- reply
+		delete(c.pending, correlationID)
+	}
+}
+
+// close fails the pending requests, their replies were lost with the channel.
+func (c *rpcClient) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+
+	for correlationID, replyCh := range c.pending {
+		replyCh <- rpcReply{err: ErrConnectionClosed}
+		delete(c.pending, correlationID)
+	}
+}
+
+func (c *rpcClient) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closed || c.channel.IsClosed()
+}
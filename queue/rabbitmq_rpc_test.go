@@ -0,0 +1,73 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRabbitMQConnection_RequestServe(t *testing.T) {
+	server := newFakeAMQPServer(t)
+	conn := newTestRabbitMQConnection(t, server)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		conn.Serve(ctx, "orders", func(_ context.Context, msg Message) (any, error) {
+			if string(msg.Body) == "fail" {
+				return nil, errors.New("order not found")
+			}
+
+			return map[string]string{"status": "paid"}, nil
+		})
+	}()
+
+	require.Eventually(t, func() bool { return server.consumers("orders") == 1 }, 5*time.Second, time.Millisecond)
+
+	reqCtx, reqCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer reqCancel()
+
+	reply, err := conn.Request(reqCtx, "order.status", []byte("ok"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"status":"paid"}`, string(reply.Body))
+
+	_, err = conn.Request(reqCtx, "order.status", []byte("fail"))
+	assert.ErrorIs(t, err, ErrRPCHandler)
+	assert.ErrorContains(t, err, "order not found")
+
+	cancel()
+	<-done
+}
+
+func TestRabbitMQConnection_RequestTimeout(t *testing.T) {
+	server := newFakeAMQPServer(t)
+	conn := newTestRabbitMQConnection(t, server)
+
+	// the request is routed to the orders queue, but nobody serves it
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := conn.Request(ctx, "order.status", []byte("ok"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestRabbitMQConnection_RequestNoRoute(t *testing.T) {
+	server := newFakeAMQPServer(t)
+	conn := newTestRabbitMQConnection(t, server)
+
+	// no queue is bound to invoice.*, the broker returns the request right away
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := conn.Request(ctx, "invoice.status", []byte("ok"))
+	assert.ErrorIs(t, err, ErrNoRoute)
+	assert.ErrorContains(t, err, "invoice.status")
+	assert.NoError(t, ctx.Err())
+}
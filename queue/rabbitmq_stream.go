@@ -0,0 +1,467 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/braiphub/go-core/cache"
+	"github.com/braiphub/go-core/log"
+	"github.com/pkg/errors"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	streamOffsetArgument     = "x-stream-offset"
+	defaultStreamPrefetch    = 100
+	defaultOffsetCommitEvery = 100
+	offsetCommitTimeout      = 5 * time.Second
+)
+
+// StreamOffset is where a stream consumer starts reading from.
+type StreamOffset struct {
+	value any
+}
+
+// OffsetFirst starts from the first message still kept by the stream.
+func OffsetFirst() StreamOffset { return StreamOffset{value: "first"} }
+
+// OffsetLast starts from the last chunk written to the stream.
+func OffsetLast() StreamOffset { return StreamOffset{value: "last"} }
+
+// OffsetNext only reads messages published from now on.
+func OffsetNext() StreamOffset { return StreamOffset{value: "next"} }
+
+// OffsetAt starts from the given offset.
+func OffsetAt(offset int64) StreamOffset { return StreamOffset{value: offset} }
+
+// OffsetTimestamp starts from the messages published at t, which allows replaying from a point in time.
+func OffsetTimestamp(t time.Time) StreamOffset { return StreamOffset{value: t} }
+
+func (o StreamOffset) String() string {
+	return fmt.Sprint(o.value)
+}
+
+type StreamConfig struct {
+	// MaxAge sets x-max-age, e.g.: "7D" or "12h".
+	MaxAge              string
+	MaxLengthBytes      int64
+	MaxSegmentSizeBytes int64
+	// RoutingKeys bind the stream to the connection exchange.
+	RoutingKeys []string
+}
+
+// OffsetStore persists the last offset processed by a stream consumer.
+type OffsetStore interface {
+	Load(ctx context.Context, stream string, consumer string) (offset int64, found bool, err error)
+	Store(ctx context.Context, stream string, consumer string, offset int64) error
+}
+
+type StreamConsumeOptions struct {
+	// Offset is where to start when there's no stored offset. Defaults to OffsetNext.
+	Offset *StreamOffset
+	// Replay starts from Offset even when there's a stored offset.
+	Replay        bool
+	OffsetStore   OffsetStore
+	CommitEvery   int
+	PrefetchCount int
+}
+
+func WithStreamOffset(offset StreamOffset) func(*StreamConsumeOptions) {
+	return func(o *StreamConsumeOptions) {
+		o.Offset = &offset
+	}
+}
+
+// WithStreamReplay starts from offset ignoring the stored one, e.g.: to rebuild a read model.
+func WithStreamReplay(offset StreamOffset) func(*StreamConsumeOptions) {
+	return func(o *StreamConsumeOptions) {
+		o.Offset = &offset
+		o.Replay = true
+	}
+}
+
+func WithOffsetStore(store OffsetStore) func(*StreamConsumeOptions) {
+	return func(o *StreamConsumeOptions) {
+		o.OffsetStore = store
+	}
+}
+
+// WithOffsetCommitEvery sets how many messages are processed between offset commits. The offset is
+// always committed on shutdown.
+func WithOffsetCommitEvery(count int) func(*StreamConsumeOptions) {
+	return func(o *StreamConsumeOptions) {
+		o.CommitEvery = count
+	}
+}
+
+func WithStreamPrefetch(count int) func(*StreamConsumeOptions) {
+	return func(o *StreamConsumeOptions) {
+		o.PrefetchCount = count
+	}
+}
+
+// DeclareStream declares a durable stream queue bound to the connection exchange.
+func (r *RabbitMQConnection) DeclareStream(ctx context.Context, name string, config StreamConfig) error {
+	args := amqp.Table{"x-queue-type": "stream"}
+
+	if config.MaxAge != "" {
+		args["x-max-age"] = config.MaxAge
+	}
+
+	if config.MaxLengthBytes > 0 {
+		args["x-max-length-bytes"] = config.MaxLengthBytes
+	}
+
+	if config.MaxSegmentSizeBytes > 0 {
+		args["x-stream-max-segment-size-bytes"] = config.MaxSegmentSizeBytes
+	}
+
+	if err := r.DeclareQueue(RabbitMQQueueConfig{Name: name, Arguments: args}); err != nil {
+		return errors.Wrap(err, "declare stream")
+	}
+
+	for _, routingKey := range config.RoutingKeys {
+		if err := r.BindQueue(ctx, name, r.config.Exchange, routingKey); err != nil {
+			return errors.Wrap(err, "bind stream")
+		}
+	}
+
+	return nil
+}
+
+// ConsumeFromStream reads a stream queue until ctx is cancelled, resuming from the stored offset of
+// consumer when an offset store is set. Messages are handled sequentially; since streams can't
+// dead-letter, failed messages are reported to the error handler and skipped.
+func (r *RabbitMQConnection) ConsumeFromStream(
+	ctx context.Context,
+	stream string,
+	consumer string,
+	processMsgFn func(ctx context.Context, msg Message) error,
+	opts ...func(*StreamConsumeOptions),
+) {
+	options := StreamConsumeOptions{
+		CommitEvery:   defaultOffsetCommitEvery,
+		PrefetchCount: defaultStreamPrefetch,
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	if r.schemaRegistry != nil {
+		processMsgFn = r.schemaRegistry.Wrap(processMsgFn)
+	}
+
+	offset, ok := r.initialStreamOffset(ctx, stream, consumer, options)
+	if !ok {
+		return
+	}
+
+	tracker := &offsetTracker{stream: stream, consumer: consumer, options: options, last: -1}
+	defer tracker.commit(ctx, r.logger)
+
+	r.logger.WithContext(ctx).Info(fmt.Sprintf("[*] Reading stream: %s (consumer: %s, offset: %s)", stream, consumer, offset))
+
+	for ctx.Err() == nil {
+		// resume after the last processed message when the channel drops
+		if tracker.last >= 0 {
+			offset = OffsetAt(tracker.last + 1)
+		}
+
+		conn := r.connection()
+		if conn == nil {
+			r.waitConnection(ctx)
+
+			continue
+		}
+
+		channel, err := conn.Channel()
+		if err != nil {
+			r.logger.WithContext(ctx).Error("open channel error", err)
+			r.waitReconnect(ctx)
+
+			continue
+		}
+
+		if err := channel.Qos(options.PrefetchCount, 0, false); err != nil {
+			r.logger.WithContext(ctx).Error("channel qos error", err)
+			_ = channel.Close()
+			r.waitReconnect(ctx)
+
+			continue
+		}
+
+		deliveries, err := channel.Consume(stream, consumer, false, false, false, false, amqp.Table{
+			streamOffsetArgument: offset.value,
+		})
+		if err != nil {
+			r.logger.WithContext(ctx).Error("stream consume error", err, log.Any("stream", stream))
+			_ = channel.Close()
+			r.waitReconnect(ctx)
+
+			continue
+		}
+
+		r.readStream(ctx, stream, deliveries, processMsgFn, tracker)
+
+		if ctx.Err() != nil {
+			if err := channel.Cancel(consumer, false); err != nil {
+				r.logger.WithContext(ctx).Error("cancel consumer", err, log.Any("stream", stream))
+			}
+		}
+
+		_ = channel.Close()
+	}
+}
+
+func (r *RabbitMQConnection) initialStreamOffset(
+	ctx context.Context,
+	stream string,
+	consumer string,
+	options StreamConsumeOptions,
+) (StreamOffset, bool) {
+	offset := OffsetNext()
+	if options.Offset != nil {
+		offset = *options.Offset
+	}
+
+	if options.OffsetStore == nil || options.Replay {
+		return offset, true
+	}
+
+	// the stored offset must be known: starting elsewhere would skip or reprocess messages
+	for {
+		stored, found, err := options.OffsetStore.Load(ctx, stream, consumer)
+		if err == nil {
+			if found {
+				return OffsetAt(stored + 1), true
+			}
+
+			return offset, true
+		}
+
+		r.logger.WithContext(ctx).Error("load stream offset", err, log.Any("stream", stream))
+		r.waitReconnect(ctx)
+
+		if ctx.Err() != nil {
+			return offset, false
+		}
+	}
+}
+
+func (r *RabbitMQConnection) readStream(
+	ctx context.Context,
+	stream string,
+	deliveries <-chan amqp.Delivery,
+	processMsgFn func(ctx context.Context, msg Message) error,
+	tracker *offsetTracker,
+) {
+	handlerCtx := context.WithoutCancel(ctx)
+
+	for {
+		var msg amqp.Delivery
+
+		select {
+		case <-ctx.Done():
+			return
+		case delivery, ok := <-deliveries:
+			if !ok {
+				return
+			}
+
+			msg = delivery
+		}
+
+		r.metrics.MessageConsumed(stream)
+		start := time.Now()
+
+		spanCtx, span := r.startConsumeSpan(handlerCtx, stream, msg)
+		err := processMsgFn(spanCtx, newMessageFromDelivery(msg))
+		finishSpan(span, err)
+
+		r.metrics.HandlerDuration(stream, time.Since(start))
+
+		if err != nil {
+			r.metrics.HandlerError(stream)
+			r.logger.WithContext(ctx).Error(
+				"process message error",
+				err,
+				log.Any("stream", stream),
+				getProcessMessageErrorField(msg),
+			)
+			r.callErrorHandler(stream, msg, err)
+		}
+
+		// stream consumers must ack to receive more messages, it doesn't remove them
+		if err := msg.Ack(false); err != nil {
+			r.logger.WithContext(ctx).Error("ack message", err)
+		} else {
+			r.metrics.MessageAcked(stream)
+		}
+
+		if offset, ok := msg.Headers[streamOffsetArgument].(int64); ok {
+			tracker.processed(ctx, r.logger, offset)
+		}
+	}
+}
+
+type offsetTracker struct {
+	stream      string
+	consumer    string
+	options     StreamConsumeOptions
+	last        int64
+	uncommitted int
+}
+
+func (t *offsetTracker) processed(ctx context.Context, logger log.LoggerI, offset int64) {
+	t.last = offset
+	t.uncommitted++
+
+	if t.uncommitted >= t.options.CommitEvery {
+		t.commit(ctx, logger)
+	}
+}
+
+func (t *offsetTracker) commit(ctx context.Context, logger log.LoggerI) {
+	if t.options.OffsetStore == nil || t.uncommitted == 0 {
+		return
+	}
+
+	commitCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), offsetCommitTimeout)
+	defer cancel()
+
+	if err := t.options.OffsetStore.Store(commitCtx, t.stream, t.consumer, t.last); err != nil {
+		logger.WithContext(ctx).Error("store stream offset", err, log.Any("stream", t.stream))
+
+		return
+	}
+
+	t.uncommitted = 0
+}
+
+// CacheOffsetStore keeps stream offsets in a cache.Cacherer, e.g.: redis.
+type CacheOffsetStore struct {
+	cache cache.Cacherer
+}
+
+func NewCacheOffsetStore(cacher cache.Cacherer) *CacheOffsetStore {
+	return &CacheOffsetStore{cache: cacher}
+}
+
+func (s *CacheOffsetStore) Load(ctx context.Context, stream string, consumer string) (int64, bool, error) {
+	value, err := s.cache.GetString(ctx, s.key(stream, consumer))
+
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, false, nil
+	case err != nil:
+		return 0, false, errors.Wrap(err, "get stream offset")
+	}
+
+	offset, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false, errors.Wrap(err, "parse stream offset")
+	}
+
+	return offset, true, nil
+}
+
+func (s *CacheOffsetStore) Store(ctx context.Context, stream string, consumer string, offset int64) error {
+	if err := s.cache.Set(ctx, s.key(stream, consumer), strconv.FormatInt(offset, 10), 0); err != nil {
+		return errors.Wrap(err, "set stream offset")
+	}
+
+	return nil
+}
+
+func (s *CacheOffsetStore) key(stream string, consumer string) string {
+	return fmt.Sprintf("queue:stream-offset:%s:%s", stream, consumer)
+}
+
+// BrokerOffsetStore keeps stream offsets on the broker. Server-side offset tracking is only
+// available through the stream protocol, so the offset is kept as the single message of a
+// "<stream>.offset.<consumer>" queue.
+type BrokerOffsetStore struct {
+	conn *RabbitMQConnection
+}
+
+func (r *RabbitMQConnection) NewBrokerOffsetStore() *BrokerOffsetStore {
+	return &BrokerOffsetStore{conn: r}
+}
+
+func (s *BrokerOffsetStore) Load(_ context.Context, stream string, consumer string) (int64, bool, error) {
+	var (
+		offset int64
+		found  bool
+	)
+
+	err := s.conn.withChannel(func(channel *amqp.Channel) error {
+		if err := s.declare(channel, stream, consumer); err != nil {
+			return err
+		}
+
+		msg, ok, err := channel.Get(s.queue(stream, consumer), false)
+		if err != nil {
+			return errors.Wrap(err, "get stream offset")
+		}
+
+		if !ok {
+			return nil
+		}
+
+		// peek: the message stays in the queue
+		if err := msg.Reject(true); err != nil {
+			return errors.Wrap(err, "requeue stream offset")
+		}
+
+		offset, err = strconv.ParseInt(string(msg.Body), 10, 64)
+		if err != nil {
+			return errors.Wrap(err, "parse stream offset")
+		}
+
+		found = true
+
+		return nil
+	})
+
+	return offset, found, err
+}
+
+func (s *BrokerOffsetStore) Store(ctx context.Context, stream string, consumer string, offset int64) error {
+	return s.conn.withChannel(func(channel *amqp.Channel) error {
+		if err := s.declare(channel, stream, consumer); err != nil {
+			return err
+		}
+
+		// the queue keeps a single message: publishing drops the previous offset
+		err := channel.PublishWithContext(ctx, "", s.queue(stream, consumer), false, false, amqp.Publishing{ //nolint:exhaustruct
+			ContentType:  "text/plain",
+			Body:         []byte(strconv.FormatInt(offset, 10)),
+			DeliveryMode: amqp.Persistent,
+		})
+		if err != nil {
+			return errors.Wrap(err, "publish stream offset")
+		}
+
+		return nil
+	})
+}
+
+func (s *BrokerOffsetStore) declare(channel *amqp.Channel, stream string, consumer string) error {
+	_, err := channel.QueueDeclare(s.queue(stream, consumer), true, false, false, false, amqp.Table{
+		"x-max-length": 1,
+		"x-overflow":   "drop-head",
+	})
+	if err != nil {
+		return errors.Wrap(err, "declare offset queue")
+	}
+
+	return nil
+}
+
+func (s *BrokerOffsetStore) queue(stream string, consumer string) string {
+	return fmt.Sprintf("%s.offset.%s", stream, consumer)
+}
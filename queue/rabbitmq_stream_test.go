@@ -0,0 +1,153 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestRabbitMQConnection_initialStreamOffset(t *testing.T) {
+	ctx := context.Background()
+	store := NewCacheOffsetStore(newTestCacher())
+	replayFrom := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	logger := log.NewMockLoggerI(gomock.NewController(t))
+	conn := NewRabbitMQConnection(Config{}, WithLogger(logger))
+
+	assert.NoError(t, store.Store(ctx, "orders", "billing", 41))
+
+	tests := []struct {
+		name string
+		opts []func(*StreamConsumeOptions)
+		want StreamOffset
+	}{
+		{name: "default", want: OffsetNext()},
+		{name: "no store", opts: []func(*StreamConsumeOptions){WithStreamOffset(OffsetFirst())}, want: OffsetFirst()},
+		{name: "stored", opts: []func(*StreamConsumeOptions){WithStreamOffset(OffsetFirst()), WithOffsetStore(store)}, want: OffsetAt(42)},
+		{name: "replay", opts: []func(*StreamConsumeOptions){WithStreamReplay(OffsetTimestamp(replayFrom)), WithOffsetStore(store)}, want: OffsetTimestamp(replayFrom)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var options StreamConsumeOptions
+			for _, opt := range tt.opts {
+				opt(&options)
+			}
+
+			got, ok := conn.initialStreamOffset(ctx, "orders", "billing", options)
+			assert.True(t, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_offsetTracker(t *testing.T) {
+	ctx := context.Background()
+	store := NewCacheOffsetStore(newTestCacher())
+	tracker := &offsetTracker{
+		stream:   "orders",
+		consumer: "billing",
+		options:  StreamConsumeOptions{OffsetStore: store, CommitEvery: 2},
+		last:     -1,
+	}
+
+	tracker.processed(ctx, nil, 10)
+
+	_, found, err := store.Load(ctx, "orders", "billing")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	tracker.processed(ctx, nil, 11)
+	tracker.processed(ctx, nil, 12)
+	tracker.commit(ctx, nil)
+
+	offset, found, err := store.Load(ctx, "orders", "billing")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(12), offset)
+}
+
+func TestRabbitMQConnection_ConsumeFromStreamResume(t *testing.T) {
+	server := newFakeAMQPServer(t)
+	conn := newTestRabbitMQConnection(t, server)
+	store := NewCacheOffsetStore(newTestCacher())
+
+	require.NoError(t, conn.DeclareStream(context.Background(), "orders.log", StreamConfig{RoutingKeys: []string{"order.*"}}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan string, 10)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		conn.ConsumeFromStream(ctx, "orders.log", "billing", func(_ context.Context, msg Message) error {
+			received <- string(msg.Body)
+
+			return nil
+		}, WithStreamOffset(OffsetFirst()), WithOffsetStore(store), WithOffsetCommitEvery(10))
+	}()
+
+	require.Eventually(t, func() bool { return server.consumers("orders.log") == 1 }, 5*time.Second, time.Millisecond)
+
+	produceEventually(t, conn, "order.created", []byte("first"))
+	produceEventually(t, conn, "order.created", []byte("second"))
+	assert.Equal(t, "first", receive(t, received))
+	assert.Equal(t, "second", receive(t, received))
+
+	server.dropConnections()
+
+	require.Eventually(t, func() bool { return server.consumers("orders.log") == 1 }, 5*time.Second, time.Millisecond)
+
+	// the consumer resumes after the last processed message instead of reading from the first one
+	produceEventually(t, conn, "order.created", []byte("third"))
+	assert.Equal(t, "third", receive(t, received))
+	assert.Equal(t, 3, server.streamLength("orders.log"))
+
+	cancel()
+	<-done
+
+	assert.Empty(t, received)
+
+	// the offset is committed on shutdown
+	offset, found, err := store.Load(context.Background(), "orders.log", "billing")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(2), offset)
+}
+
+func TestBrokerOffsetStore(t *testing.T) {
+	server := newFakeAMQPServer(t)
+	store := newTestRabbitMQConnection(t, server).NewBrokerOffsetStore()
+	ctx := context.Background()
+
+	_, found, err := store.Load(ctx, "orders.log", "billing")
+	assert.NoError(t, err)
+	assert.False(t, found)
+
+	assert.NoError(t, store.Store(ctx, "orders.log", "billing", 41))
+
+	// loading peeks: the offset stays in the queue
+	for range 2 {
+		offset, found, err := store.Load(ctx, "orders.log", "billing")
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Equal(t, int64(41), offset)
+	}
+
+	assert.NoError(t, store.Store(ctx, "orders.log", "billing", 42))
+
+	offset, found, err := store.Load(ctx, "orders.log", "billing")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, int64(42), offset)
+	// the previous offset was dropped, the current one is back in the queue once the reject is handled
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"42"}, server.ready("orders.log.offset.billing"))
+	}, 5*time.Second, time.Millisecond)
+}
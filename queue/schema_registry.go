@@ -0,0 +1,294 @@
+package queue
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+const SchemaVersionHeader = "schema-version"
+
+var (
+	ErrSchemaValidation   = errors.New("schema validation failed")
+	ErrSchemaNotFound     = errors.New("schema not found")
+	ErrInvalidSchema      = errors.New("invalid schema")
+	ErrMissingUpcaster    = errors.New("missing upcaster")
+	ErrUnsupportedVersion = errors.New("unsupported schema version")
+)
+
+// Schema describes one version of the payload published with a routing key. The payload shape is
+// given either as a JSON Schema document or as a Go struct value (e.g.: OrderCreated{}), which is
+// validated by strictly decoding the body into it.
+type Schema struct {
+	RoutingKey  string
+	Version     int
+	Description string
+	JSONSchema  []byte
+	Type        any
+}
+
+// Upcaster converts a payload from one schema version to the next one.
+type Upcaster func(body []byte) ([]byte, error)
+
+// SchemaRegistry holds the versioned payload schemas keyed by routing key. Producers validate
+// outgoing messages against the latest version and consumers upcast older versions before
+// validating them.
+type SchemaRegistry struct {
+	mu      sync.RWMutex
+	entries map[string]*schemaEntry
+}
+
+type schemaEntry struct {
+	latest    int
+	versions  map[int]*compiledSchema
+	upcasters map[int]Upcaster
+}
+
+type compiledSchema struct {
+	Schema
+	jsonSchema *jsonschema.Schema
+	goType     reflect.Type
+}
+
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{
+		entries: make(map[string]*schemaEntry),
+	}
+}
+
+func (r *SchemaRegistry) Register(schema Schema) error {
+	switch {
+	case schema.RoutingKey == "":
+		return errors.Wrap(ErrInvalidSchema, "routing key is empty")
+	case schema.Version < 1:
+		return errors.Wrap(ErrInvalidSchema, "version must be greater than zero")
+	case schema.JSONSchema == nil && schema.Type == nil:
+		return errors.Wrap(ErrInvalidSchema, "either json schema or type must be set")
+	}
+
+	compiled := &compiledSchema{Schema: schema}
+
+	if schema.JSONSchema != nil {
+		url := fmt.Sprintf("%s.v%d.json", schema.RoutingKey, schema.Version)
+
+		jsonSchema, err := jsonschema.CompileString(url, string(schema.JSONSchema))
+		if err != nil {
+			return errors.Wrap(ErrInvalidSchema, err.Error())
+		}
+
+		compiled.jsonSchema = jsonSchema
+	}
+
+	if schema.Type != nil {
+		goType := reflect.TypeOf(schema.Type)
+		if goType.Kind() == reflect.Ptr {
+			goType = goType.Elem()
+		}
+
+		if goType.Kind() != reflect.Struct {
+			return errors.Wrap(ErrInvalidSchema, "type must be a struct")
+		}
+
+		compiled.goType = goType
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[schema.RoutingKey]
+	if !ok {
+		entry = &schemaEntry{
+			versions:  make(map[int]*compiledSchema),
+			upcasters: make(map[int]Upcaster),
+		}
+		r.entries[schema.RoutingKey] = entry
+	}
+
+	entry.versions[schema.Version] = compiled
+	entry.latest = max(entry.latest, schema.Version)
+
+	return nil
+}
+
+// RegisterUpcaster registers the conversion of routing key payloads from fromVersion to fromVersion+1.
+func (r *SchemaRegistry) RegisterUpcaster(routingKey string, fromVersion int, upcaster Upcaster) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.entries[routingKey]
+	if !ok {
+		return errors.Wrap(ErrSchemaNotFound, routingKey)
+	}
+
+	entry.upcasters[fromVersion] = upcaster
+
+	return nil
+}
+
+// Schemas returns every registered schema version, sorted by routing key and version.
+func (r *SchemaRegistry) Schemas() []Schema {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schemas := make([]Schema, 0, len(r.entries))
+
+	for _, entry := range r.entries {
+		for _, version := range entry.versions {
+			schemas = append(schemas, version.Schema)
+		}
+	}
+
+	sort.Slice(schemas, func(i, j int) bool {
+		if schemas[i].RoutingKey != schemas[j].RoutingKey {
+			return schemas[i].RoutingKey < schemas[j].RoutingKey
+		}
+
+		return schemas[i].Version < schemas[j].Version
+	})
+
+	return schemas
+}
+
+// PrepareOutgoing validates the message against the latest schema of the routing key and stamps
+// the schema-version header. Routing keys without schema are left untouched.
+func (r *SchemaRegistry) PrepareOutgoing(routingKey string, msg *Message) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, ok := r.entries[routingKey]
+	if !ok {
+		return nil
+	}
+
+	schema := entry.versions[entry.latest]
+	if err := schema.validate(msg.Body); err != nil {
+		return err
+	}
+
+	if msg.Headers == nil {
+		msg.Headers = make(map[string]any)
+	}
+
+	msg.Headers[SchemaVersionHeader] = entry.latest
+
+	return nil
+}
+
+// PrepareIncoming upcasts the message body from the version stamped in its headers to the latest
+// one and validates it. Messages without version header are considered to be on the latest version.
+func (r *SchemaRegistry) PrepareIncoming(msg *Message) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	entry, ok := r.entries[msg.RoutingKey]
+	if !ok {
+		return nil
+	}
+
+	version := entry.latest
+
+	if value, ok := msg.Headers[SchemaVersionHeader]; ok {
+		parsed, err := parseSchemaVersion(value)
+		if err != nil {
+			return errors.Wrap(ErrUnsupportedVersion, err.Error())
+		}
+
+		version = parsed
+	}
+
+	if version > entry.latest {
+		return errors.Wrapf(ErrUnsupportedVersion, "%s v%d", msg.RoutingKey, version)
+	}
+
+	body := msg.Body
+
+	for ; version < entry.latest; version++ {
+		upcaster, ok := entry.upcasters[version]
+		if !ok {
+			return errors.Wrapf(ErrMissingUpcaster, "%s v%d", msg.RoutingKey, version)
+		}
+
+		upcasted, err := upcaster(body)
+		if err != nil {
+			return errors.Wrapf(err, "upcast %s v%d", msg.RoutingKey, version)
+		}
+
+		body = upcasted
+	}
+
+	if err := entry.versions[entry.latest].validate(body); err != nil {
+		return err
+	}
+
+	msg.Body = body
+	msg.Headers = cloneHeaders(msg.Headers)
+	msg.Headers[SchemaVersionHeader] = entry.latest
+
+	return nil
+}
+
+// Wrap prepares incoming messages before calling the handler, so it can be used with any QueueI
+// implementation. Invalid messages fail with ErrSchemaValidation and are dead-lettered.
+func (r *SchemaRegistry) Wrap(
+	processMsgFn func(ctx context.Context, msg Message) error,
+) func(ctx context.Context, msg Message) error {
+	return func(ctx context.Context, msg Message) error {
+		if err := r.PrepareIncoming(&msg); err != nil {
+			return errors.Wrap(err, "prepare incoming message")
+		}
+
+		return processMsgFn(ctx, msg)
+	}
+}
+
+func (s *compiledSchema) validate(body []byte) error {
+	if s.jsonSchema != nil {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+
+		var document any
+		if err := decoder.Decode(&document); err != nil {
+			return errors.Wrap(ErrSchemaValidation, err.Error())
+		}
+
+		if err := s.jsonSchema.Validate(document); err != nil {
+			return errors.Wrap(ErrSchemaValidation, err.Error())
+		}
+	}
+
+	if s.goType != nil {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.DisallowUnknownFields()
+
+		if err := decoder.Decode(reflect.New(s.goType).Interface()); err != nil {
+			return errors.Wrap(ErrSchemaValidation, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func parseSchemaVersion(value any) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int32:
+		return int(v), nil
+	case int64:
+		return int(v), nil
+	case float64:
+		return int(v), nil
+	case string:
+		return strconv.Atoi(v)
+	default:
+		return 0, errors.Errorf("invalid schema version header: %v", value)
+	}
+}
@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testOrderV2 struct {
+	ID     string `json:"id"`
+	Amount int    `json:"amount"`
+}
+
+func newTestSchemaRegistry(t *testing.T) *SchemaRegistry {
+	t.Helper()
+
+	registry := NewSchemaRegistry()
+
+	require.NoError(t, registry.Register(Schema{RoutingKey: "order.created", Version: 1, Type: testOrder{}}))
+	require.NoError(t, registry.Register(Schema{RoutingKey: "order.created", Version: 2, Type: testOrderV2{}}))
+	require.NoError(t, registry.RegisterUpcaster("order.created", 1, func(body []byte) ([]byte, error) {
+		var order testOrder
+		if err := json.Unmarshal(body, &order); err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(testOrderV2{ID: order.ID})
+	}))
+	require.NoError(t, registry.Register(Schema{
+		RoutingKey: "payment.created",
+		Version:    1,
+		JSONSchema: []byte(`{"type": "object", "required": ["id"]}`),
+	}))
+
+	return registry
+}
+
+func TestSchemaRegistry_PrepareOutgoing(t *testing.T) {
+	registry := newTestSchemaRegistry(t)
+
+	tests := []struct {
+		name       string
+		routingKey string
+		body       string
+		wantErr    error
+		wantHeader any
+	}{
+		{name: "latest struct", routingKey: "order.created", body: `{"id":"1","amount":10}`, wantHeader: 2},
+		{name: "unknown field", routingKey: "order.created", body: `{"id":"1","total":10}`, wantErr: ErrSchemaValidation},
+		{name: "json schema", routingKey: "payment.created", body: `{"id":"1"}`, wantHeader: 1},
+		{name: "json schema required", routingKey: "payment.created", body: `{}`, wantErr: ErrSchemaValidation},
+		{name: "unregistered", routingKey: "user.created", body: `{}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := Message{Body: []byte(tt.body)}
+
+			err := registry.PrepareOutgoing(tt.routingKey, &msg)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantHeader, msg.Headers[SchemaVersionHeader])
+		})
+	}
+}
+
+func TestSchemaRegistry_PrepareIncoming(t *testing.T) {
+	registry := newTestSchemaRegistry(t)
+
+	tests := []struct {
+		name     string
+		headers  map[string]any
+		body     string
+		wantErr  error
+		wantBody string
+	}{
+		{name: "upcast", headers: map[string]any{SchemaVersionHeader: int32(1)}, body: `{"id":"1"}`, wantBody: `{"id":"1","amount":0}`},
+		{name: "latest", headers: map[string]any{SchemaVersionHeader: "2"}, body: `{"id":"1","amount":5}`, wantBody: `{"id":"1","amount":5}`},
+		{name: "no header", body: `{"id":"1","amount":5}`, wantBody: `{"id":"1","amount":5}`},
+		{name: "newer version", headers: map[string]any{SchemaVersionHeader: 3}, body: `{}`, wantErr: ErrUnsupportedVersion},
+		{name: "invalid", headers: map[string]any{SchemaVersionHeader: 2}, body: `{"id":1}`, wantErr: ErrSchemaValidation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := Message{RoutingKey: "order.created", Headers: tt.headers, Body: []byte(tt.body)}
+
+			err := registry.PrepareIncoming(&msg)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.JSONEq(t, tt.wantBody, string(msg.Body))
+			assert.Equal(t, 2, msg.Headers[SchemaVersionHeader])
+		})
+	}
+}
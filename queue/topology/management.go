@@ -0,0 +1,181 @@
+package topology
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const defaultManagementTimeout = 10 * time.Second
+
+var ErrManagementAPI = errors.New("rabbitmq management api error")
+
+// ManagementClient talks to the rabbitmq management plugin HTTP API.
+type ManagementClient struct {
+	baseURL    string
+	username   string
+	password   string
+	httpClient *http.Client
+}
+
+func NewManagementClient(baseURL, username, password string, opts ...func(*ManagementClient)) *ManagementClient {
+	client := &ManagementClient{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		username:   username,
+		password:   password,
+		httpClient: &http.Client{Timeout: defaultManagementTimeout}, //nolint:exhaustruct
+	}
+
+	for _, o := range opts {
+		o(client)
+	}
+
+	return client
+}
+
+func WithHTTPClient(httpClient *http.Client) func(*ManagementClient) {
+	return func(c *ManagementClient) {
+		c.httpClient = httpClient
+	}
+}
+
+// BrokerExchange, BrokerQueue, BrokerBinding and BrokerPolicy mirror the management API payloads.
+type BrokerExchange struct {
+	Name       string         `json:"name"`
+	Type       string         `json:"type"`
+	Durable    bool           `json:"durable"`
+	AutoDelete bool           `json:"auto_delete"`
+	Internal   bool           `json:"internal"`
+	Arguments  map[string]any `json:"arguments"`
+}
+
+type BrokerQueue struct {
+	Name       string         `json:"name"`
+	Durable    bool           `json:"durable"`
+	AutoDelete bool           `json:"auto_delete"`
+	Exclusive  bool           `json:"exclusive,omitempty"`
+	Arguments  map[string]any `json:"arguments"`
+}
+
+type BrokerBinding struct {
+	Source          string         `json:"source"`
+	Destination     string         `json:"destination"`
+	DestinationType string         `json:"destination_type"`
+	RoutingKey      string         `json:"routing_key"`
+	Arguments       map[string]any `json:"arguments"`
+}
+
+type BrokerPolicy struct {
+	Name       string         `json:"name"`
+	Pattern    string         `json:"pattern"`
+	ApplyTo    string         `json:"apply-to"`
+	Priority   int            `json:"priority"`
+	Definition map[string]any `json:"definition"`
+}
+
+func (c *ManagementClient) Exchanges(ctx context.Context, vhost string) ([]BrokerExchange, error) {
+	var exchanges []BrokerExchange
+
+	return exchanges, c.do(ctx, http.MethodGet, c.path("exchanges", vhost), nil, &exchanges)
+}
+
+func (c *ManagementClient) Queues(ctx context.Context, vhost string) ([]BrokerQueue, error) {
+	var queues []BrokerQueue
+
+	return queues, c.do(ctx, http.MethodGet, c.path("queues", vhost), nil, &queues)
+}
+
+func (c *ManagementClient) Bindings(ctx context.Context, vhost string) ([]BrokerBinding, error) {
+	var bindings []BrokerBinding
+
+	return bindings, c.do(ctx, http.MethodGet, c.path("bindings", vhost), nil, &bindings)
+}
+
+func (c *ManagementClient) Policies(ctx context.Context, vhost string) ([]BrokerPolicy, error) {
+	var policies []BrokerPolicy
+
+	return policies, c.do(ctx, http.MethodGet, c.path("policies", vhost), nil, &policies)
+}
+
+func (c *ManagementClient) PutExchange(ctx context.Context, vhost string, exchange BrokerExchange) error {
+	return c.do(ctx, http.MethodPut, c.path("exchanges", vhost, exchange.Name), exchange, nil)
+}
+
+func (c *ManagementClient) PutQueue(ctx context.Context, vhost string, queue BrokerQueue) error {
+	return c.do(ctx, http.MethodPut, c.path("queues", vhost, queue.Name), queue, nil)
+}
+
+func (c *ManagementClient) PostBinding(ctx context.Context, vhost string, binding BrokerBinding) error {
+	destinationType := "q"
+	if binding.DestinationType == string(DestinationExchange) {
+		destinationType = "e"
+	}
+
+	path := c.path("bindings", vhost, "e", binding.Source, destinationType, binding.Destination)
+
+	return c.do(ctx, http.MethodPost, path, binding, nil)
+}
+
+func (c *ManagementClient) PutPolicy(ctx context.Context, vhost string, policy BrokerPolicy) error {
+	return c.do(ctx, http.MethodPut, c.path("policies", vhost, policy.Name), policy, nil)
+}
+
+func (c *ManagementClient) path(segments ...string) string {
+	escaped := make([]string, len(segments))
+	for i, segment := range segments {
+		escaped[i] = url.PathEscape(segment)
+	}
+
+	return "/api/" + strings.Join(escaped, "/")
+}
+
+func (c *ManagementClient) do(ctx context.Context, method, path string, body any, out any) error {
+	var reader io.Reader
+
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err, "marshal request")
+		}
+
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return errors.Wrap(err, "new request")
+	}
+
+	req.SetBasicAuth(c.username, c.password)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "do request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		message, _ := io.ReadAll(resp.Body)
+
+		return errors.Wrap(ErrManagementAPI, fmt.Sprintf("%s %s: %d %s", method, path, resp.StatusCode, message))
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errors.Wrap(err, "decode response")
+	}
+
+	return nil
+}
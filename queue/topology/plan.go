@@ -0,0 +1,407 @@
+package topology
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type Action string
+
+const (
+	ActionCreate Action = "create"
+	ActionUpdate Action = "update"
+	// ActionDrift marks resources that differ from the spec but can't be changed in place: rabbitmq
+	// refuses to redeclare exchanges and queues with other properties, they must be recreated. It also
+	// marks exchanges and queues found on the broker but missing from the spec, they're never deleted.
+	ActionDrift Action = "drift"
+)
+
+type Kind string
+
+const (
+	KindExchange Kind = "exchange"
+	KindQueue    Kind = "queue"
+	KindBinding  Kind = "binding"
+	KindPolicy   Kind = "policy"
+)
+
+const notInSpec = "not in the spec"
+
+type Change struct {
+	Action  Action
+	Kind    Kind
+	Name    string
+	Details []string
+
+	apply func(ctx context.Context, client *ManagementClient, vhost string) error
+}
+
+// Plan lists the changes needed to bring the broker to the topology spec.
+type Plan struct {
+	VHost   string
+	Changes []Change
+}
+
+// HasChanges reports whether Apply has anything to do.
+func (p *Plan) HasChanges() bool {
+	for _, change := range p.Changes {
+		if change.Action != ActionDrift {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Drift returns the changes Apply can't perform.
+func (p *Plan) Drift() []Change {
+	var drift []Change
+
+	for _, change := range p.Changes {
+		if change.Action == ActionDrift {
+			drift = append(drift, change)
+		}
+	}
+
+	return drift
+}
+
+func (p *Plan) String() string {
+	if len(p.Changes) == 0 {
+		return fmt.Sprintf("vhost %s is up to date\n", p.VHost)
+	}
+
+	symbols := map[Action]string{ActionCreate: "+", ActionUpdate: "~", ActionDrift: "!"}
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "vhost %s:\n", p.VHost)
+
+	for _, change := range p.Changes {
+		fmt.Fprintf(&b, "  %s %s %s\n", symbols[change.Action], change.Kind, change.Name)
+
+		for _, detail := range change.Details {
+			fmt.Fprintf(&b, "      %s\n", detail)
+		}
+	}
+
+	return b.String()
+}
+
+// NewPlan diffs the topology spec against the broker state read through the management API.
+func NewPlan(ctx context.Context, client *ManagementClient, topology *Topology) (*Plan, error) {
+	exchanges, err := client.Exchanges(ctx, topology.VHost)
+	if err != nil {
+		return nil, errors.Wrap(err, "list exchanges")
+	}
+
+	queues, err := client.Queues(ctx, topology.VHost)
+	if err != nil {
+		return nil, errors.Wrap(err, "list queues")
+	}
+
+	bindings, err := client.Bindings(ctx, topology.VHost)
+	if err != nil {
+		return nil, errors.Wrap(err, "list bindings")
+	}
+
+	policies, err := client.Policies(ctx, topology.VHost)
+	if err != nil {
+		return nil, errors.Wrap(err, "list policies")
+	}
+
+	plan := &Plan{VHost: topology.VHost}
+	plan.diffExchanges(topology.Exchanges, exchanges)
+	plan.diffQueues(topology.Queues, queues)
+	plan.diffBindings(topology.Bindings, bindings)
+	plan.diffPolicies(topology.Policies, policies)
+
+	return plan, nil
+}
+
+// Apply creates the missing resources and updates the policies. Drift is returned in the plan but
+// isn't applied.
+func Apply(ctx context.Context, client *ManagementClient, topology *Topology) (*Plan, error) {
+	plan, err := NewPlan(ctx, client, topology)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range plan.Changes {
+		if change.apply == nil {
+			continue
+		}
+
+		if err := change.apply(ctx, client, plan.VHost); err != nil {
+			return plan, errors.Wrapf(err, "%s %s %s", change.Action, change.Kind, change.Name)
+		}
+	}
+
+	return plan, nil
+}
+
+func (p *Plan) diffExchanges(desired []Exchange, current []BrokerExchange) {
+	byName := make(map[string]BrokerExchange, len(current))
+	for _, exchange := range current {
+		byName[exchange.Name] = exchange
+	}
+
+	for _, exchange := range desired {
+		want := BrokerExchange{
+			Name:       exchange.Name,
+			Type:       string(exchange.Type),
+			Durable:    exchange.durable(),
+			AutoDelete: exchange.AutoDelete,
+			Internal:   exchange.Internal,
+			Arguments:  normalize(exchange.Arguments),
+		}
+
+		got, ok := byName[exchange.Name]
+		if !ok {
+			p.Changes = append(p.Changes, Change{
+				Action: ActionCreate,
+				Kind:   KindExchange,
+				Name:   exchange.Name,
+				apply: func(ctx context.Context, client *ManagementClient, vhost string) error {
+					return client.PutExchange(ctx, vhost, want)
+				},
+			})
+
+			continue
+		}
+
+		var details []string
+		details = appendDiff(details, "type", want.Type, got.Type)
+		details = appendDiff(details, "durable", want.Durable, got.Durable)
+		details = appendDiff(details, "auto_delete", want.AutoDelete, got.AutoDelete)
+		details = appendDiff(details, "internal", want.Internal, got.Internal)
+		details = append(details, diffArguments(want.Arguments, got.Arguments)...)
+
+		if len(details) > 0 {
+			p.Changes = append(p.Changes, Change{Action: ActionDrift, Kind: KindExchange, Name: exchange.Name, Details: details})
+		}
+	}
+
+	desiredNames := make(map[string]bool, len(desired))
+	for _, exchange := range desired {
+		desiredNames[exchange.Name] = true
+	}
+
+	for _, exchange := range current {
+		// the default exchange and the amq.* ones are declared by the broker itself
+		if desiredNames[exchange.Name] || exchange.Name == "" || strings.HasPrefix(exchange.Name, "amq.") {
+			continue
+		}
+
+		p.Changes = append(p.Changes, Change{Action: ActionDrift, Kind: KindExchange, Name: exchange.Name, Details: []string{notInSpec}})
+	}
+}
+
+func (p *Plan) diffQueues(desired []Queue, current []BrokerQueue) {
+	byName := make(map[string]BrokerQueue, len(current))
+	for _, queue := range current {
+		byName[queue.Name] = queue
+	}
+
+	for _, queue := range desired {
+		want := BrokerQueue{
+			Name:       queue.Name,
+			Durable:    queue.durable(),
+			AutoDelete: queue.AutoDelete,
+			Arguments:  normalize(queue.arguments()),
+		}
+
+		got, ok := byName[queue.Name]
+		if !ok {
+			p.Changes = append(p.Changes, Change{
+				Action: ActionCreate,
+				Kind:   KindQueue,
+				Name:   queue.Name,
+				apply: func(ctx context.Context, client *ManagementClient, vhost string) error {
+					return client.PutQueue(ctx, vhost, want)
+				},
+			})
+
+			continue
+		}
+
+		var details []string
+		details = appendDiff(details, "durable", want.Durable, got.Durable)
+		details = appendDiff(details, "auto_delete", want.AutoDelete, got.AutoDelete)
+		details = append(details, diffArguments(want.Arguments, got.Arguments)...)
+
+		if len(details) > 0 {
+			p.Changes = append(p.Changes, Change{Action: ActionDrift, Kind: KindQueue, Name: queue.Name, Details: details})
+		}
+	}
+
+	desiredNames := make(map[string]bool, len(desired))
+	for _, queue := range desired {
+		desiredNames[queue.Name] = true
+	}
+
+	for _, queue := range current {
+		// exclusive and auto-delete queues belong to the connections that declared them
+		if desiredNames[queue.Name] || queue.Exclusive || queue.AutoDelete {
+			continue
+		}
+
+		p.Changes = append(p.Changes, Change{Action: ActionDrift, Kind: KindQueue, Name: queue.Name, Details: []string{notInSpec}})
+	}
+}
+
+func (p *Plan) diffBindings(desired []Binding, current []BrokerBinding) {
+	key := func(source, destination, destinationType, routingKey string, arguments map[string]any) string {
+		args, _ := json.Marshal(normalize(arguments))
+
+		return strings.Join([]string{source, destination, destinationType, routingKey, string(args)}, "\x00")
+	}
+
+	existing := make(map[string]bool, len(current))
+	for _, binding := range current {
+		existing[key(binding.Source, binding.Destination, binding.DestinationType, binding.RoutingKey, binding.Arguments)] = true
+	}
+
+	for _, binding := range desired {
+		want := BrokerBinding{
+			Source:          binding.Source,
+			Destination:     binding.Destination,
+			DestinationType: string(binding.DestinationType),
+			RoutingKey:      binding.RoutingKey,
+			Arguments:       normalize(binding.Arguments),
+		}
+
+		if existing[key(want.Source, want.Destination, want.DestinationType, want.RoutingKey, want.Arguments)] {
+			continue
+		}
+
+		p.Changes = append(p.Changes, Change{
+			Action: ActionCreate,
+			Kind:   KindBinding,
+			Name:   binding.String(),
+			apply: func(ctx context.Context, client *ManagementClient, vhost string) error {
+				return client.PostBinding(ctx, vhost, want)
+			},
+		})
+	}
+}
+
+func (p *Plan) diffPolicies(desired []Policy, current []BrokerPolicy) {
+	byName := make(map[string]BrokerPolicy, len(current))
+	for _, policy := range current {
+		byName[policy.Name] = policy
+	}
+
+	for _, policy := range desired {
+		want := BrokerPolicy{
+			Name:       policy.Name,
+			Pattern:    policy.Pattern,
+			ApplyTo:    policy.ApplyTo,
+			Priority:   policy.Priority,
+			Definition: normalize(policy.Definition),
+		}
+
+		apply := func(ctx context.Context, client *ManagementClient, vhost string) error {
+			return client.PutPolicy(ctx, vhost, want)
+		}
+
+		got, ok := byName[policy.Name]
+		if !ok {
+			p.Changes = append(p.Changes, Change{Action: ActionCreate, Kind: KindPolicy, Name: policy.Name, apply: apply})
+
+			continue
+		}
+
+		var details []string
+		details = appendDiff(details, "pattern", want.Pattern, got.Pattern)
+		details = appendDiff(details, "apply-to", want.ApplyTo, got.ApplyTo)
+		details = appendDiff(details, "priority", want.Priority, got.Priority)
+		details = append(details, diffArguments(want.Definition, got.Definition)...)
+
+		if len(details) > 0 {
+			p.Changes = append(p.Changes, Change{
+				Action:  ActionUpdate,
+				Kind:    KindPolicy,
+				Name:    policy.Name,
+				Details: details,
+				apply:   apply,
+			})
+		}
+	}
+}
+
+func appendDiff(details []string, field string, want, got any) []string {
+	if reflect.DeepEqual(want, got) {
+		return details
+	}
+
+	return append(details, fmt.Sprintf("%s: %v (broker: %v)", field, want, got))
+}
+
+func diffArguments(want, got map[string]any) []string {
+	// classic is the default queue type, it may or may not be declared explicitly
+	want = withoutClassicQueueType(want)
+	got = withoutClassicQueueType(normalize(got))
+
+	keys := make(map[string]bool, len(want)+len(got))
+	for k := range want {
+		keys[k] = true
+	}
+
+	for k := range got {
+		keys[k] = true
+	}
+
+	var details []string
+
+	for k := range keys {
+		details = appendDiff(details, k, want[k], got[k])
+	}
+
+	sort.Strings(details)
+
+	return details
+}
+
+// withoutClassicQueueType returns a copy of the arguments without an explicit classic queue type, the
+// caller's map is left as is.
+func withoutClassicQueueType(args map[string]any) map[string]any {
+	clone := make(map[string]any, len(args))
+
+	for k, v := range args {
+		if k == "x-queue-type" && v == string(QueueClassic) {
+			continue
+		}
+
+		clone[k] = v
+	}
+
+	return clone
+}
+
+// normalize round-trips the values through json, so numbers read from yaml compare equal to the ones
+// returned by the management API.
+func normalize(values map[string]any) map[string]any {
+	normalized := make(map[string]any, len(values))
+
+	if len(values) == 0 {
+		return normalized
+	}
+
+	payload, err := json.Marshal(values)
+	if err != nil {
+		return values
+	}
+
+	if err := json.Unmarshal(payload, &normalized); err != nil {
+		return values
+	}
+
+	return normalized
+}
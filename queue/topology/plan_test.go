@@ -0,0 +1,140 @@
+package topology
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSpec = `
+vhost: /
+exchanges:
+  - name: events
+    type: topic
+queues:
+  - name: orders
+    type: quorum
+    dead_letter_exchange: events
+    dead_letter_routing_key: orders.dead
+    message_ttl: 1m
+  - name: orders.dead
+    max_length: 1000
+bindings:
+  - source: events
+    destination: orders
+    routing_key: order.*
+policies:
+  - name: dead-letters
+    pattern: \.dead$
+    definition:
+      max-length: 5000
+`
+
+type fakeManagementAPI struct {
+	mu       sync.Mutex
+	state    map[string][]map[string]any
+	requests []string
+}
+
+func (f *fakeManagementAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Method == http.MethodGet {
+		_ = json.NewEncoder(w).Encode(f.state[r.URL.EscapedPath()])
+
+		return
+	}
+
+	f.requests = append(f.requests, r.Method+" "+r.URL.EscapedPath())
+	w.WriteHeader(http.StatusCreated)
+}
+
+func TestParse(t *testing.T) {
+	spec, err := Parse([]byte(testSpec))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]any{
+		"x-queue-type":              "quorum",
+		"x-dead-letter-exchange":    "events",
+		"x-dead-letter-routing-key": "orders.dead",
+		"x-message-ttl":             int64(60000),
+	}, spec.Queues[0].arguments())
+	assert.Equal(t, QueueClassic, spec.Queues[1].Type)
+	assert.Equal(t, DestinationQueue, spec.Bindings[0].DestinationType)
+
+	_, err = Parse([]byte("queues:\n  - name: stream\n    type: stream\n    auto_delete: true\n"))
+	assert.ErrorIs(t, err, ErrInvalidSpec)
+
+	_, err = Parse([]byte("bindings:\n  - source: missing\n    destination: orders\n"))
+	assert.ErrorIs(t, err, ErrInvalidSpec)
+}
+
+func TestApply(t *testing.T) {
+	spec, err := Parse([]byte(testSpec))
+	require.NoError(t, err)
+
+	api := &fakeManagementAPI{state: map[string][]map[string]any{
+		"/api/exchanges/%2F": {
+			{"name": "", "type": "direct", "durable": true},
+			{"name": "amq.topic", "type": "topic", "durable": true},
+			{"name": "events", "type": "topic", "durable": true},
+			{"name": "legacy", "type": "fanout", "durable": true},
+		},
+		"/api/queues/%2F": {
+			{
+				"name":    "orders.dead",
+				"durable": true,
+				"arguments": map[string]any{
+					"x-queue-type": "classic",
+					"x-max-length": 500,
+				},
+			},
+			{"name": "payments", "durable": true},
+			{"name": "amq.gen-stream", "exclusive": true, "auto_delete": true},
+		},
+		"/api/policies/%2F": {{
+			"name":       "dead-letters",
+			"pattern":    `\.dead$`,
+			"apply-to":   "queues",
+			"definition": map[string]any{"max-length": 1000},
+		}},
+	}}
+
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	client := NewManagementClient(server.URL, "guest", "guest")
+
+	plan, err := Apply(context.Background(), client, spec)
+	require.NoError(t, err)
+
+	assert.True(t, plan.HasChanges())
+	assert.Equal(t, []Change{
+		{Action: ActionDrift, Kind: KindExchange, Name: "legacy", Details: []string{"not in the spec"}},
+		{Action: ActionDrift, Kind: KindQueue, Name: "orders.dead", Details: []string{"x-max-length: 1000 (broker: 500)"}},
+		{Action: ActionDrift, Kind: KindQueue, Name: "payments", Details: []string{"not in the spec"}},
+	}, plan.Drift())
+	assert.Equal(t, []string{
+		"PUT /api/queues/%2F/orders",
+		"POST /api/bindings/%2F/e/events/q/orders",
+		"PUT /api/policies/%2F/dead-letters",
+	}, api.requests)
+}
+
+func Test_diffArguments(t *testing.T) {
+	want := map[string]any{"x-queue-type": "classic", "x-max-length": float64(1000)}
+	got := map[string]any{"x-max-length": 500}
+
+	assert.Equal(t, []string{"x-max-length: 1000 (broker: 500)"}, diffArguments(want, got))
+
+	// the spec arguments are still used to declare the queue
+	assert.Equal(t, map[string]any{"x-queue-type": "classic", "x-max-length": float64(1000)}, want)
+	assert.Equal(t, map[string]any{"x-max-length": 500}, got)
+}
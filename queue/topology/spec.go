@@ -0,0 +1,299 @@
+package topology
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultVHost = "/"
+
+type ExchangeType string
+
+const (
+	ExchangeDirect  ExchangeType = "direct"
+	ExchangeFanout  ExchangeType = "fanout"
+	ExchangeTopic   ExchangeType = "topic"
+	ExchangeHeaders ExchangeType = "headers"
+	// ExchangeDelayed requires the rabbitmq_delayed_message_exchange plugin.
+	ExchangeDelayed ExchangeType = "x-delayed-message"
+)
+
+type QueueType string
+
+const (
+	QueueClassic QueueType = "classic"
+	QueueQuorum  QueueType = "quorum"
+	QueueStream  QueueType = "stream"
+)
+
+type DestinationType string
+
+const (
+	DestinationQueue    DestinationType = "queue"
+	DestinationExchange DestinationType = "exchange"
+)
+
+var ErrInvalidSpec = errors.New("invalid topology spec")
+
+// Topology is the desired state of a rabbitmq virtual host.
+type Topology struct {
+	VHost     string     `yaml:"vhost"`
+	Exchanges []Exchange `yaml:"exchanges"`
+	Queues    []Queue    `yaml:"queues"`
+	Bindings  []Binding  `yaml:"bindings"`
+	Policies  []Policy   `yaml:"policies"`
+}
+
+type Exchange struct {
+	Name       string         `yaml:"name"`
+	Type       ExchangeType   `yaml:"type"`
+	Durable    *bool          `yaml:"durable"`
+	AutoDelete bool           `yaml:"auto_delete"`
+	Internal   bool           `yaml:"internal"`
+	Arguments  map[string]any `yaml:"arguments"`
+}
+
+type Queue struct {
+	Name       string    `yaml:"name"`
+	Type       QueueType `yaml:"type"`
+	Durable    *bool     `yaml:"durable"`
+	AutoDelete bool      `yaml:"auto_delete"`
+	// DeadLetterExchange and DeadLetterRoutingKey set x-dead-letter-exchange and x-dead-letter-routing-key.
+	DeadLetterExchange   string `yaml:"dead_letter_exchange"`
+	DeadLetterRoutingKey string `yaml:"dead_letter_routing_key"`
+	// MessageTTL sets x-message-ttl, e.g.: "30m".
+	MessageTTL *Duration `yaml:"message_ttl"`
+	// MaxAge sets x-max-age, only for stream queues, e.g.: "7D".
+	MaxAge         string `yaml:"max_age"`
+	MaxLength      *int   `yaml:"max_length"`
+	MaxLengthBytes *int   `yaml:"max_length_bytes"`
+	// Overflow sets x-overflow: drop-head, reject-publish or reject-publish-dlx.
+	Overflow  string         `yaml:"overflow"`
+	Arguments map[string]any `yaml:"arguments"`
+}
+
+type Binding struct {
+	Source          string          `yaml:"source"`
+	Destination     string          `yaml:"destination"`
+	DestinationType DestinationType `yaml:"destination_type"`
+	RoutingKey      string          `yaml:"routing_key"`
+	Arguments       map[string]any  `yaml:"arguments"`
+}
+
+type Policy struct {
+	Name     string `yaml:"name"`
+	Pattern  string `yaml:"pattern"`
+	ApplyTo  string `yaml:"apply_to"`
+	Priority int    `yaml:"priority"`
+	// Definition holds the policy keys, e.g.: max-length, message-ttl, dead-letter-exchange.
+	Definition map[string]any `yaml:"definition"`
+}
+
+// Duration is a time.Duration read from yaml strings such as "30s" or "1h".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	var raw string
+	if err := value.Decode(&raw); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return errors.Wrap(err, "parse duration")
+	}
+
+	*d = Duration(parsed)
+
+	return nil
+}
+
+func (d Duration) MarshalYAML() (any, error) {
+	return time.Duration(d).String(), nil
+}
+
+func LoadFile(path string) (*Topology, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "read topology file")
+	}
+
+	return Parse(data)
+}
+
+// Parse decodes a yaml topology spec, applying defaults and validating it.
+func Parse(data []byte) (*Topology, error) {
+	var topology Topology
+
+	if err := yaml.Unmarshal(data, &topology); err != nil {
+		return nil, errors.Wrap(err, "unmarshal topology")
+	}
+
+	topology.setDefaults()
+
+	if err := topology.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &topology, nil
+}
+
+func (t *Topology) setDefaults() {
+	if t.VHost == "" {
+		t.VHost = defaultVHost
+	}
+
+	for i := range t.Queues {
+		if t.Queues[i].Type == "" {
+			t.Queues[i].Type = QueueClassic
+		}
+	}
+
+	for i := range t.Bindings {
+		if t.Bindings[i].DestinationType == "" {
+			t.Bindings[i].DestinationType = DestinationQueue
+		}
+	}
+
+	for i := range t.Policies {
+		if t.Policies[i].ApplyTo == "" {
+			t.Policies[i].ApplyTo = "queues"
+		}
+	}
+}
+
+func (t *Topology) Validate() error {
+	exchanges := make(map[string]bool, len(t.Exchanges))
+	queues := make(map[string]bool, len(t.Queues))
+
+	for _, exchange := range t.Exchanges {
+		switch {
+		case exchange.Name == "":
+			return errors.Wrap(ErrInvalidSpec, "exchange without name")
+		case exchanges[exchange.Name]:
+			return errors.Wrapf(ErrInvalidSpec, "duplicated exchange %s", exchange.Name)
+		}
+
+		switch exchange.Type {
+		case ExchangeDirect, ExchangeFanout, ExchangeTopic, ExchangeHeaders, ExchangeDelayed:
+		default:
+			return errors.Wrapf(ErrInvalidSpec, "exchange %s: unknown type %q", exchange.Name, exchange.Type)
+		}
+
+		exchanges[exchange.Name] = true
+	}
+
+	for _, queue := range t.Queues {
+		switch {
+		case queue.Name == "":
+			return errors.Wrap(ErrInvalidSpec, "queue without name")
+		case queues[queue.Name]:
+			return errors.Wrapf(ErrInvalidSpec, "duplicated queue %s", queue.Name)
+		}
+
+		switch queue.Type {
+		case QueueClassic, QueueQuorum:
+			if queue.MaxAge != "" {
+				return errors.Wrapf(ErrInvalidSpec, "queue %s: max_age is only supported by streams", queue.Name)
+			}
+		case QueueStream:
+			if queue.AutoDelete || queue.DeadLetterExchange != "" {
+				return errors.Wrapf(ErrInvalidSpec, "queue %s: streams can't be auto-deleted nor dead-letter", queue.Name)
+			}
+		default:
+			return errors.Wrapf(ErrInvalidSpec, "queue %s: unknown type %q", queue.Name, queue.Type)
+		}
+
+		if queue.Type != QueueClassic && !queue.durable() {
+			return errors.Wrapf(ErrInvalidSpec, "queue %s: %s queues must be durable", queue.Name, queue.Type)
+		}
+
+		queues[queue.Name] = true
+	}
+
+	for _, binding := range t.Bindings {
+		if !exchanges[binding.Source] && !strings.HasPrefix(binding.Source, "amq.") {
+			return errors.Wrapf(ErrInvalidSpec, "binding source exchange %s isn't declared", binding.Source)
+		}
+
+		switch binding.DestinationType {
+		case DestinationQueue:
+			if !queues[binding.Destination] {
+				return errors.Wrapf(ErrInvalidSpec, "binding destination queue %s isn't declared", binding.Destination)
+			}
+		case DestinationExchange:
+			if !exchanges[binding.Destination] {
+				return errors.Wrapf(ErrInvalidSpec, "binding destination exchange %s isn't declared", binding.Destination)
+			}
+		default:
+			return errors.Wrapf(ErrInvalidSpec, "binding to %s: unknown destination type %q", binding.Destination, binding.DestinationType)
+		}
+	}
+
+	for _, policy := range t.Policies {
+		if policy.Name == "" || policy.Pattern == "" || len(policy.Definition) == 0 {
+			return errors.Wrapf(ErrInvalidSpec, "policy %q must have name, pattern and definition", policy.Name)
+		}
+	}
+
+	return nil
+}
+
+func (e Exchange) durable() bool {
+	return e.Durable == nil || *e.Durable
+}
+
+func (q Queue) durable() bool {
+	return q.Durable == nil || *q.Durable
+}
+
+// arguments merges the typed fields into the raw x-arguments.
+func (q Queue) arguments() map[string]any {
+	args := make(map[string]any, len(q.Arguments)+6)
+	for k, v := range q.Arguments {
+		args[k] = v
+	}
+
+	if q.Type != QueueClassic {
+		args["x-queue-type"] = string(q.Type)
+	}
+
+	if q.DeadLetterExchange != "" {
+		args["x-dead-letter-exchange"] = q.DeadLetterExchange
+	}
+
+	if q.DeadLetterRoutingKey != "" {
+		args["x-dead-letter-routing-key"] = q.DeadLetterRoutingKey
+	}
+
+	if q.MessageTTL != nil {
+		args["x-message-ttl"] = time.Duration(*q.MessageTTL).Milliseconds()
+	}
+
+	if q.MaxAge != "" {
+		args["x-max-age"] = q.MaxAge
+	}
+
+	if q.MaxLength != nil {
+		args["x-max-length"] = *q.MaxLength
+	}
+
+	if q.MaxLengthBytes != nil {
+		args["x-max-length-bytes"] = *q.MaxLengthBytes
+	}
+
+	if q.Overflow != "" {
+		args["x-overflow"] = q.Overflow
+	}
+
+	return args
+}
+
+func (b Binding) String() string {
+	return fmt.Sprintf("%s -> %s %s (%s)", b.Source, b.DestinationType, b.Destination, b.RoutingKey)
+}
@@ -0,0 +1,81 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/braiphub/go-core/trace"
+	"github.com/rabbitmq/amqp091-go"
+)
+
+const messagingSystem = "rabbitmq"
+
+type noopSpan struct{}
+
+func (noopSpan) Status(trace.SpanStatus, string) {}
+
+func (noopSpan) Close() {}
+
+// startProduceSpan starts a producer span and injects its context into headers, so consumers
+// can continue the trace.
+func (r *RabbitMQConnection) startProduceSpan(
+	ctx context.Context,
+	routingKey string,
+	headers map[string]any,
+	body []byte,
+) (context.Context, trace.SpanInterface) {
+	if r.tracer == nil {
+		return ctx, noopSpan{}
+	}
+
+	ctx, span := r.tracer.StartSpanWithKind(
+		ctx,
+		trace.KindProducer,
+		routingKey+" publish",
+		trace.Attr("messaging.system", messagingSystem),
+		trace.Attr("messaging.operation", "publish"),
+		trace.Attr("messaging.destination.name", r.config.Exchange),
+		trace.Attr("messaging.rabbitmq.destination.routing_key", routingKey),
+		trace.Attr("messaging.message.body.size", len(body)),
+	)
+
+	trace.Inject(ctx, headers)
+
+	return ctx, span
+}
+
+// startConsumeSpan extracts the producer span context from the delivery headers and starts a
+// consumer span as its child.
+func (r *RabbitMQConnection) startConsumeSpan(
+	ctx context.Context,
+	queue string,
+	msg amqp091.Delivery,
+) (context.Context, trace.SpanInterface) {
+	if r.tracer == nil {
+		return ctx, noopSpan{}
+	}
+
+	ctx = trace.Extract(ctx, msg.Headers)
+
+	return r.tracer.StartSpanWithKind(
+		ctx,
+		trace.KindConsumer,
+		queue+" process",
+		trace.Attr("messaging.system", messagingSystem),
+		trace.Attr("messaging.operation", "process"),
+		trace.Attr("messaging.destination.name", queue),
+		trace.Attr("messaging.rabbitmq.destination.routing_key", msg.RoutingKey),
+		trace.Attr("messaging.message.id", msg.MessageId),
+		trace.Attr("messaging.message.body.size", len(msg.Body)),
+		trace.Attr("messaging.rabbitmq.message.redelivered", msg.Redelivered),
+	)
+}
+
+func finishSpan(span trace.SpanInterface, err error) {
+	if err != nil {
+		span.Status(trace.StatusError, err.Error())
+	} else {
+		span.Status(trace.StatusOK, "")
+	}
+
+	span.Close()
+}
@@ -0,0 +1,67 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/braiphub/go-core/trace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestRabbitMQConnection_TracePropagation(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tracer := trace.NewOpenTelemetry(
+		context.Background(),
+		"test",
+		trace.WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))),
+	)
+	t.Cleanup(func() { tracer.Close(context.Background()) })
+
+	server := newFakeAMQPServer(t)
+	conn := newTestRabbitMQConnection(t, server, WithTracer(tracer))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan Message, 1)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		conn.Consume(ctx, "orders", func(_ context.Context, msg Message) error {
+			received <- msg
+
+			return nil
+		})
+	}()
+
+	require.Eventually(t, func() bool { return server.consumers("orders") == 1 }, 5*time.Second, time.Millisecond)
+	require.NoError(t, conn.Produce(context.Background(), "order.created", []byte(`{}`)))
+
+	select {
+	case msg := <-received:
+		assert.NotEmpty(t, msg.Headers["traceparent"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+
+	cancel()
+	<-done
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	producer, consumer := spans["order.created publish"], spans["orders process"]
+	require.NotNil(t, producer)
+	require.NotNil(t, consumer)
+
+	// the consumer span continues the trace of the producer span, carried by the message headers
+	assert.Equal(t, producer.SpanContext().TraceID(), consumer.SpanContext().TraceID())
+	assert.Equal(t, producer.SpanContext().SpanID(), consumer.Parent().SpanID())
+	assert.True(t, consumer.Parent().IsRemote())
+}
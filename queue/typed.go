@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+)
+
+type ProduceOptions struct {
+	Codec   Codec
+	Headers map[string]any
+}
+
+func WithCodec(codec Codec) func(*ProduceOptions) {
+	return func(o *ProduceOptions) {
+		o.Codec = codec
+	}
+}
+
+func WithHeaders(headers map[string]any) func(*ProduceOptions) {
+	return func(o *ProduceOptions) {
+		o.Headers = headers
+	}
+}
+
+// ConsumeTyped decodes each message body into T with the codec matching its content type.
+// Messages that can't be decoded fail with ErrDecodeMessage and, as any handler error, are
+// nacked without requeue, so they're routed to the queue DLQ instead of being retried.
+func ConsumeTyped[T any](
+	ctx context.Context,
+	q QueueI,
+	queue string,
+	fn func(ctx context.Context, payload T, meta Meta) error,
+	opts ...func(*ConsumeOptions),
+) {
+	q.Consume(ctx, queue, func(ctx context.Context, msg Message) error {
+		payload, err := Decode[T](msg)
+		if err != nil {
+			return err
+		}
+
+		return fn(ctx, payload, msg.Meta())
+	}, opts...)
+}
+
+// ProduceTyped encodes the payload with the configured codec (JSON by default) and publishes it.
+func ProduceTyped[T any](
+	ctx context.Context,
+	q QueueI,
+	routingKey string,
+	payload T,
+	opts ...func(*ProduceOptions),
+) error {
+	options := ProduceOptions{
+		Codec: JSONCodec{},
+	}
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	body, err := options.Codec.Marshal(payload)
+	if err != nil {
+		return errors.Wrap(err, "encode payload")
+	}
+
+	return q.Produce(ctx, routingKey, Message{
+		Headers:     options.Headers,
+		Body:        body,
+		ContentType: options.Codec.ContentType(),
+	})
+}
+
+// Decode unmarshals the message body into T using the codec registered for its content type.
+func Decode[T any](msg Message) (T, error) {
+	var payload T
+
+	codec, err := codecFor(msg.ContentType)
+	if err != nil {
+		return payload, errors.Wrap(ErrDecodeMessage, err.Error())
+	}
+
+	if err := codec.Unmarshal(msg.Body, &payload); err != nil {
+		return payload, errors.Wrap(ErrDecodeMessage, err.Error())
+	}
+
+	return payload, nil
+}
@@ -0,0 +1,173 @@
+package queue
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+// csvCodec encodes testOrder as a single csv field.
+type csvCodec struct{}
+
+func (csvCodec) ContentType() string { return "text/csv" }
+
+func (csvCodec) Marshal(v any) ([]byte, error) {
+	order, ok := v.(testOrder)
+	if !ok {
+		return nil, errors.New("not an order")
+	}
+
+	return []byte(order.ID), nil
+}
+
+func (csvCodec) Unmarshal(data []byte, v any) error {
+	order, ok := v.(*testOrder)
+	if !ok || strings.Contains(string(data), ",") {
+		return errors.New("invalid order")
+	}
+
+	order.ID = string(data)
+
+	return nil
+}
+
+func Test_codecFor(t *testing.T) {
+	RegisterCodec(csvCodec{})
+
+	tests := []struct {
+		contentType string
+		want        Codec
+		wantErr     error
+	}{
+		{contentType: "", want: JSONCodec{}},
+		{contentType: ContentTypeJSON, want: JSONCodec{}},
+		{contentType: "application/json; charset=utf-8", want: JSONCodec{}},
+		{contentType: "text/csv", want: csvCodec{}},
+		{contentType: "application/xml", wantErr: ErrUnsupportedContentType},
+		{contentType: "text/", wantErr: ErrUnsupportedContentType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.contentType, func(t *testing.T) {
+			got, err := codecFor(tt.contentType)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	RegisterCodec(csvCodec{})
+
+	tests := []struct {
+		name    string
+		msg     Message
+		want    testOrder
+		wantErr error
+	}{
+		{
+			name: "json",
+			msg:  Message{Body: []byte(`{"id":"1"}`), ContentType: ContentTypeJSON},
+			want: testOrder{ID: "1"},
+		},
+		{
+			name: "without content type",
+			msg:  Message{Body: []byte(`{"id":"1"}`)},
+			want: testOrder{ID: "1"},
+		},
+		{
+			name: "registered codec",
+			msg:  Message{Body: []byte("1"), ContentType: "text/csv"},
+			want: testOrder{ID: "1"},
+		},
+		{
+			name:    "invalid body",
+			msg:     Message{Body: []byte(`{"id":`), ContentType: ContentTypeJSON},
+			wantErr: ErrDecodeMessage,
+		},
+		{
+			name:    "unsupported content type",
+			msg:     Message{Body: []byte("<id>1</id>"), ContentType: "application/xml"},
+			wantErr: ErrDecodeMessage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode[testOrder](tt.msg)
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestProduceTyped(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []func(*ProduceOptions)
+		want Message
+	}{
+		{
+			name: "json by default",
+			want: Message{Body: []byte(`{"id":"1"}`), ContentType: ContentTypeJSON},
+		},
+		{
+			name: "codec and headers",
+			opts: []func(*ProduceOptions){WithCodec(csvCodec{}), WithHeaders(map[string]any{"tenant": "acme"})},
+			want: Message{Headers: map[string]any{"tenant": "acme"}, Body: []byte("1"), ContentType: "text/csv"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewMockQueueI(gomock.NewController(t))
+			q.EXPECT().Produce(gomock.Any(), "order.created", tt.want).Return(nil)
+
+			assert.NoError(t, ProduceTyped(context.Background(), q, "order.created", testOrder{ID: "1"}, tt.opts...))
+		})
+	}
+}
+
+func TestConsumeTyped(t *testing.T) {
+	RegisterCodec(csvCodec{})
+
+	broker := newTestBroker(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	received := make(chan testOrder, 1)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		ConsumeTyped(ctx, broker, "orders", func(_ context.Context, order testOrder, meta Meta) error {
+			assert.Equal(t, "text/csv", meta.ContentType)
+			assert.Equal(t, "acme", meta.Headers["tenant"])
+
+			received <- order
+
+			return nil
+		})
+	}()
+
+	waitConsumers(t, broker, "orders")
+
+	require.NoError(t, ProduceTyped(ctx, broker, "order.created", testOrder{ID: "1"},
+		WithCodec(csvCodec{}), WithHeaders(map[string]any{"tenant": "acme"})))
+	// csv bodies with more than one field can't be decoded: they're dead-lettered
+	require.NoError(t, broker.Produce(ctx, "order.created", Message{Body: []byte("1,2"), ContentType: "text/csv"}))
+
+	assert.Equal(t, testOrder{ID: "1"}, <-received)
+	assert.Eventually(t, func() bool { return len(broker.Messages("orders.dead")) == 1 }, time.Second, time.Millisecond)
+
+	cancel()
+	<-done
+}
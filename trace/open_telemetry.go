@@ -49,6 +49,13 @@ func NewOpenTelemetry(
 	return t
 }
 
+// WithTracerProvider uses an already configured provider, e.g.: one recording the spans in tests.
+func WithTracerProvider(provider *sdktrace.TracerProvider) func(*OpenTelemetry) {
+	return func(ot *OpenTelemetry) {
+		ot.traceProvider = provider
+	}
+}
+
 func (ot *OpenTelemetry) validate() {
 	switch {
 	case ot.traceProvider == nil:
@@ -0,0 +1,47 @@
+package trace
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// HeadersCarrier adapts message headers (e.g.: amqp tables) to a propagation.TextMapCarrier.
+type HeadersCarrier map[string]any
+
+var _ propagation.TextMapCarrier = HeadersCarrier{}
+
+func (c HeadersCarrier) Get(key string) string {
+	switch v := c[key].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return ""
+	}
+}
+
+func (c HeadersCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c HeadersCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// Inject writes the span context carried by ctx into headers using the global propagator.
+func Inject(ctx context.Context, headers map[string]any) {
+	otel.GetTextMapPropagator().Inject(ctx, HeadersCarrier(headers))
+}
+
+// Extract returns a copy of ctx carrying the remote span context found in headers.
+func Extract(ctx context.Context, headers map[string]any) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, HeadersCarrier(headers))
+}